@@ -0,0 +1,396 @@
+package predictiongame
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// adminHandler only passes requests to next which carry the admin token as bearer token in the
+// Authorization header. If no token is configured, the admin endpoints are disabled.
+func adminHandler(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Invalid admin token", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func adminQuestionsHandler(db QuestionDatabase) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			listQuestions(w, r, db)
+		case http.MethodPost:
+			addQuestion(w, r, db)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func adminQuestionHandler(db QuestionDatabase) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := splitPath(r.URL.Path, "/admin/questions/")
+		if len(parts) == 2 && parts[1] == "approve" {
+			if r.Method != http.MethodPost {
+				w.Header().Set("Allow", http.MethodPost)
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			approveQuestion(w, r, db, parts[0])
+			return
+		}
+		if len(parts) != 1 {
+			http.NotFound(w, r)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPut:
+			updateQuestion(w, r, db, parts[0])
+		case http.MethodDelete:
+			disableQuestion(w, r, db, parts[0])
+		default:
+			w.Header().Set("Allow", "PUT, DELETE")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func adminSearchHandler(db QuestionDatabase) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := strings.TrimSpace(r.URL.Query().Get("q"))
+		if query == "" {
+			http.Error(w, "Missing search query", http.StatusBadRequest)
+			return
+		}
+
+		offset, limit, err := pageParams(r, 20, maxSearchResults)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		result, err := db.Search(query)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error searching questions: %s", err), http.StatusInternalServerError)
+			return
+		}
+
+		start, end := pageBounds(len(result), offset, limit)
+		writeJSON(w, r, questionPage{
+			Questions: result[start:end],
+			Offset:    start,
+			Limit:     limit,
+			Total:     len(result),
+		})
+	})
+}
+
+// submitQuestionHandler accepts questions submitted by users. They are stored as pending
+// questions, which are not used in games until an admin approves them.
+func submitQuestionHandler(db QuestionDatabase, maxBodyBytes int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		defer r.Body.Close()
+
+		var q Question
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(&q); err != nil {
+			http.Error(w, fmt.Sprintf("Error parsing question: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		// The ID and the state are decided by the server.
+		q.ID = ""
+		q.Enabled = false
+		q.Pending = true
+
+		id, err := db.Add(q)
+		switch {
+		case err == ErrQuestionExists:
+			http.Error(w, fmt.Sprintf("Error adding question: %s", err), http.StatusConflict)
+			return
+		case err != nil:
+			http.Error(w, fmt.Sprintf("Invalid question: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		writeJSONStatus(w, r, http.StatusAccepted, struct {
+			ID string `json:"id"`
+		}{
+			ID: id,
+		})
+	})
+}
+
+// maxImportBytes is the maximum size of a batch of imported questions in bytes.
+const maxImportBytes = 10 << 20
+
+// importError is the reason a question of an import was rejected.
+type importError struct {
+	Index  int    `json:"index"`
+	Reason string `json:"reason"`
+}
+
+// importReport is the response of POST /admin/questions/import.
+type importReport struct {
+	Imported int           `json:"imported"`
+	Errors   []importError `json:"errors"`
+}
+
+// adminImportHandler adds a JSON array of questions. Invalid questions are skipped and
+// reported with their index in the array; the valid ones are added.
+func adminImportHandler(db QuestionDatabase) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		defer r.Body.Close()
+
+		var rows []json.RawMessage
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxImportBytes)).Decode(&rows); err != nil {
+			http.Error(w, fmt.Sprintf("Error parsing questions: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		report := importReport{Errors: []importError{}}
+		for i, row := range rows {
+			q := Question{Enabled: true}
+			if err := json.Unmarshal(row, &q); err != nil {
+				report.Errors = append(report.Errors, importError{Index: i, Reason: err.Error()})
+				continue
+			}
+
+			if _, err := db.Add(q); err != nil {
+				report.Errors = append(report.Errors, importError{Index: i, Reason: err.Error()})
+				continue
+			}
+			report.Imported++
+		}
+
+		writeJSON(w, r, report)
+	})
+}
+
+// questionPage is a page of the list of questions.
+type questionPage struct {
+	Questions []Question `json:"questions"`
+	Offset    int        `json:"offset"`
+	Limit     int        `json:"limit"`
+	Total     int        `json:"total"`
+}
+
+func listQuestions(w http.ResponseWriter, r *http.Request, db QuestionDatabase) {
+	offset, limit, err := pageParams(r, 50, 500)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	questions, total := db.List(offset, limit)
+	writeJSON(w, r, questionPage{
+		Questions: questions,
+		Offset:    offset,
+		Limit:     limit,
+		Total:     total,
+	})
+}
+
+func updateQuestion(w http.ResponseWriter, r *http.Request, db QuestionDatabase, id string) {
+	defer r.Body.Close()
+
+	q := Question{Enabled: true}
+	if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+		http.Error(w, fmt.Sprintf("Error parsing question: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	err := db.Update(id, q)
+	switch {
+	case err == ErrQuestionNotFound:
+		http.Error(w, fmt.Sprintf("Question %q can not be updated: %s", id, err), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, fmt.Sprintf("Invalid question: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	updated, _ := db.GetByID(id)
+	writeJSON(w, r, updated)
+}
+
+func addQuestion(w http.ResponseWriter, r *http.Request, db QuestionDatabase) {
+	defer r.Body.Close()
+
+	q := Question{Enabled: true}
+	if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+		http.Error(w, fmt.Sprintf("Error parsing question: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	id, err := db.Add(q)
+	switch {
+	case err == ErrQuestionExists:
+		http.Error(w, fmt.Sprintf("Error adding question: %s", err), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, fmt.Sprintf("Invalid question: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	writeJSONStatus(w, r, http.StatusCreated, struct {
+		ID string `json:"id"`
+	}{
+		ID: id,
+	})
+}
+
+// approveQuestion enables a question submitted by a user.
+func approveQuestion(w http.ResponseWriter, r *http.Request, db QuestionDatabase, id string) {
+	q, err := db.GetByID(id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Question %q can not be approved: %s", id, err), http.StatusNotFound)
+		return
+	}
+
+	if !q.Pending {
+		http.Error(w, fmt.Sprintf("Question %q is not pending", id), http.StatusConflict)
+		return
+	}
+
+	q.Pending = false
+	q.Enabled = true
+	if err := db.Update(id, q); err != nil {
+		http.Error(w, fmt.Sprintf("Question %q can not be approved: %s", id, err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, q)
+}
+
+// disableQuestion disables a question instead of deleting it, so games using it can still be reviewed.
+func disableQuestion(w http.ResponseWriter, r *http.Request, db QuestionDatabase, id string) {
+	q, err := db.GetByID(id)
+	if err == nil {
+		q.Enabled = false
+		err = db.Update(id, q)
+	}
+
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Question %q can not be disabled: %s", id, err), http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// rescoreRequest is the body of a POST to /admin/rescore. The scores are only stored
+// if Persist is true, so the effect of new rules can be checked first.
+type rescoreRequest struct {
+	ScoreConfig
+	Persist bool `json:"persist"`
+}
+
+// rescoreReport is the response of POST /admin/rescore.
+type rescoreReport struct {
+	Config ScoreConfig `json:"config"`
+	Games  int         `json:"games"`
+	// Changed is the number of games whose stored score differs from the new one. The
+	// scores of these games are stored if the request asks for it, so repeating the
+	// request reports no changes.
+	Changed   int  `json:"changed"`
+	Persisted bool `json:"persisted"`
+	// Rescored and Failed are the numbers of changed games whose scores have been
+	// stored and could not be stored.
+	Rescored int `json:"rescored"`
+	Failed   int `json:"failed"`
+	// Error is set if the games could not be loaded, in which case the report only
+	// covers the games loaded before.
+	Error string `json:"error,omitempty"`
+}
+
+// adminRescoreHandler computes the scores of all completed games using new rules, for
+// example after changing the scoring mode. The games are iterated and the changed scores
+// stored afterwards, so a game which can not be stored does not stop the others.
+func adminRescoreHandler(db GameDatabase, maxBodyBytes int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		defer r.Body.Close()
+
+		var req rescoreRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Error parsing request: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		cfg := req.ScoreConfig
+		if cfg.MinOverlapFraction < 0 || cfg.MinOverlapFraction > 1 {
+			http.Error(w, fmt.Sprintf("Invalid minimum overlap fraction %g", cfg.MinOverlapFraction), http.StatusBadRequest)
+			return
+		}
+
+		report := rescoreReport{Config: cfg, Persisted: req.Persist}
+		changed := make(map[string]GameScore)
+		status := http.StatusOK
+		err := db.Iterate(r, time.Time{}, func(g GameEntity) error {
+			if !g.Completed() {
+				return nil
+			}
+
+			report.Games++
+			if score := RescoreGame(g, cfg); score != g.Score {
+				report.Changed++
+				changed[g.ID] = score
+			}
+			return nil
+		})
+		if err != nil {
+			report.Error = fmt.Sprintf("Games can not be loaded: %s", err)
+			status = http.StatusInternalServerError
+		}
+
+		if req.Persist {
+			for id, score := range changed {
+				if err := db.SetScore(r, id, score); err != nil {
+					requestLogger(r).Error("Error saving score", "game", id, "error", err)
+					report.Failed++
+					continue
+				}
+				report.Rescored++
+			}
+		}
+
+		writeJSONStatus(w, r, status, report)
+	})
+}
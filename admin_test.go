@@ -0,0 +1,425 @@
+package predictiongame
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testAdminToken = "secret"
+
+func adminRequest(method, target, body string) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+testAdminToken)
+	return r
+}
+
+func TestAdminHandlerToken(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	for _, tc := range []struct {
+		token  string
+		header string
+		status int
+	}{
+		{"", "Bearer ", http.StatusNotFound},
+		{testAdminToken, "", http.StatusUnauthorized},
+		{testAdminToken, "Bearer wrong", http.StatusUnauthorized},
+		{testAdminToken, "Bearer " + testAdminToken, http.StatusOK},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/admin/questions", nil)
+		r.Header.Set("Authorization", tc.header)
+
+		adminHandler(tc.token, next).ServeHTTP(w, r)
+		if w.Code != tc.status {
+			t.Errorf("token %q, header %q: expected status %d, got %d", tc.token, tc.header, tc.status, w.Code)
+		}
+	}
+}
+
+func TestAdminAddQuestion(t *testing.T) {
+	db := SeedDemoQuestions()
+	handler := adminHandler(testAdminToken, adminQuestionsHandler(db))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, adminRequest(http.MethodPost, "/admin/questions",
+		`{"text": "How tall is the Eiffel Tower?", "boundLow": 300, "boundHigh": 330, "unit": "Meters"}`))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body)
+	}
+
+	var result struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("Can not parse response: %s", err)
+	}
+	if q, err := db.GetByID(result.ID); err != nil || q.Unit != "Meters" {
+		t.Errorf("Added question can not be loaded: %+v (%v)", q, err)
+	}
+
+	for _, body := range []string{
+		`{"text": "", "boundLow": 1, "boundHigh": 2}`,
+		`{"text": "Inverted", "boundLow": 2, "boundHigh": 1}`,
+		`not json`,
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, adminRequest(http.MethodPost, "/admin/questions", body))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", body, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+func TestAdminListAndUpdateQuestions(t *testing.T) {
+	db := SeedDemoQuestions()
+	list := adminHandler(testAdminToken, adminQuestionsHandler(db))
+	update := adminHandler(testAdminToken, adminQuestionHandler(db))
+
+	w := httptest.NewRecorder()
+	list.ServeHTTP(w, adminRequest(http.MethodGet, "/admin/questions?offset=25&limit=10", ""))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+
+	var page questionPage
+	if err := json.NewDecoder(w.Body).Decode(&page); err != nil {
+		t.Fatalf("Can not parse response: %s", err)
+	}
+	if page.Total != len(demoQuestions) || len(page.Questions) != len(demoQuestions)-25 {
+		t.Errorf("Unexpected page: total %d, %d questions", page.Total, len(page.Questions))
+	}
+
+	id := page.Questions[0].ID
+	w = httptest.NewRecorder()
+	update.ServeHTTP(w, adminRequest(http.MethodPut, "/admin/questions/"+id,
+		`{"text": "Updated?", "boundLow": 1, "boundHigh": 2, "unit": "Things", "category": "Test"}`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+	if q, _ := db.GetByID(id); q.Text != "Updated?" || q.Category != "Test" {
+		t.Errorf("Question was not updated: %+v", q)
+	}
+
+	for _, tc := range []struct {
+		target string
+		body   string
+		status int
+	}{
+		{"/admin/questions/missing", `{"text": "Text", "boundLow": 1, "boundHigh": 2}`, http.StatusNotFound},
+		{"/admin/questions/" + id, `{"text": "Text", "boundLow": 3, "boundHigh": 2}`, http.StatusBadRequest},
+	} {
+		w := httptest.NewRecorder()
+		update.ServeHTTP(w, adminRequest(http.MethodPut, tc.target, tc.body))
+		if w.Code != tc.status {
+			t.Errorf("%s: expected status %d, got %d", tc.target, tc.status, w.Code)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	list.ServeHTTP(w, adminRequest(http.MethodGet, "/admin/questions?limit=0", ""))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for invalid limit, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestAdminDisableQuestion(t *testing.T) {
+	db := SeedDemoQuestions()
+	handler := adminHandler(testAdminToken, adminQuestionHandler(db))
+
+	disabled := make(map[string]bool)
+	for _, q := range demoQuestionList()[:10] {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, adminRequest(http.MethodDelete, "/admin/questions/"+q.ID, ""))
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusNoContent, w.Code, w.Body)
+		}
+		disabled[q.ID] = true
+	}
+
+	if q, err := db.GetByID(demoQuestionList()[0].ID); err != nil || q.Enabled {
+		t.Errorf("Disabled question should still be available: %+v (%v)", q, err)
+	}
+
+	for i := 0; i < 20; i++ {
+		for _, q := range db.SelectRandom(NumQuestions) {
+			if disabled[q.ID] {
+				t.Fatalf("Disabled question %q was selected.", q.ID)
+			}
+		}
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, adminRequest(http.MethodDelete, "/admin/questions/missing", ""))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestAdminSearchQuestions(t *testing.T) {
+	db := NewQuestionDatabase([]Question{
+		{ID: "1", Text: "What is the population of Zurich?", Category: "Cities", Enabled: true},
+		{ID: "2", Text: "How high is the Matterhorn?", Category: "Mountains", Enabled: true},
+		{ID: "3", Text: "How long is the Rhine?", Tags: []string{"Population centers"}, Enabled: true},
+		{ID: "4", Text: "How many people live in Bern?", Category: "Population", Enabled: false},
+	}, nil)
+	handler := adminHandler(testAdminToken, adminSearchHandler(db))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, adminRequest(http.MethodGet, "/admin/questions/search?q=POPULATION", ""))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+
+	var page questionPage
+	if err := json.NewDecoder(w.Body).Decode(&page); err != nil {
+		t.Fatalf("Can not parse response: %s", err)
+	}
+	var ids []string
+	for _, q := range page.Questions {
+		ids = append(ids, q.ID)
+	}
+	if page.Total != 3 || strings.Join(ids, ",") != "1,3,4" {
+		t.Errorf("Unexpected result: total %d, questions %v", page.Total, ids)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, adminRequest(http.MethodGet, "/admin/questions/search?q=population&offset=1&limit=1", ""))
+	page = questionPage{}
+	if err := json.NewDecoder(w.Body).Decode(&page); err != nil || len(page.Questions) != 1 || page.Questions[0].ID != "3" {
+		t.Errorf("Unexpected page %+v (%v)", page, err)
+	}
+
+	for _, target := range []string{"/admin/questions/search", "/admin/questions/search?q=a&limit=1000"} {
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, adminRequest(http.MethodGet, target, ""))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", target, http.StatusBadRequest, w.Code)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/questions/search?q=population", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d without token, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestAdminSearchQuestionsBeyondPageSize(t *testing.T) {
+	list := make([]Question, 0, 2*maxSearchResults)
+	for i := 0; i < 2*maxSearchResults; i++ {
+		list = append(list, Question{ID: fmt.Sprint(i), Text: "Question", Enabled: true})
+	}
+	handler := adminHandler(testAdminToken, adminSearchHandler(NewQuestionDatabase(list, nil)))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, adminRequest(http.MethodGet, fmt.Sprintf("/admin/questions/search?q=question&offset=150&limit=%d", maxSearchResults), ""))
+
+	var page questionPage
+	if err := json.NewDecoder(w.Body).Decode(&page); err != nil {
+		t.Fatalf("Can not parse response: %s", err)
+	}
+	if page.Total != len(list) || len(page.Questions) != 50 || page.Questions[0].ID != "150" {
+		t.Errorf("Expected the last 50 of %d questions, got total %d and %d questions", len(list), page.Total, len(page.Questions))
+	}
+}
+
+func TestSubmitAndApproveQuestion(t *testing.T) {
+	db := NewQuestionDatabase(nil, nil)
+	submit := submitQuestionHandler(db, 1024)
+	approve := adminHandler(testAdminToken, adminQuestionHandler(db))
+
+	w := httptest.NewRecorder()
+	submit.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/questions/submit",
+		strings.NewReader(`{"id": "chosen", "enabled": true, "text": "How long is the Rhine?", "unit": "km", "boundLow": 1200, "boundHigh": 1250}`)))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusAccepted, w.Code, w.Body)
+	}
+
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil || created.ID == "" || created.ID == "chosen" {
+		t.Fatalf("Unexpected response %+v (%v)", created, err)
+	}
+
+	q, err := db.GetByID(created.ID)
+	if err != nil || !q.Pending || q.Enabled {
+		t.Fatalf("Expected a pending question, got %+v (%v)", q, err)
+	}
+	if selected := db.SelectRandom(NumQuestions); len(selected) != 0 {
+		t.Errorf("Pending question was selected: %v", selected)
+	}
+
+	for _, tc := range []struct {
+		body   string
+		status int
+	}{
+		{`{"text": "How long is the Rhine?", "boundLow": 1, "boundHigh": 2}`, http.StatusConflict},
+		{`{"text": "", "boundLow": 1, "boundHigh": 2}`, http.StatusBadRequest},
+		{`{"text": "Upside down?", "boundLow": 2, "boundHigh": 1}`, http.StatusBadRequest},
+	} {
+		w := httptest.NewRecorder()
+		submit.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/questions/submit", strings.NewReader(tc.body)))
+		if w.Code != tc.status {
+			t.Errorf("%s: expected status %d, got %d", tc.body, tc.status, w.Code)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	approve.ServeHTTP(w, adminRequest(http.MethodPost, "/admin/questions/"+created.ID+"/approve", ""))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+	if q, _ := db.GetByID(created.ID); q.Pending || !q.Enabled {
+		t.Errorf("Expected an enabled question, got %+v", q)
+	}
+
+	for _, tc := range []struct {
+		method, target string
+		status         int
+	}{
+		{http.MethodPost, "/admin/questions/" + created.ID + "/approve", http.StatusConflict},
+		{http.MethodPost, "/admin/questions/missing/approve", http.StatusNotFound},
+		{http.MethodGet, "/admin/questions/" + created.ID + "/approve", http.StatusMethodNotAllowed},
+	} {
+		w := httptest.NewRecorder()
+		approve.ServeHTTP(w, adminRequest(tc.method, tc.target, ""))
+		if w.Code != tc.status {
+			t.Errorf("%s %s: expected status %d, got %d", tc.method, tc.target, tc.status, w.Code)
+		}
+	}
+}
+
+func TestAdminImportQuestions(t *testing.T) {
+	db := NewQuestionDatabase([]Question{{ID: "existing", Text: "Existing", Enabled: true}}, nil)
+	handler := adminHandler(testAdminToken, adminImportHandler(db))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, adminRequest(http.MethodPost, "/admin/questions/import", `[
+		{"text": "How long is the Rhine?", "boundLow": 1200, "boundHigh": 1250},
+		{"text": "", "boundLow": 1, "boundHigh": 2},
+		{"id": "existing", "text": "Duplicate", "boundLow": 1, "boundHigh": 2},
+		{"text": 42},
+		{"text": "How high is the Matterhorn?", "boundLow": 4400, "boundHigh": 4500}
+	]`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+
+	var report importReport
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatalf("Can not parse report: %s", err)
+	}
+	if report.Imported != 2 || len(report.Errors) != 3 {
+		t.Fatalf("Unexpected report %+v", report)
+	}
+	for i, index := range []int{1, 2, 3} {
+		if report.Errors[i].Index != index || report.Errors[i].Reason == "" {
+			t.Errorf("Unexpected error %d: %+v", i, report.Errors[i])
+		}
+	}
+	if _, total := db.List(0, 10); total != 3 {
+		t.Errorf("Expected 3 questions, got %d", total)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, adminRequest(http.MethodPost, "/admin/questions/import", `{"text": "not an array"}`))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestAdminRescore(t *testing.T) {
+	games := NewMemoryGameDatabase()
+	q := Question{ID: "q", Text: "How many?", BoundLow: 10, BoundHigh: 20}
+	for id, a := range map[string]Answer{
+		"overlapping": {Question: q, LowerBound: 15, UpperBound: 30},
+		"containing":  {Question: q, LowerBound: 5, UpperBound: 30},
+	} {
+		g := GameEntity{ID: id, Answers: []Answer{a}}
+		if err := games.Save(nil, GameEntity{ID: id, UserID: "user", Answers: g.Answers}); err != nil {
+			t.Fatalf("Can not save game: %s", err)
+		}
+		if err := games.SetScore(nil, id, RescoreGame(g, ScoreConfig{})); err != nil {
+			t.Fatalf("Can not save score: %s", err)
+		}
+	}
+	handler := adminHandler(testAdminToken, adminRescoreHandler(games, 1<<10))
+
+	rescore := func(body string) rescoreReport {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, adminRequest(http.MethodPost, "/admin/rescore", body))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status %d, got %d: %s", body, http.StatusOK, w.Code, w.Body)
+		}
+
+		var report rescoreReport
+		if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+			t.Fatalf("Can not decode report: %s", err)
+		}
+		return report
+	}
+
+	if report := rescore(`{"mode": "overlap"}`); report.Games != 2 || report.Changed != 0 {
+		t.Errorf("Expected no changes with the same rules, got %+v", report)
+	}
+	if report := rescore(`{"mode": "contain"}`); report.Changed != 2 || report.Persisted {
+		t.Errorf("Expected 2 changed games which are not persisted, got %+v", report)
+	}
+	if report := rescore(`{"mode": "contain", "persist": true}`); report.Changed != 2 || !report.Persisted || report.Rescored != 2 || report.Failed != 0 {
+		t.Errorf("Expected 2 persisted games, got %+v", report)
+	}
+	if report := rescore(`{"mode": "contain", "persist": true}`); report.Changed != 0 {
+		t.Errorf("Expected rescoring to be idempotent, got %+v", report)
+	}
+
+	g, err := games.Get(nil, "overlapping")
+	if err != nil {
+		t.Fatalf("Can not get game: %s", err)
+	}
+	if g.Score.Config.Mode != ScoringContain || g.Score.Correct != 0 {
+		t.Errorf("Unexpected score %+v", g.Score)
+	}
+
+	for _, body := range []string{`{"mode": "unknown"}`, `{"minOverlapFraction": 2}`} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, adminRequest(http.MethodPost, "/admin/rescore", body))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", body, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+func TestAdminRescoreFailures(t *testing.T) {
+	answers := []Answer{{Question: Question{ID: "q", BoundLow: 10, BoundHigh: 20}, LowerBound: 15, UpperBound: 30}}
+	db := NewMockGameDatabase(WithListReturns([]GameEntity{
+		{ID: "first", Status: GameCompleted, Answers: answers},
+		{ID: "second", Status: GameCompleted, Answers: answers},
+		{ID: "playing", Status: GameInProgress, Answers: answers},
+	}, nil))
+	db.SetScoreErr = errors.New("connection lost")
+	handler := adminHandler(testAdminToken, adminRescoreHandler(db, 1<<10))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, adminRequest(http.MethodPost, "/admin/rescore", `{"persist": true}`))
+	var report rescoreReport
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatalf("Can not decode report: %s", err)
+	}
+	if w.Code != http.StatusOK || report.Games != 2 || report.Changed != 2 || report.Rescored != 0 || report.Failed != 2 {
+		t.Errorf("Expected 2 failed games, got %d %+v", w.Code, report)
+	}
+
+	db = NewMockGameDatabase(WithListReturns(nil, errors.New("connection lost")))
+	w = httptest.NewRecorder()
+	adminHandler(testAdminToken, adminRescoreHandler(db, 1<<10)).ServeHTTP(w, adminRequest(http.MethodPost, "/admin/rescore", `{}`))
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "connection lost") {
+		t.Errorf("Expected the error of the database, got %d: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,58 @@
+package predictiongame
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"time"
+)
+
+// embeddedAssets contains the templates and the static files, so the binary can be
+// deployed without them.
+//
+//go:embed templates static
+var embeddedAssets embed.FS
+
+// assetFS returns the directory dir of the embedded assets if embedded is true, or
+// the directory on disk otherwise.
+func assetFS(dir string, embedded bool) fs.FS {
+	if !embedded {
+		return os.DirFS(dir)
+	}
+
+	sub, err := fs.Sub(embeddedAssets, dir)
+	if err != nil {
+		// dir is one of the embedded directories, so this does not happen.
+		panic(err)
+	}
+	return sub
+}
+
+// faviconMaxAge is how long browsers may cache the favicon, in seconds.
+const faviconMaxAge = 365 * 24 * 60 * 60
+
+// FaviconHandler serves the embedded favicon. It is read once, so the requests every
+// page load triggers for it neither hit the file system nor the static file server.
+func FaviconHandler() http.Handler {
+	icon, err := fs.ReadFile(embeddedAssets, "static/favicon.ico")
+	if err != nil {
+		// static/favicon.ico is embedded, so this does not happen.
+		panic(err)
+	}
+	modTime := time.Now()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "image/x-icon")
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", faviconMaxAge))
+		http.ServeContent(w, r, "favicon.ico", modTime, bytes.NewReader(icon))
+	})
+}
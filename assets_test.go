@@ -0,0 +1,36 @@
+package predictiongame
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFaviconHandler(t *testing.T) {
+	icon, err := os.ReadFile("static/favicon.ico")
+	if err != nil {
+		t.Fatalf("Can not read favicon: %s", err)
+	}
+
+	handler := NewHandler(nil, SeedDemoQuestions(), NewMockGameDatabase(), WithBasePath("/predict"))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/predict/favicon.ico", nil))
+	if w.Code != http.StatusOK || w.Body.String() != string(icon) {
+		t.Fatalf("Unexpected favicon, status %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "image/x-icon" {
+		t.Errorf("Expected content type image/x-icon, got %q", ct)
+	}
+	if cc := w.Header().Get("Cache-Control"); !strings.Contains(cc, "max-age=31536000") {
+		t.Errorf("Expected a long Cache-Control, got %q", cc)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/predict/favicon.ico", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status %d for POST, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
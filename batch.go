@@ -0,0 +1,141 @@
+package predictiongame
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// batchResult is the result of a game in the response of POST /api/games/batch.
+type batchResult struct {
+	ID    string `json:"id"`
+	Saved bool   `json:"saved"`
+	Error string `json:"error,omitempty"`
+}
+
+// validateBatchGame returns why the game of a batch can not be saved, or nil.
+func validateBatchGame(g GameEntity, seen map[string]bool) error {
+	switch {
+	case g.ID == "":
+		return errors.New("missing game ID")
+	case !validID(g.ID):
+		return fmt.Errorf("invalid game ID %q", g.ID)
+	case seen[g.ID]:
+		return fmt.Errorf("duplicate game ID %q", g.ID)
+	case g.UserID == "":
+		return errors.New("missing user ID")
+	case !validID(g.UserID):
+		return fmt.Errorf("invalid user ID %q", g.UserID)
+	case g.Answers == nil:
+		return errors.New("missing answers")
+	}
+
+	return nil
+}
+
+// batchSubmitHandler saves several completed games at once, for example the rounds of
+// a class. The games are saved in one transaction where the database supports it. Only
+// the IDs, users and answers of the games are taken from the request, and games which
+// have been submitted before are not overwritten. If some of the games are invalid,
+// none are saved unless the partial query parameter is true, in which case the valid
+// ones are saved. The response contains the result of every game.
+func batchSubmitHandler(questions QuestionDatabase, db GameDatabase, opts handlerOptions) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		defer r.Body.Close()
+
+		partial := false
+		if raw := r.URL.Query().Get("partial"); raw != "" {
+			value, err := strconv.ParseBool(raw)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid value for partial: %s", err), http.StatusBadRequest)
+				return
+			}
+			partial = value
+		}
+
+		// A batch contains several games, so it may be larger than a single one.
+		var games []GameEntity
+		body := http.MaxBytesReader(w, r.Body, maxBatchSize*opts.maxBodyBytes)
+		if err := decodeStrict(body, &games); err != nil {
+			http.Error(w, fmt.Sprintf("Error parsing games: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		if len(games) == 0 || len(games) > maxBatchSize {
+			http.Error(w, fmt.Sprintf("A batch must contain between 1 and %d games", maxBatchSize), http.StatusBadRequest)
+			return
+		}
+
+		results := make([]batchResult, len(games))
+		valid := make([]GameEntity, 0, len(games))
+		seen := make(map[string]bool)
+		for i, submitted := range games {
+			results[i].ID = submitted.ID
+			if err := validateBatchGame(submitted, seen); err != nil {
+				results[i].Error = err.Error()
+				continue
+			}
+			seen[submitted.ID] = true
+
+			if existing, err := db.Get(r, submitted.ID); err == nil && existing.Completed() {
+				results[i].Error = fmt.Sprintf("game %q has already been submitted", submitted.ID)
+				continue
+			} else if err != nil && !errors.Is(err, ErrGameNotFound) {
+				results[i].Error = fmt.Sprintf("error loading game: %s", err)
+				continue
+			}
+
+			g := GameEntity{ID: submitted.ID, UserID: submitted.UserID, Answers: submitted.Answers}
+
+			for j, a := range g.Answers {
+				g.Answers[j] = a.Normalized()
+			}
+			if !opts.exposeBounds {
+				if err := resolveQuestions(questions, g.Answers); err != nil {
+					results[i].Error = fmt.Sprintf("unknown question: %s", err)
+					continue
+				}
+			} else {
+				addExplanations(questions, g.Answers)
+			}
+			g.Score = RescoreGame(g, opts.scoring)
+			valid = append(valid, g)
+		}
+
+		if len(valid) < len(games) && !partial {
+			for i := range results {
+				if results[i].Error == "" {
+					results[i].Error = "not saved because other games of the batch are invalid"
+				}
+			}
+			writeJSONStatus(w, r, http.StatusUnprocessableEntity, results)
+			return
+		}
+
+		if err := db.SaveBatch(r, valid); err != nil {
+			for i := range results {
+				if results[i].Error == "" {
+					results[i].Error = fmt.Sprintf("error saving game: %s", err)
+				}
+			}
+			writeJSONStatus(w, r, gameErrorStatus(err), results)
+			return
+		}
+
+		for i := range results {
+			results[i].Saved = results[i].Error == ""
+		}
+		for _, g := range valid {
+			if err := ensureProfile(r, opts.users, g.UserID); err != nil {
+				opts.logger.Error("Error creating profile", "user", g.UserID, "error", err)
+			}
+		}
+		writeJSON(w, r, results)
+	})
+}
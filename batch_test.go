@@ -0,0 +1,112 @@
+package predictiongame
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBatchSubmitHandler(t *testing.T) {
+	// The client does not know the correct answers, which are taken from the database.
+	answers, _ := json.Marshal([]Answer{{Question: publicQuestions(demoQuestionList()[:1])[0], LowerBound: 9000, UpperBound: 8000}})
+	valid := `{"id": "first", "uid": "teacher", "answers": ` + string(answers) + `}`
+	invalid := `{"id": "second", "answers": ` + string(answers) + `}`
+	batch := "[" + valid + "," + invalid + "]"
+
+	for _, tc := range []struct {
+		query  string
+		status int
+		saved  []bool
+	}{
+		{"", http.StatusUnprocessableEntity, []bool{false, false}},
+		{"?partial=true", http.StatusOK, []bool{true, false}},
+	} {
+		db := NewMemoryGameDatabase()
+		w := httptest.NewRecorder()
+		batchSubmitHandler(SeedDemoQuestions(), db, defaultHandlerOptions()).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/games/batch"+tc.query, strings.NewReader(batch)))
+		if w.Code != tc.status {
+			t.Fatalf("%q: expected status %d, got %d: %s", tc.query, tc.status, w.Code, w.Body)
+		}
+
+		var results []batchResult
+		if err := json.NewDecoder(w.Body).Decode(&results); err != nil {
+			t.Fatalf("%q: can not decode results: %s", tc.query, err)
+		}
+		for i, saved := range tc.saved {
+			if results[i].Saved != saved || (results[i].Error == "") != saved {
+				t.Errorf("%q: unexpected result %+v", tc.query, results[i])
+			}
+		}
+
+		game, err := db.Get(nil, "first")
+		if saved := err == nil; saved != tc.saved[0] {
+			t.Errorf("%q: expected the valid game to be saved: %v, got %v", tc.query, tc.saved[0], err)
+		}
+		if err == nil && (game.Answers[0].LowerBound != 8000 || game.Score.Correct != 1) {
+			t.Errorf("%q: expected a normalized and scored game, got %+v", tc.query, game)
+		}
+	}
+
+	db := NewMockGameDatabase(WithGetReturns(GameEntity{}, ErrGameNotFound))
+	db.SaveBatchErr = errors.New("connection lost")
+	w := httptest.NewRecorder()
+	batchSubmitHandler(SeedDemoQuestions(), db, defaultHandlerOptions()).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/games/batch", strings.NewReader("["+valid+"]")))
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "connection lost") {
+		t.Errorf("Expected the error of the database, got %d: %s", w.Code, w.Body)
+	}
+
+	unknown := `{"id": "third", "uid": "teacher", "answers": [{"question": {"id": "unknown"}, "lower": 1, "upper": 2}]}`
+	unknownField := `{"id": "fourth", "uid": "teacher", "answers": [], "cheat": true}`
+	invalidUser := `{"id": "fifth", "uid": "../teacher", "answers": ` + string(answers) + `}`
+	for _, body := range []string{`[]`, `{}`, "[" + valid + "," + valid + "]", "[" + unknown + "]", "[" + unknownField + "]", "[" + invalidUser + "]"} {
+		w := httptest.NewRecorder()
+		batchSubmitHandler(SeedDemoQuestions(), NewMockGameDatabase(WithGetReturns(GameEntity{}, ErrGameNotFound)), defaultHandlerOptions()).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/games/batch", strings.NewReader(body)))
+		if w.Code == http.StatusOK {
+			t.Errorf("%.40s: expected an error, got %d", body, w.Code)
+		}
+	}
+}
+
+func TestBatchSubmitHandlerKeepsSubmittedGames(t *testing.T) {
+	db := NewMemoryGameDatabase()
+	original := GameEntity{ID: "first", UserID: "player", Answers: []Answer{{Question: demoQuestionList()[0], LowerBound: 1, UpperBound: 2}}}
+	if err := db.Save(nil, original); err != nil {
+		t.Fatalf("Can not save game: %s", err)
+	}
+
+	answers, _ := json.Marshal([]Answer{{Question: Question{ID: demoQuestionList()[1].ID}, LowerBound: 1, UpperBound: 2}})
+	batch := `[{"id": "first", "uid": "teacher", "answers": ` + string(answers) + `},
+		{"id": "second", "uid": "teacher", "idempotencyKey": "chosen", "questionIds": ["chosen"], "answers": ` + string(answers) + `}]`
+
+	w := httptest.NewRecorder()
+	batchSubmitHandler(SeedDemoQuestions(), db, defaultHandlerOptions()).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/games/batch?partial=true", strings.NewReader(batch)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+
+	if game, err := db.Get(nil, "first"); err != nil || game.UserID != "player" {
+		t.Errorf("Expected the submitted game to be kept, got %+v (%v)", game, err)
+	}
+	if game, err := db.Get(nil, "second"); err != nil || game.IdempotencyKey != "" || len(game.QuestionIDs) != 0 {
+		t.Errorf("Expected only the answers to be taken from the request, got %+v (%v)", game, err)
+	}
+}
+
+func TestBatchSubmitHandlerAdminOnly(t *testing.T) {
+	handler := NewHandler(nil, SeedDemoQuestions(), NewMemoryGameDatabase(), WithAdminToken(testAdminToken))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/games/batch", strings.NewReader(`[]`)))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a player, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, adminRequest(http.MethodPost, "/api/games/batch", `[]`))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected the admin to reach the handler, got %d", w.Code)
+	}
+}
@@ -0,0 +1,476 @@
+package predictiongame
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	boltGamesBucket         = []byte("games")
+	boltUserGamesBucket     = []byte("userGames")
+	boltQuestionGamesBucket = []byte("questionGames")
+)
+
+// BoltGameDatabase is a GameDatabase which stores the games in a BoltDB file.
+// It allows running the game as a single binary without a database server.
+//
+// Games are stored as JSON in the games bucket keyed by their ID. The userGames bucket
+// indexes the completed games of every user by a key of user ID, time and game ID. The
+// questionGames bucket indexes the completed games by the questions of their answers,
+// with a key of question ID and game ID.
+type BoltGameDatabase struct {
+	db *bolt.DB
+}
+
+// NewBoltGameDatabase creates a BoltGameDatabase using db and creates the buckets if
+// necessary. The questionGames index is built for the games stored before it existed.
+func NewBoltGameDatabase(db *bolt.DB) (*BoltGameDatabase, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		indexed := tx.Bucket(boltQuestionGamesBucket) != nil
+		for _, name := range [][]byte{boltGamesBucket, boltUserGamesBucket, boltQuestionGamesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		if indexed {
+			return nil
+		}
+
+		return tx.Bucket(boltGamesBucket).ForEach(func(k, v []byte) error {
+			var e GameEntity
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			return indexBoltQuestions(tx, e)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &BoltGameDatabase{db: db}, nil
+}
+
+// userPrefix returns the prefix of all index keys of a user.
+func userPrefix(uid string) []byte {
+	return append([]byte(uid), 0)
+}
+
+// userGameKey returns the index key of a game, which sorts the games of a user by time.
+func userGameKey(e GameEntity) []byte {
+	key := userPrefix(e.UserID)
+	key = binary.BigEndian.AppendUint64(key, uint64(e.Time.UnixNano()))
+	return append(key, e.ID...)
+}
+
+// questionPrefix returns the prefix of all index keys of a question.
+func questionPrefix(questionID string) []byte {
+	return append([]byte(questionID), 0)
+}
+
+// questionGameKey returns the key of a game in the index of a question.
+func questionGameKey(questionID, gameID string) []byte {
+	return append(questionPrefix(questionID), gameID...)
+}
+
+// indexBoltQuestions adds a completed game to the index of the questions of its answers.
+func indexBoltQuestions(tx *bolt.Tx, e GameEntity) error {
+	if !e.Completed() {
+		return nil
+	}
+
+	index := tx.Bucket(boltQuestionGamesBucket)
+	for _, a := range e.Answers {
+		if err := index.Put(questionGameKey(a.Question.ID, e.ID), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getBoltGame(tx *bolt.Tx, id string) (*GameEntity, error) {
+	data := tx.Bucket(boltGamesBucket).Get([]byte(id))
+	if data == nil {
+		return nil, nil
+	}
+
+	var e GameEntity
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+func putBoltGame(tx *bolt.Tx, e GameEntity) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket(boltGamesBucket).Put([]byte(e.ID), data)
+}
+
+// updateBoltGame loads the game with the ID, or a new pending game if it does not exist,
+// lets fn change it and stores it. Completed games are indexed for their user and the
+// questions of their answers.
+func updateBoltGame(tx *bolt.Tx, id string, fn func(e *GameEntity) error) error {
+	old, err := getBoltGame(tx, id)
+	if err != nil {
+		return err
+	}
+
+	e := newGame(id)
+	if old != nil {
+		e = *old
+	}
+	if err := fn(&e); err != nil {
+		return err
+	}
+
+	index := tx.Bucket(boltUserGamesBucket)
+	if old != nil && old.Completed() {
+		if err := index.Delete(userGameKey(*old)); err != nil {
+			return err
+		}
+		for _, a := range old.Answers {
+			if err := tx.Bucket(boltQuestionGamesBucket).Delete(questionGameKey(a.Question.ID, id)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := putBoltGame(tx, e); err != nil {
+		return err
+	}
+
+	if !e.Completed() {
+		return nil
+	}
+	if err := indexBoltQuestions(tx, e); err != nil {
+		return err
+	}
+	return index.Put(userGameKey(e), []byte(e.ID))
+}
+
+func (db *BoltGameDatabase) Start(r *http.Request, id string, numQuestions int) error {
+	return db.db.Update(func(tx *bolt.Tx) error {
+		return updateBoltGame(tx, id, func(e *GameEntity) error {
+			return e.start(numQuestions, time.Now())
+		})
+	})
+}
+
+func (db *BoltGameDatabase) Save(r *http.Request, game GameEntity) error {
+	return db.db.Update(func(tx *bolt.Tx) error {
+		return updateBoltGame(tx, game.ID, func(e *GameEntity) error {
+			return e.complete(game, time.Now())
+		})
+	})
+}
+
+func (db *BoltGameDatabase) SaveBatch(r *http.Request, games []GameEntity) error {
+	now := time.Now()
+	return db.db.Update(func(tx *bolt.Tx) error {
+		for _, g := range games {
+			err := updateBoltGame(tx, g.ID, func(e *GameEntity) error {
+				return e.complete(g, now)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (db *BoltGameDatabase) SetScore(r *http.Request, id string, score GameScore) error {
+	return db.db.Update(func(tx *bolt.Tx) error {
+		e, err := getBoltGame(tx, id)
+		if err != nil {
+			return err
+		}
+
+		if e == nil {
+			return ErrGameNotFound
+		}
+
+		e.Score = score
+		return putBoltGame(tx, *e)
+	})
+}
+
+func (db *BoltGameDatabase) SaveProgress(r *http.Request, id, uid string, answers []Answer) error {
+	return db.db.Update(func(tx *bolt.Tx) error {
+		return updateBoltGame(tx, id, func(e *GameEntity) error {
+			return e.saveProgress(uid, answers, time.Now())
+		})
+	})
+}
+
+func (db *BoltGameDatabase) SaveQuestions(r *http.Request, id string, questionIDs []string) error {
+	return db.db.Update(func(tx *bolt.Tx) error {
+		return updateBoltGame(tx, id, func(e *GameEntity) error {
+			return e.serve(questionIDs, time.Now())
+		})
+	})
+}
+
+func (db *BoltGameDatabase) Abandon(r *http.Request, id string) error {
+	return db.db.Update(func(tx *bolt.Tx) error {
+		e, err := getBoltGame(tx, id)
+		if err != nil {
+			return err
+		}
+
+		if e == nil {
+			return ErrGameNotFound
+		}
+
+		if err := e.abandon(time.Now()); err != nil {
+			return err
+		}
+		return putBoltGame(tx, *e)
+	})
+}
+
+func (db *BoltGameDatabase) Get(r *http.Request, id string) (GameEntity, error) {
+	var result GameEntity
+	err := db.db.View(func(tx *bolt.Tx) error {
+		e, err := getBoltGame(tx, id)
+		if err != nil {
+			return err
+		}
+
+		if e == nil {
+			return ErrGameNotFound
+		}
+
+		result = *e
+		return nil
+	})
+	if err != nil {
+		return GameEntity{}, err
+	}
+
+	return result, nil
+}
+
+func (db *BoltGameDatabase) List(r *http.Request, uid string) ([]GameEntity, error) {
+	var result []GameEntity
+	err := db.db.View(func(tx *bolt.Tx) error {
+		return eachUserGame(tx, uid, func(e GameEntity) bool {
+			result = append(result, e)
+			return true
+		})
+	})
+	if err != nil {
+		return []GameEntity{}, err
+	}
+
+	return result, nil
+}
+
+func (db *BoltGameDatabase) ListPage(r *http.Request, uid string, offset, limit int) ([]GameEntity, int, error) {
+	result := []GameEntity{}
+	total := 0
+	err := db.db.View(func(tx *bolt.Tx) error {
+		return eachUserGame(tx, uid, func(e GameEntity) bool {
+			if total >= offset && total < offset+limit {
+				result = append(result, e)
+			}
+			total++
+			return true
+		})
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return result, total, nil
+}
+
+func (db *BoltGameDatabase) Last(r *http.Request, uid string) (*GameEntity, error) {
+	var result *GameEntity
+	err := db.db.View(func(tx *bolt.Tx) error {
+		return eachUserGame(tx, uid, func(e GameEntity) bool {
+			result = &e
+			return false
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if result == nil {
+		return nil, ErrGameNotFound
+	}
+
+	return result, nil
+}
+
+func (db *BoltGameDatabase) Leaderboard(r *http.Request, offset, limit int, by LeaderboardSort, cfg ScoreConfig) ([]LeaderboardEntry, int, error) {
+	games, err := db.all()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return newLeaderboard(games, by, offset, limit, cfg)
+}
+
+func (db *BoltGameDatabase) ListAll(r *http.Request) ([]GameEntity, error) {
+	games, err := db.all()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]GameEntity, 0, len(games))
+	for _, g := range games {
+		if g.Completed() {
+			result = append(result, g)
+		}
+	}
+	return result, nil
+}
+
+func (db *BoltGameDatabase) Iterate(r *http.Request, since time.Time, fn func(GameEntity) error) error {
+	return db.db.View(func(tx *bolt.Tx) error {
+		// The games are keyed by their ID, so only their times are collected to sort
+		// them. Each game is read again when fn is called.
+		type gameTime struct {
+			id   []byte
+			time time.Time
+		}
+		var order []gameTime
+		b := tx.Bucket(boltGamesBucket)
+		err := b.ForEach(func(k, v []byte) error {
+			var e struct {
+				Time time.Time `json:"time"`
+			}
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+
+			if !e.Time.Before(since) {
+				order = append(order, gameTime{id: k, time: e.Time})
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		sort.Slice(order, func(i, j int) bool {
+			return order[i].time.Before(order[j].time)
+		})
+		for _, g := range order {
+			var e GameEntity
+			if err := json.Unmarshal(b.Get(g.id), &e); err != nil {
+				return err
+			}
+
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (db *BoltGameDatabase) ListRecent(r *http.Request, limit int) ([]GameEntity, error) {
+	games, err := db.all()
+	if err != nil {
+		return nil, err
+	}
+
+	return recentGames(games, limit), nil
+}
+
+func (db *BoltGameDatabase) GetAnswerStats(ctx context.Context, questionID string, cfg ScoreConfig) (QuestionStats, error) {
+	var games []GameEntity
+	err := db.db.View(func(tx *bolt.Tx) error {
+		prefix := questionPrefix(questionID)
+		c := tx.Bucket(boltQuestionGamesBucket).Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			e, err := getBoltGame(tx, string(k[len(prefix):]))
+			if err != nil {
+				return err
+			}
+			if e != nil {
+				games = append(games, *e)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return QuestionStats{}, err
+	}
+
+	return answerStats(newQuestionStats(games, cfg), questionID), nil
+}
+
+func (db *BoltGameDatabase) QuestionStats(r *http.Request, cfg ScoreConfig) (map[string]QuestionStats, error) {
+	games, err := db.all()
+	if err != nil {
+		return nil, err
+	}
+
+	return newQuestionStats(games, cfg), nil
+}
+
+// all returns all games, including the ones in progress.
+func (db *BoltGameDatabase) all() ([]GameEntity, error) {
+	var games []GameEntity
+	err := db.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltGamesBucket).ForEach(func(k, v []byte) error {
+			var e GameEntity
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+
+			games = append(games, e)
+			return nil
+		})
+	})
+
+	return games, err
+}
+
+// eachUserGame calls fn for the completed games of a user, newest first, until fn returns false.
+func eachUserGame(tx *bolt.Tx, uid string, fn func(GameEntity) bool) error {
+	prefix := userPrefix(uid)
+	c := tx.Bucket(boltUserGamesBucket).Cursor()
+
+	// Position the cursor on the last key of the user by seeking past the prefix.
+	end := append([]byte(uid), 1)
+	k, v := c.Seek(end)
+	if k == nil {
+		k, v = c.Last()
+	} else {
+		k, v = c.Prev()
+	}
+
+	for ; k != nil && bytes.HasPrefix(k, prefix); k, v = c.Prev() {
+		e, err := getBoltGame(tx, string(v))
+		if err != nil {
+			return err
+		}
+
+		if e == nil || !e.Completed() {
+			continue
+		}
+
+		if !fn(*e) {
+			return nil
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,198 @@
+package predictiongame
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBoltGameDatabase(t *testing.T) {
+	raw, err := bolt.Open(filepath.Join(t.TempDir(), "games.db"), 0600, nil)
+	if err != nil {
+		t.Fatalf("Can not open database: %s", err)
+	}
+	defer raw.Close()
+
+	db, err := NewBoltGameDatabase(raw)
+	if err != nil {
+		t.Fatalf("Can not create database: %s", err)
+	}
+
+	answers := []Answer{{Question: demoQuestionList()[0], LowerBound: 8000, UpperBound: 9000}}
+	for _, id := range []string{"first", "second"} {
+		if err := db.Save(nil, GameEntity{ID: id, UserID: "user", Answers: answers}); err != nil {
+			t.Fatalf("Can not save game %s: %s", id, err)
+		}
+	}
+	if err := db.Save(nil, GameEntity{ID: "third", UserID: "other", Answers: answers}); err != nil {
+		t.Fatalf("Can not save game: %s", err)
+	}
+
+	game, err := db.Get(nil, "first")
+	if err != nil {
+		t.Fatalf("Can not get game: %s", err)
+	}
+	if game.UserID != "user" || len(game.Answers) != 1 || game.Answers[0].Question.ID != answers[0].Question.ID {
+		t.Errorf("Unexpected game: %+v", game)
+	}
+
+	if _, err := db.Get(nil, "missing"); err != ErrGameNotFound {
+		t.Errorf("Expected ErrGameNotFound, got %v", err)
+	}
+
+	list, err := db.List(nil, "user")
+	if err != nil {
+		t.Fatalf("Can not list games: %s", err)
+	}
+	if len(list) != 2 || list[0].ID != "second" || list[1].ID != "first" {
+		t.Errorf("Unexpected games: %+v", list)
+	}
+
+	last, err := db.Last(nil, "user")
+	if err != nil || last == nil || last.ID != "second" {
+		t.Errorf("Unexpected last game %+v (%v)", last, err)
+	}
+
+	if last, err := db.Last(nil, "nobody"); err != ErrGameNotFound || last != nil {
+		t.Errorf("Expected ErrGameNotFound, got %+v (%v)", last, err)
+	}
+
+	if err := db.SaveProgress(nil, "fourth", "", answers); err != nil {
+		t.Fatalf("Can not save progress: %s", err)
+	}
+	if err := db.SaveProgress(nil, "first", "", answers); err != ErrGameCompleted {
+		t.Errorf("Expected ErrGameCompleted, got %v", err)
+	}
+	if err := db.Save(nil, GameEntity{ID: "fourth", UserID: "user", Answers: answers}); err != nil {
+		t.Fatalf("Can not complete game: %s", err)
+	}
+	if last, err := db.Last(nil, "user"); err != nil || last == nil || last.ID != "fourth" {
+		t.Errorf("Expected completed game to be last, got %+v (%v)", last, err)
+	}
+
+	page, total, err := db.ListPage(nil, "user", 1, 1)
+	if err != nil || total != 3 || len(page) != 1 || page[0].ID != "second" {
+		t.Errorf("Unexpected page %+v of %d games (%v)", page, total, err)
+	}
+}
+
+func TestBoltGameDatabaseSaveBatch(t *testing.T) {
+	raw, err := bolt.Open(filepath.Join(t.TempDir(), "games.db"), 0600, nil)
+	if err != nil {
+		t.Fatalf("Can not open database: %s", err)
+	}
+	defer raw.Close()
+
+	db, err := NewBoltGameDatabase(raw)
+	if err != nil {
+		t.Fatalf("Can not create database: %s", err)
+	}
+
+	answers := []Answer{{Question: demoQuestionList()[0], LowerBound: 8000, UpperBound: 9000}}
+	if err := db.SaveBatch(nil, []GameEntity{
+		{ID: "first", UserID: "user", Answers: answers, Score: GameScore{Correct: 1}},
+		{ID: "second", UserID: "user", Answers: answers},
+	}); err != nil {
+		t.Fatalf("Can not save batch: %s", err)
+	}
+
+	games, err := db.List(nil, "user")
+	if err != nil || len(games) != 2 {
+		t.Fatalf("Expected 2 games of the user, got %d (%v)", len(games), err)
+	}
+	game, err := db.Get(nil, "first")
+	if err != nil || !game.Completed() || game.Score.Correct != 1 || game.QuestionCount != 1 {
+		t.Errorf("Unexpected game %+v (%v)", game, err)
+	}
+}
+
+func TestBoltGameDatabaseIterate(t *testing.T) {
+	raw, err := bolt.Open(filepath.Join(t.TempDir(), "games.db"), 0600, nil)
+	if err != nil {
+		t.Fatalf("Can not open database: %s", err)
+	}
+	defer raw.Close()
+
+	db, err := NewBoltGameDatabase(raw)
+	if err != nil {
+		t.Fatalf("Can not create database: %s", err)
+	}
+
+	answers := []Answer{{Question: demoQuestionList()[0], LowerBound: 8000, UpperBound: 9000}}
+	for _, id := range []string{"c", "a", "b"} {
+		if err := db.Save(nil, GameEntity{ID: id, UserID: "user", Answers: answers}); err != nil {
+			t.Fatalf("Can not save game %s: %s", id, err)
+		}
+	}
+	a, _ := db.Get(nil, "a")
+
+	for _, tc := range []struct {
+		since    time.Time
+		expected []string
+	}{
+		{time.Time{}, []string{"c", "a", "b"}},
+		{a.Time, []string{"a", "b"}},
+	} {
+		var ids []string
+		if err := db.Iterate(nil, tc.since, func(g GameEntity) error {
+			ids = append(ids, g.ID)
+			return nil
+		}); err != nil {
+			t.Fatalf("Can not iterate: %s", err)
+		}
+		if !reflect.DeepEqual(ids, tc.expected) {
+			t.Errorf("since %s: expected %v, got %v", tc.since, tc.expected, ids)
+		}
+	}
+}
+
+func TestBoltGameDatabaseAnswerStats(t *testing.T) {
+	raw, err := bolt.Open(filepath.Join(t.TempDir(), "games.db"), 0600, nil)
+	if err != nil {
+		t.Fatalf("Can not open database: %s", err)
+	}
+	defer raw.Close()
+
+	db, err := NewBoltGameDatabase(raw)
+	if err != nil {
+		t.Fatalf("Can not create database: %s", err)
+	}
+
+	list := demoQuestionList()
+	answers := []Answer{{Question: list[0], LowerBound: 8000, UpperBound: 9000}, {Question: list[1], LowerBound: 1, UpperBound: 2}}
+	if err := db.Save(nil, GameEntity{ID: "first", UserID: "user", Answers: answers}); err != nil {
+		t.Fatalf("Can not save game: %s", err)
+	}
+	if err := db.Save(nil, GameEntity{ID: "second", UserID: "user", Answers: answers[:1]}); err != nil {
+		t.Fatalf("Can not save game: %s", err)
+	}
+	if err := db.SaveProgress(nil, "third", "user", answers); err != nil {
+		t.Fatalf("Can not save progress: %s", err)
+	}
+
+	check := func(db *BoltGameDatabase) {
+		t.Helper()
+		for id, expected := range map[string]int{list[0].ID: 2, list[1].ID: 1, "unanswered": 0} {
+			if stats, err := db.GetAnswerStats(context.Background(), id, ScoreConfig{}); err != nil || stats.QuestionID != id || stats.Answers != expected {
+				t.Errorf("Expected %d answers to %s, got %+v (%v)", expected, id, stats, err)
+			}
+		}
+	}
+	check(db)
+
+	// Databases created before the index get it when they are opened.
+	if err := raw.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket(boltQuestionGamesBucket)
+	}); err != nil {
+		t.Fatalf("Can not delete index: %s", err)
+	}
+	db, err = NewBoltGameDatabase(raw)
+	if err != nil {
+		t.Fatalf("Can not open database again: %s", err)
+	}
+	check(db)
+}
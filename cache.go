@@ -0,0 +1,164 @@
+package predictiongame
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+)
+
+// CacheStats contains the number of lookups which were served from the cache or not.
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+// HitRate returns the ratio of cache hits to all lookups.
+func (s CacheStats) HitRate() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+
+	return float64(s.Hits) / float64(total)
+}
+
+type cachedGameDatabase struct {
+	GameDatabase
+
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List
+	version  uint64
+	hits     uint64
+	misses   uint64
+}
+
+type cacheEntry struct {
+	id   string
+	game GameEntity
+}
+
+// CachedGameDatabase wraps inner and caches the results of Get for the `capacity` most recently
+// used games. Saving a game removes it from the cache. The returned database can be used
+// concurrently. It has a method CacheStats() CacheStats, which can be used to export the hit
+// rate as a metric, for example using a Prometheus GaugeFunc.
+func CachedGameDatabase(inner GameDatabase, capacity int) GameDatabase {
+	return &cachedGameDatabase{
+		GameDatabase: inner,
+		capacity:     capacity,
+		entries:      make(map[string]*list.Element),
+		order:        list.New(),
+	}
+}
+
+func (db *cachedGameDatabase) Start(r *http.Request, id string, numQuestions int) error {
+	db.invalidate(id)
+	defer db.invalidate(id)
+
+	return db.GameDatabase.Start(r, id, numQuestions)
+}
+
+func (db *cachedGameDatabase) Save(r *http.Request, game GameEntity) error {
+	db.invalidate(game.ID)
+	defer db.invalidate(game.ID)
+
+	return db.GameDatabase.Save(r, game)
+}
+
+func (db *cachedGameDatabase) SaveProgress(r *http.Request, id, uid string, answers []Answer) error {
+	db.invalidate(id)
+	defer db.invalidate(id)
+
+	return db.GameDatabase.SaveProgress(r, id, uid, answers)
+}
+
+func (db *cachedGameDatabase) SaveQuestions(r *http.Request, id string, questionIDs []string) error {
+	db.invalidate(id)
+	defer db.invalidate(id)
+
+	return db.GameDatabase.SaveQuestions(r, id, questionIDs)
+}
+
+func (db *cachedGameDatabase) Abandon(r *http.Request, id string) error {
+	db.invalidate(id)
+	defer db.invalidate(id)
+
+	return db.GameDatabase.Abandon(r, id)
+}
+
+func (db *cachedGameDatabase) SetScore(r *http.Request, id string, score GameScore) error {
+	db.invalidate(id)
+	defer db.invalidate(id)
+
+	return db.GameDatabase.SetScore(r, id, score)
+}
+
+func (db *cachedGameDatabase) SaveBatch(r *http.Request, games []GameEntity) error {
+	for _, g := range games {
+		db.invalidate(g.ID)
+		defer db.invalidate(g.ID)
+	}
+
+	return db.GameDatabase.SaveBatch(r, games)
+}
+
+func (db *cachedGameDatabase) Get(r *http.Request, id string) (GameEntity, error) {
+	db.mu.Lock()
+	if e, ok := db.entries[id]; ok {
+		db.order.MoveToFront(e)
+		db.hits++
+		game := e.Value.(*cacheEntry).game
+		db.mu.Unlock()
+		return game, nil
+	}
+	db.misses++
+	version := db.version
+	db.mu.Unlock()
+
+	game, err := db.GameDatabase.Get(r, id)
+	if err != nil {
+		return GameEntity{}, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	// Do not cache the game if it might have been saved in the meantime.
+	if version != db.version {
+		return game, nil
+	}
+
+	if _, ok := db.entries[id]; !ok && db.capacity > 0 {
+		db.entries[id] = db.order.PushFront(&cacheEntry{id: id, game: game})
+		if db.order.Len() > db.capacity {
+			oldest := db.order.Back()
+			db.order.Remove(oldest)
+			delete(db.entries, oldest.Value.(*cacheEntry).id)
+		}
+	}
+
+	return game, nil
+}
+
+func (db *cachedGameDatabase) invalidate(id string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.version++
+	if e, ok := db.entries[id]; ok {
+		db.order.Remove(e)
+		delete(db.entries, id)
+	}
+}
+
+// CacheStats returns the number of cache hits and misses so far.
+func (db *cachedGameDatabase) CacheStats() CacheStats {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return CacheStats{
+		Hits:   db.hits,
+		Misses: db.misses,
+	}
+}
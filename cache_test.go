@@ -0,0 +1,71 @@
+package predictiongame
+
+import (
+	"net/http"
+	"testing"
+)
+
+// countingGameDatabase counts the calls to Get.
+type countingGameDatabase struct {
+	MockGameDatabase
+	gets map[string]int
+}
+
+func (db *countingGameDatabase) Get(r *http.Request, id string) (GameEntity, error) {
+	db.gets[id]++
+	return GameEntity{ID: id}, nil
+}
+
+func TestCachedGameDatabase(t *testing.T) {
+	inner := &countingGameDatabase{gets: make(map[string]int)}
+	db := CachedGameDatabase(inner, 2)
+
+	for _, id := range []string{"a", "a", "b", "a", "c", "b"} {
+		game, err := db.Get(nil, id)
+		if err != nil || game.ID != id {
+			t.Fatalf("Unexpected result for %s: %+v (%v)", id, game, err)
+		}
+	}
+
+	// "b" was evicted when "c" was added, "a" stayed in the cache.
+	if inner.gets["a"] != 1 || inner.gets["b"] != 2 || inner.gets["c"] != 1 {
+		t.Errorf("Unexpected calls to inner database: %v", inner.gets)
+	}
+
+	stats := db.(interface{ CacheStats() CacheStats }).CacheStats()
+	if stats.Hits != 2 || stats.Misses != 4 || stats.HitRate() != 2.0/6 {
+		t.Errorf("Unexpected cache stats: %+v", stats)
+	}
+
+	if err := db.Save(nil, GameEntity{ID: "c", UserID: "user"}); err != nil {
+		t.Fatalf("Can not save game: %s", err)
+	}
+	db.Get(nil, "c")
+	if inner.gets["c"] != 2 {
+		t.Errorf("Expected saved game to be reloaded, got %d calls", inner.gets["c"])
+	}
+
+	if err := db.SetScore(nil, "c", GameScore{Correct: 1}); err != nil {
+		t.Fatalf("Can not set score: %s", err)
+	}
+	db.Get(nil, "c")
+	if inner.gets["c"] != 3 {
+		t.Errorf("Expected rescored game to be reloaded, got %d calls", inner.gets["c"])
+	}
+
+	if err := db.Abandon(nil, "c"); err != nil {
+		t.Fatalf("Can not abandon game: %s", err)
+	}
+	db.Get(nil, "c")
+	if inner.gets["c"] != 4 {
+		t.Errorf("Expected abandoned game to be reloaded, got %d calls", inner.gets["c"])
+	}
+
+	if err := db.SaveQuestions(nil, "c", []string{"q1"}); err != nil {
+		t.Fatalf("Can not save questions: %s", err)
+	}
+	db.Get(nil, "c")
+	if inner.gets["c"] != 5 {
+		t.Errorf("Expected served game to be reloaded, got %d calls", inner.gets["c"])
+	}
+}
@@ -0,0 +1,255 @@
+package predictiongame
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by CircuitBreakerGameDatabase while the database is
+// considered unavailable.
+var ErrCircuitOpen = errors.New("game database is unavailable")
+
+// circuitState is the state of a CircuitBreakerGameDatabase.
+type circuitState int
+
+const (
+	// circuitClosed passes all calls to the database.
+	circuitClosed circuitState = iota
+	// circuitOpen fails all calls immediately.
+	circuitOpen
+	// circuitHalfOpen passes a single probe call to the database, which decides
+	// whether the circuit is closed or opened again.
+	circuitHalfOpen
+)
+
+// CircuitBreakerGameDatabase wraps a GameDatabase, so requests fail fast while the
+// database is down instead of waiting for their timeouts. After failureThreshold
+// consecutive failures, all calls fail with ErrCircuitOpen. Once probeInterval has
+// passed, the next call is passed to the database as a probe: if it succeeds, the
+// database is used again, otherwise the calls keep failing for another probeInterval.
+//
+// Errors like ErrGameNotFound which are answers of a working database are not counted
+// as failures.
+type CircuitBreakerGameDatabase struct {
+	db               GameDatabase
+	failureThreshold int
+	probeInterval    time.Duration
+	now              func() time.Time
+
+	mu       sync.Mutex
+	state    circuitState
+	failures int
+	openedAt time.Time
+}
+
+// NewCircuitBreakerGameDatabase wraps db with a circuit breaker which opens after
+// failureThreshold consecutive failures and probes the database every probeInterval
+// while it is open.
+func NewCircuitBreakerGameDatabase(db GameDatabase, failureThreshold int, probeInterval time.Duration) *CircuitBreakerGameDatabase {
+	if failureThreshold < 1 {
+		failureThreshold = 1
+	}
+
+	return &CircuitBreakerGameDatabase{
+		db:               db,
+		failureThreshold: failureThreshold,
+		probeInterval:    probeInterval,
+		now:              time.Now,
+	}
+}
+
+// isFailure returns true if err shows that the database is not working.
+func isFailure(err error) bool {
+	return err != nil &&
+		!errors.Is(err, ErrGameNotFound) &&
+		!errors.Is(err, ErrGameCompleted) &&
+		!errors.Is(err, ErrInvalidTransition) &&
+		!errors.Is(err, ErrDuplicateSubmit) &&
+		!errors.Is(err, context.Canceled)
+}
+
+// allow returns true if a call may be passed to the database.
+func (cb *CircuitBreakerGameDatabase) allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case circuitOpen:
+		if cb.now().Sub(cb.openedAt) < cb.probeInterval {
+			return false
+		}
+		cb.state = circuitHalfOpen
+		return true
+	case circuitHalfOpen:
+		// A probe is running.
+		return false
+	default:
+		return true
+	}
+}
+
+// record updates the state with the result of a call.
+func (cb *CircuitBreakerGameDatabase) record(err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if !isFailure(err) {
+		cb.state = circuitClosed
+		cb.failures = 0
+		return
+	}
+
+	cb.failures++
+	if cb.state == circuitHalfOpen || cb.failures >= cb.failureThreshold {
+		cb.state = circuitOpen
+		cb.openedAt = cb.now()
+	}
+}
+
+// call passes fn to the database if the circuit allows it.
+func (cb *CircuitBreakerGameDatabase) call(fn func() error) error {
+	if !cb.allow() {
+		return ErrCircuitOpen
+	}
+
+	err := fn()
+	cb.record(err)
+	return err
+}
+
+func (cb *CircuitBreakerGameDatabase) Start(r *http.Request, id string, numQuestions int) error {
+	return cb.call(func() error {
+		return cb.db.Start(r, id, numQuestions)
+	})
+}
+
+func (cb *CircuitBreakerGameDatabase) Save(r *http.Request, game GameEntity) error {
+	return cb.call(func() error {
+		return cb.db.Save(r, game)
+	})
+}
+
+func (cb *CircuitBreakerGameDatabase) SaveProgress(r *http.Request, id, uid string, answers []Answer) error {
+	return cb.call(func() error {
+		return cb.db.SaveProgress(r, id, uid, answers)
+	})
+}
+
+func (cb *CircuitBreakerGameDatabase) SaveQuestions(r *http.Request, id string, questionIDs []string) error {
+	return cb.call(func() error {
+		return cb.db.SaveQuestions(r, id, questionIDs)
+	})
+}
+
+func (cb *CircuitBreakerGameDatabase) Abandon(r *http.Request, id string) error {
+	return cb.call(func() error {
+		return cb.db.Abandon(r, id)
+	})
+}
+
+func (cb *CircuitBreakerGameDatabase) SetScore(r *http.Request, id string, score GameScore) error {
+	return cb.call(func() error {
+		return cb.db.SetScore(r, id, score)
+	})
+}
+
+func (cb *CircuitBreakerGameDatabase) SaveBatch(r *http.Request, games []GameEntity) error {
+	return cb.call(func() error {
+		return cb.db.SaveBatch(r, games)
+	})
+}
+
+func (cb *CircuitBreakerGameDatabase) Get(r *http.Request, id string) (game GameEntity, err error) {
+	err = cb.call(func() error {
+		game, err = cb.db.Get(r, id)
+		return err
+	})
+	return game, err
+}
+
+func (cb *CircuitBreakerGameDatabase) List(r *http.Request, uid string) (games []GameEntity, err error) {
+	err = cb.call(func() error {
+		games, err = cb.db.List(r, uid)
+		return err
+	})
+	return games, err
+}
+
+func (cb *CircuitBreakerGameDatabase) ListPage(r *http.Request, uid string, offset, limit int) (games []GameEntity, total int, err error) {
+	err = cb.call(func() error {
+		games, total, err = cb.db.ListPage(r, uid, offset, limit)
+		return err
+	})
+	return games, total, err
+}
+
+func (cb *CircuitBreakerGameDatabase) ListAll(r *http.Request) (games []GameEntity, err error) {
+	err = cb.call(func() error {
+		games, err = cb.db.ListAll(r)
+		return err
+	})
+	return games, err
+}
+
+func (cb *CircuitBreakerGameDatabase) Iterate(r *http.Request, since time.Time, fn func(GameEntity) error) error {
+	// The errors of fn, like a client going away during an export, are not failures of
+	// the database.
+	var fnErr error
+	err := cb.call(func() error {
+		err := cb.db.Iterate(r, since, func(e GameEntity) error {
+			fnErr = fn(e)
+			return fnErr
+		})
+		if fnErr != nil {
+			return nil
+		}
+		return err
+	})
+	if fnErr != nil {
+		return fnErr
+	}
+	return err
+}
+
+func (cb *CircuitBreakerGameDatabase) ListRecent(r *http.Request, limit int) (games []GameEntity, err error) {
+	err = cb.call(func() error {
+		games, err = cb.db.ListRecent(r, limit)
+		return err
+	})
+	return games, err
+}
+
+func (cb *CircuitBreakerGameDatabase) Last(r *http.Request, uid string) (game *GameEntity, err error) {
+	err = cb.call(func() error {
+		game, err = cb.db.Last(r, uid)
+		return err
+	})
+	return game, err
+}
+
+func (cb *CircuitBreakerGameDatabase) Leaderboard(r *http.Request, offset, limit int, by LeaderboardSort, cfg ScoreConfig) (entries []LeaderboardEntry, total int, err error) {
+	err = cb.call(func() error {
+		entries, total, err = cb.db.Leaderboard(r, offset, limit, by, cfg)
+		return err
+	})
+	return entries, total, err
+}
+
+func (cb *CircuitBreakerGameDatabase) QuestionStats(r *http.Request, cfg ScoreConfig) (stats map[string]QuestionStats, err error) {
+	err = cb.call(func() error {
+		stats, err = cb.db.QuestionStats(r, cfg)
+		return err
+	})
+	return stats, err
+}
+
+func (cb *CircuitBreakerGameDatabase) GetAnswerStats(ctx context.Context, questionID string, cfg ScoreConfig) (stats QuestionStats, err error) {
+	err = cb.call(func() error {
+		stats, err = cb.db.GetAnswerStats(ctx, questionID, cfg)
+		return err
+	})
+	return stats, err
+}
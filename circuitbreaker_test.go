@@ -0,0 +1,77 @@
+package predictiongame
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerGameDatabase(t *testing.T) {
+	outage := errors.New("connection refused")
+	mock := NewMockGameDatabase(WithGetReturns(GameEntity{}, outage))
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	db := NewCircuitBreakerGameDatabase(mock, 3, time.Minute)
+	db.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if _, err := db.Get(nil, "game"); err != outage {
+			t.Fatalf("Call %d: expected the database error, got %v", i, err)
+		}
+	}
+
+	if _, err := db.Get(nil, "game"); err != ErrCircuitOpen {
+		t.Fatalf("Expected ErrCircuitOpen after 3 failures, got %v", err)
+	}
+	if n := len(mock.Calls("Get")); n != 3 {
+		t.Errorf("Expected 3 calls of the database while the circuit is open, got %d", n)
+	}
+
+	// The failing probe opens the circuit again.
+	now = now.Add(time.Minute)
+	if _, err := db.Get(nil, "game"); err != outage {
+		t.Errorf("Expected the probe to reach the database, got %v", err)
+	}
+	if _, err := db.Get(nil, "game"); err != ErrCircuitOpen {
+		t.Errorf("Expected ErrCircuitOpen after the failed probe, got %v", err)
+	}
+
+	// The successful probe closes it.
+	now = now.Add(time.Minute)
+	mock.GetErr = nil
+	for i := 0; i < 2; i++ {
+		if _, err := db.Get(nil, "game"); err != nil {
+			t.Errorf("Call %d: expected the circuit to be closed, got %v", i, err)
+		}
+	}
+}
+
+func TestCircuitBreakerIgnoresNotFound(t *testing.T) {
+	mock := NewMockGameDatabase(WithGetReturns(GameEntity{}, ErrGameNotFound))
+	db := NewCircuitBreakerGameDatabase(mock, 1, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		if _, err := db.Get(nil, "game"); err != ErrGameNotFound {
+			t.Errorf("Call %d: expected ErrGameNotFound, got %v", i, err)
+		}
+	}
+}
+
+func TestCircuitBreakerIgnoresInvalidTransition(t *testing.T) {
+	mock := NewMockGameDatabase()
+	mock.SaveErr = fmt.Errorf("%w from %q to %q", ErrInvalidTransition, GameCompleted, GameCompleted)
+	db := NewCircuitBreakerGameDatabase(mock, 1, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		if err := db.Save(nil, GameEntity{ID: "game", UserID: "user"}); !errors.Is(err, ErrInvalidTransition) {
+			t.Errorf("Call %d: expected ErrInvalidTransition, got %v", i, err)
+		}
+	}
+}
+
+func TestGameErrorStatusCircuitOpen(t *testing.T) {
+	if status := gameErrorStatus(ErrCircuitOpen); status != 503 {
+		t.Errorf("Expected status 503, got %d", status)
+	}
+}
@@ -0,0 +1,12 @@
+// Command predictiongame serves the game on App Engine. The handlers are registered by
+// the init function of the predictiongame package.
+package main
+
+import (
+	_ "github.com/danishabdullah/predictiongame"
+	"google.golang.org/appengine"
+)
+
+func main() {
+	appengine.Main()
+}
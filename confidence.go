@@ -3,6 +3,17 @@ package predictiongame
 import "math"
 import "fmt"
 
+// significanceLevel is the p-value below which a player counts as over- or underconfident.
+const significanceLevel = 0.2
+
+// binomialTest returns the p-values of the two-sided binomial test for having too few
+// and too many correct answers given the stated confidence.
+func binomialTest(correct int, questions int, statedConfidence float64) (pLeft, pRight float64) {
+	pLeft = binomCDF(float64(correct), float64(questions), statedConfidence) * 2
+	pRight = (1 - binomCDF(float64(correct-1), float64(questions), statedConfidence)) * 2
+	return pLeft, pRight
+}
+
 func evaluateConfidence(correct int, questions int, statedConfidence float64) string {
 	var message string
 
@@ -10,15 +21,13 @@ func evaluateConfidence(correct int, questions int, statedConfidence float64) st
 		return "Assertion failed in evaluateConfidence: variable questions out of bounds!"
 	}
 
-	// Two-sided binomial test
-	pLeft := binomCDF(float64(correct), float64(questions), statedConfidence) * 2
-	pRight := (1 - binomCDF(float64(correct-1), float64(questions), statedConfidence)) * 2
+	pLeft, pRight := binomialTest(correct, questions, statedConfidence)
 	factor := (float64(correct) / float64(questions)) / statedConfidence
 
-	if pLeft <= 0.2 {
+	if pLeft <= significanceLevel {
 		message = fmt.Sprintf("You're %s overconfident, by an estimated factor of %.1fX",
 			degree(pLeft), 1/factor)
-	} else if pRight <= 0.2 {
+	} else if pRight <= significanceLevel {
 		message = fmt.Sprintf("You're %s underconfident, by an estimated factor of %.1fX",
 			degree(pRight), factor)
 	} else {
@@ -29,7 +38,7 @@ func evaluateConfidence(correct int, questions int, statedConfidence float64) st
 }
 
 func degree(p float64) string {
-	if p > 0.2 {
+	if p > significanceLevel {
 		return "not"
 	} else if p > 0.05 {
 		return "likely"
@@ -0,0 +1,499 @@
+package predictiongame
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/datastore"
+)
+
+// CorrectionStatus describes whether a correction has been reviewed.
+type CorrectionStatus string
+
+const (
+	// CorrectionPending is the status of a correction which has not been reviewed yet.
+	CorrectionPending CorrectionStatus = "pending"
+	// CorrectionApproved is the status of a correction whose bounds have been applied to
+	// the question.
+	CorrectionApproved CorrectionStatus = "approved"
+	// CorrectionRejected is the status of a correction which has been rejected.
+	CorrectionRejected CorrectionStatus = "rejected"
+)
+
+// CorrectionRequest is the suggestion of a player that the bounds of a question are
+// wrong, made after playing a game with it.
+type CorrectionRequest struct {
+	ID            string  `json:"id" datastore:"-"`
+	QuestionID    string  `json:"question_id"`
+	SuggestedLow  float64 `json:"suggested_low"`
+	SuggestedHigh float64 `json:"suggested_high"`
+	Explanation   string  `json:"explanation" datastore:",noindex"`
+	// GameID is the game in which the question was answered.
+	GameID string `json:"game_id"`
+	// UserID is the player who submitted the correction.
+	UserID string           `json:"uid"`
+	Time   time.Time        `json:"time"`
+	Status CorrectionStatus `json:"status"`
+}
+
+// ErrCorrectionNotFound is returned when a correction does not exist.
+var ErrCorrectionNotFound = errors.New("correction not found")
+
+// ErrDuplicateCorrection is returned when a question of a game is corrected again.
+var ErrDuplicateCorrection = errors.New("question of the game has been corrected already")
+
+// CorrectionDatabase is the interface for the database containing the corrections.
+type CorrectionDatabase interface {
+	// Add stores new corrections of a game and returns their IDs. Either all of them are
+	// stored or none; ErrDuplicateCorrection is returned if one of their questions has
+	// been corrected in the game already.
+	Add(r *http.Request, corrections []CorrectionRequest) ([]string, error)
+	// Get returns a correction or ErrCorrectionNotFound.
+	Get(r *http.Request, id string) (CorrectionRequest, error)
+	// List returns the corrections with the status, oldest first, or all corrections if
+	// the status is empty.
+	List(r *http.Request, status CorrectionStatus) ([]CorrectionRequest, error)
+	// SetStatus changes the status of a correction.
+	SetStatus(r *http.Request, id string, status CorrectionStatus) error
+}
+
+type memoryCorrectionDatabase struct {
+	mu          sync.RWMutex
+	corrections map[string]CorrectionRequest
+	next        int
+}
+
+// NewCorrectionDatabase returns an in-memory CorrectionDatabase which can be used
+// concurrently.
+func NewCorrectionDatabase() CorrectionDatabase {
+	return &memoryCorrectionDatabase{corrections: make(map[string]CorrectionRequest)}
+}
+
+func (db *memoryCorrectionDatabase) Add(r *http.Request, corrections []CorrectionRequest) ([]string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, c := range corrections {
+		for _, existing := range db.corrections {
+			if existing.GameID == c.GameID && existing.QuestionID == c.QuestionID {
+				return nil, ErrDuplicateCorrection
+			}
+		}
+	}
+
+	ids := make([]string, len(corrections))
+	for i, c := range corrections {
+		db.next++
+		c.ID = strconv.Itoa(db.next)
+		db.corrections[c.ID] = c
+		ids[i] = c.ID
+	}
+	return ids, nil
+}
+
+func (db *memoryCorrectionDatabase) Get(r *http.Request, id string) (CorrectionRequest, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	c, ok := db.corrections[id]
+	if !ok {
+		return CorrectionRequest{}, ErrCorrectionNotFound
+	}
+	return c, nil
+}
+
+func (db *memoryCorrectionDatabase) List(r *http.Request, status CorrectionStatus) ([]CorrectionRequest, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	result := []CorrectionRequest{}
+	for _, c := range db.corrections {
+		if status == "" || c.Status == status {
+			result = append(result, c)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Time.Before(result[j].Time) ||
+			(result[i].Time.Equal(result[j].Time) && result[i].ID < result[j].ID)
+	})
+	return result, nil
+}
+
+func (db *memoryCorrectionDatabase) SetStatus(r *http.Request, id string, status CorrectionStatus) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	c, ok := db.corrections[id]
+	if !ok {
+		return ErrCorrectionNotFound
+	}
+
+	c.Status = status
+	db.corrections[id] = c
+	return nil
+}
+
+// correctionDatabase is the CorrectionDatabase storing the corrections in the datastore
+// of App Engine. The corrections of a game are children of its key named by their
+// question, so a question can be corrected once per game, and the encoded keys are
+// their IDs.
+type correctionDatabase struct{}
+
+func (db *correctionDatabase) Add(r *http.Request, corrections []CorrectionRequest) ([]string, error) {
+	ctx := appengine.NewContext(r)
+
+	keys := make([]*datastore.Key, len(corrections))
+	for i, c := range corrections {
+		game := datastore.NewKey(ctx, "Game", c.GameID, 0, nil)
+		keys[i] = datastore.NewKey(ctx, "Correction", c.QuestionID, 0, game)
+	}
+
+	// All keys have the same parent if the corrections belong to one game, so they are
+	// stored in a single group transaction.
+	err := datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		existing := make([]CorrectionRequest, len(keys))
+		err := datastore.GetMulti(ctx, keys, existing)
+		if err == nil {
+			return ErrDuplicateCorrection
+		}
+		if multi, ok := err.(appengine.MultiError); ok {
+			for _, err := range multi {
+				if err == nil {
+					return ErrDuplicateCorrection
+				}
+				if err != datastore.ErrNoSuchEntity {
+					return err
+				}
+			}
+		} else if err != nil {
+			return err
+		}
+
+		_, err = datastore.PutMulti(ctx, keys, corrections)
+		return err
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(keys))
+	for i, k := range keys {
+		ids[i] = k.Encode()
+	}
+	return ids, nil
+}
+
+// correctionKey decodes the ID of a correction.
+func correctionKey(id string) (*datastore.Key, error) {
+	k, err := datastore.DecodeKey(id)
+	if err != nil || k.Kind() != "Correction" {
+		return nil, ErrCorrectionNotFound
+	}
+	return k, nil
+}
+
+func (db *correctionDatabase) Get(r *http.Request, id string) (CorrectionRequest, error) {
+	ctx := appengine.NewContext(r)
+
+	k, err := correctionKey(id)
+	if err != nil {
+		return CorrectionRequest{}, err
+	}
+
+	var c CorrectionRequest
+	err = datastore.Get(ctx, k, &c)
+	if err == datastore.ErrNoSuchEntity {
+		return CorrectionRequest{}, ErrCorrectionNotFound
+	}
+	if err != nil {
+		return CorrectionRequest{}, err
+	}
+
+	c.ID = id
+	return c, nil
+}
+
+func (db *correctionDatabase) List(r *http.Request, status CorrectionStatus) ([]CorrectionRequest, error) {
+	ctx := appengine.NewContext(r)
+
+	q := datastore.NewQuery("Correction")
+	if status != "" {
+		q = q.Filter("Status =", string(status))
+	}
+
+	result := []CorrectionRequest{}
+	keys, err := q.Order("Time").GetAll(ctx, &result)
+	if err != nil {
+		return nil, err
+	}
+	for i, k := range keys {
+		result[i].ID = k.Encode()
+	}
+	return result, nil
+}
+
+func (db *correctionDatabase) SetStatus(r *http.Request, id string, status CorrectionStatus) error {
+	ctx := appengine.NewContext(r)
+
+	k, err := correctionKey(id)
+	if err != nil {
+		return err
+	}
+
+	return datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		var c CorrectionRequest
+		err := datastore.Get(ctx, k, &c)
+		if err == datastore.ErrNoSuchEntity {
+			return ErrCorrectionNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		c.Status = status
+		_, err = datastore.Put(ctx, k, &c)
+		return err
+	}, nil)
+}
+
+// maxCorrectionExplanationLength is the maximum length of the explanation of a
+// correction in characters.
+const maxCorrectionExplanationLength = 1000
+
+// validateCorrection returns the correction with a normalized explanation, or an error
+// if it does not refer to a question of the game or its bounds are invalid.
+func validateCorrection(c CorrectionRequest, game GameEntity) (CorrectionRequest, error) {
+	found := false
+	for _, a := range game.Answers {
+		if a.Question.ID != "" && a.Question.ID == c.QuestionID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return c, fmt.Errorf("question %q is not part of the game", c.QuestionID)
+	}
+
+	for _, v := range []float64{c.SuggestedLow, c.SuggestedHigh} {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return c, fmt.Errorf("suggested bound %g is not a number", v)
+		}
+	}
+	if c.SuggestedLow > c.SuggestedHigh {
+		return c, fmt.Errorf("suggested_low %g is greater than suggested_high %g", c.SuggestedLow, c.SuggestedHigh)
+	}
+
+	explanation, err := validateUserText(c.Explanation, maxCorrectionExplanationLength)
+	if err != nil {
+		return c, fmt.Errorf("invalid explanation: %s", err)
+	}
+	c.Explanation = explanation
+
+	return c, nil
+}
+
+// serveGameCorrections stores the corrections posted by the player of a game as a JSON
+// list of objects with the fields question_id, suggested_low, suggested_high and
+// explanation. Either all of them are stored or none.
+func serveGameCorrections(w http.ResponseWriter, r *http.Request, db GameDatabase, id string, opts handlerOptions) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	defer r.Body.Close()
+
+	game, err := db.Get(r, id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Game can not be loaded: %s", err), gameErrorStatus(err))
+		return
+	}
+
+	if !opts.hasIdentity(r, game.UserID) {
+		http.Error(w, "Only the player of the game can submit corrections", http.StatusForbidden)
+		return
+	}
+
+	var submitted []CorrectionRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, opts.maxBodyBytes)).Decode(&submitted); err != nil {
+		http.Error(w, fmt.Sprintf("Error parsing corrections: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if len(submitted) == 0 || len(submitted) > len(game.Answers) {
+		http.Error(w, fmt.Sprintf("A game can have between 1 and %d corrections", len(game.Answers)), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	seen := make(map[string]bool, len(submitted))
+	for i, c := range submitted {
+		c, err := validateCorrection(c, game)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid correction %d: %s", i+1, err), http.StatusBadRequest)
+			return
+		}
+		if seen[c.QuestionID] {
+			http.Error(w, fmt.Sprintf("Invalid correction %d: question %q is corrected twice", i+1, c.QuestionID), http.StatusBadRequest)
+			return
+		}
+		seen[c.QuestionID] = true
+
+		// The player, the time and the state are decided by the server.
+		c.GameID = game.ID
+		c.UserID = game.UserID
+		c.Time = now
+		c.Status = CorrectionPending
+		submitted[i] = c
+	}
+
+	ids, err := opts.corrections.Add(r, submitted)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrDuplicateCorrection) {
+			status = http.StatusConflict
+		}
+		http.Error(w, fmt.Sprintf("Error saving corrections: %s", err), status)
+		return
+	}
+	for i, id := range ids {
+		submitted[i].ID = id
+	}
+
+	writeJSONStatus(w, r, http.StatusAccepted, submitted)
+}
+
+// adminCorrectionsHandler lists the corrections with the status given in the query
+// parameter, the pending ones by default.
+func adminCorrectionsHandler(corrections CorrectionDatabase) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		status := CorrectionStatus(r.URL.Query().Get("status"))
+		switch status {
+		case "":
+			status = CorrectionPending
+		case "all":
+			status = ""
+		case CorrectionPending, CorrectionApproved, CorrectionRejected:
+		default:
+			http.Error(w, fmt.Sprintf("Unknown status %q", status), http.StatusBadRequest)
+			return
+		}
+
+		list, err := corrections.List(r, status)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Corrections can not be loaded: %s", err), http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, r, list)
+	})
+}
+
+// adminCorrectionHandler shows a correction with GET, approves it with POST, which sets
+// the bounds of its question to the suggested ones, and rejects it with DELETE.
+func adminCorrectionHandler(questions QuestionDatabase, corrections CorrectionDatabase) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := splitPath(r.URL.Path, "/admin/corrections/")
+		if len(parts) != 1 {
+			http.NotFound(w, r)
+			return
+		}
+
+		c, err := corrections.Get(r, parts[0])
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Correction %q can not be loaded: %s", parts[0], err), correctionErrorStatus(err))
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, r, c)
+			return
+		case http.MethodPost, http.MethodDelete:
+		default:
+			w.Header().Set("Allow", "GET, POST, DELETE")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if c.Status != CorrectionPending {
+			http.Error(w, fmt.Sprintf("Correction %q is already %s", c.ID, c.Status), http.StatusConflict)
+			return
+		}
+
+		c.Status = CorrectionRejected
+		if r.Method == http.MethodPost {
+			if err := applyCorrection(questions, c); err != nil {
+				http.Error(w, fmt.Sprintf("Correction %q can not be applied: %s", c.ID, err), correctionErrorStatus(err))
+				return
+			}
+			c.Status = CorrectionApproved
+		}
+
+		if err := corrections.SetStatus(r, c.ID, c.Status); err != nil {
+			http.Error(w, fmt.Sprintf("Correction %q can not be saved: %s", c.ID, err), correctionErrorStatus(err))
+			return
+		}
+
+		writeJSON(w, r, c)
+	})
+}
+
+// errInvalidCorrection is returned by applyCorrection if the corrected question is invalid.
+var errInvalidCorrection = errors.New("invalid corrected question")
+
+// applyCorrection sets the bounds of the question of the correction to the suggested ones.
+// The true value of a question takes precedence over its bounds, so it is corrected
+// instead if the question has one, which needs a correction suggesting a single value.
+func applyCorrection(questions QuestionDatabase, c CorrectionRequest) error {
+	q, err := questions.GetByID(c.QuestionID)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case !q.HasTrueValue:
+		q.BoundLow, q.BoundHigh = c.SuggestedLow, c.SuggestedHigh
+	case c.SuggestedLow != c.SuggestedHigh:
+		return fmt.Errorf("%w: the question has the true value %g, which takes precedence over the suggested bounds", errInvalidCorrection, q.TrueValue)
+	case q.IsPoint():
+		q.BoundLow, q.BoundHigh = c.SuggestedLow, c.SuggestedHigh
+		q.TrueValue = c.SuggestedLow
+	default:
+		q.TrueValue = c.SuggestedLow
+	}
+	if err := q.Validate(); err != nil {
+		return fmt.Errorf("%w: %s", errInvalidCorrection, err)
+	}
+
+	return questions.Update(q.ID, q)
+}
+
+// correctionErrorStatus returns the HTTP status for an error returned when reviewing a
+// correction.
+func correctionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrCorrectionNotFound), errors.Is(err, ErrQuestionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errInvalidCorrection):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
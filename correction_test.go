@@ -0,0 +1,110 @@
+package predictiongame
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGameCorrections(t *testing.T) {
+	questions := SeedDemoQuestions()
+	q := demoQuestionList()[0]
+	games := NewMemoryGameDatabase()
+	if err := games.Save(nil, GameEntity{ID: "game", UserID: "user", Answers: []Answer{{Question: q, LowerBound: 1, UpperBound: 2}}}); err != nil {
+		t.Fatal(err)
+	}
+	corrections := NewCorrectionDatabase()
+	handler := NewHandler(nil, questions, games, WithCorrectionDatabase(corrections), WithAdminToken("secret"), WithSessionSecret(testSessionSecret))
+
+	request := func(method, path, uid, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		if uid != "" {
+			addIdentity(r, uid)
+		}
+		if strings.HasPrefix(path, "/admin/") {
+			r.Header.Set("Authorization", "Bearer secret")
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	valid := `[{"question_id": "` + q.ID + `", "suggested_low": 100, "suggested_high": 200, "explanation": " Updated in 2024. "}]`
+	for _, tc := range []struct {
+		path, uid, body string
+		status          int
+	}{
+		{"/api/game/game/corrections", "other", valid, http.StatusForbidden},
+		{"/api/game/missing/corrections", "user", valid, http.StatusNotFound},
+		{"/api/game/game/corrections", "user", `[]`, http.StatusBadRequest},
+		{"/api/game/game/corrections", "user", `[{"question_id": "unknown", "suggested_low": 1, "suggested_high": 2, "explanation": "x"}]`, http.StatusBadRequest},
+		{"/api/game/game/corrections", "user", `[{"question_id": "` + q.ID + `", "suggested_low": 2, "suggested_high": 1, "explanation": "x"}]`, http.StatusBadRequest},
+		{"/api/game/game/corrections", "user", `[{"question_id": "` + q.ID + `", "suggested_low": 1, "suggested_high": 2}]`, http.StatusBadRequest},
+		{"/api/game/game/corrections", "user", `[` + strings.Trim(valid, "[]") + `, ` + strings.Trim(valid, "[]") + `]`, http.StatusBadRequest},
+		{"/api/game/game/corrections", "user", valid, http.StatusAccepted},
+		{"/api/game/game/corrections", "user", valid, http.StatusConflict},
+	} {
+		if w := request(http.MethodPost, tc.path, tc.uid, tc.body); w.Code != tc.status {
+			t.Errorf("%s %q %.60s: expected status %d, got %d: %s", tc.path, tc.uid, tc.body, tc.status, w.Code, w.Body)
+		}
+	}
+
+	w := request(http.MethodGet, "/admin/corrections", "", "")
+	var pending []CorrectionRequest
+	if err := json.Unmarshal(w.Body.Bytes(), &pending); err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 {
+		t.Fatalf("Expected one pending correction, got %s", w.Body)
+	}
+	c := pending[0]
+	if c.UserID != "user" || c.GameID != "game" || c.Explanation != "Updated in 2024." || c.Status != CorrectionPending {
+		t.Errorf("Unexpected correction %+v", c)
+	}
+
+	if w := request(http.MethodPost, "/admin/corrections/"+c.ID, "", ""); w.Code != http.StatusOK {
+		t.Fatalf("Expected the correction to be approved, got %d: %s", w.Code, w.Body)
+	}
+	if updated, err := questions.GetByID(q.ID); err != nil || updated.BoundLow != 100 || updated.BoundHigh != 200 {
+		t.Errorf("Expected the corrected bounds, got %+v (%v)", updated, err)
+	}
+	if w := request(http.MethodDelete, "/admin/corrections/"+c.ID, "", ""); w.Code != http.StatusConflict {
+		t.Errorf("Expected a reviewed correction to be final, got %d", w.Code)
+	}
+	if w := request(http.MethodGet, "/admin/corrections/missing", "", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for an unknown correction, got %d", http.StatusNotFound, w.Code)
+	}
+	if approved, _ := corrections.List(nil, CorrectionApproved); len(approved) != 1 {
+		t.Errorf("Expected one approved correction, got %+v", approved)
+	}
+}
+
+func TestApplyCorrectionWithTrueValue(t *testing.T) {
+	questions := SeedDemoQuestions()
+	q := demoQuestionList()[0]
+	q.BoundLow, q.BoundHigh, q.TrueValue, q.HasTrueValue = 10, 20, 15, true
+	if err := questions.Update(q.ID, q); err != nil {
+		t.Fatal(err)
+	}
+
+	// The true value takes precedence over suggested bounds.
+	err := applyCorrection(questions, CorrectionRequest{QuestionID: q.ID, SuggestedLow: 12, SuggestedHigh: 18})
+	if status := correctionErrorStatus(err); status != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status %d for bounds, got %d (%v)", http.StatusUnprocessableEntity, status, err)
+	}
+
+	// The suggested true value would lie outside of the bounds.
+	err = applyCorrection(questions, CorrectionRequest{QuestionID: q.ID, SuggestedLow: 30, SuggestedHigh: 30})
+	if status := correctionErrorStatus(err); status != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status %d for a value outside of the bounds, got %d (%v)", http.StatusUnprocessableEntity, status, err)
+	}
+
+	if err := applyCorrection(questions, CorrectionRequest{QuestionID: q.ID, SuggestedLow: 17, SuggestedHigh: 17}); err != nil {
+		t.Fatal(err)
+	}
+	if updated, _ := questions.GetByID(q.ID); updated.TrueValue != 17 || updated.BoundLow != 10 || updated.BoundHigh != 20 {
+		t.Errorf("Expected the true value to be corrected, got %+v", updated)
+	}
+}
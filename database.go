@@ -1,130 +1,1039 @@
 package predictiongame
 
 import (
-	"encoding/csv"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"log"
+	"hash/fnv"
+	"math"
 	"math/rand"
 	"net/http"
-	"os"
-	"strconv"
+	"sort"
+	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	"google.golang.org/appengine"
 	"google.golang.org/appengine/datastore"
 )
 
+// DefaultLanguage is the language of questions which do not specify one.
+const DefaultLanguage = "en"
+
+// ErrQuestionNotFound is returned when a question can not be found in the database.
+var ErrQuestionNotFound = errors.New("question not found")
+
+// ErrQuestionExists is returned when adding a question with an ID which is already used.
+var ErrQuestionExists = errors.New("question already exists")
+
+// QuestionKind describes how a question is answered.
+type QuestionKind string
+
+const (
+	// RangeQuestion is answered with a lower and an upper bound. It is the default.
+	RangeQuestion QuestionKind = "range"
+	// PointQuestion is answered with an estimate and a tolerance. The correct value is BoundLow,
+	// which has to be equal to BoundHigh.
+	PointQuestion QuestionKind = "point"
+)
+
+// QuestionScale is the scale on which the answers to a question are compared.
+type QuestionScale string
+
+const (
+	// LinearScale compares the answers by their differences. It is the default.
+	LinearScale QuestionScale = "linear"
+	// LogScale compares the answers by their ratios. It is meant for questions whose
+	// answers span orders of magnitude; their bounds have to be positive.
+	LogScale QuestionScale = "log"
+)
+
+// logScaleFloor is the fraction of the lower bound of a log-scale question which is
+// used instead of answer bounds that are not positive.
+const logScaleFloor = 1e-3
+
 // Question is the basic data entity.
 type Question struct {
-	Text      string  `json:"text"`
-	Unit      string  `json:"unit"`
-	BoundLow  float64 `json:"boundLow"`
-	BoundHigh float64 `json:"boundHigh"`
+	ID       string       `json:"id"`
+	Text     string       `json:"text"`
+	Unit     string       `json:"unit"`
+	Category string       `json:"category"`
+	Kind     QuestionKind `json:"kind,omitempty"`
+	// Scale is used for the analytics of the answers, like their widths and miss
+	// distances. Whether an answer is correct does not depend on it.
+	Scale QuestionScale `json:"scale,omitempty"`
+	Lang  string        `json:"lang,omitempty"`
+	// Translations contains the text of the question in other languages by language
+	// code, see TextIn. They are not stored with the answers of a game, because the
+	// datastore does not support maps.
+	Translations map[string]string `json:"translations,omitempty" datastore:"-"`
+	// Tags are not stored with the answers of a game, because the datastore
+	// does not support nested slices.
+	Tags []string `json:"tags,omitempty" datastore:"-"`
+	// Enabled is false for questions which should not be used in new games anymore.
+	Enabled bool `json:"enabled"`
+	// Pending is true for questions submitted by users which have not been approved
+	// by an admin yet. Pending questions are not enabled.
+	Pending bool `json:"pending,omitempty"`
+	// Explanation optionally describes the correct answer after a game. It is never sent
+	// to the players before they submitted their answers.
+	Explanation string `json:"explanation,omitempty"`
+	// Precision is the number of decimal places the bounds and answers are shown with,
+	// see FormatBound.
+	Precision int `json:"precision,omitempty"`
+	// Difficulty is the weight of a correct answer to the question when scoring with
+	// ScoreConfig.WeightByDifficulty. Zero counts as 1, like the other questions.
+	Difficulty float64 `json:"difficulty,omitempty"`
+	BoundLow   float64 `json:"boundLow"`
+	BoundHigh  float64 `json:"boundHigh"`
+	// TrueValue is the exact answer if HasTrueValue is set. It has to lie within the
+	// bounds and takes precedence over them when scoring: an answer is correct if it
+	// contains the true value.
+	TrueValue    float64 `json:"trueValue,omitempty"`
+	HasTrueValue bool    `json:"hasTrueValue,omitempty"`
 }
 
-func convertRecord(rec []string) (Question, error) {
-	if len(rec) != 4 {
-		return Question{}, fmt.Errorf("invalid length: %d", len(rec))
+// Language returns the language of the question.
+func (q Question) Language() string {
+	if q.Lang == "" {
+		return DefaultLanguage
 	}
 
-	low, err := strconv.ParseFloat(rec[1], 64)
-	if err != nil {
-		return Question{}, err
+	return q.Lang
+}
+
+// TextIn returns the text of the question in the language lang, or its text in its own
+// language if there is no translation.
+func (q Question) TextIn(lang string) string {
+	if text, ok := q.Translations[lang]; ok && text != "" {
+		return text
 	}
 
-	high, err := strconv.ParseFloat(rec[2], 64)
-	if err != nil {
-		return Question{}, err
+	return q.Text
+}
+
+// IsPoint returns true if the question is answered with an estimate and a tolerance.
+func (q Question) IsPoint() bool {
+	return q.Kind == PointQuestion
+}
+
+// IsLog returns true if the answers to the question are compared on a logarithmic scale.
+func (q Question) IsLog() bool {
+	return q.Scale == LogScale
+}
+
+// scaled maps a value to the scale of the question, so distances between scaled values
+// can be compared across questions. On a log scale, the distances are orders of magnitude.
+func (q Question) scaled(v float64) float64 {
+	if !q.IsLog() {
+		return v
 	}
 
-	return Question{
-		Text:      rec[0],
-		Unit:      rec[3],
-		BoundLow:  low,
-		BoundHigh: high,
-	}, nil
+	if floor := q.BoundLow * logScaleFloor; v < floor {
+		v = floor
+	}
+	return math.Log10(v)
 }
 
-func readDatabase() ([]Question, error) {
-	f, err := os.Open("Questions.csv")
-	if err != nil {
-		return []Question{}, err
+// Value returns the exact answer of the question: the TrueValue if it is set, or the
+// value of a point question. The second result is false if the answer is a range.
+func (q Question) Value() (float64, bool) {
+	if q.HasTrueValue {
+		return q.TrueValue, true
 	}
 
-	reader := csv.NewReader(f)
-	reader.Comma = ';'
+	if q.IsPoint() {
+		return q.BoundLow, true
+	}
 
-	records, err := reader.ReadAll()
-	if err != nil {
-		return []Question{}, err
+	return 0, false
+}
+
+// correctRange returns the range of correct values, which is a single value if the
+// question has an exact answer.
+func (q Question) correctRange() (float64, float64) {
+	if v, ok := q.Value(); ok {
+		return v, v
 	}
 
-	var result []Question
-	for _, rec := range records {
-		q, err := convertRecord(rec)
-		if err != nil {
-			log.Printf("Invalid record: %s", err)
-			continue
+	return q.BoundLow, q.BoundHigh
+}
+
+// matches returns true if the text, the category or one of the tags of the question
+// contains the lower case query.
+func (q Question) matches(query string) bool {
+	if strings.Contains(strings.ToLower(q.Text), query) || strings.Contains(strings.ToLower(q.Category), query) {
+		return true
+	}
+
+	for _, t := range q.Tags {
+		if strings.Contains(strings.ToLower(t), query) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasTag returns true if the question has one of the tags. Tags are compared case-insensitively.
+func (q Question) HasTag(tags ...string) bool {
+	for _, t := range q.Tags {
+		for _, tag := range tags {
+			if strings.EqualFold(t, tag) {
+				return true
+			}
 		}
+	}
+
+	return false
+}
 
-		result = append(result, q)
+// Validate checks that the question is well-formed.
+func (q Question) Validate() error {
+	if strings.TrimSpace(q.Text) == "" {
+		return errors.New("text is empty")
 	}
-	return result, nil
+
+	for _, b := range []float64{q.BoundLow, q.BoundHigh, q.TrueValue} {
+		if math.IsNaN(b) || math.IsInf(b, 0) {
+			return fmt.Errorf("bound is not a finite number: %g", b)
+		}
+	}
+
+	if q.BoundLow > q.BoundHigh {
+		return fmt.Errorf("lower bound %g is greater than upper bound %g", q.BoundLow, q.BoundHigh)
+	}
+
+	if !q.HasTrueValue && q.TrueValue != 0 {
+		return fmt.Errorf("true value %g is set without HasTrueValue", q.TrueValue)
+	}
+
+	if q.HasTrueValue && (q.TrueValue < q.BoundLow || q.TrueValue > q.BoundHigh) {
+		return fmt.Errorf("true value %g is not within the bounds %g and %g", q.TrueValue, q.BoundLow, q.BoundHigh)
+	}
+
+	switch q.Kind {
+	case "", RangeQuestion:
+	case PointQuestion:
+		if q.BoundLow != q.BoundHigh {
+			return fmt.Errorf("point question has different bounds %g and %g", q.BoundLow, q.BoundHigh)
+		}
+	default:
+		return fmt.Errorf("unknown kind %q", q.Kind)
+	}
+
+	switch q.Scale {
+	case "", LinearScale:
+	case LogScale:
+		if q.BoundLow <= 0 {
+			return fmt.Errorf("log-scale question has a lower bound %g which is not positive", q.BoundLow)
+		}
+	default:
+		return fmt.Errorf("unknown scale %q", q.Scale)
+	}
+
+	if q.Precision < 0 || q.Precision > maxPrecision {
+		return fmt.Errorf("precision %d is not between 0 and %d", q.Precision, maxPrecision)
+	}
+
+	if q.Difficulty < 0 || math.IsInf(q.Difficulty, 0) || math.IsNaN(q.Difficulty) {
+		return fmt.Errorf("difficulty %g is not a non-negative number", q.Difficulty)
+	}
+
+	if n := utf8.RuneCountInString(q.Explanation); n > maxExplanationLength {
+		return fmt.Errorf("explanation has %d characters, more than %d", n, maxExplanationLength)
+	}
+
+	for i, t := range q.Tags {
+		if strings.TrimSpace(t) == "" {
+			return fmt.Errorf("tag %d is empty", i+1)
+		}
+	}
+
+	return nil
+}
+
+// maxPrecision is the maximum number of decimal places of a question.
+const maxPrecision = 6
+
+// maxExplanationLength is the maximum length of the explanation of a question in
+// characters.
+const maxExplanationLength = 1000
+
+// questionID derives a stable identifier from the question text.
+func questionID(text string) string {
+	sum := sha1.Sum([]byte(text))
+	return hex.EncodeToString(sum[:6])
 }
 
 // QuestionDatabase is the interface for the database containing the questions.
-type QuestionDatabase []Question
+type QuestionDatabase interface {
+	SelectRandom(num int) []Question
+	SelectRandomByLang(num int, lang string) []Question
+	SelectRandomByTag(num int, tags ...string) []Question
+	SelectRandomExcluding(num int, excludeIDs []string) []Question
+	SelectDaily(date time.Time, num int) []Question
+	SelectForGame(gameID, lang string, num int) []Question
+	SelectWeighted(num int, weight func(Question) float64) []Question
+	GetByID(id string) (Question, error)
+	Languages() []string
+	Add(q Question) (string, error)
+	List(offset, limit int) ([]Question, int)
+	Update(id string, q Question) error
+	Reload(questions []Question)
+	Search(query string) ([]Question, error)
+	Version() uint64
+}
+
+type memoryQuestionDatabase struct {
+	// mu guards questions and version. The selections only need a read lock, so they
+	// run concurrently with each other but not with Add, Update or Reload.
+	mu        sync.RWMutex
+	questions []Question
+	version   uint64
+
+	// rndMu guards rnd, which is not safe for concurrent use.
+	rndMu sync.Mutex
+	rnd   *rand.Rand
+}
+
+// NewQuestionDatabase creates an in-memory database containing the given questions.
+// Random selection uses rnd, which makes the selection reproducible when it is created
+// with a fixed seed. If rnd is nil, a source seeded from the current time is used.
+func NewQuestionDatabase(questions []Question, rnd *rand.Rand) QuestionDatabase {
+	if rnd == nil {
+		rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	return &memoryQuestionDatabase{
+		questions: questions,
+		rnd:       rnd,
+	}
+}
+
+// shuffle returns the indices [0, n) in random order from db.rnd, one at a time, until
+// next returns false. It is a partial Fisher-Yates shuffle which only stores the
+// swapped positions, so drawing k of the n indices takes O(k) time and memory instead
+// of the O(n) of a full permutation.
+func (db *memoryQuestionDatabase) shuffle(n int, next func(i int) bool) {
+	db.rndMu.Lock()
+	defer db.rndMu.Unlock()
+
+	swapped := make(map[int]int)
+	at := func(i int) int {
+		if v, ok := swapped[i]; ok {
+			return v
+		}
+		return i
+	}
+
+	for i := 0; i < n; i++ {
+		j := i + db.rnd.Intn(n-i)
+		// Position i is never visited again, so only position j has to be stored.
+		v := at(j)
+		swapped[j] = at(i)
+		if !next(v) {
+			return
+		}
+	}
+}
+
+// perm returns a random permutation of [0, n) from db.rnd.
+func (db *memoryQuestionDatabase) perm(n int) []int {
+	db.rndMu.Lock()
+	defer db.rndMu.Unlock()
+
+	return db.rnd.Perm(n)
+}
+
+// randFloat returns a random number in [0, 1) from db.rnd.
+func (db *memoryQuestionDatabase) randFloat() float64 {
+	db.rndMu.Lock()
+	defer db.rndMu.Unlock()
+
+	return db.rnd.Float64()
+}
+
+// SelectRandom selects `num` distinct questions at random from the database.
+// If the database contains less than `num` distinct questions, all of them are returned once.
+// Like all selection methods, it never returns questions which are not enabled.
+func (db *memoryQuestionDatabase) SelectRandom(num int) []Question {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	// Usually only few of the questions are needed, so they are drawn one at a time
+	// instead of permuting all of them.
+	var result []Question
+	seen := make(map[string]bool)
+	db.shuffle(len(db.questions), func(i int) bool {
+		result = db.appendDistinct(result, seen, i, num)
+		return len(result) < num
+	})
+	return result
+}
+
+// SelectRandomByLang selects `num` distinct questions in the language `lang` at random.
+func (db *memoryQuestionDatabase) SelectRandomByLang(num int, lang string) []Question {
+	return db.selectMatching(num, func(q Question) bool {
+		return q.Language() == lang
+	})
+}
+
+// SelectRandomByTag selects `num` distinct questions at random which have at least one of the tags.
+func (db *memoryQuestionDatabase) SelectRandomByTag(num int, tags ...string) []Question {
+	return db.selectMatching(num, func(q Question) bool {
+		return q.HasTag(tags...)
+	})
+}
+
+// SelectRandomExcluding selects `num` distinct questions at random, preferring questions whose IDs
+// are not in excludeIDs. Excluded questions are only selected if there are not enough other questions.
+func (db *memoryQuestionDatabase) SelectRandomExcluding(num int, excludeIDs []string) []Question {
+	excluded := make(map[string]bool, len(excludeIDs))
+	for _, id := range excludeIDs {
+		excluded[id] = true
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	idx := db.permuteMatching(db.perm, func(q Question) bool {
+		return !excluded[q.ID]
+	})
+	idx = append(idx, db.permuteMatching(db.perm, func(q Question) bool {
+		return excluded[q.ID]
+	})...)
+	return db.selectDistinct(idx, num)
+}
+
+// selectMatching selects `num` distinct questions at random for which match returns true.
+func (db *memoryQuestionDatabase) selectMatching(num int, match func(Question) bool) []Question {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.selectDistinct(db.permuteMatching(db.perm, match), num)
+}
+
+// permuteMatching returns the indices of the questions for which match returns true in
+// the random order given by perm. The caller must hold db.mu.
+func (db *memoryQuestionDatabase) permuteMatching(perm func(n int) []int, match func(Question) bool) []int {
+	var matching []int
+	for i, q := range db.questions {
+		if match(q) {
+			matching = append(matching, i)
+		}
+	}
+
+	order := perm(len(matching))
+
+	idx := make([]int, len(order))
+	for i, p := range order {
+		idx[i] = matching[p]
+	}
+
+	return idx
+}
+
+// SelectForGame selects `num` distinct questions in the language for a game. The selection
+// only depends on the game ID, so it is the same every time the game is loaded as long as
+// the questions do not change.
+func (db *memoryQuestionDatabase) SelectForGame(gameID, lang string, num int) []Question {
+	h := fnv.New64a()
+	h.Write([]byte(gameID))
+	rnd := rand.New(rand.NewSource(int64(h.Sum64())))
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	idx := db.permuteMatching(rnd.Perm, func(q Question) bool {
+		return q.Language() == lang
+	})
+	return db.selectDistinct(idx, num)
+}
+
+// SelectDaily selects `num` distinct questions for the day of `date`. The selection only depends
+// on the date (in UTC), so all players get the same questions on the same day.
+func (db *memoryQuestionDatabase) SelectDaily(date time.Time, num int) []Question {
+	y, m, d := date.UTC().Date()
+	seed := int64(y)*10000 + int64(m)*100 + int64(d)
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	idx := rand.New(rand.NewSource(seed)).Perm(len(db.questions))
+	return db.selectDistinct(idx, num)
+}
+
+// selectDistinct returns up to `num` questions in the order given by idx, skipping duplicates.
+// The caller must hold db.mu.
+func (db *memoryQuestionDatabase) selectDistinct(idx []int, num int) []Question {
+	seen := make(map[string]bool)
+	var result []Question
+	for _, i := range idx {
+		if len(result) >= num {
+			break
+		}
+		result = db.appendDistinct(result, seen, i, num)
+	}
+
+	return result
+}
+
+// appendDistinct appends the question at index i to result unless result already has
+// `num` questions, or the question is not enabled or in seen. The caller must hold db.mu.
+func (db *memoryQuestionDatabase) appendDistinct(result []Question, seen map[string]bool, i, num int) []Question {
+	q := db.questions[i]
+	if len(result) >= num || !q.Enabled || seen[q.ID] {
+		return result
+	}
+	seen[q.ID] = true
+
+	return append(result, q)
+}
+
+// SelectWeighted selects `num` distinct questions at random from the database. The probability
+// of a question to be selected is proportional to its weight. Questions with a weight of zero
+// or less are never selected.
+func (db *memoryQuestionDatabase) SelectWeighted(num int, weight func(Question) float64) []Question {
+	type candidate struct {
+		question Question
+		key      float64
+	}
+
+	db.mu.RLock()
+	candidates := make([]candidate, 0, len(db.questions))
+	for _, q := range db.questions {
+		if !q.Enabled {
+			continue
+		}
+
+		w := weight(q)
+		if w <= 0 {
+			continue
+		}
 
-// SelectRandom selects `num` questions at random from the database.
-func (db QuestionDatabase) SelectRandom(num int) []Question {
-	if len(db) < num {
-		return db
+		// Weighted sampling without replacement (Efraimidis and Spirakis).
+		key := math.Log(db.randFloat()) / w
+		candidates = append(candidates, candidate{q, key})
 	}
+	db.mu.RUnlock()
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].key > candidates[j].key
+	})
 
-	idx := rand.Perm(len(db))
+	seen := make(map[string]bool)
 	var result []Question
-	for c, i := range idx {
-		if c >= num {
+	for _, c := range candidates {
+		if len(result) >= num {
 			break
 		}
-		result = append(result, db[i])
+
+		if seen[c.question.ID] {
+			continue
+		}
+		seen[c.question.ID] = true
+
+		result = append(result, c.question)
 	}
 
 	return result
 }
 
+// GetByID returns the question with the given ID.
+func (db *memoryQuestionDatabase) GetByID(id string) (Question, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	for _, q := range db.questions {
+		if q.ID == id {
+			return q, nil
+		}
+	}
+
+	return Question{}, ErrQuestionNotFound
+}
+
+// Languages returns the languages of the questions in the database.
+func (db *memoryQuestionDatabase) Languages() []string {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var result []string
+	for _, q := range db.questions {
+		if !q.Enabled {
+			continue
+		}
+
+		if lang := q.Language(); !seen[lang] {
+			seen[lang] = true
+			result = append(result, lang)
+		}
+	}
+
+	sort.Strings(result)
+	return result
+}
+
+// Add validates the question and adds it to the database. If the question has no ID,
+// it is derived from the text. The ID of the question is returned.
+func (db *memoryQuestionDatabase) Add(q Question) (string, error) {
+	if err := q.Validate(); err != nil {
+		return "", err
+	}
+
+	if q.ID == "" {
+		q.ID = questionID(q.Text)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, existing := range db.questions {
+		if existing.ID == q.ID {
+			return "", ErrQuestionExists
+		}
+	}
+
+	db.questions = append(db.questions, q)
+	db.version++
+	return q.ID, nil
+}
+
+// List returns up to `limit` questions starting at `offset` and the total number of questions.
+func (db *memoryQuestionDatabase) List(offset, limit int) ([]Question, int) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	total := len(db.questions)
+	if offset >= total {
+		return []Question{}, total
+	}
+
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+
+	result := make([]Question, end-offset)
+	copy(result, db.questions[offset:end])
+	return result, total
+}
+
+// Update validates the question and replaces the question with the given ID by it.
+// The ID of the question is not changed.
+func (db *memoryQuestionDatabase) Update(id string, q Question) error {
+	q.ID = id
+	if err := q.Validate(); err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i := range db.questions {
+		if db.questions[i].ID == id {
+			db.questions[i] = q
+			db.version++
+			return nil
+		}
+	}
+
+	return ErrQuestionNotFound
+}
+
+// Reload replaces all questions in the database, for example after the question file
+// was changed. It waits for the selections which are running.
+func (db *memoryQuestionDatabase) Reload(questions []Question) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.questions = questions
+	db.version++
+}
+
+// Version returns a number which changes whenever the questions in the database are modified.
+func (db *memoryQuestionDatabase) Version() uint64 {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.version
+}
+
+// maxSearchResults is the maximum number of questions returned by the search endpoints
+// at once.
+const maxSearchResults = 100
+
+// Search returns all questions containing query in their text, category or one of their
+// tags, ignoring case. The callers limit the results, so they know the number of matches.
+func (db *memoryQuestionDatabase) Search(query string) ([]Question, error) {
+	query = strings.ToLower(query)
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	result := []Question{}
+	for _, q := range db.questions {
+		if q.matches(query) {
+			result = append(result, q)
+		}
+	}
+
+	return result, nil
+}
+
+// DefaultQuestionExclusionWindow is the number of recent games whose questions are not repeated
+// for a returning user.
+const DefaultQuestionExclusionWindow = 3
+
+// excludedWeight is the weight of recently answered questions in SelectRandomForUser. It is small
+// enough that they are only selected if there are not enough other questions.
+const excludedWeight = 1e-9
+
+// recentQuestionIDs returns the IDs of the questions of the first `window` games.
+func recentQuestionIDs(games []GameEntity, window int) []string {
+	if len(games) > window {
+		games = games[:window]
+	}
+
+	var ids []string
+	for _, g := range games {
+		if len(g.QuestionIDs) > 0 {
+			ids = append(ids, g.QuestionIDs...)
+			continue
+		}
+
+		for _, a := range g.Answers {
+			ids = append(ids, a.Question.ID)
+		}
+	}
+
+	return ids
+}
+
+// SelectRandomForUser selects `num` questions in the language `lang` for a user. Questions the user
+// has answered in the last `window` games are not repeated unless there are not enough other
+// questions. For new users the selection is uniformly random.
+func SelectRandomForUser(r *http.Request, questions QuestionDatabase, games GameDatabase, userID, lang string, num, window int) ([]Question, error) {
+	history, err := games.List(r, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(history) == 0 || window < 1 {
+		return questions.SelectRandomByLang(num, lang), nil
+	}
+
+	excluded := recentQuestionIDs(history, window)
+
+	// SelectRandomExcluding does not filter by language, so it can only be used if all
+	// questions share one.
+	if len(questions.Languages()) <= 1 {
+		return questions.SelectRandomExcluding(num, excluded), nil
+	}
+
+	recent := make(map[string]bool, len(excluded))
+	for _, id := range excluded {
+		recent[id] = true
+	}
+
+	return questions.SelectWeighted(num, func(q Question) float64 {
+		switch {
+		case q.Language() != lang:
+			return 0
+		case recent[q.ID]:
+			return excludedWeight
+		default:
+			return 1
+		}
+	}), nil
+}
+
+// ErrGameNotFound is returned by all GameDatabase implementations when a game does not exist.
+var ErrGameNotFound = errors.New("game not found")
+
+// ErrGameCompleted is returned when trying to start, save progress for or abandon a game
+// which is already completed.
+var ErrGameCompleted = errors.New("game is already completed")
+
+// GameDatabase is the interface for the database containing the games.
+// List and Last only return completed games. Get and Last return
+// ErrGameNotFound if there is no such game.
+//
+// The status of the stored games is only changed by their Transition, so the methods
+// saving a game return an error wrapping ErrInvalidTransition if its status does not
+// allow it, like when saving a completed game again.
 type GameDatabase interface {
-	Save(r *http.Request, userID, id string, game []Answer) error
+	// Start creates a pending game with the number of questions chosen for it.
+	Start(r *http.Request, id string, numQuestions int) error
+	// Save completes the game with its answers, score and idempotency key. It returns
+	// ErrDuplicateSubmit if the game has already been completed by the same user with the
+	// same non-empty idempotency key.
+	Save(r *http.Request, game GameEntity) error
+	// SaveProgress stores the answers of a game which is still being played by the user
+	// uid, which is empty if the player is not known yet.
+	SaveProgress(r *http.Request, id, uid string, answers []Answer) error
+	// SaveQuestions stores the IDs of the questions served for a game which has not been
+	// completed, in the order they are presented. A game which does not exist is created
+	// as a pending game.
+	SaveQuestions(r *http.Request, id string, questionIDs []string) error
+	// Abandon marks a game which has not been completed as abandoned, so it can not be
+	// played anymore.
+	Abandon(r *http.Request, id string) error
 	Get(r *http.Request, id string) (GameEntity, error)
 	List(r *http.Request, uid string) ([]GameEntity, error)
+	// ListPage returns the completed games of a user from offset to offset+limit, newest
+	// first, and the total number of completed games of the user.
+	ListPage(r *http.Request, uid string, offset, limit int) ([]GameEntity, int, error)
 	Last(r *http.Request, uid string) (*GameEntity, error)
+	// Leaderboard returns the users ranked by their completed games scored with cfg,
+	// starting at offset, and the total number of users.
+	Leaderboard(r *http.Request, offset, limit int, by LeaderboardSort, cfg ScoreConfig) ([]LeaderboardEntry, int, error)
+	// QuestionStats returns how often the questions have been answered correctly using
+	// the rules of cfg in the completed games, by question ID.
+	QuestionStats(r *http.Request, cfg ScoreConfig) (map[string]QuestionStats, error)
+	// ListAll returns the completed games of all users.
+	ListAll(r *http.Request) ([]GameEntity, error)
+	// Iterate calls fn for every game saved at or after since, oldest first, including
+	// the games in progress. It stops at the first error, which it returns. The games
+	// are read in batches, so all games can be exported without loading them at once.
+	Iterate(r *http.Request, since time.Time, fn func(GameEntity) error) error
+	// ListRecent returns the limit newest completed games of all users, newest first.
+	ListRecent(r *http.Request, limit int) ([]GameEntity, error)
+	// SetScore stores the score of a game.
+	SetScore(r *http.Request, id string, score GameScore) error
+	// SaveBatch saves the completed games with their scores like Save and SetScore.
+	// Where the database supports transactions, either all of them are saved or none.
+	SaveBatch(r *http.Request, games []GameEntity) error
+	// GetAnswerStats returns the QuestionStats of a single question. They are empty if
+	// the question has not been answered yet. Only the games answering the question are
+	// loaded.
+	GetAnswerStats(ctx context.Context, questionID string, cfg ScoreConfig) (QuestionStats, error)
 }
 
 type gameDatabase struct{}
 
+// transientDatastoreCodes are the names of the error codes of the App Engine APIs which
+// are temporary. The error type of the APIs is internal to the appengine package, but
+// its message contains the name, like "API error 5 (datastore_v3: TIMEOUT)".
+var transientDatastoreCodes = []string{"TIMEOUT", "INTERNAL_ERROR", "UNAVAILABLE"}
+
+// datastoreError wraps err into ErrTransient if it is a temporary failure of the
+// datastore, so RetryGameDatabase repeats the call. Other errors are returned unchanged.
+func datastoreError(err error) error {
+	if err == nil || errors.Is(err, ErrTransient) {
+		return err
+	}
+
+	if appengine.IsTimeoutError(err) {
+		return fmt.Errorf("%w: %w", ErrTransient, err)
+	}
+	msg := err.Error()
+	for _, code := range transientDatastoreCodes {
+		if strings.Contains(msg, ": "+code+")") {
+			return fmt.Errorf("%w: %w", ErrTransient, err)
+		}
+	}
+
+	return err
+}
+
+// GameStatus describes whether a game is still being played.
+type GameStatus string
+
+const (
+	// GamePending is the status of a game which has been created but not started yet.
+	GamePending GameStatus = "pending"
+	// GameInProgress is the status of a game which has been saved before all questions were answered.
+	GameInProgress GameStatus = "in-progress"
+	// GameCompleted is the status of a game which has been submitted.
+	GameCompleted GameStatus = "completed"
+	// GameAbandoned is the status of a game which will not be completed anymore.
+	GameAbandoned GameStatus = "abandoned"
+)
+
 type GameEntity struct {
-	ID      string    `json:"id"`
-	UserID  string    `json:"uid"`
-	Time    time.Time `json:"time"`
-	Answers []Answer  `json:"answers"`
+	ID     string     `json:"id"`
+	UserID string     `json:"uid"`
+	Time   time.Time  `json:"time"`
+	Status GameStatus `json:"status,omitempty"`
+	// QuestionCount is the number of questions of the game. It is zero for games
+	// which use the default number of questions.
+	QuestionCount int `json:"questionCount,omitempty"`
+	// QuestionIDs are the IDs of the questions served for the game in the order they
+	// were presented. It is empty for games saved before the order was stored.
+	QuestionIDs []string `json:"questionIds,omitempty"`
+	Answers     []Answer `json:"answers"`
+	// Score is the score computed when the game was submitted or last rescored. It is
+	// empty for games saved before scores were stored.
+	Score GameScore `json:"score"`
+	// IdempotencyKey is the Idempotency-Key header of the request which submitted the
+	// game, so a repeated submit is recognized. It is empty if there was none.
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
 }
 
-func (db *gameDatabase) Save(r *http.Request, userID, id string, game []Answer) error {
-	ctx := appengine.NewContext(r)
+// Completed returns true if the game has been submitted. Games saved
+// before the status was introduced are always completed.
+func (g GameEntity) Completed() bool {
+	return g.Status == GameCompleted || g.Status == ""
+}
 
-	e := &GameEntity{
-		ID:      id,
-		UserID:  userID,
-		Time:    time.Now(),
-		Answers: game,
+// hasQuestion returns true if the question was served or answered in the game.
+func (g GameEntity) hasQuestion(id string) bool {
+	for _, qid := range g.QuestionIDs {
+		if qid == id {
+			return true
+		}
 	}
 
-	k := datastore.NewKey(ctx, "Game", id, 0, nil)
-	if _, err := datastore.Put(ctx, k, e); err != nil {
+	return g.answered(id)
+}
+
+// answered returns true if the question was answered in the game.
+func (g GameEntity) answered(id string) bool {
+	for _, a := range g.Answers {
+		if a.Question.ID == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// updateGame loads the game with the key, or a new pending game if it does not exist,
+// lets fn change it and stores it. It has to be called in a transaction.
+func updateGame(ctx context.Context, k *datastore.Key, fn func(e *GameEntity) error) error {
+	var e GameEntity
+	err := datastore.Get(ctx, k, &e)
+	if err == datastore.ErrNoSuchEntity {
+		e = newGame(k.StringID())
+	} else if err != nil {
 		return err
 	}
 
-	return nil
+	if err := fn(&e); err != nil {
+		return err
+	}
+
+	_, err = datastore.Put(ctx, k, &e)
+	return err
+}
+
+func (db *gameDatabase) Start(r *http.Request, id string, numQuestions int) error {
+	ctx := appengine.NewContext(r)
+
+	k := datastore.NewKey(ctx, "Game", id, 0, nil)
+	return datastoreError(datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		return updateGame(ctx, k, func(e *GameEntity) error {
+			return e.start(numQuestions, time.Now())
+		})
+	}, nil))
+}
+
+func (db *gameDatabase) Save(r *http.Request, game GameEntity) error {
+	ctx := appengine.NewContext(r)
+
+	k := datastore.NewKey(ctx, "Game", game.ID, 0, nil)
+	return datastoreError(datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		return updateGame(ctx, k, func(e *GameEntity) error {
+			return e.complete(game, time.Now())
+		})
+	}, nil))
+}
+
+// maxBatchSize is the maximum number of games saved by SaveBatch, because a cross-group
+// transaction of the datastore can write at most 25 entity groups.
+const maxBatchSize = 25
+
+func (db *gameDatabase) SaveBatch(r *http.Request, games []GameEntity) error {
+	ctx := appengine.NewContext(r)
+
+	now := time.Now()
+	return datastoreError(datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		for _, g := range games {
+			k := datastore.NewKey(ctx, "Game", g.ID, 0, nil)
+			err := updateGame(ctx, k, func(e *GameEntity) error {
+				return e.complete(g, now)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}, &datastore.TransactionOptions{XG: true}))
+}
+
+func (db *gameDatabase) SetScore(r *http.Request, id string, score GameScore) error {
+	ctx := appengine.NewContext(r)
+
+	k := datastore.NewKey(ctx, "Game", id, 0, nil)
+	return datastoreError(datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		var e GameEntity
+		err := datastore.Get(ctx, k, &e)
+		if err == datastore.ErrNoSuchEntity {
+			return ErrGameNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		e.Score = score
+		// The games saved before the status was introduced are completed.
+		if e.Status == "" {
+			e.Status = GameCompleted
+		}
+		_, err = datastore.Put(ctx, k, &e)
+		return err
+	}, nil))
+}
+
+func (db *gameDatabase) SaveProgress(r *http.Request, id, uid string, answers []Answer) error {
+	ctx := appengine.NewContext(r)
+
+	k := datastore.NewKey(ctx, "Game", id, 0, nil)
+	return datastoreError(datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		return updateGame(ctx, k, func(e *GameEntity) error {
+			return e.saveProgress(uid, answers, time.Now())
+		})
+	}, nil))
+}
+
+func (db *gameDatabase) SaveQuestions(r *http.Request, id string, questionIDs []string) error {
+	ctx := appengine.NewContext(r)
+
+	k := datastore.NewKey(ctx, "Game", id, 0, nil)
+	return datastoreError(datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		return updateGame(ctx, k, func(e *GameEntity) error {
+			return e.serve(questionIDs, time.Now())
+		})
+	}, nil))
+}
+
+func (db *gameDatabase) Abandon(r *http.Request, id string) error {
+	ctx := appengine.NewContext(r)
+
+	k := datastore.NewKey(ctx, "Game", id, 0, nil)
+	return datastoreError(datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		var e GameEntity
+		err := datastore.Get(ctx, k, &e)
+		if err == datastore.ErrNoSuchEntity {
+			return ErrGameNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := e.abandon(time.Now()); err != nil {
+			return err
+		}
+
+		_, err = datastore.Put(ctx, k, &e)
+		return err
+	}, nil))
 }
 
 func (db *gameDatabase) Get(r *http.Request, id string) (GameEntity, error) {
@@ -133,7 +1042,10 @@ func (db *gameDatabase) Get(r *http.Request, id string) (GameEntity, error) {
 	k := datastore.NewKey(ctx, "Game", id, 0, nil)
 	var e GameEntity
 	if err := datastore.Get(ctx, k, &e); err != nil {
-		return GameEntity{}, err
+		if err == datastore.ErrNoSuchEntity {
+			return GameEntity{}, ErrGameNotFound
+		}
+		return GameEntity{}, datastoreError(err)
 	}
 
 	return e, nil
@@ -152,7 +1064,11 @@ func (db *gameDatabase) List(r *http.Request, uid string) ([]GameEntity, error)
 			break
 		}
 		if err != nil {
-			return []GameEntity{}, err
+			return []GameEntity{}, datastoreError(err)
+		}
+
+		if !e.Completed() {
+			continue
 		}
 
 		result = append(result, e)
@@ -160,22 +1076,142 @@ func (db *gameDatabase) List(r *http.Request, uid string) ([]GameEntity, error)
 	return result, nil
 }
 
+func (db *gameDatabase) ListPage(r *http.Request, uid string, offset, limit int) ([]GameEntity, int, error) {
+	ctx := appengine.NewContext(r)
+
+	// Only the games with the completed status are paged by the query, so the games
+	// saved before the status was introduced are not listed until SetScore, for example
+	// by /admin/rescore, has stored their status.
+	q := datastore.NewQuery("Game").Filter("UserID =", uid).Filter("Status =", string(GameCompleted))
+	total, err := q.Count(ctx)
+	if err != nil {
+		return nil, 0, datastoreError(err)
+	}
+
+	result := []GameEntity{}
+	if offset >= total || limit <= 0 {
+		return result, total, nil
+	}
+	if _, err := q.Order("-Time").Offset(offset).Limit(limit).GetAll(ctx, &result); err != nil {
+		return nil, 0, datastoreError(err)
+	}
+	return result, total, nil
+}
+
 func (db *gameDatabase) Last(r *http.Request, uid string) (*GameEntity, error) {
 	ctx := appengine.NewContext(r)
 
-	q := datastore.NewQuery("Game").Filter("UserID =", uid).Order("-Time").Limit(1)
+	q := datastore.NewQuery("Game").Filter("UserID =", uid).Order("-Time")
+	for t := q.Run(ctx); ; {
+		result := new(GameEntity)
+
+		_, err := t.Next(result)
+		if err == datastore.Done {
+			return nil, ErrGameNotFound
+		}
 
-	result := new(GameEntity)
-	t := q.Run(ctx)
+		if err != nil {
+			return nil, datastoreError(err)
+		}
 
-	_, err := t.Next(result)
-	if err == datastore.Done {
-		return nil, nil
+		if result.Completed() {
+			return result, nil
+		}
 	}
+}
 
-	if err != nil {
-		return nil, err
+func (db *gameDatabase) Leaderboard(r *http.Request, offset, limit int, by LeaderboardSort, cfg ScoreConfig) ([]LeaderboardEntry, int, error) {
+	ctx := appengine.NewContext(r)
+
+	var games []GameEntity
+	if _, err := datastore.NewQuery("Game").GetAll(ctx, &games); err != nil {
+		return nil, 0, datastoreError(err)
 	}
 
+	return newLeaderboard(games, by, offset, limit, cfg)
+}
+
+func (db *gameDatabase) ListAll(r *http.Request) ([]GameEntity, error) {
+	ctx := appengine.NewContext(r)
+
+	var games []GameEntity
+	if _, err := datastore.NewQuery("Game").GetAll(ctx, &games); err != nil {
+		return nil, datastoreError(err)
+	}
+
+	result := make([]GameEntity, 0, len(games))
+	for _, g := range games {
+		if g.Completed() {
+			result = append(result, g)
+		}
+	}
 	return result, nil
 }
+
+func (db *gameDatabase) Iterate(r *http.Request, since time.Time, fn func(GameEntity) error) error {
+	ctx := appengine.NewContext(r)
+
+	q := datastore.NewQuery("Game").Filter("Time >=", since).Order("Time")
+	for t := q.Run(ctx); ; {
+		var e GameEntity
+
+		_, err := t.Next(&e)
+		if err == datastore.Done {
+			return nil
+		}
+		if err != nil {
+			return datastoreError(err)
+		}
+
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+}
+
+func (db *gameDatabase) ListRecent(r *http.Request, limit int) ([]GameEntity, error) {
+	ctx := appengine.NewContext(r)
+
+	// Like in ListPage, games in progress can not be filtered by the query, so they
+	// are skipped here.
+	result := make([]GameEntity, 0, limit)
+	q := datastore.NewQuery("Game").Order("-Time")
+	for t := q.Run(ctx); len(result) < limit; {
+		var e GameEntity
+
+		_, err := t.Next(&e)
+		if err == datastore.Done {
+			break
+		}
+		if err != nil {
+			return nil, datastoreError(err)
+		}
+
+		if e.Completed() {
+			result = append(result, e)
+		}
+	}
+	return result, nil
+}
+
+// GetAnswerStats queries the games by the IDs of the questions of their answers, which
+// are indexed. The context of the request already is an App Engine context.
+func (db *gameDatabase) GetAnswerStats(ctx context.Context, questionID string, cfg ScoreConfig) (QuestionStats, error) {
+	var games []GameEntity
+	if _, err := datastore.NewQuery("Game").Filter("Answers.Question.ID =", questionID).GetAll(ctx, &games); err != nil {
+		return QuestionStats{}, datastoreError(err)
+	}
+
+	return answerStats(newQuestionStats(games, cfg), questionID), nil
+}
+
+func (db *gameDatabase) QuestionStats(r *http.Request, cfg ScoreConfig) (map[string]QuestionStats, error) {
+	ctx := appengine.NewContext(r)
+
+	var games []GameEntity
+	if _, err := datastore.NewQuery("Game").GetAll(ctx, &games); err != nil {
+		return nil, datastoreError(err)
+	}
+
+	return newQuestionStats(games, cfg), nil
+}
@@ -0,0 +1,332 @@
+package predictiongame
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSelectRandomSeeded(t *testing.T) {
+	first := NewQuestionDatabase(demoQuestionList(), rand.New(rand.NewSource(42)))
+	second := NewQuestionDatabase(demoQuestionList(), rand.New(rand.NewSource(42)))
+
+	for i := 0; i < 3; i++ {
+		a := first.SelectRandom(NumQuestions)
+		b := second.SelectRandom(NumQuestions)
+		if !reflect.DeepEqual(a, b) {
+			t.Fatalf("Selection %d differs for the same seed.", i)
+		}
+		if len(a) != NumQuestions {
+			t.Errorf("Expected %d questions, got %d", NumQuestions, len(a))
+		}
+	}
+}
+
+func TestSelectRandomUnique(t *testing.T) {
+	list := demoQuestionList()
+	list = append(list, list[:5]...)
+	db := NewQuestionDatabase(list, rand.New(rand.NewSource(1)))
+
+	for _, num := range []int{NumQuestions, len(list)} {
+		selected := db.SelectRandom(num)
+
+		ids := make(map[string]bool)
+		for _, q := range selected {
+			if ids[q.ID] {
+				t.Errorf("Duplicate question %q in selection of %d", q.ID, num)
+			}
+			ids[q.ID] = true
+		}
+
+		expected := num
+		if unique := len(demoQuestions); unique < num {
+			expected = unique
+		}
+		if len(selected) != expected {
+			t.Errorf("Expected %d questions, got %d", expected, len(selected))
+		}
+	}
+}
+
+func TestSelectDaily(t *testing.T) {
+	first := NewQuestionDatabase(demoQuestionList(), rand.New(rand.NewSource(1)))
+	second := NewQuestionDatabase(demoQuestionList(), rand.New(rand.NewSource(2)))
+
+	morning := time.Date(2016, 9, 17, 8, 0, 0, 0, time.UTC)
+	evening := time.Date(2016, 9, 17, 20, 0, 0, 0, time.UTC)
+	if !reflect.DeepEqual(first.SelectDaily(morning, NumQuestions), second.SelectDaily(evening, NumQuestions)) {
+		t.Error("Daily selection differs within the same day.")
+	}
+
+	if reflect.DeepEqual(first.SelectDaily(morning, NumQuestions), first.SelectDaily(morning.AddDate(0, 0, 1), NumQuestions)) {
+		t.Error("Daily selection is the same on consecutive days.")
+	}
+}
+
+func TestSelectRandomByTag(t *testing.T) {
+	list := demoQuestionList()
+	list[0].Tags = []string{"mountains"}
+	list[1].Tags = []string{"rivers", "water"}
+	list[2].Tags = []string{"countries"}
+	db := NewQuestionDatabase(list, nil)
+
+	selected := db.SelectRandomByTag(NumQuestions, "Mountains", "water")
+	if len(selected) != 2 {
+		t.Fatalf("Expected 2 questions, got %d", len(selected))
+	}
+	for _, q := range selected {
+		if !q.HasTag("mountains", "water") {
+			t.Errorf("Question %q does not have a requested tag.", q.Text)
+		}
+	}
+}
+
+func TestSelectRandomExcluding(t *testing.T) {
+	list := demoQuestionList()
+	db := NewQuestionDatabase(list, rand.New(rand.NewSource(1)))
+
+	var excluded []string
+	for _, q := range list[:len(list)-3] {
+		excluded = append(excluded, q.ID)
+	}
+	isExcluded := make(map[string]bool)
+	for _, id := range excluded {
+		isExcluded[id] = true
+	}
+
+	selected := db.SelectRandomExcluding(3, excluded)
+	if len(selected) != 3 {
+		t.Fatalf("Expected 3 questions, got %d", len(selected))
+	}
+	for _, q := range selected {
+		if isExcluded[q.ID] {
+			t.Errorf("Excluded question %q was selected.", q.ID)
+		}
+	}
+
+	selected = db.SelectRandomExcluding(5, excluded)
+	if len(selected) != 5 {
+		t.Fatalf("Expected excluded questions to fill up the selection, got %d", len(selected))
+	}
+	for _, q := range selected[3:] {
+		if !isExcluded[q.ID] {
+			t.Errorf("Expected the remaining questions to be excluded ones, got %q", q.ID)
+		}
+	}
+}
+
+func TestSelectRandomForUserExclusionWindow(t *testing.T) {
+	list := demoQuestionList()
+	questions := NewQuestionDatabase(list, rand.New(rand.NewSource(1)))
+	games := NewMemoryGameDatabase()
+	now := time.Date(2016, time.September, 18, 12, 0, 0, 0, time.UTC)
+	games.(*memoryGameDatabase).now = func() time.Time { return now }
+
+	// The user has answered two questions in each of four games; the oldest game is
+	// outside of the window of three games.
+	for i := 0; i < 4; i++ {
+		answers := []Answer{{Question: list[2*i]}, {Question: list[2*i+1]}}
+		if err := games.Save(nil, GameEntity{ID: fmt.Sprintf("game%d", i), UserID: "user", Answers: answers}); err != nil {
+			t.Fatalf("Can not save game: %s", err)
+		}
+		now = now.Add(time.Minute)
+	}
+
+	recent := map[string]bool{}
+	for _, q := range list[2:8] {
+		recent[q.ID] = true
+	}
+
+	num := len(list) - len(recent)
+	selected, err := SelectRandomForUser(nil, questions, games, "user", DefaultLanguage, num, DefaultQuestionExclusionWindow)
+	if err != nil {
+		t.Fatalf("Can not select questions: %s", err)
+	}
+	if len(selected) != num {
+		t.Fatalf("Expected %d questions, got %d", num, len(selected))
+	}
+	for _, q := range selected {
+		if recent[q.ID] {
+			t.Errorf("Question %q of the last %d games was repeated.", q.ID, DefaultQuestionExclusionWindow)
+		}
+	}
+}
+
+func TestSelectWeighted(t *testing.T) {
+	db := NewQuestionDatabase([]Question{
+		{ID: "heavy", Text: "Heavy", Enabled: true},
+		{ID: "light", Text: "Light", Enabled: true},
+		{ID: "zero", Text: "Zero", Enabled: true},
+		{ID: "disabled", Text: "Disabled"},
+	}, rand.New(rand.NewSource(1)))
+	weights := map[string]float64{"heavy": 1, "light": 1e-9, "disabled": 1}
+	weight := func(q Question) float64 { return weights[q.ID] }
+
+	for i := 0; i < 20; i++ {
+		if selected := db.SelectWeighted(1, weight); len(selected) != 1 || selected[0].ID != "heavy" {
+			t.Fatalf("Expected the heavy question, got %+v", selected)
+		}
+	}
+
+	selected := db.SelectWeighted(10, weight)
+	var ids []string
+	for _, q := range selected {
+		ids = append(ids, q.ID)
+	}
+	if !reflect.DeepEqual(ids, []string{"heavy", "light"}) {
+		t.Errorf("Expected only the enabled questions with a positive weight, got %v", ids)
+	}
+}
+
+func TestSelectRandomByLang(t *testing.T) {
+	list := demoQuestionList()
+	for i := range list[:4] {
+		list[i].Lang = "de"
+	}
+	db := NewQuestionDatabase(list, rand.New(rand.NewSource(1)))
+
+	if selected := db.SelectRandomByLang(NumQuestions, "de"); len(selected) != 4 {
+		t.Errorf("Expected the 4 German questions, got %d", len(selected))
+	} else {
+		for _, q := range selected {
+			if q.Lang != "de" {
+				t.Errorf("Expected German questions, got %q in %q", q.ID, q.Lang)
+			}
+		}
+	}
+
+	// Questions without a language are in DefaultLanguage.
+	for _, q := range db.SelectRandomByLang(len(list), DefaultLanguage) {
+		if q.Lang != "" {
+			t.Errorf("Expected questions in the default language, got %q in %q", q.ID, q.Lang)
+		}
+	}
+	if selected := db.SelectRandomByLang(NumQuestions, "fr"); len(selected) != 0 {
+		t.Errorf("Expected no questions in a missing language, got %d", len(selected))
+	}
+}
+
+func TestSelectRandomForUser(t *testing.T) {
+	list := demoQuestionList()
+	for i := range list[:6] {
+		list[i].Lang = "de"
+	}
+	questions := NewQuestionDatabase(list, rand.New(rand.NewSource(1)))
+
+	// A new user gets questions of the language.
+	selected, err := SelectRandomForUser(nil, questions, NewMockGameDatabase(), "user", "de", 3, DefaultQuestionExclusionWindow)
+	if err != nil || len(selected) != 3 {
+		t.Fatalf("Expected 3 questions, got %d (%v)", len(selected), err)
+	}
+	for _, q := range selected {
+		if q.Lang != "de" {
+			t.Errorf("Expected German questions for a new user, got %q", q.ID)
+		}
+	}
+
+	// With several languages the recent questions are weighted down in the language.
+	games := NewMockGameDatabase(WithListReturns([]GameEntity{
+		{Answers: []Answer{{Question: list[0]}, {Question: list[1]}}},
+	}, nil))
+	for i := 0; i < 10; i++ {
+		selected, err := SelectRandomForUser(nil, questions, games, "user", "de", 4, DefaultQuestionExclusionWindow)
+		if err != nil || len(selected) != 4 {
+			t.Fatalf("Expected 4 questions, got %d (%v)", len(selected), err)
+		}
+		for _, q := range selected {
+			if q.Lang != "de" || q.ID == list[0].ID || q.ID == list[1].ID {
+				t.Errorf("Expected new German questions, got %q", q.ID)
+			}
+		}
+	}
+
+	// The recent questions fill up the selection if there are not enough others.
+	if selected, _ := SelectRandomForUser(nil, questions, games, "user", "de", 6, DefaultQuestionExclusionWindow); len(selected) != 6 {
+		t.Errorf("Expected the recent questions to fill up the selection, got %d", len(selected))
+	}
+
+	failing := NewMockGameDatabase(WithListReturns(nil, errors.New("connection lost")))
+	if _, err := SelectRandomForUser(nil, questions, failing, "user", "de", 3, DefaultQuestionExclusionWindow); err == nil {
+		t.Errorf("Expected the error of the game database")
+	}
+}
+
+func TestSearch(t *testing.T) {
+	db := SeedDemoQuestions()
+
+	result, err := db.Search("HOW HIGH")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(result) != 2 {
+		t.Errorf("Expected 2 questions, got %d", len(result))
+	}
+
+	list := make([]Question, 0, 2*maxSearchResults)
+	for i := 0; i < 2*maxSearchResults; i++ {
+		list = append(list, Question{ID: fmt.Sprint(i), Text: "Question", Enabled: true})
+	}
+	if result, _ := NewQuestionDatabase(list, nil).Search("question"); len(result) != len(list) {
+		t.Errorf("Expected all %d questions, got %d", len(list), len(result))
+	}
+}
+
+func TestQuestionDatabaseConcurrentAccess(t *testing.T) {
+	db := NewQuestionDatabase(demoQuestionList(), rand.New(rand.NewSource(1)))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				db.SelectRandom(NumQuestions)
+				db.SelectRandomByTag(NumQuestions, "history")
+				db.SelectWeighted(NumQuestions, func(Question) float64 { return 1 })
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < 100; j++ {
+			list := demoQuestionList()
+			db.Reload(list)
+			if _, err := db.Add(Question{Text: fmt.Sprintf("Question %d", j), BoundLow: 0, BoundHigh: 10, Enabled: true}); err != nil {
+				t.Errorf("Error adding question: %s", err)
+			}
+			if err := db.Update(list[0].ID, list[0]); err != nil {
+				t.Errorf("Error updating question: %s", err)
+			}
+		}
+	}()
+
+	wg.Wait()
+}
+
+// BenchmarkSelectRandom selects a game's questions from databases of different sizes.
+// The selection only draws the questions it needs, so the time per selection should
+// barely grow with the size of the database.
+func BenchmarkSelectRandom(b *testing.B) {
+	for _, size := range []int{1000, 10000, 100000} {
+		list := make([]Question, size)
+		for i := range list {
+			list[i] = Question{ID: fmt.Sprint(i), Text: "Question", BoundLow: 0, BoundHigh: 10, Enabled: true}
+		}
+		db := NewQuestionDatabase(list, rand.New(rand.NewSource(1)))
+
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if selected := db.SelectRandom(NumQuestions); len(selected) != NumQuestions {
+					b.Fatalf("Expected %d questions, got %d", NumQuestions, len(selected))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package predictiongame
+
+// demoQuestion is a compact notation for the questions of the demo dataset.
+type demoQuestion struct {
+	text      string
+	low, high float64
+	unit      string
+	category  string
+}
+
+var demoQuestions = []demoQuestion{
+	{"How high is Mount Everest?", 8840, 8850, "Meters", "Geography"},
+	{"How long is the river Nile?", 6600, 6700, "Kilometers", "Geography"},
+	{"What is the area of Switzerland?", 41200, 41300, "Square kilometers", "Geography"},
+	{"How deep is the Mariana Trench at its deepest point?", 10900, 11000, "Meters", "Geography"},
+	{"How many countries are members of the United Nations?", 192, 194, "Countries", "Geography"},
+	{"How long is the Great Wall of China including all its branches?", 21000, 21200, "Kilometers", "Geography"},
+	{"In which year did the Berlin Wall fall?", 1988.5, 1989.5, "Year", "History"},
+	{"In which year was the first Gutenberg Bible printed?", 1452, 1456, "Year", "History"},
+	{"In which year did the Titanic sink?", 1911.5, 1912.5, "Year", "History"},
+	{"In which year was the Magna Carta sealed?", 1214.5, 1215.5, "Year", "History"},
+	{"How many years did the Hundred Years' War last?", 115, 117, "Years", "History"},
+	{"In which year did the first modern Olympic Games take place?", 1895.5, 1896.5, "Year", "History"},
+	{"What is the speed of light in vacuum?", 299700, 299800, "Kilometers per second", "Science"},
+	{"At which temperature does iron melt?", 1530, 1540, "Degrees Celsius", "Science"},
+	{"How many bones are in the adult human body?", 205, 207, "Bones", "Science"},
+	{"How many elements are in the periodic table?", 117, 119, "Elements", "Science"},
+	{"What is the average distance between the Earth and the Moon?", 384000, 385000, "Kilometers", "Science"},
+	{"How long does light from the Sun take to reach the Earth?", 490, 510, "Seconds", "Science"},
+	{"How many moons of Jupiter have been confirmed?", 90, 100, "Moons", "Science"},
+	{"What is the diameter of the Earth at the equator?", 12750, 12760, "Kilometers", "Science"},
+	{"How many keys does a standard piano have?", 87, 89, "Keys", "Culture"},
+	{"How many symphonies did Beethoven complete?", 8.5, 9.5, "Symphonies", "Culture"},
+	{"How many plays are attributed to William Shakespeare?", 37, 39, "Plays", "Culture"},
+	{"How many squares are on a chess board?", 63, 65, "Squares", "Culture"},
+	{"How many official languages does the European Union have?", 23, 25, "Languages", "Culture"},
+	{"How long is a marathon?", 42100, 42300, "Meters", "Sports"},
+	{"How many players are on the field for one team in a football (soccer) match?", 10.5, 11.5, "Players", "Sports"},
+	{"How high is a basketball hoop?", 3.0, 3.1, "Meters", "Sports"},
+	{"How long is an Olympic swimming pool?", 49.9, 50.1, "Meters", "Sports"},
+	{"How many dimples does a typical golf ball have?", 300, 500, "Dimples", "Sports"},
+}
+
+// SeedDemoQuestions returns a small in-memory database of well-formed questions.
+// It can be used for local runs without a question file and as a test fixture.
+func SeedDemoQuestions() QuestionDatabase {
+	return NewQuestionDatabase(demoQuestionList(), nil)
+}
+
+func demoQuestionList() []Question {
+	result := make([]Question, 0, len(demoQuestions))
+	for _, d := range demoQuestions {
+		result = append(result, Question{
+			ID:        questionID(d.text),
+			Text:      d.text,
+			Unit:      d.unit,
+			Category:  d.category,
+			BoundLow:  d.low,
+			BoundHigh: d.high,
+			Enabled:   true,
+		})
+	}
+
+	return result
+}
@@ -0,0 +1,24 @@
+package predictiongame
+
+import "testing"
+
+func TestSeedDemoQuestions(t *testing.T) {
+	db := demoQuestionList()
+	if len(db) == 0 {
+		t.Fatal("Demo database is empty.")
+	}
+
+	ids := make(map[string]bool)
+	for _, q := range db {
+		if q.BoundLow >= q.BoundHigh {
+			t.Errorf("Question %q has invalid bounds: %g >= %g", q.Text, q.BoundLow, q.BoundHigh)
+		}
+		if q.Unit == "" || q.Category == "" {
+			t.Errorf("Question %q is missing unit or category.", q.Text)
+		}
+		if ids[q.ID] {
+			t.Errorf("Duplicate question ID %q", q.ID)
+		}
+		ids[q.ID] = true
+	}
+}
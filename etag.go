@@ -0,0 +1,81 @@
+package predictiongame
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// computeETag returns a strong ETag for the JSON representation of value.
+func computeETag(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+
+	sum := sha1.Sum(data)
+	return `"` + hex.EncodeToString(sum[:10]) + `"`
+}
+
+// etagMatches returns true if the If-None-Match header of the request matches tag.
+func etagMatches(r *http.Request, tag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" || tag == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == tag || candidate == "*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// etagCache remembers the ETags of responses as long as the question database is not modified,
+// so requests for unchanged content can be answered without querying the database.
+type etagCache struct {
+	mu      sync.Mutex
+	version uint64
+	tags    map[string]string
+}
+
+func (c *etagCache) get(version uint64, key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.tags == nil || c.version != version {
+		return "", false
+	}
+
+	tag, ok := c.tags[key]
+	return tag, ok
+}
+
+func (c *etagCache) put(version uint64, key, tag string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.tags == nil || c.version != version {
+		c.version = version
+		c.tags = make(map[string]string)
+	}
+
+	c.tags[key] = tag
+}
+
+// notModified writes a 304 response if the request matches tag and reports whether it did.
+func notModified(w http.ResponseWriter, r *http.Request, tag string) bool {
+	if !etagMatches(r, tag) {
+		return false
+	}
+
+	w.Header().Set("ETag", tag)
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
@@ -0,0 +1,141 @@
+package predictiongame
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// countingQuestionDatabase counts the queries for single questions and the question count.
+type countingQuestionDatabase struct {
+	QuestionDatabase
+	queries int
+}
+
+func (db *countingQuestionDatabase) GetByID(id string) (Question, error) {
+	db.queries++
+	return db.QuestionDatabase.GetByID(id)
+}
+
+func (db *countingQuestionDatabase) List(offset, limit int) ([]Question, int) {
+	db.queries++
+	return db.QuestionDatabase.List(offset, limit)
+}
+
+func TestQuestionETag(t *testing.T) {
+	id := demoQuestionList()[0].ID
+	for _, target := range []string{"/api/questions/" + id, "/api/questions/count"} {
+		db := &countingQuestionDatabase{QuestionDatabase: SeedDemoQuestions()}
+		etags := &etagCache{}
+		handler := questionByIDHandler(db, NewMockGameDatabase(), etags, defaultHandlerOptions())
+		if target == "/api/questions/count" {
+			handler = questionCountHandler(db, etags)
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		tag := w.Header().Get("ETag")
+		if w.Code != http.StatusOK || tag == "" {
+			t.Fatalf("%s: expected status %d with ETag, got %d %q", target, http.StatusOK, w.Code, tag)
+		}
+
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r.Header.Set("If-None-Match", tag)
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != http.StatusNotModified {
+			t.Errorf("%s: expected status %d, got %d", target, http.StatusNotModified, w.Code)
+		}
+		if db.queries != 1 {
+			t.Errorf("%s: expected 1 database query, got %d", target, db.queries)
+		}
+
+		// Modifying the database invalidates the cached ETags.
+		db.Add(Question{Text: "New question?", BoundLow: 1, BoundHigh: 2, Enabled: true})
+		q, _ := db.QuestionDatabase.GetByID(id)
+		q.Text = "Changed?"
+		db.Update(id, q)
+
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != http.StatusOK || w.Header().Get("ETag") == tag {
+			t.Errorf("%s: expected new content after modification, got %d %q", target, w.Code, w.Header().Get("ETag"))
+		}
+	}
+}
+
+func TestGameQuestionsETag(t *testing.T) {
+	questions := SeedDemoQuestions()
+	games := NewMemoryGameDatabase()
+	handler := gameQuestionsHandler(questions, games, defaultHandlerOptions())
+
+	get := func(tag string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/api/questions/game/game", nil)
+		if tag != "" {
+			r.Header.Set("If-None-Match", tag)
+		}
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	first := get("")
+	tag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || tag == "" {
+		t.Fatalf("Expected status %d with ETag, got %d %q", http.StatusOK, first.Code, tag)
+	}
+	if second := get(""); second.Body.String() != first.Body.String() {
+		t.Error("Expected the same questions for the same game.")
+	}
+	if w := get(tag); w.Code != http.StatusNotModified {
+		t.Errorf("Expected status %d, got %d", http.StatusNotModified, w.Code)
+	}
+
+	// Answering a question which was not selected changes the stored set.
+	var answered Question
+	for _, q := range demoQuestionList() {
+		if !strings.Contains(first.Body.String(), q.ID) {
+			answered = q
+			break
+		}
+	}
+	if err := games.SaveProgress(nil, "game", "", []Answer{{Question: answered}}); err != nil {
+		t.Fatalf("Can not save progress: %s", err)
+	}
+	if w := get(tag); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), answered.ID) {
+		t.Errorf("Expected the stored questions with status %d, got %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestGameQuestionsMatchPlayPage(t *testing.T) {
+	templ, err := loadTemplates()
+	if err != nil {
+		t.Fatalf("Can not load templates: %s", err)
+	}
+
+	games := NewMemoryGameDatabase()
+	handler := NewHandler(templ, SeedDemoQuestions(), games, WithNumQuestions(3), WithSessionSecret(testSessionSecret))
+
+	r := httptest.NewRequest(http.MethodGet, "/play/game", nil)
+	addIdentity(r, "user")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	page := w.Body.String()
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/questions/game/game", nil))
+	var selected []Question
+	if err := json.NewDecoder(w.Body).Decode(&selected); err != nil || len(selected) != 3 {
+		t.Fatalf("Unexpected questions %+v (%v)", selected, err)
+	}
+	for _, q := range selected {
+		if !strings.Contains(page, q.ID) {
+			t.Errorf("Expected question %s on the play page", q.ID)
+		}
+	}
+}
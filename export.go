@@ -0,0 +1,207 @@
+package predictiongame
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// gameCSVHeader contains the columns of the CSV export of a game.
+var gameCSVHeader = []string{"question_text", "lower_bound", "upper_bound", "true_low", "true_high", "correct", "score"}
+
+func formatCSVFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// serveGameCSV writes the answers of a game as a CSV file for spreadsheet tools.
+func serveGameCSV(w http.ResponseWriter, r *http.Request, db GameDatabase, id string, cfg ScoreConfig) {
+	if !validID(id) {
+		http.Error(w, "Invalid game ID", http.StatusBadRequest)
+		return
+	}
+
+	game, err := db.Get(r, id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Game can not be loaded: %s", err), gameErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="game-%s.csv"`, id))
+
+	cw := csv.NewWriter(w)
+	cw.Write(gameCSVHeader)
+	for _, a := range game.Answers {
+		low, high := a.Question.correctRange()
+		cw.Write([]string{
+			a.Question.Text,
+			formatCSVFloat(a.LowerBound),
+			formatCSVFloat(a.UpperBound),
+			formatCSVFloat(low),
+			formatCSVFloat(high),
+			strconv.FormatBool(a.CorrectWith(cfg)),
+			formatCSVFloat(a.ScoreWith(cfg)),
+		})
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		requestLogger(r).Error("Error writing CSV export", "game", id, "error", err)
+	}
+}
+
+// exportPageSize is the number of games loaded at once for the export of a user.
+const exportPageSize = 100
+
+// serveUserExport writes all completed games and the statistics of a user as one JSON
+// object with the fields user_id, export_time, stats and games. The games are loaded
+// and encoded page by page, so long histories are not held in memory. Only the user
+// can export their games.
+func serveUserExport(w http.ResponseWriter, r *http.Request, db GameDatabase, uid string, opts handlerOptions) {
+	if !validID(uid) {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if !opts.hasIdentity(r, uid) {
+		http.Error(w, "Games of other users can not be exported", http.StatusForbidden)
+		return
+	}
+
+	stats, err := loadUserStats(r, db, uid, time.Time{}, opts.scoring)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Stats can not be loaded: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	// The first page is loaded before writing, so the status can still report errors.
+	first, total, err := db.ListPage(r, uid, 0, exportPageSize)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Game list can not be loaded: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="user-%s.json"`, uid))
+	w.Header().Set("Cache-Control", "private, no-cache")
+
+	games := func(fn func(GameEntity) error) error {
+		page := first
+		for offset := 0; offset < total && len(page) > 0; offset += len(page) {
+			if offset > 0 {
+				if page, _, err = db.ListPage(r, uid, offset, exportPageSize); err != nil {
+					return err
+				}
+			}
+			for _, g := range page {
+				if err := fn(g); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	if err := writeUserExport(w, uid, time.Now().UTC(), stats, games); err != nil {
+		opts.logger.Error("Error writing export", "user", uid, "error", err)
+	}
+}
+
+// writeUserExport writes the export of a user, calling games to encode each of them.
+func writeUserExport(w io.Writer, uid string, exportTime time.Time, stats UserStats, games func(func(GameEntity) error) error) error {
+	enc := json.NewEncoder(w)
+	fields := []struct {
+		prefix string
+		value  interface{}
+	}{
+		{`{"user_id":`, uid},
+		{`,"export_time":`, exportTime},
+		{`,"stats":`, stats},
+	}
+	for _, f := range fields {
+		if _, err := io.WriteString(w, f.prefix); err != nil {
+			return err
+		}
+		if err := enc.Encode(f.value); err != nil {
+			return err
+		}
+	}
+
+	if _, err := io.WriteString(w, `,"games":[`); err != nil {
+		return err
+	}
+	i := 0
+	err := games(func(g GameEntity) error {
+		if i > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		i++
+		return enc.Encode(g)
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "]}\n")
+	return err
+}
+
+// exportFlushInterval is the number of games after which the NDJSON export is flushed
+// to the client.
+const exportFlushInterval = 100
+
+// adminExportGamesHandler streams all games as newline-delimited JSON, oldest first.
+// The since query parameter, an RFC 3339 timestamp, restricts the export to the games
+// saved at or after it, so an interrupted export can be resumed from the time of the
+// last game received.
+func adminExportGamesHandler(db GameDatabase) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var since time.Time
+		if raw := r.URL.Query().Get("since"); raw != "" {
+			var err error
+			since, err = time.Parse(time.RFC3339Nano, raw)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid since: %s", err), http.StatusBadRequest)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="games.ndjson"`)
+
+		flusher, _ := w.(http.Flusher)
+		enc := json.NewEncoder(w)
+		n := 0
+		err := db.Iterate(r, since, func(g GameEntity) error {
+			if err := enc.Encode(g); err != nil {
+				return err
+			}
+
+			n++
+			if flusher != nil && n%exportFlushInterval == 0 {
+				flusher.Flush()
+			}
+			return nil
+		})
+		if err != nil {
+			// Once games have been written, the status can not be changed anymore.
+			if n == 0 {
+				http.Error(w, fmt.Sprintf("Games can not be loaded: %s", err), gameErrorStatus(err))
+				return
+			}
+			requestLogger(r).Error("Error writing export of all games", "games", n, "error", err)
+		}
+	})
+}
@@ -0,0 +1,158 @@
+package predictiongame
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGameCSVExport(t *testing.T) {
+	games := NewMemoryGameDatabase()
+	q := Question{ID: "q", Text: "How many, roughly?", BoundLow: 10, BoundHigh: 20}
+	answers := []Answer{
+		{Question: q, LowerBound: 15, UpperBound: 30},
+		{Question: q, LowerBound: 1, UpperBound: 2.5},
+	}
+	if err := games.Save(nil, GameEntity{ID: "game", UserID: "user", Answers: answers}); err != nil {
+		t.Fatalf("Can not save game: %s", err)
+	}
+
+	w := httptest.NewRecorder()
+	apiGameHandler(SeedDemoQuestions(), games, defaultHandlerOptions()).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/game/game/export.csv", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if cd := w.Header().Get("Content-Disposition"); cd != `attachment; filename="game-game.csv"` {
+		t.Errorf("Unexpected Content-Disposition %q", cd)
+	}
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Can not parse CSV: %s", err)
+	}
+	expected := [][]string{
+		gameCSVHeader,
+		{"How many, roughly?", "15", "30", "10", "20", "true", "1"},
+		{"How many, roughly?", "1", "2.5", "10", "20", "false", "0"},
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("Expected %q, got %q", expected, records)
+	}
+
+	w = httptest.NewRecorder()
+	apiGameHandler(SeedDemoQuestions(), games, defaultHandlerOptions()).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/game/missing/export.csv", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for a missing game, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestUserExport(t *testing.T) {
+	games := NewMemoryGameDatabase()
+	q := Question{ID: "q", Text: "How many?", BoundLow: 10, BoundHigh: 20}
+	// The games do not fit on one page.
+	n := exportPageSize + 1
+	for i := 0; i < n; i++ {
+		if err := games.Save(nil, GameEntity{ID: fmt.Sprintf("game-%d", i), UserID: "user", Answers: []Answer{{Question: q, LowerBound: 15, UpperBound: 30}}}); err != nil {
+			t.Fatalf("Can not save game: %s", err)
+		}
+	}
+	handler := userAPIHandler(games, newHandlerOptions(WithSessionSecret(testSessionSecret)))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/user/user/export.json", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d without the identity of the user, got %d", http.StatusForbidden, w.Code)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/user/user/export.json", nil)
+	addIdentity(r, "user")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if cd := w.Header().Get("Content-Disposition"); cd != `attachment; filename="user-user.json"` {
+		t.Errorf("Unexpected Content-Disposition %q", cd)
+	}
+
+	var export struct {
+		UserID     string       `json:"user_id"`
+		ExportTime time.Time    `json:"export_time"`
+		Stats      UserStats    `json:"stats"`
+		Games      []GameEntity `json:"games"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&export); err != nil {
+		t.Fatalf("Can not decode export: %s", err)
+	}
+	if export.UserID != "user" || export.ExportTime.IsZero() {
+		t.Errorf("Unexpected user ID %q or export time %v", export.UserID, export.ExportTime)
+	}
+	if export.Stats.Games != n || export.Stats.Correct != n {
+		t.Errorf("Unexpected stats %+v", export.Stats)
+	}
+	if len(export.Games) != n || len(export.Games[0].Answers) != 1 {
+		t.Errorf("Expected %d games with one answer each, got %d", n, len(export.Games))
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/user/a%20b/export.json", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid user ID, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestAdminExportGamesHandler(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	db := NewMockGameDatabase(WithListReturns([]GameEntity{
+		{ID: "first", UserID: "user", Time: start, Status: GameCompleted},
+		{ID: "second", UserID: "user", Time: start.Add(time.Hour), Status: GameInProgress},
+	}, nil))
+	handler := adminExportGamesHandler(db)
+
+	for _, tc := range []struct {
+		query    string
+		status   int
+		expected []string
+	}{
+		{"", http.StatusOK, []string{"first", "second"}},
+		{"?since=2024-01-01T00:30:00Z", http.StatusOK, []string{"second"}},
+		{"?since=yesterday", http.StatusBadRequest, nil},
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/export/games.ndjson"+tc.query, nil))
+		if w.Code != tc.status {
+			t.Errorf("%q: expected status %d, got %d", tc.query, tc.status, w.Code)
+			continue
+		}
+		if tc.status != http.StatusOK {
+			continue
+		}
+
+		if contentType := w.Header().Get("Content-Type"); contentType != "application/x-ndjson" {
+			t.Errorf("%q: unexpected Content-Type %q", tc.query, contentType)
+		}
+		var ids []string
+		dec := json.NewDecoder(w.Body)
+		for dec.More() {
+			var g GameEntity
+			if err := dec.Decode(&g); err != nil {
+				t.Fatalf("%q: invalid NDJSON: %s", tc.query, err)
+			}
+			ids = append(ids, g.ID)
+		}
+		if !reflect.DeepEqual(ids, tc.expected) {
+			t.Errorf("%q: expected %v, got %v", tc.query, tc.expected, ids)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	adminExportGamesHandler(NewMockGameDatabase(WithListReturns(nil, ErrCircuitOpen))).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/export/games.ndjson", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d when the database is unavailable, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+}
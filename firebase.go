@@ -0,0 +1,221 @@
+package predictiongame
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// firebaseCertsURL is the URL of the certificates whose keys sign the Firebase ID tokens.
+const firebaseCertsURL = "https://www.googleapis.com/robot/v1/metadata/x509/securetoken@system.gserviceaccount.com"
+
+// firebaseIssuer is the issuer of the ID tokens of a Firebase project without its ID.
+const firebaseIssuer = "https://securetoken.google.com/"
+
+// firebaseCertsMaxAge is how long the certificates are cached if the response does not
+// say how long they are valid.
+const firebaseCertsMaxAge = time.Hour
+
+// firebaseClockSkew is how far the clocks of the server and Firebase may differ.
+const firebaseClockSkew = 5 * time.Minute
+
+// FirebaseTokenVerifier is a TokenVerifier for the ID tokens of Firebase Authentication,
+// including the ones of anonymous users, which the clients get with getIdToken.
+type FirebaseTokenVerifier struct {
+	// ProjectID is the ID of the Firebase project the tokens are issued by.
+	ProjectID string
+	// Client loads the certificates. http.DefaultClient is used if it is nil.
+	Client *http.Client
+	// CertsURL is the URL of the certificates, which is the one of Google by default.
+	CertsURL string
+
+	now     func() time.Time
+	mu      sync.Mutex
+	keys    map[string]*rsa.PublicKey
+	expires time.Time
+}
+
+// NewFirebaseTokenVerifier returns a verifier for the ID tokens of the Firebase project.
+func NewFirebaseTokenVerifier(projectID string) *FirebaseTokenVerifier {
+	return &FirebaseTokenVerifier{ProjectID: projectID}
+}
+
+// firebaseTokenHeader is the header of an ID token.
+type firebaseTokenHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+// firebaseTokenClaims are the claims of an ID token which are verified.
+type firebaseTokenClaims struct {
+	Audience  string `json:"aud"`
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// Verify returns the ID of the user the token was issued to if it is signed by Firebase
+// for the project and has not expired.
+func (v *FirebaseTokenVerifier) Verify(ctx context.Context, token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", errors.New("token is not a JWT")
+	}
+
+	var header firebaseTokenHeader
+	if err := decodeTokenPart(parts[0], &header); err != nil {
+		return "", fmt.Errorf("invalid token header: %s", err)
+	}
+	if header.Algorithm != "RS256" {
+		return "", fmt.Errorf("unexpected algorithm %q", header.Algorithm)
+	}
+
+	key, err := v.key(ctx, header.KeyID)
+	if err != nil {
+		return "", err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("invalid token signature: %s", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return "", fmt.Errorf("invalid token signature: %s", err)
+	}
+
+	var claims firebaseTokenClaims
+	if err := decodeTokenPart(parts[1], &claims); err != nil {
+		return "", fmt.Errorf("invalid token claims: %s", err)
+	}
+
+	now := v.clock()
+	switch {
+	case claims.Audience != v.ProjectID:
+		return "", fmt.Errorf("token is issued for project %q", claims.Audience)
+	case claims.Issuer != firebaseIssuer+v.ProjectID:
+		return "", fmt.Errorf("token is issued by %q", claims.Issuer)
+	case claims.Subject == "":
+		return "", errors.New("token has no subject")
+	case now.After(time.Unix(claims.ExpiresAt, 0).Add(firebaseClockSkew)):
+		return "", errors.New("token has expired")
+	case now.Add(firebaseClockSkew).Before(time.Unix(claims.IssuedAt, 0)):
+		return "", errors.New("token is issued in the future")
+	}
+
+	return claims.Subject, nil
+}
+
+// decodeTokenPart decodes a base64 encoded JSON part of a JWT.
+func decodeTokenPart(part string, v interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+func (v *FirebaseTokenVerifier) clock() time.Time {
+	if v.now != nil {
+		return v.now()
+	}
+	return time.Now()
+}
+
+// key returns the public key with the ID, loading the certificates again if they have
+// expired.
+func (v *FirebaseTokenVerifier) key(ctx context.Context, id string) (*rsa.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.keys == nil || v.clock().After(v.expires) {
+		keys, maxAge, err := v.loadKeys(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("certificates can not be loaded: %s", err)
+		}
+		v.keys, v.expires = keys, v.clock().Add(maxAge)
+	}
+
+	key, ok := v.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", id)
+	}
+	return key, nil
+}
+
+// loadKeys loads the certificates and returns their public keys by ID and how long they
+// can be cached.
+func (v *FirebaseTokenVerifier) loadKeys(ctx context.Context) (map[string]*rsa.PublicKey, time.Duration, error) {
+	certsURL, client := v.CertsURL, v.Client
+	if certsURL == "" {
+		certsURL = firebaseCertsURL
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, certsURL, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var certs map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&certs); err != nil {
+		return nil, 0, err
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(certs))
+	for id, cert := range certs {
+		block, _ := pem.Decode([]byte(cert))
+		if block == nil {
+			return nil, 0, fmt.Errorf("certificate %q is not PEM encoded", id)
+		}
+		parsed, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, 0, fmt.Errorf("certificate %q: %s", id, err)
+		}
+		key, ok := parsed.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, 0, fmt.Errorf("certificate %q has no RSA key", id)
+		}
+		keys[id] = key
+	}
+
+	return keys, cacheMaxAge(resp.Header.Get("Cache-Control")), nil
+}
+
+// cacheMaxAge returns the max-age of a Cache-Control header or firebaseCertsMaxAge.
+func cacheMaxAge(cacheControl string) time.Duration {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(directive), "=")
+		if !ok || !strings.EqualFold(name, "max-age") {
+			continue
+		}
+		if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	return firebaseCertsMaxAge
+}
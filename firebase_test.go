@@ -0,0 +1,105 @@
+package predictiongame
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// signTestToken returns a JWT with the claims signed by the key.
+func signTestToken(t *testing.T, key *rsa.PrivateKey, kid string, claims firebaseTokenClaims) string {
+	t.Helper()
+
+	header, _ := json.Marshal(firebaseTokenHeader{Algorithm: "RS256", KeyID: kid})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestFirebaseTokenVerifier(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "securetoken"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		loads++
+		w.Header().Set("Cache-Control", "public, max-age=600")
+		writeJSON(w, r, map[string]string{"kid": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))})
+	}))
+	defer server.Close()
+
+	now := time.Unix(1700000000, 0)
+	v := NewFirebaseTokenVerifier("project")
+	v.CertsURL = server.URL
+	v.now = func() time.Time { return now }
+
+	valid := firebaseTokenClaims{
+		Audience:  "project",
+		Issuer:    firebaseIssuer + "project",
+		Subject:   "user",
+		IssuedAt:  now.Add(-time.Minute).Unix(),
+		ExpiresAt: now.Add(time.Hour).Unix(),
+	}
+	if uid, err := v.Verify(context.Background(), signTestToken(t, key, "kid", valid)); err != nil || uid != "user" {
+		t.Errorf("Expected user, got %q (%v)", uid, err)
+	}
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, token := range map[string]string{
+		"not a JWT":     "token",
+		"unknown key":   signTestToken(t, key, "other", valid),
+		"other signer":  signTestToken(t, other, "kid", valid),
+		"other project": signTestToken(t, key, "kid", firebaseTokenClaims{Audience: "other", Issuer: valid.Issuer, Subject: "user", IssuedAt: valid.IssuedAt, ExpiresAt: valid.ExpiresAt}),
+		"other issuer":  signTestToken(t, key, "kid", firebaseTokenClaims{Audience: "project", Issuer: firebaseIssuer + "other", Subject: "user", IssuedAt: valid.IssuedAt, ExpiresAt: valid.ExpiresAt}),
+		"no subject":    signTestToken(t, key, "kid", firebaseTokenClaims{Audience: "project", Issuer: valid.Issuer, IssuedAt: valid.IssuedAt, ExpiresAt: valid.ExpiresAt}),
+		"expired":       signTestToken(t, key, "kid", firebaseTokenClaims{Audience: "project", Issuer: valid.Issuer, Subject: "user", IssuedAt: valid.IssuedAt, ExpiresAt: now.Add(-time.Hour).Unix()}),
+	} {
+		if uid, err := v.Verify(context.Background(), token); err == nil {
+			t.Errorf("%s: expected an error, got %q", name, uid)
+		}
+	}
+
+	if loads != 1 {
+		t.Errorf("Expected the certificates to be loaded once, got %d", loads)
+	}
+	now = now.Add(11 * time.Minute)
+	if _, err := v.Verify(context.Background(), signTestToken(t, key, "kid", valid)); err != nil {
+		t.Errorf("Expected the token to be valid, got %v", err)
+	}
+	if loads != 2 {
+		t.Errorf("Expected the expired certificates to be loaded again, got %d loads", loads)
+	}
+}
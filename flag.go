@@ -0,0 +1,291 @@
+package predictiongame
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/datastore"
+)
+
+// QuestionFlag is a report of a user that a question is wrong or outdated.
+type QuestionFlag struct {
+	QuestionID string `json:"questionId"`
+	Reason     string `json:"reason" datastore:",noindex"`
+	// UserID is the verified user who flagged the question.
+	UserID string    `json:"uid"`
+	Time   time.Time `json:"time"`
+}
+
+// ErrDuplicateFlag is returned when a user flags a question again.
+var ErrDuplicateFlag = errors.New("question has been flagged by the user already")
+
+// FlagDatabase is the interface for the database containing the flags of the questions.
+type FlagDatabase interface {
+	// Add stores the flag or returns ErrDuplicateFlag if its user has flagged the
+	// question already.
+	Add(r *http.Request, f QuestionFlag) error
+	// List returns all flags, oldest first.
+	List(r *http.Request) ([]QuestionFlag, error)
+	// Clear deletes the flags of a question once they have been dealt with and returns
+	// how many there were.
+	Clear(r *http.Request, questionID string) (int, error)
+}
+
+type memoryFlagDatabase struct {
+	mu    sync.RWMutex
+	flags []QuestionFlag
+}
+
+// NewFlagDatabase returns an in-memory FlagDatabase which can be used concurrently.
+func NewFlagDatabase() FlagDatabase {
+	return &memoryFlagDatabase{}
+}
+
+func (db *memoryFlagDatabase) Add(r *http.Request, f QuestionFlag) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, existing := range db.flags {
+		if existing.QuestionID == f.QuestionID && existing.UserID == f.UserID {
+			return ErrDuplicateFlag
+		}
+	}
+
+	db.flags = append(db.flags, f)
+	return nil
+}
+
+func (db *memoryFlagDatabase) List(r *http.Request) ([]QuestionFlag, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return append([]QuestionFlag(nil), db.flags...), nil
+}
+
+func (db *memoryFlagDatabase) Clear(r *http.Request, questionID string) (int, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	kept := db.flags[:0]
+	for _, f := range db.flags {
+		if f.QuestionID != questionID {
+			kept = append(kept, f)
+		}
+	}
+
+	cleared := len(db.flags) - len(kept)
+	db.flags = kept
+	return cleared, nil
+}
+
+// flagDatabase is the FlagDatabase storing the flags in the datastore of App Engine. A
+// flag is keyed by its question and user, so every user can flag a question once.
+type flagDatabase struct{}
+
+func flagKey(ctx context.Context, f QuestionFlag) *datastore.Key {
+	return datastore.NewKey(ctx, "QuestionFlag", f.QuestionID+"/"+f.UserID, 0, nil)
+}
+
+func (db *flagDatabase) Add(r *http.Request, f QuestionFlag) error {
+	ctx := appengine.NewContext(r)
+
+	k := flagKey(ctx, f)
+	return datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		var existing QuestionFlag
+		err := datastore.Get(ctx, k, &existing)
+		if err == nil {
+			return ErrDuplicateFlag
+		}
+		if err != datastore.ErrNoSuchEntity {
+			return err
+		}
+
+		_, err = datastore.Put(ctx, k, &f)
+		return err
+	}, nil)
+}
+
+func (db *flagDatabase) List(r *http.Request) ([]QuestionFlag, error) {
+	ctx := appengine.NewContext(r)
+
+	result := []QuestionFlag{}
+	if _, err := datastore.NewQuery("QuestionFlag").Order("Time").GetAll(ctx, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (db *flagDatabase) Clear(r *http.Request, questionID string) (int, error) {
+	ctx := appengine.NewContext(r)
+
+	keys, err := datastore.NewQuery("QuestionFlag").Filter("QuestionID =", questionID).KeysOnly().GetAll(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	if err := datastore.DeleteMulti(ctx, keys); err != nil {
+		return 0, err
+	}
+	return len(keys), nil
+}
+
+// maxFlagReasonLength is the maximum length of the reason of a flag in characters.
+const maxFlagReasonLength = 500
+
+// validateUserText returns a text written by a user, like the reason of a flag, without
+// surrounding white space or an error if it is empty, longer than maxLength characters
+// or contains control characters other than line breaks.
+func validateUserText(text string, maxLength int) (string, error) {
+	text = strings.TrimSpace(text)
+	switch {
+	case text == "":
+		return "", errors.New("text is empty")
+	case !utf8.ValidString(text):
+		return "", errors.New("text is not valid UTF-8")
+	case utf8.RuneCountInString(text) > maxLength:
+		return "", fmt.Errorf("text is longer than %d characters", maxLength)
+	}
+
+	for _, c := range text {
+		if unicode.IsControl(c) && c != '\n' {
+			return "", fmt.Errorf("text contains the control character %U", c)
+		}
+	}
+
+	return text, nil
+}
+
+// serveQuestionFlag stores the flag posted for a question as JSON with the field reason.
+// Only verified users can flag questions, each of them once.
+func serveQuestionFlag(w http.ResponseWriter, r *http.Request, questions QuestionDatabase, id string, opts handlerOptions) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	defer r.Body.Close()
+
+	uid, ok := opts.userID(r)
+	if !ok {
+		http.Error(w, "Only signed in users can flag questions", http.StatusForbidden)
+		return
+	}
+
+	q, err := questions.GetByID(id)
+	if err == nil && q.Pending {
+		err = ErrQuestionNotFound
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Question %q can not be loaded: %s", id, err), http.StatusNotFound)
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, opts.maxBodyBytes)).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Error parsing flag: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	reason, err := validateUserText(req.Reason, maxFlagReasonLength)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid reason: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	flag := QuestionFlag{QuestionID: q.ID, Reason: reason, UserID: uid, Time: time.Now()}
+	if err := opts.flags.Add(r, flag); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrDuplicateFlag) {
+			status = http.StatusConflict
+		}
+		http.Error(w, fmt.Sprintf("Error saving flag: %s", err), status)
+		return
+	}
+
+	writeJSONStatus(w, r, http.StatusAccepted, flag)
+}
+
+// flaggedQuestion is a question with its flags in the response of /admin/questions/flags.
+type flaggedQuestion struct {
+	// Question is nil if the question has been deleted since it was flagged.
+	Question *Question      `json:"question"`
+	Flags    []QuestionFlag `json:"flags"`
+}
+
+// adminFlagsHandler lists the flagged questions with their flags for review, the most
+// flagged questions first. A DELETE with the query parameter question clears the flags
+// of the question once they have been dealt with.
+func adminFlagsHandler(questions QuestionDatabase, flags FlagDatabase) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodDelete:
+			clearFlags(w, r, flags, r.URL.Query().Get("question"))
+			return
+		default:
+			w.Header().Set("Allow", "GET, DELETE")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		all, err := flags.List(r)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Flags can not be loaded: %s", err), http.StatusInternalServerError)
+			return
+		}
+
+		byQuestion := make(map[string]int)
+		result := []flaggedQuestion{}
+		for _, f := range all {
+			i, ok := byQuestion[f.QuestionID]
+			if !ok {
+				i = len(result)
+				byQuestion[f.QuestionID] = i
+
+				entry := flaggedQuestion{}
+				if q, err := questions.GetByID(f.QuestionID); err == nil {
+					entry.Question = &q
+				}
+				result = append(result, entry)
+			}
+			result[i].Flags = append(result[i].Flags, f)
+		}
+
+		sort.SliceStable(result, func(i, j int) bool {
+			return len(result[i].Flags) > len(result[j].Flags)
+		})
+		writeJSON(w, r, result)
+	})
+}
+
+// clearedFlags is the response of DELETE /admin/questions/flags.
+type clearedFlags struct {
+	QuestionID string `json:"questionId"`
+	Cleared    int    `json:"cleared"`
+}
+
+func clearFlags(w http.ResponseWriter, r *http.Request, flags FlagDatabase, questionID string) {
+	if questionID == "" {
+		http.Error(w, "Missing question parameter", http.StatusBadRequest)
+		return
+	}
+
+	n, err := flags.Clear(r, questionID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Flags can not be cleared: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, clearedFlags{QuestionID: questionID, Cleared: n})
+}
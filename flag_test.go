@@ -0,0 +1,83 @@
+package predictiongame
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestQuestionFlagHandler(t *testing.T) {
+	questions := SeedDemoQuestions()
+	flags := NewFlagDatabase()
+	handler := NewHandler(nil, questions, NewMockGameDatabase(), WithFlagDatabase(flags), WithAdminToken("secret"), WithSessionSecret(testSessionSecret))
+	id := demoQuestionList()[0].ID
+
+	request := func(method, path, uid, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		if uid != "" {
+			addIdentity(r, uid)
+		}
+		if strings.HasPrefix(path, "/admin/") {
+			r.Header.Set("Authorization", "Bearer secret")
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	for _, tc := range []struct {
+		method, path, uid, body string
+		status                  int
+	}{
+		{http.MethodPost, "/api/questions/" + id + "/flag", "user", `{"reason": " The population has grown. ", "uid": "forged"}`, http.StatusAccepted},
+		{http.MethodPost, "/api/questions/" + id + "/flag", "user", `{"reason": "Still wrong"}`, http.StatusConflict},
+		{http.MethodPost, "/api/questions/" + id + "/flag", "", `{"reason": "Outdated"}`, http.StatusForbidden},
+		{http.MethodPost, "/api/questions/" + id + "/flag", "other", `{"reason": "Outdated"}`, http.StatusAccepted},
+		{http.MethodPost, "/api/questions/" + id + "/flag", "third", `{"reason": "   "}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/questions/" + id + "/flag", "third", `{"reason": "` + strings.Repeat("x", maxFlagReasonLength+1) + `"}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/questions/" + id + "/flag", "third", `{"reason": "bell\u0007"}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/questions/" + id + "/flag", "third", `not json`, http.StatusBadRequest},
+		{http.MethodPost, "/api/questions/missing/flag", "third", `{"reason": "Outdated"}`, http.StatusNotFound},
+		{http.MethodGet, "/api/questions/" + id + "/flag", "third", ``, http.StatusMethodNotAllowed},
+	} {
+		if w := request(tc.method, tc.path, tc.uid, tc.body); w.Code != tc.status {
+			t.Errorf("%s %s %q %.40s: expected status %d, got %d: %s", tc.method, tc.path, tc.uid, tc.body, tc.status, w.Code, w.Body)
+		}
+	}
+
+	w := request(http.MethodGet, "/admin/questions/flags", "", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var result []flaggedQuestion
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 1 || result[0].Question == nil || result[0].Question.ID != id || len(result[0].Flags) != 2 {
+		t.Fatalf("Unexpected flagged questions %s", w.Body)
+	}
+	if f := result[0].Flags[0]; f.Reason != "The population has grown." || f.UserID != "user" || f.Time.IsZero() {
+		t.Errorf("Unexpected flag %+v", f)
+	}
+
+	w = request(http.MethodDelete, "/admin/questions/flags?question="+id, "", "")
+	var cleared clearedFlags
+	if err := json.Unmarshal(w.Body.Bytes(), &cleared); err != nil || cleared.Cleared != 2 {
+		t.Errorf("Expected 2 cleared flags, got %s", w.Body)
+	}
+	if all, _ := flags.List(nil); len(all) != 0 {
+		t.Errorf("Expected no flags after clearing, got %+v", all)
+	}
+	if w := request(http.MethodDelete, "/admin/questions/flags", "", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d without a question, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/questions/flags", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the flags to need the admin token, got status %d", w.Code)
+	}
+}
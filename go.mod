@@ -0,0 +1,18 @@
+module github.com/danishabdullah/predictiongame
+
+go 1.21
+
+require (
+	github.com/lib/pq v1.10.9
+	github.com/pborman/uuid v1.2.1
+	go.etcd.io/bbolt v1.3.8
+	golang.org/x/text v0.14.0
+	google.golang.org/appengine v1.6.8
+)
+
+require (
+	github.com/golang/protobuf v1.5.2 // indirect
+	github.com/google/uuid v1.0.0 // indirect
+	golang.org/x/sys v0.5.0 // indirect
+	google.golang.org/protobuf v1.26.0 // indirect
+)
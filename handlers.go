@@ -2,86 +2,949 @@ package predictiongame
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
 	"io/ioutil"
-	"log"
+	"math"
+	"mime"
 	"net/http"
 	"net/url"
 	"path"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/pborman/uuid"
 )
 
-// NumQuestions contains the number of questions for a single round.
+// NumQuestions contains the default number of questions for a single round.
 const NumQuestions = 12
 
 // ExpectedConfidence is the confidence that is expected from the user.
 const ExpectedConfidence = 0.5
 
-func initHandlers(mux *http.ServeMux, templ *template.Template, questions QuestionDatabase, games GameDatabase) {
-	mux.Handle("/api/questions/random", questionHandler(questions))
+// DefaultPassThreshold is the CalibratedScore a game needs to be passed by default.
+const DefaultPassThreshold = 0.5
 
-	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static/"))))
-	mux.Handle("/play/", playHandler(templ, questions))
-	mux.Handle("/play", newGameHandler())
-	mux.Handle("/game/", gameHandler(templ, games))
-	mux.Handle("/game", submitHandler(games))
-	mux.Handle("/lastGame/", lastGameHandler(games))
-	mux.Handle("/about", simpleHandler(templ, "about.html"))
-	mux.Handle("/help/overview", simpleHandler(templ, "help-overview.html"))
-	mux.Handle("/help/elements", simpleHandler(templ, "help-elements.html"))
-	mux.Handle("/", simpleHandler(templ, "index.html"))
+// playAssets contains the static assets which are needed by the play page.
+var playAssets = []string{
+	"/static/css/bootstrap.css",
+	"/static/css/bootstrap-theme.css",
+	"/static/css/app.css",
+	"/static/css/introjs.css",
+	"/static/js/getrational.js",
+	"/static/js/bootstrap.js",
+	"/static/js/intro.js",
 }
 
-func render(templ *template.Template, w io.Writer, name string, value interface{}) {
+// NewHandler returns the handler serving the pages and the API of the game. The
+// default settings are changed by the options. If templ is nil, the templates are
+// parsed from the file system set by WithTemplateFS or WithEmbeddedAssets with the
+// functions added by WithTemplateFuncs; NewHandler panics if they are invalid. If a
+// base path is set, templ is cloned, so it must not have been executed yet.
+func NewHandler(templ *template.Template, questions QuestionDatabase, games GameDatabase, opts ...Option) http.Handler {
+	o := newHandlerOptions(opts...)
+	if templ == nil {
+		var err error
+		templ, err = parseTemplates(o.templates(), o.templateFuncs)
+		if err != nil {
+			panic(fmt.Sprintf("predictiongame: can not parse templates: %s", err))
+		}
+	}
+	if o.basePath != "" {
+		templ = template.Must(templ.Clone()).Funcs(template.FuncMap{
+			"basePath": func() string { return o.basePath },
+		})
+	}
+
+	names := profileDisplayNames{users: o.users}
+	hub := NewMultiplayerHub()
+	mux := newRouteMux()
+	secure := SecurityHeadersMiddleware(o.csp.String())
+
+	mux.hide("/api/questions/random", questionHandler(questions, o))
+	etags := &etagCache{}
+	mux.hide("/api/questions/search", searchHandler(questions, o))
+	mux.hide("/api/questions/count", questionCountHandler(questions, etags))
+	mux.hide("/api/questions/difficulty", questionDifficultyHandler(games, o))
+	mux.hide("/api/questions/game/", gameQuestionsHandler(questions, games, o))
+	mux.hide("/api/questions/submit", submitQuestionHandler(questions, o.maxBodyBytes))
+	mux.hide("/api/questions/", questionByIDHandler(questions, games, etags, o))
+	mux.hide("/api/answer", answerHandler(questions, games, o))
+	mux.hide("/admin/questions", adminHandler(o.adminToken, adminQuestionsHandler(questions)))
+	mux.hide("/admin/questions/", adminHandler(o.adminToken, adminQuestionHandler(questions)))
+	mux.hide("/admin/questions/import", adminHandler(o.adminToken, adminImportHandler(questions)))
+	mux.hide("/admin/questions/flags", adminHandler(o.adminToken, adminFlagsHandler(questions, o.flags)))
+	mux.hide("/admin/questions/search", adminHandler(o.adminToken, adminSearchHandler(questions)))
+	mux.hide("/admin/corrections", adminHandler(o.adminToken, adminCorrectionsHandler(o.corrections)))
+	mux.hide("/admin/corrections/", adminHandler(o.adminToken, adminCorrectionHandler(questions, o.corrections)))
+	mux.hide("/admin/rescore", adminHandler(o.adminToken, adminRescoreHandler(games, o.maxBodyBytes)))
+	mux.hide("/admin/export/games.ndjson", adminHandler(o.adminToken, adminExportGamesHandler(games)))
+
+	mux.Handle("/favicon.ico", FaviconHandler())
+	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.FS(assetFS("static", o.embeddedAssets)))))
+	mux.hide("/play/", secure(playHandler(templ, questions, games, o)))
+	mux.hide("/play", secure(newGameHandler(templ, games, o)))
+	mux.hide("/play/tournament/", secure(playTournamentHandler(templ, o.tournaments, o)))
+	mux.hide("/daily", secure(dailyHandler(templ, questions, o)))
+	mux.hide("/game/", secure(gameHandler(templ, games, o)), "/game/*/share", "/game/*/card.png")
+	mux.hide("/history", secure(historyHandler(templ, games, o)))
+	mux.hide("/game", submitHandler(questions, games, o.tournaments, hub, o))
+	mux.hide("/api/games/batch", adminHandler(o.adminToken, batchSubmitHandler(questions, games, o)))
+	mux.hide("/api/games/recent", recentGamesHandler(games, o))
+	mux.hide("/lastGame/", lastGameHandler(games, o.basePath))
+	mux.hide("/api/game/", apiGameHandler(questions, games, o))
+	mux.hide("/api/game/simulate", adminHandler(o.adminToken, simulateHandler(questions, o)))
+	mux.hide("/api/leaderboard", leaderboardHandler(games, names, o))
+	mux.hide("/api/user/name", displayNameHandler(names, o))
+	mux.hide("/api/user/", userAPIHandler(games, o))
+	mux.hide("/api/users/", profileHandler(o.users, o))
+	mux.hide("/api/preferences/theme", themePreferenceHandler(o.basePath, o.maxBodyBytes))
+	mux.hide("/api/tournaments", adminHandler(o.adminToken, tournamentsHandler(questions, o.tournaments, o)))
+	mux.hide("/api/tournaments/", tournamentHandler(o.tournaments, hub, o))
+	mux.page("/about", secure(simpleHandler(templ, "about.html")))
+	mux.page("/help/overview", secure(simpleHandler(templ, "help-overview.html")))
+	mux.page("/help/elements", secure(simpleHandler(templ, "help-elements.html")))
+	mux.page("/", secure(simpleHandler(templ, "index.html")))
+
+	// robots.txt and the sitemap are built from the routes above.
+	allow, disallow := mux.robotsRules(o.basePath)
+	mux.Handle("/robots.txt", RobotsHandler(allow, disallow))
+	mux.Handle("/sitemap.xml", SitemapHandler(o.baseURL, mux.sitemapPages(o.basePath)))
+
+	var handler http.Handler = ThemeMiddleware(LocalizeMiddleware(defaultCatalog)(mux))
+	if o.basePath != "" {
+		root := http.NewServeMux()
+		root.Handle(o.basePath+"/", http.StripPrefix(o.basePath, handler))
+		handler = root
+	}
+	handler = loggerMiddleware(o.logger)(handler)
+	if o.gzip {
+		handler = GzipMiddleware(handler, o.gzipMinSize)
+	}
+	for i := len(o.middleware) - 1; i >= 0; i-- {
+		handler = o.middleware[i](handler)
+	}
+
+	return handler
+}
+
+func render(templ *template.Template, w io.Writer, r *http.Request, name string, value interface{}) {
 	if err := templ.ExecuteTemplate(w, name, value); err != nil {
-		log.Printf("Error rendering template: %s", err)
+		requestLogger(r).Error("Error rendering template", "template", name, "error", err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, value interface{}) {
+	writeJSONStatus(w, r, http.StatusOK, value)
+}
+
+func writeJSONStatus(w http.ResponseWriter, r *http.Request, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		requestLogger(r).Error("Error writing JSON", "path", r.URL.Path, "error", err)
+	}
+}
+
+// splitPath returns the segments of the URL path following prefix.
+func splitPath(urlPath, prefix string) []string {
+	trimmed := strings.Trim(strings.TrimPrefix(urlPath, prefix), "/")
+	if trimmed == "" {
+		return nil
+	}
+
+	return strings.Split(trimmed, "/")
+}
+
+// maxIDLength is the maximum length of the IDs of games and users.
+const maxIDLength = 128
+
+// validID returns true if id can be used as a path segment of a URL as is. This is the
+// case for the UUIDs of the games and the Firebase IDs of the users.
+func validID(id string) bool {
+	if id == "" || len(id) > maxIDLength {
+		return false
 	}
+
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// redirectToID redirects to the path prefix followed by id and the query. It responds
+// with 400 instead if id is not valid, so crafted IDs can neither inject headers nor
+// redirect to other sites.
+func redirectToID(w http.ResponseWriter, r *http.Request, prefix, id, rawQuery string, status int) {
+	if !validID(id) {
+		http.Error(w, fmt.Sprintf("Invalid ID %q", id), http.StatusBadRequest)
+		return
+	}
+
+	target := url.URL{Path: prefix + id, RawQuery: rawQuery}
+	http.Redirect(w, r, target.String(), status)
+}
+
+// pageContext contains the data which is available on every page.
+type pageContext struct {
+	Locale string
+	// Theme is LightTheme or DarkTheme.
+	Theme string
+	// Localizer translates the strings of the page with the localize template function.
+	Localizer *Localizer
+}
+
+// newPageContext returns the pageContext of a page in locale for the request. If the
+// request passed LocalizeMiddleware, its Localizer translates the strings of the page,
+// so the page is in the language of the Localizer even if the template has no variant
+// for it.
+func newPageContext(r *http.Request, locale string) pageContext {
+	if l, ok := r.Context().Value(localizerKey{}).(*Localizer); ok {
+		locale = l.Language()
+	}
+
+	return pageContext{
+		Locale:    locale,
+		Theme:     requestTheme(r),
+		Localizer: requestLocalizer(r),
+	}
+}
+
+// pageBounds returns the indexes of the items from offset to offset+limit in a list of
+// total items.
+func pageBounds(total, offset, limit int) (int, int) {
+	if offset > total {
+		offset = total
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+
+	return offset, end
+}
+
+// pageParams parses the offset and limit query parameters of a paged request.
+func pageParams(r *http.Request, defaultLimit, maxLimit int) (offset, limit int, err error) {
+	limit = defaultLimit
+	query := r.URL.Query()
+
+	if raw := query.Get("offset"); raw != "" {
+		offset, err = strconv.Atoi(raw)
+		if err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("invalid offset: %q", raw)
+		}
+	}
+
+	if raw := query.Get("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxLimit {
+			return 0, 0, fmt.Errorf("invalid limit, must be between 1 and %d: %q", maxLimit, raw)
+		}
+	}
+
+	return offset, limit, nil
+}
+
+// gameErrorStatus returns the HTTP status for an error returned when loading a game.
+func gameErrorStatus(err error) int {
+	if errors.Is(err, ErrGameNotFound) {
+		return http.StatusNotFound
+	}
+	if errors.Is(err, ErrCircuitOpen) {
+		return http.StatusServiceUnavailable
+	}
+	if errors.Is(err, ErrInvalidTransition) {
+		return http.StatusConflict
+	}
+
+	return http.StatusInternalServerError
 }
 
 func simpleHandler(templ *template.Template, name string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		render(templ, w, name, nil)
+		page, locale := localizedTemplate(templ, r, name)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		render(templ, w, r, page, newPageContext(r, locale))
 	})
 }
 
-func newGameHandler() http.Handler {
+// newGameRequest is the optional body of a POST to /play.
+type newGameRequest struct {
+	QuestionsCount *int `json:"questions_count"`
+}
+
+// startContext is the context of the page with the button starting a new game.
+type startContext struct {
+	pageContext
+	// Action is the URL to which the button posts, including the query of the request.
+	Action string
+}
+
+// newGameHandler starts a new game and redirects to its play page. A POST may contain a
+// newGameRequest. With the postOnlyPlayStart option, only a POST starts a game, and a
+// GET shows a page with a button posting to the handler instead.
+func newGameHandler(templ *template.Template, games GameDatabase, opts handlerOptions) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if opts.postOnlyPlayStart {
+			switch r.Method {
+			case http.MethodPost:
+			case http.MethodGet, http.MethodHead:
+				action := opts.basePath + "/play"
+				if r.URL.RawQuery != "" {
+					action += "?" + r.URL.RawQuery
+				}
+
+				page, locale := localizedTemplate(templ, r, "start.html")
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				render(templ, w, r, page, startContext{pageContext: newPageContext(r, locale), Action: action})
+				return
+			default:
+				w.Header().Set("Allow", "GET, HEAD, POST")
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+		}
+
 		id := uuid.NewRandom().String()
-		// TODO: save game id somewhere
 
-		http.Redirect(w, r, fmt.Sprintf("/play/%s", id), http.StatusFound)
+		status := http.StatusFound
+		if r.Method == http.MethodPost {
+			defer r.Body.Close()
+
+			var req newGameRequest
+			err := json.NewDecoder(http.MaxBytesReader(w, r.Body, opts.maxBodyBytes)).Decode(&req)
+			if err != nil && err != io.EOF {
+				http.Error(w, fmt.Sprintf("Error parsing request: %s", err), http.StatusBadRequest)
+				return
+			}
+
+			if count := req.QuestionsCount; count != nil {
+				if *count < 1 || *count > opts.maxQuestions {
+					http.Error(w, fmt.Sprintf("questions_count must be between 1 and %d", opts.maxQuestions), http.StatusBadRequest)
+					return
+				}
+
+				if err := games.Start(r, id, *count); err != nil {
+					http.Error(w, fmt.Sprintf("Error starting game: %s", err), http.StatusInternalServerError)
+					return
+				}
+			}
+			status = http.StatusSeeOther
+		}
+
+		redirectToID(w, r, opts.basePath+"/play/", id, r.URL.RawQuery, status)
 	})
 }
 
 type playContext struct {
+	pageContext
 	ID        string
 	Questions []Question
+	Progress  []Answer
+	// Tournament is the ID of the tournament the game is played for, if any.
+	Tournament string
+}
+
+// publicQuestions returns copies of the questions without their correct answers, which
+// can be sent to the players.
+func publicQuestions(questions []Question) []Question {
+	result := withoutExplanations(questions)
+	for i := range result {
+		result[i].BoundLow, result[i].BoundHigh = 0, 0
+		result[i].TrueValue, result[i].HasTrueValue = 0, false
+	}
+
+	return result
 }
 
-func playHandler(templ *template.Template, db QuestionDatabase) http.Handler {
+// withoutExplanations returns copies of the questions without their explanations, which
+// would give away the answers before a game is submitted.
+func withoutExplanations(questions []Question) []Question {
+	result := make([]Question, len(questions))
+	for i, q := range questions {
+		q.Explanation = ""
+		result[i] = q
+	}
+
+	return result
+}
+
+// playQuestions returns the questions as they are sent to the play page.
+func (o handlerOptions) playQuestions(questions []Question) []Question {
+	if o.exposeBounds {
+		return withoutExplanations(questions)
+	}
+
+	return publicQuestions(questions)
+}
+
+// addExplanations sets the explanations of the questions of the answers, which the
+// client did not get, from the database. Questions which are not in the database keep
+// their explanation.
+func addExplanations(questions QuestionDatabase, answers []Answer) {
+	for i, a := range answers {
+		if q, err := questions.GetByID(a.Question.ID); err == nil {
+			answers[i].Question.Explanation = q.Explanation
+		}
+	}
+}
+
+// resolveQuestions replaces the questions of the answers by the ones in the database,
+// which contain the correct answers the play page does not know.
+func resolveQuestions(questions QuestionDatabase, answers []Answer) error {
+	for i, a := range answers {
+		q, err := questions.GetByID(a.Question.ID)
+		if err != nil {
+			return fmt.Errorf("question %q: %w", a.Question.ID, err)
+		}
+		answers[i].Question = q
+	}
+
+	return nil
+}
+
+func pushAssets(w http.ResponseWriter, r *http.Request, basePath string, assets []string) {
+	pusher, ok := w.(http.Pusher)
+	if !ok {
+		return
+	}
+
+	for _, a := range assets {
+		if err := pusher.Push(basePath+a, nil); err != nil {
+			if err != http.ErrNotSupported {
+				requestLogger(r).Error("Error pushing asset", "asset", a, "error", err)
+			}
+			return
+		}
+	}
+}
+
+func playHandler(templ *template.Template, db QuestionDatabase, games GameDatabase, opts handlerOptions) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		id := path.Base(r.URL.Path)
-		selected := db.SelectRandom(NumQuestions)
 
-		render(templ, w, "play.html", playContext{
-			ID:        id,
-			Questions: selected,
+		lang := selectLanguage(r, db.Languages())
+		selected, progress, err := gameQuestions(r, db, games, id, selectionUser(r, opts), lang, opts)
+		if err != nil {
+			opts.logger.Error("Error loading progress of game", "game", id, "error", err)
+		}
+
+		if opts.serverPush {
+			pushAssets(w, r, opts.basePath, playAssets)
+		}
+
+		page, locale := localizedTemplate(templ, r, "play.html")
+		pc := newPageContext(r, locale)
+		questions := opts.playQuestions(localizeQuestions(pc.Localizer, selected))
+		render(templ, w, r, page, playContext{
+			pageContext: pc,
+			ID:          id,
+			Questions:   questions,
+			Progress:    playProgress(progress, questions),
+		})
+	})
+}
+
+// playProgress replaces the questions of the answers given so far with the questions
+// served on the play page, so resuming a game does not reveal their correct ranges.
+func playProgress(progress []Answer, questions []Question) []Answer {
+	byID := make(map[string]Question, len(questions))
+	for _, q := range questions {
+		byID[q.ID] = q
+	}
+
+	resumed := make([]Answer, len(progress))
+	for i, a := range progress {
+		resumed[i] = a
+		resumed[i].Question = byID[a.Question.ID]
+	}
+	return resumed
+}
+
+// selectionUser returns the user whose history the questions of a new game are selected
+// for, see SelectRandomForUser. Only the verified user of the request is used, so the
+// history of other users is not revealed. It is empty if the user is not verified, in
+// which case the questions are selected for the game ID only.
+func selectionUser(r *http.Request, opts handlerOptions) string {
+	uid, ok := opts.userID(r)
+	if !ok {
+		return ""
+	}
+	return uid
+}
+
+// gameQuestions returns the questions of the game with the ID and the answers given so
+// far. A game which has been served before gets the same questions, the answered ones
+// first. Otherwise the questions are selected in lang, for the user uid if it is set, and
+// stored with the game, so its replay shows them in the order they were presented. The
+// error is only returned if the game can not be loaded, in which case new questions are
+// selected anyway.
+func gameQuestions(r *http.Request, db QuestionDatabase, games GameDatabase, id, uid, lang string, opts handlerOptions) ([]Question, []Answer, error) {
+	saved, err := games.Get(r, id)
+	if err != nil && !errors.Is(err, ErrGameNotFound) {
+		return db.SelectForGame(id, lang, opts.numQuestions), nil, err
+	}
+	found := err == nil
+
+	num := opts.numQuestions
+	if found && saved.QuestionCount > 0 {
+		num = saved.QuestionCount
+	}
+
+	var selected []Question
+	if found {
+		for _, qid := range saved.QuestionIDs {
+			if q, err := db.GetByID(qid); err == nil {
+				selected = append(selected, q)
+			}
+		}
+	}
+	served := len(selected) > 0
+
+	if !served && uid != "" {
+		selected, err = SelectRandomForUser(r, db, games, uid, lang, num, opts.questionExclusionWindow)
+		if err != nil {
+			requestLogger(r).Error("Error selecting questions for user", "uid", uid, "error", err)
+		}
+	}
+	if len(selected) == 0 {
+		selected = db.SelectForGame(id, lang, num)
+	}
+
+	if found && !saved.Playable() {
+		return selected, nil, nil
+	}
+
+	var progress []Answer
+	if found {
+		progress = saved.Answers
+		selected = resumeQuestions(progress, selected, num)
+	}
+
+	if !served {
+		ids := make([]string, 0, len(selected))
+		for _, q := range selected {
+			ids = append(ids, q.ID)
+		}
+		if err := games.SaveQuestions(r, id, ids); err != nil {
+			requestLogger(r).Error("Error saving questions of game", "game", id, "error", err)
+		}
+	}
+
+	return selected, progress, nil
+}
+
+// resumeQuestions returns the num questions for a resumed game: the already answered
+// questions followed by the selected questions which have not been answered yet.
+func resumeQuestions(progress []Answer, selected []Question, num int) []Question {
+	answered := make(map[string]bool)
+	result := make([]Question, 0, num)
+	for _, a := range progress {
+		answered[a.Question.ID] = true
+		result = append(result, a.Question)
+	}
+
+	for _, q := range selected {
+		if len(result) >= num {
+			break
+		}
+
+		if !answered[q.ID] {
+			result = append(result, q)
+		}
+	}
+
+	return result
+}
+
+func dailyHandler(templ *template.Template, db QuestionDatabase, opts handlerOptions) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := uuid.NewRandom().String()
+		selected := db.SelectDaily(time.Now(), opts.numQuestions)
+
+		page, locale := localizedTemplate(templ, r, "play.html")
+		pc := newPageContext(r, locale)
+		render(templ, w, r, page, playContext{
+			pageContext: pc,
+			ID:          id,
+			Questions:   opts.playQuestions(localizeQuestions(pc.Localizer, selected)),
 		})
 	})
 }
 
-func questionHandler(db QuestionDatabase) http.Handler {
+// randomQuestionsRequest is the optional body of a POST to /api/questions/random. All
+// fields are optional; N defaults to the number of questions of a game, see WithNumQuestions.
+type randomQuestionsRequest struct {
+	ExcludeIDs []string `json:"exclude_ids"`
+	Category   string   `json:"category"`
+	N          int      `json:"n"`
+}
+
+// selectFiltered selects req.N questions of the category which are not excluded.
+func (req randomQuestionsRequest) selectFiltered(db QuestionDatabase) []Question {
+	excluded := make(map[string]bool, len(req.ExcludeIDs))
+	for _, id := range req.ExcludeIDs {
+		excluded[id] = true
+	}
+
+	return db.SelectWeighted(req.N, func(q Question) float64 {
+		if excluded[q.ID] || (req.Category != "" && !strings.EqualFold(q.Category, req.Category)) {
+			return 0
+		}
+		return 1
+	})
+}
+
+// The orders of the questions returned by /api/questions/random.
+const (
+	// RandomOrder keeps the questions in the random order they were selected in.
+	RandomOrder = "random"
+	// DifficultyAscOrder sorts the questions from the easiest to the hardest, for
+	// warming up.
+	DifficultyAscOrder = "difficulty_asc"
+	// DifficultyDescOrder sorts the questions from the hardest to the easiest.
+	DifficultyDescOrder = "difficulty_desc"
+)
+
+// questionOrders contains the known orders.
+var questionOrders = map[string]bool{
+	RandomOrder:         true,
+	DifficultyAscOrder:  true,
+	DifficultyDescOrder: true,
+}
+
+// orderQuestions sorts the selected questions in the order, which must be one of
+// questionOrders. See Question.Weight for their difficulty. Questions of equal
+// difficulty keep their random order.
+func orderQuestions(questions []Question, order string) {
+	switch order {
+	case DifficultyAscOrder:
+		sort.SliceStable(questions, func(i, j int) bool {
+			return questions[i].Weight() < questions[j].Weight()
+		})
+	case DifficultyDescOrder:
+		sort.SliceStable(questions, func(i, j int) bool {
+			return questions[i].Weight() > questions[j].Weight()
+		})
+	}
+}
+
+// questionHandler selects random questions. The order query parameter sorts them after
+// they are selected, see orderQuestions.
+func questionHandler(db QuestionDatabase, opts handlerOptions) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		selected := db.SelectRandom(NumQuestions)
+		order := r.URL.Query().Get("order")
+		if order == "" {
+			order = RandomOrder
+		}
+		if !questionOrders[order] {
+			http.Error(w, fmt.Sprintf("Unknown order %q", order), http.StatusBadRequest)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+		case http.MethodPost:
+			defer r.Body.Close()
 
-		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(selected); err != nil {
-			log.Printf("Error writing JSON: %s", err)
+			var req randomQuestionsRequest
+			err := json.NewDecoder(http.MaxBytesReader(w, r.Body, opts.maxBodyBytes)).Decode(&req)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Error parsing filters: %s", err), http.StatusBadRequest)
+				return
+			}
+
+			if req.N == 0 {
+				req.N = opts.numQuestions
+			}
+			if req.N < 1 || req.N > opts.maxQuestions {
+				http.Error(w, fmt.Sprintf("n must be between 1 and %d", opts.maxQuestions), http.StatusBadRequest)
+				return
+			}
+
+			selected := req.selectFiltered(db)
+			orderQuestions(selected, order)
+			writeJSON(w, r, opts.playQuestions(selected))
+			return
+		default:
+			w.Header().Set("Allow", "GET, HEAD, POST")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
 		}
+
+		var selected []Question
+		if tags := r.URL.Query().Get("tags"); tags != "" {
+			selected = db.SelectRandomByTag(opts.numQuestions, strings.Split(tags, ",")...)
+		} else {
+			selected = db.SelectRandom(opts.numQuestions)
+		}
+
+		orderQuestions(selected, order)
+		writeJSON(w, r, opts.playQuestions(selected))
+	})
+}
+
+func searchHandler(db QuestionDatabase, opts handlerOptions) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := strings.TrimSpace(r.URL.Query().Get("q"))
+		if query == "" {
+			http.Error(w, "Missing search query", http.StatusBadRequest)
+			return
+		}
+
+		result, err := db.Search(query)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error searching questions: %s", err), http.StatusInternalServerError)
+			return
+		}
+
+		// Submitted questions are only shown once they have been approved, and disabled
+		// questions only to the admins, see adminSearchHandler.
+		approved := make([]Question, 0, len(result))
+		for _, q := range result {
+			if len(approved) >= maxSearchResults {
+				break
+			}
+			if !q.Pending && q.Enabled {
+				approved = append(approved, q)
+			}
+		}
+
+		writeJSON(w, r, opts.playQuestions(approved))
+	})
+}
+
+func questionByIDHandler(db QuestionDatabase, games GameDatabase, etags *etagCache, opts handlerOptions) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if parts := splitPath(r.URL.Path, "/api/questions/"); len(parts) == 2 {
+			switch parts[1] {
+			case "stats":
+				serveQuestionStats(w, r, db, games, parts[0], opts.scoring)
+			case "flag":
+				serveQuestionFlag(w, r, db, parts[0], opts)
+			default:
+				http.NotFound(w, r)
+			}
+			return
+		}
+
+		id := path.Base(r.URL.Path)
+
+		version := db.Version()
+		if tag, ok := etags.get(version, id); ok && notModified(w, r, tag) {
+			return
+		}
+
+		q, err := db.GetByID(id)
+		if err == nil && q.Pending {
+			err = ErrQuestionNotFound
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Question %q can not be loaded: %s", id, err), http.StatusNotFound)
+			return
+		}
+		q = opts.playQuestions([]Question{q})[0]
+
+		tag := computeETag(q)
+		etags.put(version, id, tag)
+		if notModified(w, r, tag) {
+			return
+		}
+
+		w.Header().Set("ETag", tag)
+		writeJSON(w, r, q)
+	})
+}
+
+// gameQuestionsHandler returns the questions of a game, see gameQuestions. The play page
+// serves the same questions, whichever is requested first. The result only changes if
+// the game or the questions change, so it can be cached using its ETag.
+func gameQuestionsHandler(db QuestionDatabase, games GameDatabase, opts handlerOptions) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := path.Base(r.URL.Path)
+
+		selected, _, err := gameQuestions(r, db, games, id, selectionUser(r, opts), selectLanguage(r, db.Languages()), opts)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Game can not be loaded: %s", err), gameErrorStatus(err))
+			return
+		}
+		selected = opts.playQuestions(selected)
+
+		tag := computeETag(selected)
+		w.Header().Set("Vary", "Accept-Language")
+		if notModified(w, r, tag) {
+			return
+		}
+
+		w.Header().Set("ETag", tag)
+		writeJSON(w, r, selected)
+	})
+}
+
+// countKey is the key of the question count in the ETag cache. It can not collide
+// with question IDs, which never contain a slash.
+const countKey = "/count"
+
+func questionCountHandler(db QuestionDatabase, etags *etagCache) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		version := db.Version()
+		if tag, ok := etags.get(version, countKey); ok && notModified(w, r, tag) {
+			return
+		}
+
+		_, total := db.List(0, 0)
+		result := struct {
+			Count int `json:"count"`
+		}{
+			Count: total,
+		}
+
+		tag := computeETag(result)
+		etags.put(version, countKey, tag)
+		if notModified(w, r, tag) {
+			return
+		}
+
+		w.Header().Set("ETag", tag)
+		writeJSON(w, r, result)
+	})
+}
+
+// minDifficultyAnswers is the number of answers a question needs before its hit rate is
+// reported as its difficulty.
+const minDifficultyAnswers = 20
+
+// difficultyCacheTTL is how long the difficulties are served from the cache before the
+// question stats are computed again.
+const difficultyCacheTTL = 10 * time.Minute
+
+// difficultyCache remembers the difficulties of the questions for ttl, so the games are
+// not loaded for every request.
+type difficultyCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu         sync.Mutex
+	difficulty map[string]float64
+	expires    time.Time
+}
+
+func newDifficultyCache(ttl time.Duration) *difficultyCache {
+	return &difficultyCache{ttl: ttl, now: time.Now}
+}
+
+// get returns the hit rates of the questions which have been answered at least
+// minDifficultyAnswers times, computing them from the stats in db if they are not
+// cached or expired.
+func (c *difficultyCache) get(r *http.Request, db GameDatabase, cfg ScoreConfig) (map[string]float64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.difficulty != nil && c.now().Before(c.expires) {
+		return c.difficulty, nil
+	}
+
+	stats, err := db.QuestionStats(r, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	difficulty := make(map[string]float64)
+	for id, s := range stats {
+		if s.Answers >= minDifficultyAnswers {
+			difficulty[id] = s.HitRate()
+		}
+	}
+	c.difficulty, c.expires = difficulty, c.now().Add(c.ttl)
+	return difficulty, nil
+}
+
+// questionDifficultyHandler returns the hit rates of the questions which have been
+// answered at least minDifficultyAnswers times, by question ID. The answers are checked
+// using the configured rules, and the result is cached for difficultyCacheTTL.
+func questionDifficultyHandler(db GameDatabase, opts handlerOptions) http.Handler {
+	cache := newDifficultyCache(difficultyCacheTTL)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		difficulty, err := cache.get(r, db, opts.scoring)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Question statistics can not be loaded: %s", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		writeJSON(w, r, difficulty)
+	})
+}
+
+// defaultHistogramBuckets and maxHistogramBuckets limit the number of buckets of the
+// histogram of the answer widths.
+const (
+	defaultHistogramBuckets = 10
+	maxHistogramBuckets     = 100
+)
+
+// questionStatsResponse is the response of GET /api/questions/{id}/stats.
+type questionStatsResponse struct {
+	QuestionID        string            `json:"question_id"`
+	TotalAttempts     int               `json:"total_attempts"`
+	CorrectCount      int               `json:"correct_count"`
+	AverageLowerBound float64           `json:"average_lower_bound"`
+	AverageUpperBound float64           `json:"average_upper_bound"`
+	WidthHistogram    []histogramBucket `json:"width_histogram"`
+}
+
+// serveQuestionStats returns how often a question has been answered correctly and how
+// the answers are distributed. The number of buckets of the histogram of the answer
+// widths can be chosen with the buckets parameter. The answers are checked using the
+// rules of cfg.
+func serveQuestionStats(w http.ResponseWriter, r *http.Request, db QuestionDatabase, games GameDatabase, id string, cfg ScoreConfig) {
+	buckets := defaultHistogramBuckets
+	if raw := r.URL.Query().Get("buckets"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxHistogramBuckets {
+			http.Error(w, fmt.Sprintf("Invalid number of buckets %q, expected 1 to %d", raw, maxHistogramBuckets), http.StatusBadRequest)
+			return
+		}
+		buckets = n
+	}
+
+	q, err := db.GetByID(id)
+	if err == nil && q.Pending {
+		err = ErrQuestionNotFound
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Question %q can not be loaded: %s", id, err), http.StatusNotFound)
+		return
+	}
+
+	stats, err := games.GetAnswerStats(r.Context(), q.ID, cfg)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Question statistics can not be loaded: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, questionStatsResponse{
+		QuestionID:        q.ID,
+		TotalAttempts:     stats.Answers,
+		CorrectCount:      stats.Correct,
+		AverageLowerBound: stats.AverageLowerBound,
+		AverageUpperBound: stats.AverageUpperBound,
+		WidthHistogram:    histogram(stats.Widths, buckets),
 	})
 }
 
@@ -90,102 +953,701 @@ type Answer struct {
 	Question   Question `json:"question"`
 	LowerBound float64  `json:"lower"`
 	UpperBound float64  `json:"upper"`
+	// Inverted is true if the bounds were submitted in the wrong order and swapped, see
+	// Normalized.
+	Inverted bool `json:"inverted,omitempty"`
 }
 
-// Correct returns true if the range given in the answer was correct.
+// Normalized returns the answer with LowerBound not greater than UpperBound, swapping
+// them if the client submitted them in the wrong order, so the widths and scores of
+// the stored answers do not have to handle inverted ranges.
+func (a Answer) Normalized() Answer {
+	a.Inverted = a.LowerBound > a.UpperBound
+	if a.Inverted {
+		a.LowerBound, a.UpperBound = a.UpperBound, a.LowerBound
+	}
+
+	return a
+}
+
+// Correct returns true if the range given in the answer overlaps the correct range.
 func (a Answer) Correct() bool {
-	qLow := a.Question.BoundLow
-	qHigh := a.Question.BoundHigh
-	aLow := a.LowerBound
-	aHigh := a.UpperBound
-	return (aLow >= qLow && aHigh <= qHigh) ||
-		(aLow <= qLow && aHigh >= qLow) ||
-		(aLow <= qHigh && aHigh >= qHigh)
+	return a.CorrectIn(ScoringOverlap)
+}
+
+// Estimate returns the estimate and the tolerance of an answer to a point question.
+func (a Answer) Estimate() (float64, float64) {
+	return (a.LowerBound + a.UpperBound) / 2, (a.UpperBound - a.LowerBound) / 2
+}
+
+// Width returns the width of the range given in the answer. For log-scale questions it
+// is the number of orders of magnitude the range spans.
+func (a Answer) Width() float64 {
+	q := a.Question
+	return q.scaled(a.UpperBound) - q.scaled(a.LowerBound)
+}
+
+// MissDistance returns the distance between the range given in the answer and the correct range.
+// It is zero if the ranges overlap. For log-scale questions it is measured in orders of magnitude.
+func (a Answer) MissDistance() float64 {
+	return a.MissDistanceWith(ScoreConfig{})
 }
 
-func submitHandler(db GameDatabase) http.Handler {
+// MissDistanceWith returns how far the answer is from being correct using the rules of cfg.
+// It is zero for correct answers. With ScoringContain it is the part of the correct range
+// outside of the answer, with ScoringMidpoint the distance of the midpoint of the answer
+// to the correct range, and with ScoringOverlap the distance between the ranges or the
+// overlap missing to MinOverlapFraction. If the question has an exact answer, it is the
+// distance to the value. For log-scale questions it is measured in orders of magnitude.
+func (a Answer) MissDistanceWith(cfg ScoreConfig) float64 {
+	if a.CorrectWith(cfg) {
+		return 0
+	}
+
+	q := a.Question
+	qLow, qHigh := q.correctRange()
+	low, high := q.scaled(qLow), q.scaled(qHigh)
+	aLow, aHigh := q.scaled(a.LowerBound), q.scaled(a.UpperBound)
+
+	if _, exact := q.Value(); !exact {
+		switch cfg.Mode {
+		case ScoringContain:
+			return math.Max(aLow-low, high-aHigh)
+		case ScoringMidpoint:
+			mid := q.scaled((a.LowerBound + a.UpperBound) / 2)
+			if mid < low {
+				return low - mid
+			}
+			return mid - high
+		default:
+			if aHigh >= low && aLow <= high {
+				overlap := math.Min(aHigh, high) - math.Max(aLow, low)
+				return cfg.MinOverlapFraction*(high-low) - overlap
+			}
+		}
+	}
+
+	if aHigh < low {
+		return low - aHigh
+	}
+
+	return aLow - high
+}
+
+// RelativeError returns how far the midpoint of the answer is from the midpoint of the
+// correct range or the true value, relative to the latter. It is positive for overestimates and negative
+// for underestimates. It is zero if the midpoint of the correct range is zero. For log-scale
+// questions the geometric midpoints are used.
+func (a Answer) RelativeError() float64 {
+	qLow, qHigh := a.Question.correctRange()
+	qMid, aMid := (qLow+qHigh)/2, (a.LowerBound+a.UpperBound)/2
+	if q := a.Question; q.IsLog() {
+		qMid = math.Pow(10, (q.scaled(qLow)+q.scaled(qHigh))/2)
+		aMid = math.Pow(10, (q.scaled(a.LowerBound)+q.scaled(a.UpperBound))/2)
+	}
+	if qMid == 0 {
+		return 0
+	}
+
+	return (aMid - qMid) / math.Abs(qMid)
+}
+
+// Score returns the points awarded for the answer.
+func (a Answer) Score() float64 {
+	return a.ScoreIn(ScoringOverlap)
+}
+
+// Feedback contains the evaluation of a single answer which is shown after a game.
+type Feedback struct {
+	Answer
+	Correct      bool
+	Score        float64
+	CorrectRange string
+	Explanation  string
+}
+
+func newFeedback(answers []Answer, cfg ScoreConfig) []Feedback {
+	result := make([]Feedback, 0, len(answers))
+	for _, a := range answers {
+		low, high := a.Question.correctRange()
+		result = append(result, Feedback{
+			Answer:       a,
+			Correct:      a.CorrectWith(cfg),
+			Score:        a.ScoreWith(cfg),
+			CorrectRange: fmt.Sprintf("%s %s", rangeStr(low, high, a.Question.Precision), a.Question.Unit),
+			Explanation:  a.Question.Explanation,
+		})
+	}
+
+	return result
+}
+
+// answerResult is the evaluation of a single answer in practice mode.
+type answerResult struct {
+	QuestionID string       `json:"questionId"`
+	Kind       QuestionKind `json:"kind,omitempty"`
+	Correct    bool         `json:"correct"`
+	BoundLow   float64      `json:"boundLow"`
+	BoundHigh  float64      `json:"boundHigh"`
+	// TrueValue is only set if the question has a true value, which may be zero.
+	TrueValue *float64 `json:"trueValue,omitempty"`
+	Miss      float64  `json:"miss"`
+	// CorrectRange and Answer are the correct range and the answer formatted with the
+	// precision of the question.
+	CorrectRange string `json:"correctRange"`
+	Answer       string `json:"answer"`
+}
+
+// answerHandler evaluates a single answer. Unless the bounds are exposed for practice,
+// see WithExposedBounds, the correct answer is only revealed for a question of the
+// submitted game given by the game query parameter.
+func answerHandler(db QuestionDatabase, games GameDatabase, opts handlerOptions) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
-			http.Redirect(w, r, "/", http.StatusFound)
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 		defer r.Body.Close()
 
-		bytes, err := ioutil.ReadAll(r.Body)
+		var answer Answer
+		if err := json.NewDecoder(r.Body).Decode(&answer); err != nil {
+			http.Error(w, fmt.Sprintf("Error parsing answer: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		// Only trust the ID of the question sent by the client.
+		q, err := db.GetByID(answer.Question.ID)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Error reading request: %s", err), http.StatusBadRequest)
+			http.Error(w, fmt.Sprintf("Question %q can not be loaded: %s", answer.Question.ID, err), http.StatusNotFound)
+			return
+		}
+		if !opts.exposeBounds {
+			gameID := r.URL.Query().Get("game")
+			game, err := games.Get(r, gameID)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Game %q can not be loaded: %s", gameID, err), gameErrorStatus(err))
+				return
+			}
+			if !game.Completed() || !game.hasQuestion(q.ID) {
+				http.Error(w, "The answer is only shown for the questions of submitted games", http.StatusForbidden)
+				return
+			}
+		}
+
+		answer.Question = q
+		low, high := q.correctRange()
+
+		result := answerResult{
+			QuestionID:   q.ID,
+			Kind:         q.Kind,
+			Correct:      answer.CorrectWith(opts.scoring),
+			BoundLow:     q.BoundLow,
+			BoundHigh:    q.BoundHigh,
+			Miss:         answer.MissDistanceWith(opts.scoring),
+			CorrectRange: rangeStr(low, high, q.Precision),
+			Answer:       answerStr(answer),
+		}
+		if q.HasTrueValue {
+			result.TrueValue = &q.TrueValue
+		}
+
+		writeJSON(w, r, result)
+	})
+}
+
+// submitHandler saves a completed game. The game is posted as JSON, to which it
+// responds with a submitResult, or as the deprecated form field data, to which it
+// responds with a redirect to the results. If a game is submitted again with the
+// Idempotency-Key header of the request which saved it, the response is repeated
+// without saving the game again.
+func submitHandler(questions QuestionDatabase, db GameDatabase, tournaments TournamentDatabase, hub *MultiplayerHub, opts handlerOptions) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Redirect(w, r, opts.basePath+"/", http.StatusFound)
+			return
+		}
+		defer r.Body.Close()
+
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key != "" && !validIdempotencyKey(key) {
+			http.Error(w, fmt.Sprintf("Invalid %s header", idempotencyKeyHeader), http.StatusBadRequest)
 			return
 		}
 
-		raw := strings.TrimPrefix(string(bytes), "data=")
-		data, err := url.QueryUnescape(raw)
+		bytes, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, opts.maxBodyBytes))
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Error decoding request: %s", err), http.StatusBadRequest)
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, fmt.Sprintf("Request too large: %s", err), http.StatusRequestEntityTooLarge)
+				return
+			}
+
+			http.Error(w, fmt.Sprintf("Error reading request: %s", err), http.StatusBadRequest)
 			return
 		}
 
-		var game GameEntity
-		if err := json.Unmarshal([]byte(data), &game); err != nil {
+		jsonBody := isJSONRequest(r)
+		data := string(bytes)
+		if !jsonBody {
+			// Older clients post the JSON as the form field data. This is deprecated in
+			// favour of posting it directly.
+			w.Header().Set("Deprecation", "true")
+			data, err = url.QueryUnescape(strings.TrimPrefix(data, "data="))
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Error decoding request: %s", err), http.StatusBadRequest)
+				return
+			}
+		}
+
+		var game struct {
+			GameEntity
+			Tournament string `json:"tournament"`
+		}
+		if err := decodeStrict(strings.NewReader(data), &game); err != nil {
 			http.Error(w, fmt.Sprintf("Error parsing answers: %s", err), http.StatusBadRequest)
 			return
 		}
 
-		if err := db.Save(r, game.UserID, game.ID, game.Answers); err != nil {
-			http.Error(w, fmt.Sprintf("Error saving game: %s", err), http.StatusInternalServerError)
+		uid, verified := opts.userID(r)
+		if verified && game.UserID == "" {
+			game.UserID = uid
+		}
+
+		switch {
+		case game.ID == "":
+			http.Error(w, "Missing game ID", http.StatusBadRequest)
 			return
+		case game.UserID == "":
+			http.Error(w, "Missing user ID", http.StatusBadRequest)
+			return
+		case game.Answers == nil:
+			http.Error(w, "Missing answers", http.StatusBadRequest)
+			return
+		}
+
+		if !validID(game.ID) {
+			http.Error(w, fmt.Sprintf("Invalid game ID %q", game.ID), http.StatusBadRequest)
+			return
+		}
+		if !validID(game.UserID) {
+			http.Error(w, fmt.Sprintf("Invalid user ID %q", game.UserID), http.StatusBadRequest)
+			return
+		}
+
+		if verified && game.UserID != uid {
+			http.Error(w, "Games can only be submitted by their player", http.StatusForbidden)
+			return
+		}
+		if !verified {
+			claimed, err := userClaimed(r, db, game.UserID)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("User can not be verified: %s", err), gameErrorStatus(err))
+				return
+			}
+			if claimed {
+				http.Error(w, "The user has to sign in to submit games", http.StatusForbidden)
+				return
+			}
 		}
 
-		http.Redirect(w, r, fmt.Sprintf("/game/%s", game.ID), http.StatusFound)
+		for i, a := range game.Answers {
+			game.Answers[i] = a.Normalized()
+		}
+
+		if !opts.exposeBounds {
+			if err := resolveQuestions(questions, game.Answers); err != nil {
+				http.Error(w, fmt.Sprintf("Unknown question: %s", err), http.StatusBadRequest)
+				return
+			}
+		} else {
+			addExplanations(questions, game.Answers)
+		}
+
+		// The game is only saved if the tournament accepts it as a result.
+		now := time.Now()
+		if game.Tournament != "" {
+			result := game.GameEntity
+			result.Time = now
+			if err := checkTournamentResult(r, tournaments, game.Tournament, result); err != nil {
+				http.Error(w, fmt.Sprintf("Error adding tournament result: %s", err), tournamentErrorStatus(err))
+				return
+			}
+		}
+
+		// The key is only taken from the header.
+		game.IdempotencyKey = key
+		game.Score = RescoreGame(game.GameEntity, opts.scoring)
+		if err := db.Save(r, game.GameEntity); err != nil {
+			if errors.Is(err, ErrDuplicateSubmit) {
+				w.Header().Set("Idempotent-Replayed", "true")
+				respondSubmitted(w, r, game.UserID, game.ID, jsonBody, opts)
+				return
+			}
+
+			http.Error(w, fmt.Sprintf("Error saving game: %s", err), gameErrorStatus(err))
+			return
+		}
+
+		if game.Tournament != "" {
+			result := game.GameEntity
+			result.Time = now
+			if err := tournaments.AddResult(r, game.Tournament, result); err != nil {
+				http.Error(w, fmt.Sprintf("Error adding tournament result: %s", err), tournamentErrorStatus(err))
+				return
+			}
+
+			update := ScoreUpdate{
+				GameID:  result.ID,
+				Score:   result.CalibratedScoreWith(opts.scoring),
+				Correct: int(correctAnswers(opts.scoring, result.Answers)),
+			}
+			update.DisplayName, update.AnonymousID = opts.playerName(r, result.UserID)
+			hub.Publish(game.Tournament, update)
+		}
+
+		if err := ensureProfile(r, opts.users, game.UserID); err != nil {
+			opts.logger.Error("Error creating profile", "user", game.UserID, "error", err)
+		}
+
+		respondSubmitted(w, r, game.UserID, game.ID, jsonBody, opts)
 	})
 }
 
-func gameHandler(templ *template.Template, db GameDatabase) http.Handler {
+// respondSubmitted sets the identity cookie of the user and responds to the submit of
+// the game, see submitHandler.
+func respondSubmitted(w http.ResponseWriter, r *http.Request, uid, id string, jsonBody bool, opts handlerOptions) {
+	basePath := opts.basePath
+	if validID(uid) {
+		opts.setIdentityCookie(w, r, uid)
+	}
+
+	if jsonBody {
+		target := basePath + "/game/" + url.PathEscape(id)
+		w.Header().Set("Location", target)
+		writeJSONStatus(w, r, http.StatusCreated, submitResult{ID: id, URL: target})
+		return
+	}
+
+	redirectToID(w, r, basePath+"/game/", id, "", http.StatusFound)
+}
+
+// userClaimed returns true if the user has saved games already. The games of a new user
+// can be submitted without a verified identity, after which the identity cookie is set,
+// but the cookie is never issued for the users of other players.
+func userClaimed(r *http.Request, db GameDatabase, uid string) (bool, error) {
+	_, err := db.Last(r, uid)
+	if errors.Is(err, ErrGameNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// submitResult is the response to a game posted as JSON.
+type submitResult struct {
+	ID string `json:"id"`
+	// URL is the path of the page showing the results of the game.
+	URL string `json:"url"`
+}
+
+// isJSONRequest returns true if the body of the request is JSON according to its
+// Content-Type.
+func isJSONRequest(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
+
+// decodeStrict decodes submitted games from the JSON read from body into v. Unknown
+// fields are rejected, so bugs of the client are noticed instead of saving incomplete
+// games.
+func decodeStrict(body io.Reader, v interface{}) error {
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+func gameHandler(templ *template.Template, db GameDatabase, opts handlerOptions) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if parts := splitPath(r.URL.Path, "/game/"); len(parts) == 2 {
+			switch parts[1] {
+			case "autosave":
+				serveAutosave(w, r, db, parts[0], opts)
+			case "share":
+				serveShare(w, r, templ, db, parts[0], opts)
+			case "card.png":
+				serveCard(w, r, db, parts[0], opts)
+			default:
+				http.NotFound(w, r)
+			}
+			return
+		}
+
 		id := path.Base(r.URL.Path)
 
 		if len(id) == 0 {
-			http.Redirect(w, r, "/", http.StatusFound)
+			http.Redirect(w, r, opts.basePath+"/", http.StatusFound)
 		}
 
 		game, err := db.Get(r, id)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Game can not be loaded: %s", err), http.StatusNotFound)
+			http.Error(w, fmt.Sprintf("Game can not be loaded: %s", err), gameErrorStatus(err))
 			return
 		}
 
-		history, err := db.List(r, game.UserID)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Game list can not be loaded: %s", err), http.StatusInternalServerError)
-			return
+		// Only the most recent games are shown, the others are linked to. The totals
+		// cover all games of the user.
+		history := []GameEntity{}
+		historyTotal := 0
+		var totals UserStats
+		if r.URL.Query().Get("noHistory") != "1" {
+			history, historyTotal, err = db.ListPage(r, game.UserID, 0, opts.historyLimit)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Game list can not be loaded: %s", err), http.StatusInternalServerError)
+				return
+			}
+			totals, err = loadUserStats(r, db, game.UserID, time.Time{}, opts.scoring)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Game list can not be loaded: %s", err), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		// Only the user can list their games.
+		historyURL := ""
+		if opts.hasIdentity(r, game.UserID) {
+			historyURL = opts.basePath + "/history"
 		}
 
-		render(templ, w, "game.html", struct {
-			ID      string
-			Answers []Answer
-			History []GameEntity
+		score := RescoreGame(game, opts.scoring)
+		page, locale := localizedTemplate(templ, r, "game.html")
+		render(templ, w, r, page, struct {
+			pageContext
+			ID       string
+			Scoring  ScoreConfig
+			Expected float64
+			Answers  []Answer
+			Score    GameScore
+			// Passed is true if the calibrated score of the game reaches the pass threshold.
+			Passed   bool
+			Feedback []Feedback
+			History  []GameEntity
+			// HistoryTotal is the number of games of the user, of which History
+			// contains the most recent ones.
+			HistoryTotal int
+			// Totals summarizes all completed games of the user. TotalCorrect and
+			// TotalTarget are its correct answers and the number expected.
+			Totals       UserStats
+			TotalCorrect float64
+			TotalTarget  float64
+			// HistoryURL links to the page listing all games, if the viewer is the user.
+			HistoryURL string
 		}{
-			ID:      id,
-			Answers: game.Answers,
-			History: history,
+			pageContext:  newPageContext(r, locale),
+			ID:           id,
+			Scoring:      opts.scoring,
+			Expected:     opts.scoring.expected(),
+			Answers:      game.Answers,
+			Score:        score,
+			Passed:       score.Calibration >= opts.passThreshold,
+			Feedback:     newFeedback(game.Answers, opts.scoring),
+			History:      history,
+			HistoryTotal: historyTotal,
+			Totals:       totals,
+			TotalCorrect: float64(totals.Correct),
+			TotalTarget:  float64(totals.Answers) * opts.scoring.expected(),
+			HistoryURL:   historyURL,
 		})
 	})
 }
 
-func lastGameHandler(db GameDatabase) http.Handler {
+// serveAutosave stores the answers of a game which is still being played, so it can be
+// resumed on the play page. The game belongs to the user if their identity is verified.
+func serveAutosave(w http.ResponseWriter, r *http.Request, db GameDatabase, id string, opts handlerOptions) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	defer r.Body.Close()
+
+	var answers []Answer
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, opts.maxBodyBytes)).Decode(&answers); err != nil {
+		http.Error(w, fmt.Sprintf("Error parsing answers: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	uid, verified := opts.userID(r)
+	if !verified {
+		uid = ""
+	}
+
+	if err := db.SaveProgress(r, id, uid, answers); err != nil {
+		if errors.Is(err, ErrGameCompleted) {
+			http.Error(w, fmt.Sprintf("Error saving progress: %s", err), http.StatusConflict)
+			return
+		}
+
+		http.Error(w, fmt.Sprintf("Error saving progress: %s", err), gameErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serveAbandon marks a game which has not been completed as abandoned, so its progress
+// is not resumed anymore.
+func serveAbandon(w http.ResponseWriter, r *http.Request, db GameDatabase, id string) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := db.Abandon(r, id); err != nil {
+		if errors.Is(err, ErrGameCompleted) {
+			http.Error(w, fmt.Sprintf("Error abandoning game: %s", err), http.StatusConflict)
+			return
+		}
+
+		http.Error(w, fmt.Sprintf("Error abandoning game: %s", err), gameErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func lastGameHandler(db GameDatabase, basePath string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		uid := path.Base(r.URL.Path)
 
 		game, err := db.Last(r, uid)
+		if errors.Is(err, ErrGameNotFound) {
+			http.Redirect(w, r, basePath+"/", http.StatusFound)
+			return
+		}
 		if err != nil {
 			http.Error(w, fmt.Sprintf("Game list can not be loaded: %s", err), http.StatusInternalServerError)
 			return
 		}
 
-		if game == nil {
-			http.Redirect(w, r, "/", http.StatusFound)
+		redirectToID(w, r, basePath+"/game/", game.ID, "", http.StatusFound)
+	})
+}
+
+func apiGameHandler(questions QuestionDatabase, db GameDatabase, opts handlerOptions) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := splitPath(r.URL.Path, "/api/game/")
+		if len(parts) != 2 {
+			http.NotFound(w, r)
 			return
 		}
 
-		http.Redirect(w, r, fmt.Sprintf("/game/%s", game.ID), http.StatusFound)
+		id, action := parts[0], parts[1]
+		switch action {
+		case "answers":
+			serveGameAnswers(w, r, db, id)
+		case "replay":
+			serveGameReplay(w, r, questions, db, id)
+		case "export.csv":
+			serveGameCSV(w, r, db, id, opts.scoring)
+		case "corrections":
+			serveGameCorrections(w, r, db, id, opts)
+		case "abandon":
+			serveAbandon(w, r, db, id)
+		default:
+			http.NotFound(w, r)
+		}
 	})
 }
+
+// answerSummary is an Answer without the embedded question.
+type answerSummary struct {
+	QuestionID string  `json:"questionId"`
+	LowerBound float64 `json:"lower"`
+	UpperBound float64 `json:"upper"`
+}
+
+func serveGameAnswers(w http.ResponseWriter, r *http.Request, db GameDatabase, id string) {
+	includeQuestions := true
+	if raw := r.URL.Query().Get("include_questions"); raw != "" {
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid value for include_questions: %s", err), http.StatusBadRequest)
+			return
+		}
+		includeQuestions = value
+	}
+
+	game, err := db.Get(r, id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Game can not be loaded: %s", err), gameErrorStatus(err))
+		return
+	}
+
+	if includeQuestions {
+		writeJSON(w, r, game.Answers)
+		return
+	}
+
+	summaries := make([]answerSummary, 0, len(game.Answers))
+	for _, a := range game.Answers {
+		summaries = append(summaries, answerSummary{
+			QuestionID: a.Question.ID,
+			LowerBound: a.LowerBound,
+			UpperBound: a.UpperBound,
+		})
+	}
+	writeJSON(w, r, summaries)
+}
+
+// gameReplay contains the questions of a game in the order they were presented.
+// Answers[i] is the answer to Questions[i].
+type gameReplay struct {
+	Questions []Question `json:"questions"`
+	Answers   []Answer   `json:"answers"`
+}
+
+func serveGameReplay(w http.ResponseWriter, r *http.Request, questions QuestionDatabase, db GameDatabase, id string) {
+	game, err := db.Get(r, id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Game can not be loaded: %s", err), gameErrorStatus(err))
+		return
+	}
+
+	// The questions contain the correct answers, so they are only replayed once the game
+	// has been submitted.
+	if !game.Completed() {
+		http.Error(w, "Game is not completed yet", http.StatusConflict)
+		return
+	}
+
+	if len(game.QuestionIDs) == 0 {
+		http.Error(w, fmt.Sprintf("Game %s is a legacy game without question order", id), http.StatusNotFound)
+		return
+	}
+
+	// Prefer the questions stored with the answers, they are what the user saw.
+	answered := make(map[string]Question, len(game.Answers))
+	for _, a := range game.Answers {
+		answered[a.Question.ID] = a.Question
+	}
+
+	replay := gameReplay{
+		Questions: make([]Question, 0, len(game.QuestionIDs)),
+		Answers:   game.Answers,
+	}
+	for _, qid := range game.QuestionIDs {
+		q, ok := answered[qid]
+		if !ok {
+			q, err = questions.GetByID(qid)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Question %s can not be loaded: %s", qid, err), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		replay.Questions = append(replay.Questions, q)
+	}
+
+	writeJSON(w, r, replay)
+}
@@ -0,0 +1,1279 @@
+package predictiongame
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type pushRecorder struct {
+	*httptest.ResponseRecorder
+	pushed []string
+}
+
+func (p *pushRecorder) Push(target string, opts *http.PushOptions) error {
+	p.pushed = append(p.pushed, target)
+	return nil
+}
+
+func TestPlayHandlerServerPush(t *testing.T) {
+	templ, err := loadTemplates()
+	if err != nil {
+		t.Fatalf("Can not load templates: %s", err)
+	}
+
+	for _, enabled := range []bool{true, false} {
+		w := &pushRecorder{ResponseRecorder: httptest.NewRecorder()}
+		r := httptest.NewRequest(http.MethodGet, "/play/test-game", nil)
+
+		playHandler(templ, SeedDemoQuestions(), NewMockGameDatabase(), newHandlerOptions(WithServerPush(enabled))).ServeHTTP(w, r)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+		}
+
+		var expected []string
+		if enabled {
+			expected = playAssets
+		}
+		if !reflect.DeepEqual(w.pushed, expected) {
+			t.Errorf("ServerPush=%v: expected pushes %v, got %v", enabled, expected, w.pushed)
+		}
+	}
+}
+
+func TestGameHandlerNoHistory(t *testing.T) {
+	templ, err := loadTemplates()
+	if err != nil {
+		t.Fatalf("Can not load templates: %s", err)
+	}
+
+	game := GameEntity{
+		ID:      "game",
+		UserID:  "user",
+		Answers: []Answer{{Question: demoQuestionList()[0], LowerBound: 1, UpperBound: 2}},
+	}
+
+	for _, tc := range []struct {
+		query     string
+		listCalls int
+	}{
+		{"", 1},
+		{"?noHistory=0", 1},
+		{"?noHistory=1", 0},
+	} {
+		db := NewMockGameDatabase(WithGetReturns(game, nil), WithListReturns([]GameEntity{game}, nil))
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/game/game"+tc.query, nil)
+
+		gameHandler(templ, db, defaultHandlerOptions()).ServeHTTP(w, r)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("%q: expected status %d, got %d", tc.query, http.StatusOK, w.Code)
+		}
+		if calls := len(db.Calls("ListPage")); calls != tc.listCalls {
+			t.Errorf("%q: expected %d calls to ListPage, got %d", tc.query, tc.listCalls, calls)
+		}
+	}
+}
+
+func TestGameHandlerHitRateBadge(t *testing.T) {
+	templ, err := loadTemplates()
+	if err != nil {
+		t.Fatalf("Can not load templates: %s", err)
+	}
+
+	q := demoQuestionList()[0]
+	low, high := q.correctRange()
+	for _, tc := range []struct {
+		answers []Answer
+		badge   string
+	}{
+		{[]Answer{{Question: q, LowerBound: low, UpperBound: high}, {Question: q, LowerBound: high + 1, UpperBound: high + 2}}, `<span class="badge">50%</span>`},
+		{[]Answer{}, `<span class="badge">0%</span>`},
+	} {
+		db := NewMockGameDatabase(WithGetReturns(GameEntity{ID: "game", UserID: "user", Answers: tc.answers}, nil))
+		w := httptest.NewRecorder()
+		gameHandler(templ, db, defaultHandlerOptions()).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/game/game", nil))
+		if body := w.Body.String(); !strings.Contains(body, tc.badge) {
+			t.Errorf("%d answers: expected %s, got %s", len(tc.answers), tc.badge, body)
+		}
+	}
+}
+
+func TestGameHandlerPassThreshold(t *testing.T) {
+	templ, err := loadTemplates()
+	if err != nil {
+		t.Fatalf("Can not load templates: %s", err)
+	}
+
+	q := demoQuestionList()[0]
+	low, high := q.correctRange()
+	correct := Answer{Question: q, LowerBound: low, UpperBound: high}
+	wrong := Answer{Question: q, LowerBound: high + 1, UpperBound: high + 2}
+	touching := Answer{Question: q, LowerBound: high, UpperBound: high + 1}
+	for _, tc := range []struct {
+		answers []Answer
+		opts    []Option
+		message string
+	}{
+		{[]Answer{correct, wrong}, nil, `id="passed"`},
+		{[]Answer{correct, correct}, nil, `id="notPassed"`},
+		{[]Answer{correct, correct}, []Option{WithPassThreshold(0)}, `id="passed"`},
+		{[]Answer{correct, correct, correct, wrong}, []Option{WithPassThreshold(0.9)}, `id="notPassed"`},
+		{[]Answer{correct, correct, correct, wrong}, []Option{WithPassThreshold(0.9), WithExpectedConfidence(0.75)}, `id="passed"`},
+		{[]Answer{correct, touching}, nil, `id="notPassed"`},
+		{[]Answer{correct, touching}, []Option{WithMinOverlapFraction(0.5)}, `id="passed"`},
+	} {
+		db := NewMockGameDatabase(WithGetReturns(GameEntity{ID: "game", UserID: "user", Answers: tc.answers}, nil))
+		w := httptest.NewRecorder()
+		gameHandler(templ, db, newHandlerOptions(tc.opts...)).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/game/game", nil))
+		if body := w.Body.String(); !strings.Contains(body, tc.message) {
+			t.Errorf("%d answers with %d options: expected %s, got %s", len(tc.answers), len(tc.opts), tc.message, body)
+		}
+	}
+}
+
+func TestGameHandlerHistoryLimit(t *testing.T) {
+	templ, err := loadTemplates()
+	if err != nil {
+		t.Fatalf("Can not load templates: %s", err)
+	}
+
+	q := demoQuestionList()[0]
+	game := GameEntity{
+		ID:      "game",
+		UserID:  "user",
+		Answers: []Answer{{Question: q, LowerBound: q.BoundLow, UpperBound: q.BoundHigh}},
+	}
+	history := make([]GameEntity, 5)
+	for i := range history {
+		history[i] = game
+	}
+
+	for _, tc := range []struct {
+		limit    int
+		identity string
+		viewAll  bool
+		rendered int
+	}{
+		{3, "user", true, 3},
+		{3, "other", false, 3},
+		{5, "user", false, 5},
+		{10, "user", false, 5},
+	} {
+		db := NewMockGameDatabase(WithGetReturns(game, nil), WithListReturns(history, nil))
+		r := httptest.NewRequest(http.MethodGet, "/game/game", nil)
+		addIdentity(r, tc.identity)
+		w := httptest.NewRecorder()
+		gameHandler(templ, db, newHandlerOptions(WithHistoryLimit(tc.limit), WithSessionSecret(testSessionSecret))).ServeHTTP(w, r)
+
+		calls := db.Calls("ListPage")
+		if len(calls) != 1 || calls[0].Args[2] != tc.limit {
+			t.Errorf("Limit %d: expected ListPage to be called with the limit, got %v", tc.limit, calls)
+		}
+
+		body := w.Body.String()
+		if strings.Contains(body, `href="/history"`) != tc.viewAll {
+			t.Errorf("Limit %d, identity %q: expected view all link %v", tc.limit, tc.identity, tc.viewAll)
+		}
+		if tc.rendered < len(history) && !strings.Contains(body, fmt.Sprintf("Showing the last %d of %d games.", tc.rendered, len(history))) {
+			t.Errorf("Limit %d: expected the number of shown games, got %s", tc.limit, body)
+		}
+		// The totals cover all games, not only the shown ones.
+		if !strings.Contains(body, fmt.Sprintf("%d (100%%)", len(history))) {
+			t.Errorf("Limit %d: expected the totals of all games, got %s", tc.limit, body)
+		}
+	}
+}
+
+func TestSimpleHandlerContentType(t *testing.T) {
+	templ, err := loadTemplates()
+	if err != nil {
+		t.Fatalf("Can not load templates: %s", err)
+	}
+
+	for _, name := range []string{"about.html", "help-overview.html", "help-elements.html", "index.html"} {
+		w := httptest.NewRecorder()
+		simpleHandler(templ, name).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if ct := w.Result().Header.Get("Content-Type"); ct != "text/html; charset=utf-8" {
+			t.Errorf("%s: unexpected Content-Type %q", name, ct)
+		}
+	}
+}
+
+func TestGameHandlerErrors(t *testing.T) {
+	templ, err := loadTemplates()
+	if err != nil {
+		t.Fatalf("Can not load templates: %s", err)
+	}
+
+	for _, tc := range []struct {
+		err    error
+		status int
+	}{
+		{ErrGameNotFound, http.StatusNotFound},
+		{fmt.Errorf("loading game: %w", ErrGameNotFound), http.StatusNotFound},
+		{errors.New("datastore unavailable"), http.StatusInternalServerError},
+	} {
+		db := NewMockGameDatabase(WithGetReturns(GameEntity{}, tc.err))
+		w := httptest.NewRecorder()
+
+		gameHandler(templ, db, defaultHandlerOptions()).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/game/game", nil))
+		if w.Code != tc.status {
+			t.Errorf("%v: expected status %d, got %d", tc.err, tc.status, w.Code)
+		}
+	}
+}
+
+func TestGameReplay(t *testing.T) {
+	questions := SeedDemoQuestions()
+	games := NewMemoryGameDatabase()
+
+	list := demoQuestionList()
+	answers := []Answer{
+		{Question: list[2], LowerBound: 1, UpperBound: 2},
+		{Question: list[0], LowerBound: 3, UpperBound: 4},
+	}
+	if err := games.SaveQuestions(nil, "game", []string{list[2].ID, list[0].ID}); err != nil {
+		t.Fatalf("Can not save questions: %s", err)
+	}
+	if err := games.Save(nil, GameEntity{ID: "game", UserID: "user", Answers: answers}); err != nil {
+		t.Fatalf("Can not save game: %s", err)
+	}
+
+	w := httptest.NewRecorder()
+	apiGameHandler(questions, games, defaultHandlerOptions()).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/game/game/replay", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var replay gameReplay
+	if err := json.NewDecoder(w.Body).Decode(&replay); err != nil {
+		t.Fatalf("Can not decode replay: %s", err)
+	}
+
+	if len(replay.Questions) != len(answers) || len(replay.Answers) != len(answers) {
+		t.Fatalf("Expected %d questions and answers, got %d and %d", len(answers), len(replay.Questions), len(replay.Answers))
+	}
+	for i, a := range answers {
+		if replay.Questions[i].ID != a.Question.ID {
+			t.Errorf("Question %d: expected %s, got %s", i, a.Question.ID, replay.Questions[i].ID)
+		}
+		if replay.Answers[i].LowerBound != a.LowerBound {
+			t.Errorf("Answer %d: expected lower bound %v, got %v", i, a.LowerBound, replay.Answers[i].LowerBound)
+		}
+	}
+}
+
+func TestGameQuestionsStored(t *testing.T) {
+	questions := SeedDemoQuestions()
+	games := NewMemoryGameDatabase()
+	opts := newHandlerOptions(WithNumQuestions(3))
+
+	selected, progress, err := gameQuestions(httptest.NewRequest(http.MethodGet, "/play/game", nil), questions, games, "game", "", "en", opts)
+	if err != nil || len(selected) != 3 || progress != nil {
+		t.Fatalf("Unexpected questions %+v and progress %+v (%v)", selected, progress, err)
+	}
+
+	game, err := games.Get(nil, "game")
+	if err != nil || game.Status != GamePending || len(game.QuestionIDs) != 3 {
+		t.Fatalf("Expected a pending game with the served questions, got %+v (%v)", game, err)
+	}
+	for i, q := range selected {
+		if game.QuestionIDs[i] != q.ID {
+			t.Errorf("Question %d: expected %s to be stored, got %s", i, q.ID, game.QuestionIDs[i])
+		}
+	}
+
+	// The stored selection is served again, even if the client answers in another order.
+	answers := []Answer{{Question: selected[1], LowerBound: 1, UpperBound: 2}}
+	if err := games.SaveProgress(nil, "game", "", answers); err != nil {
+		t.Fatalf("Can not save progress: %s", err)
+	}
+	again, progress, err := gameQuestions(httptest.NewRequest(http.MethodGet, "/play/game", nil), questions, games, "game", "", "de", opts)
+	if err != nil || len(again) != 3 || len(progress) != 1 || again[0].ID != selected[1].ID {
+		t.Errorf("Expected the stored questions, answered first, got %+v (%v)", again, err)
+	}
+	if err := games.Save(nil, GameEntity{ID: "game", UserID: "user", Answers: answers}); err != nil {
+		t.Fatalf("Can not save game: %s", err)
+	}
+	if game, _ := games.Get(nil, "game"); !reflect.DeepEqual(game.QuestionIDs, []string{selected[0].ID, selected[1].ID, selected[2].ID}) {
+		t.Errorf("Expected the served order to be kept, got %v", game.QuestionIDs)
+	}
+}
+
+func TestGameReplayLegacyGame(t *testing.T) {
+	legacy := GameEntity{
+		ID:      "game",
+		Answers: []Answer{{Question: demoQuestionList()[0], LowerBound: 1, UpperBound: 2}},
+	}
+	db := NewMockGameDatabase(WithGetReturns(legacy, nil))
+
+	w := httptest.NewRecorder()
+	apiGameHandler(SeedDemoQuestions(), db, defaultHandlerOptions()).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/game/game/replay", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestGameReplayPendingGame(t *testing.T) {
+	q := demoQuestionList()[0]
+	pending := GameEntity{
+		ID:          "game",
+		UserID:      "user",
+		Status:      GameInProgress,
+		QuestionIDs: []string{q.ID},
+	}
+	db := NewMockGameDatabase(WithGetReturns(pending, nil))
+
+	w := httptest.NewRecorder()
+	apiGameHandler(SeedDemoQuestions(), db, defaultHandlerOptions()).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/game/game/replay", nil))
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status %d, got %d", http.StatusConflict, w.Code)
+	}
+	if body := w.Body.String(); strings.Contains(body, q.Text) {
+		t.Errorf("Expected no questions of a pending game, got %s", body)
+	}
+}
+
+func TestGameAnswersHandler(t *testing.T) {
+	q := demoQuestionList()[0]
+	game := GameEntity{
+		ID:      "game",
+		UserID:  "user",
+		Answers: []Answer{{Question: q, LowerBound: 1, UpperBound: 2}},
+	}
+	handler := apiGameHandler(SeedDemoQuestions(), NewMockGameDatabase(WithGetReturns(game, nil)), defaultHandlerOptions())
+
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	w := get("/api/game/game/answers")
+	var answers []Answer
+	if err := json.NewDecoder(w.Body).Decode(&answers); err != nil || !reflect.DeepEqual(answers, game.Answers) {
+		t.Errorf("Expected the answers with their questions, got %+v (%v)", answers, err)
+	}
+
+	w = get("/api/game/game/answers?include_questions=false")
+	if body := w.Body.String(); strings.Contains(body, `"question"`) {
+		t.Errorf("Expected the answers without questions, got %s", body)
+	}
+	var summaries []answerSummary
+	if err := json.NewDecoder(w.Body).Decode(&summaries); err != nil || !reflect.DeepEqual(summaries, []answerSummary{{QuestionID: q.ID, LowerBound: 1, UpperBound: 2}}) {
+		t.Errorf("Unexpected answers %+v (%v)", summaries, err)
+	}
+
+	if w := get("/api/game/game/answers?include_questions=maybe"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid parameter, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	missing := apiGameHandler(SeedDemoQuestions(), NewMockGameDatabase(WithGetReturns(GameEntity{}, ErrGameNotFound)), defaultHandlerOptions())
+	missing.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/game/missing/answers", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for a missing game, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestLastGameHandler(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		game     *GameEntity
+		err      error
+		status   int
+		location string
+	}{
+		{"last game", &GameEntity{ID: "game"}, nil, http.StatusFound, "/game/game"},
+		{"no games", nil, ErrGameNotFound, http.StatusFound, "/"},
+		{"database error", nil, errors.New("datastore unavailable"), http.StatusInternalServerError, ""},
+	} {
+		db := NewMockGameDatabase(WithLastReturns(tc.game, tc.err))
+		w := httptest.NewRecorder()
+
+		lastGameHandler(db, "").ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/lastGame/user", nil))
+		if w.Code != tc.status {
+			t.Errorf("%s: expected status %d, got %d", tc.name, tc.status, w.Code)
+		}
+		if location := w.Header().Get("Location"); location != tc.location {
+			t.Errorf("%s: expected location %q, got %q", tc.name, tc.location, location)
+		}
+	}
+}
+
+func TestSubmitHandlerBodyLimit(t *testing.T) {
+	db := NewMockGameDatabase()
+	handler := submitHandler(SeedDemoQuestions(), db, NewTournamentDatabase(), NewMultiplayerHub(), defaultHandlerOptions())
+
+	body := "data=" + strings.Repeat("x", int(defaultHandlerOptions().maxBodyBytes))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/game", strings.NewReader(body)))
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status %d, got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+	if calls := db.Calls("Save"); len(calls) != 0 {
+		t.Errorf("Expected no saved game, got %v", calls)
+	}
+}
+
+func TestNewGameHandlerQuestionsCount(t *testing.T) {
+	games := NewMemoryGameDatabase()
+	handler := newGameHandler(nil, games, defaultHandlerOptions())
+
+	for _, tc := range []struct {
+		body   string
+		status int
+	}{
+		{``, http.StatusSeeOther},
+		{`{"questions_count": 5}`, http.StatusSeeOther},
+		{`{"questions_count": 0}`, http.StatusBadRequest},
+		{`{"questions_count": 51}`, http.StatusBadRequest},
+		{`{"questions_count": "5"}`, http.StatusBadRequest},
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/play", strings.NewReader(tc.body)))
+
+		if w.Code != tc.status {
+			t.Errorf("%q: expected status %d, got %d", tc.body, tc.status, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/play", strings.NewReader(`{"questions_count": 5}`)))
+
+	id := strings.TrimPrefix(w.Header().Get("Location"), "/play/")
+	game, err := games.Get(nil, id)
+	if err != nil {
+		t.Fatalf("Can not load game %s: %s", id, err)
+	}
+	if game.QuestionCount != 5 || game.Completed() {
+		t.Errorf("Expected an in-progress game with 5 questions, got %+v", game)
+	}
+}
+
+func TestNewGameHandlerPostOnly(t *testing.T) {
+	for _, tc := range []struct {
+		postOnly bool
+		method   string
+		status   int
+	}{
+		{false, http.MethodGet, http.StatusFound},
+		{true, http.MethodGet, http.StatusOK},
+		{true, http.MethodHead, http.StatusOK},
+		{true, http.MethodPost, http.StatusSeeOther},
+		{true, http.MethodPut, http.StatusMethodNotAllowed},
+	} {
+		handler := NewHandler(nil, SeedDemoQuestions(), NewMemoryGameDatabase(), WithPostOnlyPlayStart(tc.postOnly))
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(tc.method, "/play?uid=user", nil))
+		if w.Code != tc.status {
+			t.Errorf("%v %s: expected status %d, got %d", tc.postOnly, tc.method, tc.status, w.Code)
+			continue
+		}
+
+		if tc.postOnly && tc.method == http.MethodGet {
+			if body := w.Body.String(); !strings.Contains(body, `id="startGame"`) || !strings.Contains(body, `action="/play?uid=user"`) {
+				t.Errorf("Expected a button posting to /play?uid=user, got %s", body)
+			}
+		}
+	}
+}
+
+func TestResumeQuestions(t *testing.T) {
+	list := demoQuestionList()
+	progress := []Answer{{Question: list[3]}}
+
+	selected := resumeQuestions(progress, list[:6], 4)
+	if len(selected) != 4 || selected[0].ID != list[3].ID {
+		t.Errorf("Expected 4 questions starting with the answered one, got %+v", selected)
+	}
+}
+
+func TestSelectionUser(t *testing.T) {
+	templ, err := loadTemplates()
+	if err != nil {
+		t.Fatalf("Can not load templates: %s", err)
+	}
+	opts := newHandlerOptions(WithSessionSecret(testSessionSecret))
+
+	for _, tc := range []struct {
+		identity string
+		expected string
+	}{
+		{"", ""},
+		{"user", "user"},
+	} {
+		games := NewMockGameDatabase(WithGetReturns(GameEntity{}, ErrGameNotFound))
+		// The uid parameter is not trusted, only the verified identity is.
+		r := httptest.NewRequest(http.MethodGet, "/play/game?uid=victim", nil)
+		if tc.identity != "" {
+			addIdentity(r, tc.identity)
+		}
+		playHandler(templ, SeedDemoQuestions(), games, opts).ServeHTTP(httptest.NewRecorder(), r)
+
+		calls := games.Calls("List")
+		switch {
+		case tc.expected == "" && len(calls) != 0:
+			t.Errorf("Identity %q: expected no history to be loaded, got %v", tc.identity, calls)
+		case tc.expected != "" && (len(calls) != 1 || calls[0].Args[0] != tc.expected):
+			t.Errorf("Identity %q: expected the history of %q to be loaded, got %v", tc.identity, tc.expected, calls)
+		}
+	}
+}
+
+func TestAutosave(t *testing.T) {
+	templ, err := loadTemplates()
+	if err != nil {
+		t.Fatalf("Can not load templates: %s", err)
+	}
+	questions := SeedDemoQuestions()
+	games := NewMemoryGameDatabase()
+	opts := newHandlerOptions(WithNumQuestions(3), WithSessionSecret(testSessionSecret))
+
+	selected, _, err := gameQuestions(httptest.NewRequest(http.MethodGet, "/play/game", nil), questions, games, "game", "", "en", opts)
+	if err != nil {
+		t.Fatalf("Can not select questions: %s", err)
+	}
+	answers := []Answer{{Question: selected[2], LowerBound: 1, UpperBound: 2}}
+	body, _ := json.Marshal(answers)
+
+	autosave := func(method, id, body string) int {
+		r := httptest.NewRequest(method, "/game/"+id+"/autosave", strings.NewReader(body))
+		addIdentity(r, "user")
+		w := httptest.NewRecorder()
+		gameHandler(templ, games, opts).ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := autosave(http.MethodPost, "game", string(body)); code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusNoContent, code)
+	}
+	game, err := games.Get(nil, "game")
+	if err != nil || game.Status != GameInProgress || game.UserID != "user" || len(game.Answers) != 1 {
+		t.Errorf("Expected the progress of the user to be stored, got %+v (%v)", game, err)
+	}
+
+	// The play page resumes the game with the answered questions first.
+	w := httptest.NewRecorder()
+	playHandler(templ, questions, games, opts).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/play/game", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	page := html.UnescapeString(w.Body.String())
+	if !strings.Contains(page, `"lower":1`) || strings.Index(page, selected[2].ID) > strings.Index(page, selected[0].ID) {
+		t.Errorf("Expected the play page to resume the progress, got %s", page)
+	}
+	if strings.Contains(page, fmt.Sprintf(`"boundLow":%v`, selected[2].BoundLow)) {
+		t.Errorf("Expected the progress not to reveal the correct range, got %s", page)
+	}
+
+	for _, tc := range []struct {
+		method, body string
+		expected     int
+	}{
+		{http.MethodGet, "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "{", http.StatusBadRequest},
+	} {
+		if code := autosave(tc.method, "game", tc.body); code != tc.expected {
+			t.Errorf("%s %q: expected status %d, got %d", tc.method, tc.body, tc.expected, code)
+		}
+	}
+
+	if err := games.Save(nil, GameEntity{ID: "game", UserID: "user", Answers: answers}); err != nil {
+		t.Fatalf("Can not save game: %s", err)
+	}
+	if code := autosave(http.MethodPost, "game", string(body)); code != http.StatusConflict {
+		t.Errorf("Expected status %d for a completed game, got %d", http.StatusConflict, code)
+	}
+
+	if err := games.Start(nil, "abandoned", 3); err != nil {
+		t.Fatalf("Can not start game: %s", err)
+	}
+	if err := games.Abandon(nil, "abandoned"); err != nil {
+		t.Fatalf("Can not abandon game: %s", err)
+	}
+	if code := autosave(http.MethodPost, "abandoned", string(body)); code != http.StatusConflict {
+		t.Errorf("Expected status %d for an abandoned game, got %d", http.StatusConflict, code)
+	}
+}
+
+func TestAutosaveUnverifiedUser(t *testing.T) {
+	games := NewMemoryGameDatabase()
+
+	r := httptest.NewRequest(http.MethodPost, "/game/game/autosave?uid=someone", strings.NewReader(`[]`))
+	w := httptest.NewRecorder()
+	gameHandler(nil, games, newHandlerOptions(WithSessionSecret(testSessionSecret))).ServeHTTP(w, r)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+	if game, err := games.Get(nil, "game"); err != nil || game.UserID != "" {
+		t.Errorf("Expected no user without a verified identity, got %+v (%v)", game, err)
+	}
+}
+
+func TestNewHandler(t *testing.T) {
+	templ, err := loadTemplates()
+	if err != nil {
+		t.Fatalf("Can not load templates: %s", err)
+	}
+
+	handler := NewHandler(templ, SeedDemoQuestions(), NewMockGameDatabase())
+
+	for _, tc := range []struct {
+		path   string
+		status int
+	}{
+		{"/", http.StatusOK},
+		{"/about", http.StatusOK},
+		{"/robots.txt", http.StatusOK},
+		{"/api/questions/random", http.StatusOK},
+		{"/api/tournaments/unknown", http.StatusNotFound},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		handler.ServeHTTP(w, r)
+
+		if w.Code != tc.status {
+			t.Errorf("%s: expected status %d, got %d", tc.path, tc.status, w.Code)
+		}
+		if vary := w.Header().Get("Vary"); vary != "Accept-Encoding" {
+			t.Errorf("%s: expected responses to pass the gzip middleware, got Vary %q", tc.path, vary)
+		}
+	}
+}
+
+func TestSubmitHandlerInvalidID(t *testing.T) {
+	for _, id := range []string{"", "../admin", "//evil.example.com", "game\r\nSet-Cookie: session=evil", "game?x=1", strings.Repeat("a", maxIDLength+1)} {
+		db := NewMockGameDatabase()
+		handler := submitHandler(SeedDemoQuestions(), db, NewTournamentDatabase(), NewMultiplayerHub(), defaultHandlerOptions())
+
+		data, _ := json.Marshal(GameEntity{ID: id, UserID: "user"})
+		body := "data=" + url.QueryEscape(string(data))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/game", strings.NewReader(body)))
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected status %d, got %d", id, http.StatusBadRequest, w.Code)
+		}
+		if location := w.Header().Get("Location"); location != "" {
+			t.Errorf("%q: unexpected redirect to %q", id, location)
+		}
+		if calls := db.Calls("Save"); len(calls) != 0 {
+			t.Errorf("%q: expected no saved game, got %v", id, calls)
+		}
+	}
+}
+
+func TestSubmitHandlerValidation(t *testing.T) {
+	answers, _ := json.Marshal([]Answer{{Question: demoQuestionList()[0], LowerBound: 1, UpperBound: 2}})
+
+	for _, tc := range []struct {
+		data, message string
+	}{
+		{`{"uid": "user", "answers": ` + string(answers) + `}`, "Missing game ID"},
+		{`{"id": "game", "answers": ` + string(answers) + `}`, "Missing user ID"},
+		{`{"id": "game", "uid": "user"}`, "Missing answers"},
+		{`{"id": "game", "uid": "user", "answers": null}`, "Missing answers"},
+		{`{"id": "game", "uid": "user", "answers": ` + string(answers) + `, "extra": 1}`, `unknown field "extra"`},
+	} {
+		db := NewMockGameDatabase()
+		handler := submitHandler(SeedDemoQuestions(), db, NewTournamentDatabase(), NewMultiplayerHub(), defaultHandlerOptions())
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/game", strings.NewReader("data="+url.QueryEscape(tc.data))))
+
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tc.message) {
+			t.Errorf("%s: expected status %d with %q, got %d: %s", tc.data, http.StatusBadRequest, tc.message, w.Code, w.Body)
+		}
+		if calls := db.Calls("Save"); len(calls) != 0 {
+			t.Errorf("%s: expected no saved game, got %v", tc.data, calls)
+		}
+	}
+}
+
+func TestSubmitHandlerFormats(t *testing.T) {
+	data, _ := json.Marshal(GameEntity{ID: "game", UserID: "user", Answers: []Answer{{Question: demoQuestionList()[0], LowerBound: 1, UpperBound: 2}}})
+
+	for _, tc := range []struct {
+		contentType, body string
+		status            int
+		deprecated        bool
+	}{
+		{"application/json", string(data), http.StatusCreated, false},
+		{"application/json; charset=utf-8", string(data), http.StatusCreated, false},
+		{"application/x-www-form-urlencoded", "data=" + url.QueryEscape(string(data)), http.StatusFound, true},
+		{"", "data=" + url.QueryEscape(string(data)), http.StatusFound, true},
+		{"application/json", "data=" + url.QueryEscape(string(data)), http.StatusBadRequest, false},
+	} {
+		db := NewMemoryGameDatabase()
+		handler := submitHandler(SeedDemoQuestions(), db, NewTournamentDatabase(), NewMultiplayerHub(), defaultHandlerOptions())
+
+		r := httptest.NewRequest(http.MethodPost, "/game", strings.NewReader(tc.body))
+		r.Header.Set("Content-Type", tc.contentType)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != tc.status {
+			t.Errorf("%q: expected status %d, got %d: %s", tc.contentType, tc.status, w.Code, w.Body)
+			continue
+		}
+		if deprecated := w.Header().Get("Deprecation") != ""; deprecated != tc.deprecated {
+			t.Errorf("%q: expected deprecated=%v, got header %q", tc.contentType, tc.deprecated, w.Header().Get("Deprecation"))
+		}
+		if w.Code == http.StatusBadRequest {
+			continue
+		}
+
+		if location := w.Header().Get("Location"); location != "/game/game" {
+			t.Errorf("%q: expected the results at /game/game, got %q", tc.contentType, location)
+		}
+		if _, err := db.Get(nil, "game"); err != nil {
+			t.Errorf("%q: expected the game to be saved, got %v", tc.contentType, err)
+		}
+		if w.Code == http.StatusCreated {
+			var result submitResult
+			if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil || result.ID != "game" || result.URL != "/game/game" {
+				t.Errorf("%q: unexpected result %s (%v)", tc.contentType, w.Body, err)
+			}
+		}
+	}
+}
+
+func TestSubmitHandlerIdempotencyKey(t *testing.T) {
+	data, _ := json.Marshal(GameEntity{ID: "game", UserID: "user", Answers: []Answer{{Question: demoQuestionList()[0], LowerBound: 1, UpperBound: 2}}})
+	db := NewMemoryGameDatabase()
+	handler := submitHandler(SeedDemoQuestions(), db, NewTournamentDatabase(), NewMultiplayerHub(), newHandlerOptions(WithSessionSecret(testSessionSecret)))
+
+	submit := func(key string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/game", strings.NewReader(string(data)))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("Idempotency-Key", key)
+		addIdentity(r, "user")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	first := submit("key-1")
+	if first.Code != http.StatusCreated || first.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("Expected the game to be saved, got %d %v: %s", first.Code, first.Header(), first.Body)
+	}
+	saved, err := db.Get(nil, "game")
+	if err != nil || saved.IdempotencyKey != "key-1" {
+		t.Fatalf("Expected the key to be stored with the game, got %+v (%v)", saved, err)
+	}
+
+	repeated := submit("key-1")
+	if repeated.Code != http.StatusCreated || repeated.Header().Get("Idempotent-Replayed") != "true" || repeated.Body.String() != first.Body.String() {
+		t.Errorf("Expected the original result, got %d %v: %s", repeated.Code, repeated.Header(), repeated.Body)
+	}
+	if again, _ := db.Get(nil, "game"); !again.Time.Equal(saved.Time) {
+		t.Errorf("Expected the game not to be saved again, got time %v instead of %v", again.Time, saved.Time)
+	}
+
+	// With a different key it is a new submit of the completed game.
+	if w := submit("key-2"); w.Code != http.StatusConflict || w.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("Expected status %d for a different key, got %d %v", http.StatusConflict, w.Code, w.Header())
+	}
+	if w := submit("invalid key"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid key, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestSubmitHandlerIdempotencyKeyConcurrent(t *testing.T) {
+	data, _ := json.Marshal(GameEntity{ID: "game", UserID: "user", Answers: []Answer{{Question: demoQuestionList()[0], LowerBound: 1, UpperBound: 2}}})
+	handler := submitHandler(SeedDemoQuestions(), NewMemoryGameDatabase(), NewTournamentDatabase(), NewMultiplayerHub(), newHandlerOptions(WithSessionSecret(testSessionSecret)))
+
+	codes := make([]int, 10)
+	replayed := make([]bool, len(codes))
+	var wg sync.WaitGroup
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			r := httptest.NewRequest(http.MethodPost, "/game", strings.NewReader(string(data)))
+			r.Header.Set("Content-Type", "application/json")
+			r.Header.Set("Idempotency-Key", "key")
+			addIdentity(r, "user")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			codes[i], replayed[i] = w.Code, w.Header().Get("Idempotent-Replayed") == "true"
+		}(i)
+	}
+	wg.Wait()
+
+	saved := 0
+	for i, code := range codes {
+		if code != http.StatusCreated {
+			t.Errorf("Submit %d: expected status %d, got %d", i, http.StatusCreated, code)
+		}
+		if !replayed[i] {
+			saved++
+		}
+	}
+	if saved != 1 {
+		t.Errorf("Expected the game to be saved once, got %d", saved)
+	}
+}
+
+func TestSubmitHandlerNormalizesAnswers(t *testing.T) {
+	db := NewMemoryGameDatabase()
+	handler := submitHandler(SeedDemoQuestions(), db, NewTournamentDatabase(), NewMultiplayerHub(), defaultHandlerOptions())
+
+	q := demoQuestionList()[0]
+	data, _ := json.Marshal(GameEntity{ID: "game", UserID: "user", Answers: []Answer{
+		{Question: q, LowerBound: 20, UpperBound: 10},
+		{Question: q, LowerBound: 10, UpperBound: 20, Inverted: true},
+	}})
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/game", strings.NewReader("data="+url.QueryEscape(string(data)))))
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expected status %d, got %d", http.StatusFound, w.Code)
+	}
+
+	game, err := db.Get(nil, "game")
+	if err != nil {
+		t.Fatalf("Can not load game: %s", err)
+	}
+	for i, expected := range []bool{true, false} {
+		a := game.Answers[i]
+		if a.LowerBound != 10 || a.UpperBound != 20 || a.Inverted != expected {
+			t.Errorf("Answer %d: expected the range 10-20 with inverted %v, got %+v", i, expected, a)
+		}
+	}
+}
+
+func TestLastGameHandlerInvalidID(t *testing.T) {
+	db := NewMockGameDatabase(WithLastReturns(&GameEntity{ID: "//evil.example.com"}, nil))
+
+	w := httptest.NewRecorder()
+	lastGameHandler(db, "").ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/lastGame/user", nil))
+
+	if w.Code != http.StatusBadRequest || w.Header().Get("Location") != "" {
+		t.Errorf("Expected status %d without redirect, got %d %q", http.StatusBadRequest, w.Code, w.Header().Get("Location"))
+	}
+}
+
+func TestQuestionHandlerOrder(t *testing.T) {
+	list := demoQuestionList()
+	for i := range list {
+		list[i].Difficulty = float64(i % 4)
+	}
+	handler := questionHandler(NewQuestionDatabase(list, nil), defaultHandlerOptions())
+
+	for _, tc := range []struct {
+		order  string
+		status int
+		sorted func(a, b float64) bool
+	}{
+		{"", http.StatusOK, nil},
+		{"?order=random", http.StatusOK, nil},
+		{"?order=difficulty_asc", http.StatusOK, func(a, b float64) bool { return a <= b }},
+		{"?order=difficulty_desc", http.StatusOK, func(a, b float64) bool { return a >= b }},
+		{"?order=alphabetical", http.StatusBadRequest, nil},
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/questions/random"+tc.order, nil))
+		if w.Code != tc.status {
+			t.Errorf("%q: expected status %d, got %d", tc.order, tc.status, w.Code)
+			continue
+		}
+		if tc.status != http.StatusOK {
+			continue
+		}
+
+		var selected []Question
+		if err := json.NewDecoder(w.Body).Decode(&selected); err != nil {
+			t.Fatalf("Can not decode questions: %s", err)
+		}
+		if len(selected) != NumQuestions {
+			t.Errorf("%q: expected %d questions, got %d", tc.order, NumQuestions, len(selected))
+		}
+		for i := 1; tc.sorted != nil && i < len(selected); i++ {
+			if !tc.sorted(selected[i-1].Weight(), selected[i].Weight()) {
+				t.Errorf("%q: questions are not sorted: %g before %g", tc.order, selected[i-1].Weight(), selected[i].Weight())
+			}
+		}
+	}
+}
+
+func TestQuestionHandlerFilters(t *testing.T) {
+	list := demoQuestionList()
+	for i := range list {
+		list[i].Category = "History"
+	}
+	list[0].Category = "Science"
+	list[1].Category = "science"
+	list[2].Category = "Science"
+	handler := questionHandler(NewQuestionDatabase(list, nil), defaultHandlerOptions())
+
+	for _, tc := range []struct {
+		method   string
+		body     string
+		status   int
+		expected []string
+	}{
+		{http.MethodPost, `{"exclude_ids": ["` + list[0].ID + `"], "category": "SCIENCE", "n": 5}`, http.StatusOK, []string{list[1].ID, list[2].ID}},
+		{http.MethodPost, `{"category": "science", "n": 1}`, http.StatusOK, nil},
+		{http.MethodPost, `{"n": 1000}`, http.StatusBadRequest, nil},
+		{http.MethodPost, `{"n": -1}`, http.StatusBadRequest, nil},
+		{http.MethodPost, `[1, 2]`, http.StatusBadRequest, nil},
+		{http.MethodDelete, ``, http.StatusMethodNotAllowed, nil},
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(tc.method, "/api/questions/random", strings.NewReader(tc.body)))
+		if w.Code != tc.status {
+			t.Errorf("%s %s: expected status %d, got %d", tc.method, tc.body, tc.status, w.Code)
+			continue
+		}
+		if tc.status != http.StatusOK {
+			continue
+		}
+
+		var selected []Question
+		if err := json.NewDecoder(w.Body).Decode(&selected); err != nil {
+			t.Fatalf("Can not decode questions: %s", err)
+		}
+		if tc.expected == nil {
+			if len(selected) != 1 || !strings.EqualFold(selected[0].Category, "science") {
+				t.Errorf("%s: unexpected questions %v", tc.body, selected)
+			}
+			continue
+		}
+
+		ids := map[string]bool{}
+		for _, q := range selected {
+			ids[q.ID] = true
+		}
+		if len(ids) != len(tc.expected) || !ids[tc.expected[0]] || !ids[tc.expected[1]] {
+			t.Errorf("%s: expected %v, got %v", tc.body, tc.expected, ids)
+		}
+	}
+
+	// Without a body, POST and GET select the configured number of random questions.
+	handler = questionHandler(NewQuestionDatabase(list, nil), newHandlerOptions(WithNumQuestions(5)))
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, "/api/questions/random", nil))
+
+		var selected []Question
+		if err := json.NewDecoder(w.Body).Decode(&selected); err != nil || len(selected) != 5 {
+			t.Errorf("%s: expected 5 questions, got %d (%v)", method, len(selected), err)
+		}
+	}
+}
+
+func TestQuestionDifficultyHandler(t *testing.T) {
+	db := NewMockGameDatabase(WithQuestionStatsReturns(map[string]QuestionStats{
+		"popular": {QuestionID: "popular", Answers: minDifficultyAnswers, Correct: minDifficultyAnswers / 4},
+		"rare":    {QuestionID: "rare", Answers: minDifficultyAnswers - 1, Correct: 1},
+	}, nil))
+
+	opts := newHandlerOptions(WithScoringMode(ScoringContain))
+	handler := questionDifficultyHandler(db, opts)
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/questions/difficulty", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+		}
+
+		var difficulty map[string]float64
+		if err := json.NewDecoder(w.Body).Decode(&difficulty); err != nil {
+			t.Fatalf("Can not decode difficulty: %s", err)
+		}
+		if expected := map[string]float64{"popular": 0.25}; !reflect.DeepEqual(difficulty, expected) {
+			t.Errorf("Expected %v, got %v", expected, difficulty)
+		}
+	}
+	if calls := db.Calls("QuestionStats"); len(calls) != 1 || calls[0].Args[0] != opts.scoring {
+		t.Errorf("Expected the stats to be loaded once with the scoring rules, got %v", calls)
+	}
+
+	db = NewMockGameDatabase(WithQuestionStatsReturns(nil, errors.New("datastore unavailable")))
+	handler = questionDifficultyHandler(db, opts)
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/questions/difficulty", nil))
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("Expected status %d, got %d", http.StatusInternalServerError, w.Code)
+		}
+	}
+	if calls := db.Calls("QuestionStats"); len(calls) != 2 {
+		t.Errorf("Expected errors not to be cached, got %v", calls)
+	}
+}
+
+func TestDifficultyCacheExpires(t *testing.T) {
+	db := NewMockGameDatabase(WithQuestionStatsReturns(map[string]QuestionStats{}, nil))
+	now := time.Now()
+	cache := newDifficultyCache(time.Minute)
+	cache.now = func() time.Time { return now }
+
+	cache.get(nil, db, ScoreConfig{})
+	cache.get(nil, db, ScoreConfig{})
+	now = now.Add(time.Minute)
+	cache.get(nil, db, ScoreConfig{})
+	if calls := db.Calls("QuestionStats"); len(calls) != 2 {
+		t.Errorf("Expected the expired difficulties to be computed again, got %v", calls)
+	}
+}
+
+func TestQuestionStatsHandler(t *testing.T) {
+	questions := SeedDemoQuestions()
+	q := demoQuestionList()[0]
+	games := NewMemoryGameDatabase()
+	for i, width := range []float64{10, 20, 30, 100} {
+		answers := []Answer{{Question: q, LowerBound: q.BoundLow, UpperBound: q.BoundLow + width}}
+		if err := games.Save(nil, GameEntity{ID: fmt.Sprintf("game%d", i), UserID: "user", Answers: answers}); err != nil {
+			t.Fatalf("Can not save game: %s", err)
+		}
+	}
+	handler := questionByIDHandler(questions, games, &etagCache{}, defaultHandlerOptions())
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/questions/"+q.ID+"/stats?buckets=3", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var stats questionStatsResponse
+	if err := json.NewDecoder(w.Body).Decode(&stats); err != nil {
+		t.Fatalf("Can not decode stats: %s", err)
+	}
+	if stats.QuestionID != q.ID || stats.TotalAttempts != 4 || stats.CorrectCount != 4 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	if stats.AverageLowerBound != q.BoundLow || stats.AverageUpperBound != q.BoundLow+40 {
+		t.Errorf("Unexpected average bounds %v and %v", stats.AverageLowerBound, stats.AverageUpperBound)
+	}
+	if expected := []histogramBucket{{10, 40, 3}, {40, 70, 0}, {70, 100, 1}}; !reflect.DeepEqual(stats.WidthHistogram, expected) {
+		t.Errorf("Expected histogram %v, got %v", expected, stats.WidthHistogram)
+	}
+
+	for _, tc := range []struct {
+		path   string
+		status int
+	}{
+		{"/api/questions/missing/stats", http.StatusNotFound},
+		{"/api/questions/" + q.ID + "/stats?buckets=0", http.StatusBadRequest},
+		{"/api/questions/" + q.ID + "/other", http.StatusNotFound},
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if w.Code != tc.status {
+			t.Errorf("%s: expected status %d, got %d", tc.path, tc.status, w.Code)
+		}
+	}
+}
+
+func TestAnswerStrPrecision(t *testing.T) {
+	for _, tc := range []struct {
+		answer   Answer
+		expected string
+	}{
+		{Answer{Question: Question{}, LowerBound: 1200.4, UpperBound: 1500.6}, "1200-1501"},
+		{Answer{Question: Question{Precision: 2}, LowerBound: 12.5, UpperBound: 12.5}, "12.50"},
+		{Answer{Question: Question{Kind: PointQuestion, Precision: 1}, LowerBound: 9.5, UpperBound: 10.5}, "10.0±0.5"},
+	} {
+		if s := answerStr(tc.answer); s != tc.expected {
+			t.Errorf("Expected %q, got %q", tc.expected, s)
+		}
+	}
+}
+
+func TestAnswerHandlerPrecision(t *testing.T) {
+	db := NewQuestionDatabase([]Question{{ID: "share", Text: "Share?", Unit: "%", BoundLow: 12.34, BoundHigh: 12.56, Precision: 2, Enabled: true}}, nil)
+
+	body := `{"question": {"id": "share"}, "lower": 12.3, "upper": 12.4}`
+	w := httptest.NewRecorder()
+	answerHandler(db, NewMockGameDatabase(), newHandlerOptions(WithExposedBounds(true))).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/answer", strings.NewReader(body)))
+
+	var result answerResult
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("Can not decode result: %s", err)
+	}
+	if result.CorrectRange != "12.34-12.56" || result.Answer != "12.30-12.40" {
+		t.Errorf("Expected the ranges with two decimal places, got %q and %q", result.CorrectRange, result.Answer)
+	}
+}
+
+func TestAnswerHandlerSubmittedGames(t *testing.T) {
+	db := NewQuestionDatabase([]Question{{ID: "tower", Text: "How high is the tower?", Unit: "m", BoundLow: 100, BoundHigh: 200, Enabled: true}}, nil)
+	games := NewMemoryGameDatabase()
+	if err := games.SaveQuestions(nil, "pending", []string{"tower"}); err != nil {
+		t.Fatalf("Can not save questions: %s", err)
+	}
+	if err := games.Save(nil, GameEntity{ID: "submitted", UserID: "user", Answers: []Answer{{Question: Question{ID: "tower"}}}}); err != nil {
+		t.Fatalf("Can not save game: %s", err)
+	}
+	if err := games.Save(nil, GameEntity{ID: "other", UserID: "user", Answers: []Answer{{Question: Question{ID: "bridge"}}}}); err != nil {
+		t.Fatalf("Can not save game: %s", err)
+	}
+
+	body := `{"question": {"id": "tower"}, "lower": 150, "upper": 160}`
+	for _, tc := range []struct {
+		query    string
+		expected int
+	}{
+		{"", http.StatusNotFound},
+		{"?game=pending", http.StatusForbidden},
+		{"?game=other", http.StatusForbidden},
+		{"?game=submitted", http.StatusOK},
+	} {
+		w := httptest.NewRecorder()
+		answerHandler(db, games, defaultHandlerOptions()).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/answer"+tc.query, strings.NewReader(body)))
+		if w.Code != tc.expected {
+			t.Errorf("%q: expected status %d, got %d", tc.query, tc.expected, w.Code)
+		}
+	}
+}
+
+func TestQuestionAPIHidesBounds(t *testing.T) {
+	q := Question{ID: "tower", Text: "How high is the tower?", Unit: "m", BoundLow: 123456, BoundHigh: 123457, Enabled: true}
+
+	for _, exposed := range []bool{false, true} {
+		handler := NewHandler(nil, NewQuestionDatabase([]Question{q}, nil), NewMemoryGameDatabase(), WithExposedBounds(exposed), WithNumQuestions(1))
+
+		for _, target := range []string{"/api/questions/random", "/api/questions/search?q=tower", "/api/questions/tower", "/api/questions/game/game"} {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+			if w.Code != http.StatusOK {
+				t.Errorf("%s: expected status %d, got %d", target, http.StatusOK, w.Code)
+			}
+			if body := w.Body.String(); strings.Contains(body, "123456") != exposed {
+				t.Errorf("%s: exposed %v: unexpected bounds in %s", target, exposed, body)
+			}
+		}
+	}
+}
+
+func TestSearchHandlerHidesDisabled(t *testing.T) {
+	questions := NewQuestionDatabase([]Question{
+		{ID: "enabled", Text: "How high is the tower?", Enabled: true},
+		{ID: "disabled", Text: "How old is the tower?"},
+		{ID: "pending", Text: "How wide is the tower?", Enabled: true, Pending: true},
+	}, nil)
+
+	w := httptest.NewRecorder()
+	NewHandler(nil, questions, NewMemoryGameDatabase()).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/questions/search?q=tower", nil))
+
+	var result []Question
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("Can not decode response: %s", err)
+	}
+	if len(result) != 1 || result[0].ID != "enabled" {
+		t.Errorf("Expected only the enabled question, got %+v", result)
+	}
+}
+
+func TestPlayHandlerHidesBounds(t *testing.T) {
+	templ, err := loadTemplates()
+	if err != nil {
+		t.Fatalf("Can not load templates: %s", err)
+	}
+
+	q := Question{ID: "tower", Text: "How high is the tower?", Unit: "m", BoundLow: 123456, BoundHigh: 123457, Enabled: true}
+	questions := NewQuestionDatabase([]Question{q}, nil)
+
+	for _, exposed := range []bool{false, true} {
+		w := httptest.NewRecorder()
+		opts := newHandlerOptions(WithExposedBounds(exposed), WithServerPush(false))
+		playHandler(templ, questions, NewMockGameDatabase(), opts).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/play/game", nil))
+
+		if body := w.Body.String(); strings.Contains(body, "123456") != exposed {
+			t.Errorf("Exposed %v: expected the bounds in the page %v", exposed, exposed)
+		}
+	}
+}
+
+func TestQuestionExplanations(t *testing.T) {
+	const explanation = "The antenna was added in 1957."
+	q := Question{ID: "tower", Text: "How high is the tower?", Unit: "m", BoundLow: 300, BoundHigh: 330, Explanation: explanation, Enabled: true}
+
+	for _, exposed := range []bool{false, true} {
+		games := NewMemoryGameDatabase()
+		handler := NewHandler(nil, NewQuestionDatabase([]Question{q}, nil), games, WithExposedBounds(exposed), WithServerPush(false))
+
+		for _, path := range []string{"/play/game", "/api/questions/random", "/api/questions/tower", "/api/questions/game/game", "/api/questions/search?q=tower"} {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+			if strings.Contains(w.Body.String(), "antenna") {
+				t.Errorf("Exposed %v: expected no explanation before the game is submitted at %s", exposed, path)
+			}
+		}
+
+		public := q
+		public.Explanation = ""
+		data, _ := json.Marshal(GameEntity{ID: "game", UserID: "user", Answers: []Answer{{Question: public, LowerBound: 1, UpperBound: 2}}})
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/game", strings.NewReader("data="+url.QueryEscape(string(data)))))
+
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/game/game", nil))
+		if body := w.Body.String(); !strings.Contains(body, "Here&#39;s why: "+explanation) {
+			t.Errorf("Exposed %v: expected the explanation in the results, got %s", exposed, body)
+		}
+	}
+
+	q.Explanation = strings.Repeat("x", maxExplanationLength+1)
+	if err := q.Validate(); err == nil {
+		t.Error("Expected an error for a too long explanation")
+	}
+}
+
+func TestSubmitHandlerResolvesQuestions(t *testing.T) {
+	q := demoQuestionList()[0]
+	tampered := q
+	tampered.BoundLow, tampered.BoundHigh = 1, 2
+
+	for _, tc := range []struct {
+		exposed bool
+		correct int
+	}{
+		{false, 0},
+		{true, 1},
+	} {
+		db := NewMemoryGameDatabase()
+		handler := submitHandler(SeedDemoQuestions(), db, NewTournamentDatabase(), NewMultiplayerHub(), newHandlerOptions(WithExposedBounds(tc.exposed)))
+
+		data, _ := json.Marshal(GameEntity{ID: "game", UserID: "user", Answers: []Answer{{Question: tampered, LowerBound: 1, UpperBound: 2}}})
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/game", strings.NewReader("data="+url.QueryEscape(string(data)))))
+
+		game, err := db.Get(nil, "game")
+		if err != nil {
+			t.Fatalf("Exposed %v: can not load game: %s", tc.exposed, err)
+		}
+		if game.Score.Correct != tc.correct {
+			t.Errorf("Exposed %v: expected %d correct answers, got %d", tc.exposed, tc.correct, game.Score.Correct)
+		}
+	}
+
+	unknown := q
+	unknown.ID = "unknown"
+	data, _ := json.Marshal(GameEntity{ID: "game", UserID: "user", Answers: []Answer{{Question: unknown}}})
+	w := httptest.NewRecorder()
+	submitHandler(SeedDemoQuestions(), NewMockGameDatabase(), NewTournamentDatabase(), NewMultiplayerHub(), defaultHandlerOptions()).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/game", strings.NewReader("data="+url.QueryEscape(string(data)))))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an unknown question, got %d", http.StatusBadRequest, w.Code)
+	}
+}
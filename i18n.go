@@ -0,0 +1,139 @@
+package predictiongame
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/message/catalog"
+)
+
+// uiMessages contains the translations of the strings of the user interface by language.
+// The keys are the English strings, which are used for languages without a translation.
+var uiMessages = map[string]map[string]string{
+	"de": {
+		"Home":                                "Start",
+		"About":                               "Über",
+		"New round":                           "Neue Runde",
+		"Start":                               "Starten",
+		"History":                             "Verlauf",
+		"Correct":                             "Richtig",
+		"Target":                              "Ziel",
+		"Share":                               "Teilen",
+		"View all":                            "Alle anzeigen",
+		"Well done, you reached your target!": "Gut gemacht, du hast dein Ziel erreicht!",
+		"Not quite there yet. Keep practicing to improve your calibration.": "Noch nicht ganz. Übe weiter, um deine Kalibrierung zu verbessern.",
+		"Here's why:":                           "Die Erklärung:",
+		"Showing the last %d of %d games.":      "Die letzten %d von %d Spielen.",
+		"Date":                                  "Datum",
+		"Score":                                 "Punkte",
+		"Newer":                                 "Neuer",
+		"Older":                                 "Älter",
+		"You have not completed any games yet.": "Du hast noch keine Spiele abgeschlossen.",
+	},
+}
+
+// defaultCatalog contains uiMessages.
+var defaultCatalog = newCatalog(uiMessages)
+
+// newCatalog creates a catalog of the messages. It panics if a language tag is invalid.
+func newCatalog(messages map[string]map[string]string) *catalog.Builder {
+	b := catalog.NewBuilder(catalog.Fallback(language.English))
+	for lang, translations := range messages {
+		tag := language.MustParse(lang)
+		for key, msg := range translations {
+			if err := b.SetString(tag, key, msg); err != nil {
+				panic(fmt.Sprintf("predictiongame: invalid message %q: %s", key, err))
+			}
+		}
+	}
+
+	return b
+}
+
+// Localizer translates the strings of the user interface and the questions into a
+// language.
+type Localizer struct {
+	lang    language.Tag
+	printer *message.Printer
+}
+
+// NewLocalizer creates a Localizer translating into lang with the messages of cat.
+func NewLocalizer(cat catalog.Catalog, lang language.Tag) *Localizer {
+	return &Localizer{
+		lang:    lang,
+		printer: message.NewPrinter(lang, message.Catalog(cat)),
+	}
+}
+
+// Language returns the base language of the Localizer, for example "de".
+func (l *Localizer) Language() string {
+	base, _ := l.lang.Base()
+	return base.String()
+}
+
+// Translate returns the translation of key formatted with args like fmt.Sprintf. If
+// there is no translation, key itself is formatted.
+func (l *Localizer) Translate(key string, args ...interface{}) string {
+	return l.printer.Sprintf(key, args...)
+}
+
+// QuestionText returns the text of the question in the language of the Localizer.
+func (l *Localizer) QuestionText(q Question) string {
+	return q.TextIn(l.Language())
+}
+
+// localizerKey is the context key of the Localizer of a request.
+type localizerKey struct{}
+
+// LocalizeMiddleware selects the language of the catalog the request prefers with
+// selectLanguage, like the localized templates, and stores a Localizer for it in the
+// context of the request, where the handlers find it with requestLocalizer.
+func LocalizeMiddleware(cat catalog.Catalog) MiddlewareFunc {
+	available := []string{DefaultLanguage}
+	for _, tag := range cat.Languages() {
+		base, _ := tag.Base()
+		available = append(available, base.String())
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			l := NewLocalizer(cat, language.Make(selectLanguage(r, available)))
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), localizerKey{}, l)))
+		})
+	}
+}
+
+// requestLocalizer returns the Localizer of the request, or an English one if it did not
+// pass LocalizeMiddleware.
+func requestLocalizer(r *http.Request) *Localizer {
+	if l, ok := r.Context().Value(localizerKey{}).(*Localizer); ok {
+		return l
+	}
+
+	return NewLocalizer(defaultCatalog, language.English)
+}
+
+// localize is the template function translating key with the Localizer of the page,
+// which may be nil for pages which are not localized.
+func localize(l *Localizer, key string, args ...interface{}) string {
+	if l == nil {
+		return fmt.Sprintf(key, args...)
+	}
+
+	return l.Translate(key, args...)
+}
+
+// localizeQuestions returns copies of the questions with their texts in the language of
+// the Localizer.
+func localizeQuestions(l *Localizer, questions []Question) []Question {
+	result := make([]Question, len(questions))
+	for i, q := range questions {
+		q.Text = l.QuestionText(q)
+		result[i] = q
+	}
+
+	return result
+}
@@ -0,0 +1,81 @@
+package predictiongame
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLocalizeMiddleware(t *testing.T) {
+	for _, tc := range []struct {
+		query, acceptLanguage, lang, home string
+	}{
+		{"", "", "en", "Home"},
+		{"", "de-CH,de;q=0.9,en;q=0.8", "de", "Start"},
+		{"", "fr, en;q=0.5", "en", "Home"},
+		{"?lang=de", "en", "de", "Start"},
+	} {
+		var l *Localizer
+		handler := LocalizeMiddleware(defaultCatalog)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			l = requestLocalizer(r)
+		}))
+
+		r := httptest.NewRequest(http.MethodGet, "/"+tc.query, nil)
+		r.Header.Set("Accept-Language", tc.acceptLanguage)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+
+		if lang := l.Language(); lang != tc.lang {
+			t.Errorf("%q %q: expected language %q, got %q", tc.query, tc.acceptLanguage, tc.lang, lang)
+		}
+		if home := l.Translate("Home"); home != tc.home {
+			t.Errorf("%q %q: expected %q, got %q", tc.query, tc.acceptLanguage, tc.home, home)
+		}
+	}
+}
+
+func TestLocalizedPages(t *testing.T) {
+	handler := NewHandler(nil, SeedDemoQuestions(), NewMockGameDatabase())
+
+	r := httptest.NewRequest(http.MethodGet, "/about", nil)
+	r.Header.Set("Accept-Language", "de")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if body := w.Body.String(); !strings.Contains(body, ">Über</a>") || !strings.Contains(body, `<html lang="de">`) {
+		t.Errorf("Expected the German navigation on a German page, got %s", body)
+	}
+
+	// The templates and the Localizer select the language the same way.
+	for _, tc := range []struct {
+		acceptLanguage, lang, home string
+	}{
+		{"fr, de;q=0.8, en;q=0.5", "de", ">Start</a>"},
+		{"de;q=0.5, en", "en", ">Home</a>"},
+		{"de-CH", "de", ">Start</a>"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Language", tc.acceptLanguage)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		body := w.Body.String()
+		if !strings.Contains(body, `<html lang="`+tc.lang+`">`) || !strings.Contains(body, tc.home) {
+			t.Errorf("%q: expected a page in %q, got %s", tc.acceptLanguage, tc.lang, body)
+		}
+	}
+}
+
+func TestQuestionTextIn(t *testing.T) {
+	q := Question{Text: "How high is the Eiffel Tower?", Translations: map[string]string{"de": "Wie hoch ist der Eiffelturm?"}}
+
+	if text := q.TextIn("de"); text != "Wie hoch ist der Eiffelturm?" {
+		t.Errorf("Expected the German text, got %q", text)
+	}
+	if text := q.TextIn("fr"); text != q.Text {
+		t.Errorf("Expected the original text without a translation, got %q", text)
+	}
+
+	localized := localizeQuestions(requestLocalizer(httptest.NewRequest(http.MethodGet, "/?lang=de", nil)), []Question{q})
+	if localized[0].Text != q.Text {
+		t.Errorf("Expected English without LocalizeMiddleware, got %q", localized[0].Text)
+	}
+}
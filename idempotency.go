@@ -0,0 +1,30 @@
+package predictiongame
+
+import "errors"
+
+// idempotencyKeyHeader is the header with which a client marks repeated submits of the
+// same game, for example after a double click, so the game is only saved once.
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// ErrDuplicateSubmit is returned when saving a game again with the idempotency key it was
+// completed with. The key is checked in the same transaction which completes the game, so
+// concurrent repeats, like the ones of a double click, are recognized too.
+var ErrDuplicateSubmit = errors.New("game has already been submitted with the idempotency key")
+
+// maxIdempotencyKeyLength is the maximum length of an idempotency key in bytes.
+const maxIdempotencyKeyLength = 255
+
+// validIdempotencyKey returns true if the key is not empty, not too long and only
+// contains printable ASCII characters.
+func validIdempotencyKey(key string) bool {
+	if key == "" || len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x21 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
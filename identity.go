@@ -0,0 +1,110 @@
+package predictiongame
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// identityCookie is the name of the cookie containing the ID of the user. It is set when
+// the user submits a game and allows them to list their own games.
+const identityCookie = "uid"
+
+// identityCookieMaxAge is how long the identity cookie is kept, in seconds.
+const identityCookieMaxAge = 365 * 24 * 60 * 60
+
+// sessionSecretLength is the length in bytes of the secret signing the identity cookies
+// unless it is set with WithSessionSecret.
+const sessionSecretLength = 32
+
+// TokenVerifier verifies the ID tokens the clients send as bearer tokens in the
+// Authorization header, see FirebaseTokenVerifier.
+type TokenVerifier interface {
+	// Verify returns the ID of the user the token was issued to or an error if the
+	// token is invalid or expired.
+	Verify(ctx context.Context, token string) (string, error)
+}
+
+// newSessionSecret returns a random secret for signing the identity cookies. The cookies
+// signed with it are only valid until the process exits.
+func newSessionSecret() []byte {
+	secret := make([]byte, sessionSecretLength)
+	if _, err := rand.Read(secret); err != nil {
+		panic(fmt.Sprintf("predictiongame: can not create session secret: %s", err))
+	}
+	return secret
+}
+
+// signIdentity returns the value of the identity cookie of the user, which is the ID
+// followed by its HMAC, so clients can not claim the identity of other users.
+func signIdentity(secret []byte, uid string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(uid))
+	return uid + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyIdentity returns the ID of the user of an identity cookie or false if the value
+// has not been signed with the secret.
+func verifyIdentity(secret []byte, value string) (string, bool) {
+	i := strings.LastIndexByte(value, '.')
+	if i < 0 {
+		return "", false
+	}
+
+	uid := value[:i]
+	if !validID(uid) || !hmac.Equal([]byte(signIdentity(secret, uid)), []byte(value)) {
+		return "", false
+	}
+	return uid, true
+}
+
+// bearerToken returns the bearer token of the Authorization header or an empty string.
+func bearerToken(r *http.Request) string {
+	const prefix = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if len(auth) < len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return ""
+	}
+	return strings.TrimSpace(auth[len(prefix):])
+}
+
+// userID returns the verified ID of the user of the request. It is the user an ID token
+// was issued to if a TokenVerifier is set, or otherwise the user of a signed identity
+// cookie. It returns false if the request has neither.
+func (o handlerOptions) userID(r *http.Request) (string, bool) {
+	if token := bearerToken(r); token != "" && o.tokenVerifier != nil {
+		if uid, err := o.tokenVerifier.Verify(r.Context(), token); err == nil && validID(uid) {
+			return uid, true
+		}
+	}
+
+	c, err := r.Cookie(identityCookie)
+	if err != nil {
+		return "", false
+	}
+	return verifyIdentity(o.sessionSecret, c.Value)
+}
+
+// hasIdentity returns true if the request is verified to come from the user.
+func (o handlerOptions) hasIdentity(r *http.Request, uid string) bool {
+	verified, ok := o.userID(r)
+	return ok && verified == uid
+}
+
+// setIdentityCookie sets the signed identity cookie of the user.
+func (o handlerOptions) setIdentityCookie(w http.ResponseWriter, r *http.Request, uid string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     identityCookie,
+		Value:    signIdentity(o.sessionSecret, uid),
+		Path:     o.basePath + "/",
+		MaxAge:   identityCookieMaxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
@@ -0,0 +1,127 @@
+package predictiongame
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testSessionSecret signs the identity cookies in the tests, see addIdentity.
+var testSessionSecret = []byte("test secret")
+
+// addIdentity adds the identity cookie of the user signed with testSessionSecret.
+func addIdentity(r *http.Request, uid string) {
+	r.AddCookie(&http.Cookie{Name: identityCookie, Value: signIdentity(testSessionSecret, uid)})
+}
+
+// staticTokenVerifier accepts the tokens which are its keys.
+type staticTokenVerifier map[string]string
+
+func (v staticTokenVerifier) Verify(ctx context.Context, token string) (string, error) {
+	uid, ok := v[token]
+	if !ok {
+		return "", errors.New("invalid token")
+	}
+	return uid, nil
+}
+
+func TestVerifyIdentity(t *testing.T) {
+	value := signIdentity(testSessionSecret, "user")
+	if uid, ok := verifyIdentity(testSessionSecret, value); !ok || uid != "user" {
+		t.Errorf("Expected user, got %q, %t", uid, ok)
+	}
+
+	for _, value := range []string{
+		"",
+		"user",
+		"user.",
+		"other" + strings.TrimPrefix(value, "user"),
+		signIdentity([]byte("other secret"), "user"),
+		signIdentity(testSessionSecret, "a b"),
+	} {
+		if uid, ok := verifyIdentity(testSessionSecret, value); ok {
+			t.Errorf("%q: expected an invalid identity, got %q", value, uid)
+		}
+	}
+}
+
+func TestHandlerOptionsUserID(t *testing.T) {
+	opts := newHandlerOptions(WithSessionSecret(testSessionSecret), WithTokenVerifier(staticTokenVerifier{"token": "tokenUser"}))
+
+	for _, tc := range []struct {
+		name, auth, cookie, uid string
+	}{
+		{"nothing", "", "", ""},
+		{"cookie", "", "cookieUser", "cookieUser"},
+		{"token", "Bearer token", "", "tokenUser"},
+		{"token before cookie", "Bearer token", "cookieUser", "tokenUser"},
+		{"invalid token", "Bearer forged", "", ""},
+		{"invalid token with cookie", "Bearer forged", "cookieUser", "cookieUser"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tc.auth != "" {
+			r.Header.Set("Authorization", tc.auth)
+		}
+		if tc.cookie != "" {
+			addIdentity(r, tc.cookie)
+		}
+
+		uid, ok := opts.userID(r)
+		if uid != tc.uid || ok != (tc.uid != "") {
+			t.Errorf("%s: expected %q, got %q, %t", tc.name, tc.uid, uid, ok)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: identityCookie, Value: "cookieUser"})
+	if uid, ok := opts.userID(r); ok {
+		t.Errorf("Expected an unsigned cookie to be rejected, got %q", uid)
+	}
+}
+
+func TestSubmitHandlerVerifiesUser(t *testing.T) {
+	games := NewMemoryGameDatabase()
+	if err := games.Save(nil, GameEntity{ID: "first", UserID: "victim", Answers: []Answer{}}); err != nil {
+		t.Fatal(err)
+	}
+	handler := NewHandler(nil, SeedDemoQuestions(), games, WithSessionSecret(testSessionSecret),
+		WithTokenVerifier(staticTokenVerifier{"token": "tokenUser"}))
+
+	submit := func(id, uid string, prepare func(*http.Request)) *httptest.ResponseRecorder {
+		body := `{"id": "` + id + `", "uid": "` + uid + `", "answers": []}`
+		r := httptest.NewRequest(http.MethodPost, "/game", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		prepare(r)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	none := func(r *http.Request) {}
+
+	for _, tc := range []struct {
+		name, id, uid string
+		prepare       func(*http.Request)
+		status        int
+	}{
+		{"claimed user", "forged", "victim", none, http.StatusForbidden},
+		{"other cookie", "forged", "victim", func(r *http.Request) { addIdentity(r, "attacker") }, http.StatusForbidden},
+		{"other token", "forged", "victim", func(r *http.Request) { r.Header.Set("Authorization", "Bearer token") }, http.StatusForbidden},
+		{"cookie", "second", "victim", func(r *http.Request) { addIdentity(r, "victim") }, http.StatusCreated},
+		{"token", "third", "", func(r *http.Request) { r.Header.Set("Authorization", "Bearer token") }, http.StatusCreated},
+		{"new user", "fourth", "newUser", none, http.StatusCreated},
+	} {
+		if w := submit(tc.id, tc.uid, tc.prepare); w.Code != tc.status {
+			t.Errorf("%s: expected status %d, got %d: %s", tc.name, tc.status, w.Code, w.Body)
+		}
+	}
+
+	if _, err := games.Get(nil, "forged"); !errors.Is(err, ErrGameNotFound) {
+		t.Errorf("Expected the forged games not to be saved, got %v", err)
+	}
+	if g, err := games.Get(nil, "third"); err != nil || g.UserID != "tokenUser" {
+		t.Errorf("Expected the game of the token user, got %+v, %v", g, err)
+	}
+}
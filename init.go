@@ -2,25 +2,99 @@ package predictiongame
 
 import (
 	"log"
-	"math/rand"
 	"net/http"
+	"os"
+	"strconv"
 	"time"
 )
 
-func init() {
-	rand.Seed(time.Now().UnixNano())
+// summaryAddressFile is the path of the CSV file with the user IDs and email addresses
+// which receive the weekly summary.
+const summaryAddressFile = "summary-addresses.csv"
+
+// The datastore calls fail fast after circuitFailureThreshold consecutive errors, and
+// the datastore is tried again every circuitProbeInterval.
+const (
+	circuitFailureThreshold = 5
+	circuitProbeInterval    = 30 * time.Second
+)
+
+// Saving and loading a game is tried retryAttempts times when the datastore fails
+// temporarily, waiting retryBaseDelay before the second attempt and twice as long
+// before every further one.
+const (
+	retryAttempts  = 3
+	retryBaseDelay = 100 * time.Millisecond
+)
 
-	templ, err := loadTemplates()
+func init() {
+	mode, err := ParseScoringMode(os.Getenv("SCORING_MODE"))
 	if err != nil {
-		log.Fatalf("Can not load templates: %s", err)
+		log.Fatalf("Invalid scoring mode: %s", err)
+	}
+
+	minOverlap := 0.0
+	if raw := os.Getenv("MIN_OVERLAP_FRACTION"); raw != "" {
+		minOverlap, err = strconv.ParseFloat(raw, 64)
+		if err != nil {
+			log.Fatalf("Invalid minimum overlap fraction: %s", err)
+		}
+	}
+
+	// The retries are inside of the circuit breaker, so it only counts a call as failed
+	// when all of its attempts failed.
+	retrying := NewRetryGameDatabase(&gameDatabase{}, retryAttempts, retryBaseDelay)
+	games := NewCircuitBreakerGameDatabase(retrying, circuitFailureThreshold, circuitProbeInterval)
+
+	var tokens TokenVerifier
+	if project := os.Getenv("FIREBASE_PROJECT_ID"); project != "" {
+		tokens = NewFirebaseTokenVerifier(project)
 	}
 
-	questions, err := readDatabase()
+	options := []Option{
+		WithAdminToken(os.Getenv("ADMIN_TOKEN")),
+		WithSessionSecret([]byte(os.Getenv("SESSION_SECRET"))),
+		WithTokenVerifier(tokens),
+		WithUserDatabase(&userDatabase{}),
+		WithFlagDatabase(&flagDatabase{}),
+		WithCorrectionDatabase(&correctionDatabase{}),
+		WithTournamentDatabase(&tournamentDatabase{}),
+		WithBaseURL(os.Getenv("BASE_URL")),
+		WithScoringMode(mode),
+		WithMinOverlapFraction(minOverlap),
+		WithQuestionFile(os.Getenv("QUESTION_FILE")),
+	}
+
+	list, err := readQuestionFile(newHandlerOptions(options...).questionFile)
 	if err != nil {
 		log.Fatalf("Can not read database: %s", err)
 	}
 
-	games := &gameDatabase{}
+	questions := NewQuestionDatabase(list, nil)
+	if len(list) == 0 {
+		log.Printf("Question database is empty, using demo questions.")
+		questions = SeedDemoQuestions()
+	}
+
+	if os.Getenv("WEEKLY_SUMMARY") == "true" {
+		templ, err := loadTemplates()
+		if err != nil {
+			log.Fatalf("Can not load templates: %s", err)
+		}
+
+		addresses, err := readAddressFile(summaryAddressFile)
+		if err != nil {
+			log.Fatalf("Can not read summary addresses: %s", err)
+		}
+
+		mailer := SMTPMailer{
+			Addr:     os.Getenv("SMTP_ADDR"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("SMTP_FROM"),
+		}
+		http.Handle("/tasks/weekly-summary", weeklySummaryHandler(templ, games, mailer, addresses, newHandlerOptions(options...)))
+	}
 
-	initHandlers(http.DefaultServeMux, templ, questions, games)
+	http.Handle("/", NewHandler(nil, questions, games, options...))
 }
@@ -0,0 +1,81 @@
+//go:build integration
+
+package predictiongame
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// TestIntegration plays a game against the full handler stack with in-memory databases.
+func TestIntegration(t *testing.T) {
+	templ, err := loadTemplates()
+	if err != nil {
+		t.Fatalf("Can not load templates: %s", err)
+	}
+
+	seed := SeedDemoQuestions()
+	server := httptest.NewServer(NewHandler(templ, seed, NewMemoryGameDatabase()))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/questions/random")
+	if err != nil {
+		t.Fatalf("Can not load questions: %s", err)
+	}
+	var questions []Question
+	err = json.NewDecoder(resp.Body).Decode(&questions)
+	resp.Body.Close()
+	if err != nil || len(questions) < 4 {
+		t.Fatalf("Expected at least 4 questions, got %d (%v)", len(questions), err)
+	}
+
+	// The questions are sent without their correct answers, which the test looks up.
+	// Every fourth answer misses the correct range.
+	game := GameEntity{ID: "integration-game", UserID: "integration-user"}
+	correct := 0
+	for i, q := range questions {
+		full, err := seed.GetByID(q.ID)
+		if err != nil {
+			t.Fatalf("Can not look up question %q: %s", q.ID, err)
+		}
+		lower, upper := full.correctRange()
+		if i%4 == 3 {
+			width := math.Max(upper-lower, 1)
+			lower, upper = upper+width*10, upper+width*20
+		} else {
+			correct++
+		}
+		game.Answers = append(game.Answers, Answer{Question: q, LowerBound: lower, UpperBound: upper})
+	}
+
+	data, err := json.Marshal(game)
+	if err != nil {
+		t.Fatalf("Can not encode game: %s", err)
+	}
+
+	resp, err = http.Post(server.URL+"/game", "application/x-www-form-urlencoded", strings.NewReader("data="+url.QueryEscape(string(data))))
+	if err != nil {
+		t.Fatalf("Can not submit game: %s", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("Can not read game page: %s", err)
+	}
+
+	if resp.StatusCode != http.StatusOK || resp.Request.URL.Path != "/game/"+game.ID {
+		t.Fatalf("Expected to be redirected to the game page, got %d %s", resp.StatusCode, resp.Request.URL.Path)
+	}
+
+	score := fmt.Sprintf(`%d <span class="badge">%d%%</span>`, correct, int(math.Round(float64(correct)/float64(len(questions))*100)))
+	if !strings.Contains(string(body), score) {
+		t.Errorf("Expected the game page to show the score %q", score)
+	}
+}
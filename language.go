@@ -0,0 +1,94 @@
+package predictiongame
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// requestLanguages returns the languages requested by the client ordered by preference.
+// The `lang` query parameter takes precedence over the Accept-Language header.
+func requestLanguages(r *http.Request) []string {
+	var result []string
+	if lang := r.URL.Query().Get("lang"); lang != "" {
+		result = append(result, baseLanguage(lang))
+	}
+
+	type weighted struct {
+		lang string
+		q    float64
+	}
+
+	var accepted []weighted
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		if fields[0] == "" || fields[0] == "*" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			if value := strings.TrimPrefix(strings.TrimSpace(param), "q="); value != param {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		accepted = append(accepted, weighted{baseLanguage(fields[0]), q})
+	}
+
+	sort.SliceStable(accepted, func(i, j int) bool {
+		return accepted[i].q > accepted[j].q
+	})
+	for _, a := range accepted {
+		result = append(result, a.lang)
+	}
+
+	return result
+}
+
+// baseLanguage reduces a language tag like "de-CH" to its primary language "de".
+func baseLanguage(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+
+	return tag
+}
+
+// selectLanguage returns the most preferred language of the request which is available.
+// If none of the requested languages is available, DefaultLanguage is returned.
+func selectLanguage(r *http.Request, available []string) string {
+	for _, lang := range requestLanguages(r) {
+		for _, a := range available {
+			if lang == a {
+				return lang
+			}
+		}
+	}
+
+	return DefaultLanguage
+}
+
+// localizedTemplate returns the name of the template to render for the page `name` and its locale.
+// A localized variant of a page is named like "play.de.html". If there is no variant for any of the
+// requested languages, the page itself is used, which is in DefaultLanguage.
+func localizedTemplate(templ *template.Template, r *http.Request, name string) (string, string) {
+	base := strings.TrimSuffix(name, ".html")
+	for _, lang := range requestLanguages(r) {
+		if lang == DefaultLanguage {
+			break
+		}
+
+		localized := fmt.Sprintf("%s.%s.html", base, lang)
+		if templ.Lookup(localized) != nil {
+			return localized, lang
+		}
+	}
+
+	return name, DefaultLanguage
+}
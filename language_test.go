@@ -0,0 +1,63 @@
+package predictiongame
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSelectLanguage(t *testing.T) {
+	available := []string{"de", "en"}
+	for _, tc := range []struct {
+		query    string
+		header   string
+		expected string
+	}{
+		{"", "", "en"},
+		{"", "de-CH,de;q=0.9,en;q=0.8", "de"},
+		{"", "fr, en;q=0.5, de;q=0.8", "de"},
+		{"?lang=en", "de", "en"},
+		{"?lang=fr", "it", "en"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/play/game"+tc.query, nil)
+		if tc.header != "" {
+			r.Header.Set("Accept-Language", tc.header)
+		}
+
+		if lang := selectLanguage(r, available); lang != tc.expected {
+			t.Errorf("%q %q: expected %q, got %q", tc.query, tc.header, tc.expected, lang)
+		}
+	}
+}
+
+func TestLocalizedTemplate(t *testing.T) {
+	templ, err := loadTemplates()
+	if err != nil {
+		t.Fatalf("Can not load templates: %s", err)
+	}
+
+	for _, tc := range []struct {
+		header string
+		page   string
+		locale string
+	}{
+		{"", "index.html", "en"},
+		{"de-DE,de;q=0.9", "index.de.html", "de"},
+		{"en-US,de;q=0.5", "index.html", "en"},
+		{"fr", "index.html", "en"},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Language", tc.header)
+
+		if page, locale := localizedTemplate(templ, r, "index.html"); page != tc.page || locale != tc.locale {
+			t.Errorf("%q: expected %s (%s), got %s (%s)", tc.header, tc.page, tc.locale, page, locale)
+		}
+
+		simpleHandler(templ, "index.html").ServeHTTP(w, r)
+		if expected := `<html lang="` + tc.locale + `">`; !strings.Contains(w.Body.String(), expected) {
+			t.Errorf("%q: expected page to contain %s", tc.header, expected)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package predictiongame
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LeaderboardSort is the key the leaderboard is sorted by.
+type LeaderboardSort string
+
+const (
+	// SortByCalibration sorts by UserStats.CalibratedScore. It is the default.
+	SortByCalibration LeaderboardSort = "calibration"
+	// SortByHitRate sorts by the ratio of correct answers.
+	SortByHitRate LeaderboardSort = "hitrate"
+	// SortByGames sorts by the number of completed games.
+	SortByGames LeaderboardSort = "games"
+)
+
+// ParseLeaderboardSort returns the LeaderboardSort with the given name. An empty
+// name selects SortByCalibration.
+func ParseLeaderboardSort(name string) (LeaderboardSort, error) {
+	switch s := LeaderboardSort(name); s {
+	case "":
+		return SortByCalibration, nil
+	case SortByCalibration, SortByHitRate, SortByGames:
+		return s, nil
+	default:
+		return "", fmt.Errorf("unknown sort key %q", name)
+	}
+}
+
+// value returns the value of the stats the leaderboard is sorted by.
+func (s LeaderboardSort) value(stats UserStats) float64 {
+	switch s {
+	case SortByHitRate:
+		return stats.HitRate()
+	case SortByGames:
+		return float64(stats.Games)
+	default:
+		return stats.CalibratedScore()
+	}
+}
+
+// LeaderboardEntry is the position of a user in the leaderboard. The public
+// leaderboard does not contain the ID of the user, only AnonymousID.
+type LeaderboardEntry struct {
+	Rank int `json:"rank"`
+	// DisplayName is the name the user has chosen. It is empty if the user has none.
+	DisplayName string `json:"displayName,omitempty"`
+	// AnonymousID identifies users without a display name, see PublicGameSummary.
+	AnonymousID string `json:"anonymousId,omitempty"`
+	UserStats
+	HitRate     float64 `json:"hitRate"`
+	Calibration float64 `json:"calibration"`
+}
+
+// newLeaderboard ranks the users of the completed games scored with cfg and returns the
+// entries from offset to offset+limit and the total number of users. Users with equal
+// values share a rank.
+func newLeaderboard(games []GameEntity, by LeaderboardSort, offset, limit int, cfg ScoreConfig) ([]LeaderboardEntry, int, error) {
+	if _, err := ParseLeaderboardSort(string(by)); err != nil {
+		return nil, 0, err
+	}
+
+	byUser := make(map[string][]GameEntity)
+	for _, g := range games {
+		if g.UserID != "" && g.Completed() {
+			byUser[g.UserID] = append(byUser[g.UserID], g)
+		}
+	}
+
+	entries := make([]LeaderboardEntry, 0, len(byUser))
+	for uid, games := range byUser {
+		stats := newUserStats(uid, games, cfg)
+		entries = append(entries, LeaderboardEntry{
+			UserStats:   stats,
+			HitRate:     stats.HitRate(),
+			Calibration: stats.CalibratedScore(),
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		vi, vj := by.value(entries[i].UserStats), by.value(entries[j].UserStats)
+		if vi != vj {
+			return vi > vj
+		}
+		if entries[i].Games != entries[j].Games {
+			return entries[i].Games > entries[j].Games
+		}
+		return entries[i].UserID < entries[j].UserID
+	})
+
+	for i := range entries {
+		entries[i].Rank = i + 1
+		if i > 0 && by.value(entries[i-1].UserStats) == by.value(entries[i].UserStats) {
+			entries[i].Rank = entries[i-1].Rank
+		}
+	}
+
+	start, end := pageBounds(len(entries), offset, limit)
+	return entries[start:end], len(entries), nil
+}
+
+// leaderboardPage is the response of GET /api/leaderboard.
+type leaderboardPage struct {
+	Entries []LeaderboardEntry `json:"entries"`
+	Sort    LeaderboardSort    `json:"sort"`
+	Offset  int                `json:"offset"`
+	Limit   int                `json:"limit"`
+	Total   int                `json:"total"`
+}
+
+// leaderboardCacheTTL is how long a ranking is served from the cache before the games
+// are loaded again.
+const leaderboardCacheTTL = time.Minute
+
+// leaderboardCache remembers the complete rankings for ttl, so the games are not
+// loaded for every request of the leaderboard.
+type leaderboardCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu       sync.Mutex
+	rankings map[LeaderboardSort]cachedRanking
+}
+
+type cachedRanking struct {
+	entries []LeaderboardEntry
+	expires time.Time
+}
+
+func newLeaderboardCache(ttl time.Duration) *leaderboardCache {
+	return &leaderboardCache{
+		ttl:      ttl,
+		now:      time.Now,
+		rankings: make(map[LeaderboardSort]cachedRanking),
+	}
+}
+
+// ranking returns all entries of the leaderboard sorted by, loading them from db if
+// they are not cached or expired.
+func (c *leaderboardCache) ranking(r *http.Request, db GameDatabase, by LeaderboardSort, cfg ScoreConfig) ([]LeaderboardEntry, error) {
+	c.mu.Lock()
+	cached, ok := c.rankings[by]
+	c.mu.Unlock()
+	if ok && c.now().Before(cached.expires) {
+		return cached.entries, nil
+	}
+
+	entries, _, err := db.Leaderboard(r, 0, math.MaxInt32, by, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.rankings[by] = cachedRanking{entries: entries, expires: c.now().Add(c.ttl)}
+	c.mu.Unlock()
+	return entries, nil
+}
+
+func leaderboardHandler(db GameDatabase, names DisplayNameDatabase, opts handlerOptions) http.Handler {
+	cache := newLeaderboardCache(leaderboardCacheTTL)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		offset, limit, err := pageParams(r, 20, 100)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		by, err := ParseLeaderboardSort(r.URL.Query().Get("sort"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ranking, err := cache.ranking(r, db, by, opts.scoring)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Leaderboard can not be loaded: %s", err), http.StatusInternalServerError)
+			return
+		}
+
+		// The cached entries are shared, so the public entries are copies of them.
+		start, end := pageBounds(len(ranking), offset, limit)
+		entries := make([]LeaderboardEntry, 0, end-start)
+		for _, e := range ranking[start:end] {
+			e.DisplayName, _ = names.Get(r, e.UserID)
+			if e.DisplayName == "" {
+				e.AnonymousID = opts.anonymousID(e.UserID)
+			}
+			e.UserID = ""
+			entries = append(entries, e)
+		}
+
+		writeJSON(w, r, leaderboardPage{
+			Entries: entries,
+			Sort:    by,
+			Offset:  offset,
+			Limit:   limit,
+			Total:   len(ranking),
+		})
+	})
+}
@@ -0,0 +1,139 @@
+package predictiongame
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func leaderboardGames(t *testing.T) GameDatabase {
+	db := NewMemoryGameDatabase()
+	question := Question{ID: "q", BoundLow: 10, BoundHigh: 20}
+	correct := Answer{Question: question, LowerBound: 10, UpperBound: 20}
+	wrong := Answer{Question: question, LowerBound: 30, UpperBound: 40}
+
+	for _, g := range []struct {
+		uid, id string
+		answers []Answer
+	}{
+		{"calibrated", "1", []Answer{correct, wrong}},
+		{"lucky", "2", []Answer{correct, correct}},
+		{"busy", "3", []Answer{correct, correct, correct, wrong}},
+		{"busy", "4", []Answer{correct, correct, correct, wrong}},
+		{"", "5", []Answer{correct, wrong}},
+	} {
+		if err := db.Save(nil, GameEntity{ID: g.id, UserID: g.uid, Answers: g.answers}); err != nil {
+			t.Fatalf("Can not save game: %s", err)
+		}
+	}
+	if err := db.SaveProgress(nil, "6", "", []Answer{wrong}); err != nil {
+		t.Fatalf("Can not save progress: %s", err)
+	}
+
+	return db
+}
+
+func TestLeaderboard(t *testing.T) {
+	db := leaderboardGames(t)
+
+	for _, tc := range []struct {
+		by       LeaderboardSort
+		expected []string
+	}{
+		{SortByCalibration, []string{"calibrated", "busy", "lucky"}},
+		{SortByHitRate, []string{"lucky", "busy", "calibrated"}},
+		{SortByGames, []string{"busy", "calibrated", "lucky"}},
+	} {
+		entries, total, err := db.Leaderboard(nil, 0, 10, tc.by, ScoreConfig{})
+		if err != nil {
+			t.Fatalf("Can not load leaderboard: %s", err)
+		}
+		if total != 3 || len(entries) != 3 {
+			t.Fatalf("%s: expected 3 users, got %d of %d", tc.by, len(entries), total)
+		}
+		for i, uid := range tc.expected {
+			if entries[i].UserID != uid {
+				t.Errorf("%s: expected %s at position %d, got %s", tc.by, uid, i+1, entries[i].UserID)
+			}
+		}
+	}
+
+	entries, _, err := db.Leaderboard(nil, 1, 1, SortByGames, ScoreConfig{})
+	if err != nil || len(entries) != 1 || entries[0].Rank != 2 || entries[0].UserID != "calibrated" {
+		t.Errorf("Unexpected page %+v (%v)", entries, err)
+	}
+
+	if _, _, err := db.Leaderboard(nil, 0, 10, "name", ScoreConfig{}); err == nil {
+		t.Error("Expected an error for an unknown sort key.")
+	}
+}
+
+func TestLeaderboardHandler(t *testing.T) {
+	names := profileDisplayNames{users: NewUserDatabase()}
+	names.Set(nil, "busy", "<b>Busy</b>")
+	opts := newHandlerOptions(WithSessionSecret(testSessionSecret))
+	handler := leaderboardHandler(leaderboardGames(t), names, opts)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/leaderboard?sort=hitrate&offset=1&limit=2", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	body := w.Body.String()
+	if strings.Contains(body, "<b>") {
+		t.Errorf("Expected HTML characters to be escaped, got %s", body)
+	}
+	if strings.Contains(body, `"uid"`) || strings.Contains(body, "calibrated") {
+		t.Errorf("Expected no user IDs in the leaderboard, got %s", body)
+	}
+
+	var page leaderboardPage
+	if err := json.NewDecoder(w.Body).Decode(&page); err != nil {
+		t.Fatalf("Can not decode leaderboard: %s", err)
+	}
+	if page.Total != 3 || len(page.Entries) != 2 {
+		t.Fatalf("Unexpected leaderboard %+v", page)
+	}
+	if e := page.Entries[0]; e.Rank != 2 || e.DisplayName != "<b>Busy</b>" || e.AnonymousID != "" {
+		t.Errorf("Expected the display name of busy, got %+v", e)
+	}
+	if e := page.Entries[1]; e.Rank != 3 || e.DisplayName != "" || e.AnonymousID != opts.anonymousID("calibrated") {
+		t.Errorf("Expected the anonymous ID of calibrated, got %+v", e)
+	}
+
+	for _, query := range []string{"sort=name", "limit=0", "offset=-1"} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/leaderboard?"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", query, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+func TestLeaderboardCache(t *testing.T) {
+	db := NewMockGameDatabase()
+	db.LeaderboardRows = []LeaderboardEntry{{Rank: 1, UserStats: UserStats{UserID: "user"}}}
+	now := time.Now()
+	cache := newLeaderboardCache(time.Minute)
+	cache.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if entries, err := cache.ranking(nil, db, SortByGames, ScoreConfig{}); err != nil || len(entries) != 1 {
+			t.Fatalf("Unexpected ranking %+v (%v)", entries, err)
+		}
+	}
+	if calls := db.Calls("Leaderboard"); len(calls) != 1 {
+		t.Errorf("Expected the ranking to be loaded once, got %v", calls)
+	}
+
+	cache.ranking(nil, db, SortByHitRate, ScoreConfig{})
+	now = now.Add(time.Minute)
+	cache.ranking(nil, db, SortByGames, ScoreConfig{})
+	if calls := db.Calls("Leaderboard"); len(calls) != 3 {
+		t.Errorf("Expected each sort key and expired rankings to be loaded, got %v", calls)
+	}
+}
@@ -0,0 +1,223 @@
+package predictiongame
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// CSVQuestionDatabase reads the questions from a CSV file and returns an in-memory database containing them.
+// The first line of the file is a header naming the columns id, text, bound_low, bound_high, unit, category,
+// kind, scale, true_value, precision, difficulty, explanation, lang and tags. Only text, bound_low, bound_high and unit are required. Multiple tags are
+// separated by commas. If a question has no ID, one is derived from its text. Columns named like text_de contain
+// translations of the text.
+func CSVQuestionDatabase(path string) (QuestionDatabase, error) {
+	questions, err := readQuestionFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewQuestionDatabase(questions, nil), nil
+}
+
+func readQuestionFile(path string) ([]Question, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	questions, err := readQuestionsCSV(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	return questions, nil
+}
+
+func readQuestionsCSV(r io.Reader) ([]Question, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("can not read header: %s", err)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, name := range []string{"text", "bound_low", "bound_high", "unit"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing column %q", name)
+		}
+	}
+
+	var result []Question
+	for {
+		rec, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		if len(rec) != len(header) {
+			return nil, fmt.Errorf("line %d: invalid number of fields: %d instead of %d", line, len(rec), len(header))
+		}
+
+		q, err := convertRecord(columns, rec)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+
+		result = append(result, q)
+	}
+
+	return result, nil
+}
+
+func convertRecord(columns map[string]int, rec []string) (Question, error) {
+	field := func(name string) string {
+		i, ok := columns[name]
+		if !ok {
+			return ""
+		}
+		return strings.TrimSpace(rec[i])
+	}
+
+	low, err := strconv.ParseFloat(field("bound_low"), 64)
+	if err != nil {
+		return Question{}, fmt.Errorf("invalid bound_low: %s", err)
+	}
+
+	high, err := strconv.ParseFloat(field("bound_high"), 64)
+	if err != nil {
+		return Question{}, fmt.Errorf("invalid bound_high: %s", err)
+	}
+
+	var trueValue float64
+	hasTrueValue := false
+	if raw := field("true_value"); raw != "" {
+		hasTrueValue = true
+		trueValue, err = strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return Question{}, fmt.Errorf("invalid true_value: %s", err)
+		}
+	}
+
+	var precision int
+	if raw := field("precision"); raw != "" {
+		precision, err = strconv.Atoi(raw)
+		if err != nil {
+			return Question{}, fmt.Errorf("invalid precision: %s", err)
+		}
+	}
+
+	var difficulty float64
+	if raw := field("difficulty"); raw != "" {
+		difficulty, err = strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return Question{}, fmt.Errorf("invalid difficulty: %s", err)
+		}
+	}
+
+	q := Question{
+		ID:           field("id"),
+		Text:         field("text"),
+		Unit:         field("unit"),
+		Category:     field("category"),
+		Kind:         QuestionKind(field("kind")),
+		Scale:        QuestionScale(field("scale")),
+		Explanation:  field("explanation"),
+		Precision:    precision,
+		Difficulty:   difficulty,
+		Lang:         field("lang"),
+		BoundLow:     low,
+		BoundHigh:    high,
+		TrueValue:    trueValue,
+		HasTrueValue: hasTrueValue,
+		Enabled:      true,
+	}
+	if tags := field("tags"); tags != "" {
+		for _, t := range strings.Split(tags, ",") {
+			q.Tags = append(q.Tags, strings.TrimSpace(t))
+		}
+	}
+
+	for name, i := range columns {
+		lang := strings.TrimPrefix(name, "text_")
+		if lang == name || strings.TrimSpace(rec[i]) == "" {
+			continue
+		}
+		if q.Translations == nil {
+			q.Translations = make(map[string]string)
+		}
+		q.Translations[lang] = strings.TrimSpace(rec[i])
+	}
+
+	if q.ID == "" {
+		q.ID = questionID(q.Text)
+	}
+
+	if err := q.Validate(); err != nil {
+		return Question{}, err
+	}
+
+	return q, nil
+}
+
+// JSONLinesQuestionDatabase reads questions from newline-delimited JSON, one question per line.
+// Invalid lines do not stop the import: the returned database contains all valid questions and
+// the returned error, if not nil, describes every line which could not be used.
+func JSONLinesQuestionDatabase(r io.Reader) (QuestionDatabase, error) {
+	questions, err := readQuestionsJSONLines(r)
+	return NewQuestionDatabase(questions, nil), err
+}
+
+func readQuestionsJSONLines(r io.Reader) ([]Question, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var result []Question
+	var errs []error
+	for line := 1; scanner.Scan(); line++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		q := Question{Enabled: true}
+		if err := json.Unmarshal(data, &q); err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %s", line, err))
+			continue
+		}
+
+		if q.ID == "" {
+			q.ID = questionID(q.Text)
+		}
+
+		if err := q.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %s", line, err))
+			continue
+		}
+
+		result = append(result, q)
+	}
+
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return result, errors.Join(errs...)
+}
@@ -0,0 +1,148 @@
+package predictiongame
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadQuestionsCSV(t *testing.T) {
+	input := `id,text,bound_low,bound_high,unit,category,explanation,tags
+,"How long is a marathon, in meters?",42100,42300,Meters,Sports,,
+q2,How many keys does a piano have?,87,89,Keys,Culture,Counting black and white keys.,"music, instruments"
+`
+	questions, err := readQuestionsCSV(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if len(questions) != 2 {
+		t.Fatalf("Expected 2 questions, got %d", len(questions))
+	}
+	if questions[0].ID != questionID(questions[0].Text) {
+		t.Errorf("Expected derived ID, got %q", questions[0].ID)
+	}
+	if q := questions[1]; q.ID != "q2" || q.BoundLow != 87 || q.Category != "Culture" || q.Explanation == "" || !q.HasTag("Instruments") {
+		t.Errorf("Unexpected question: %+v", q)
+	}
+}
+
+func TestReadQuestionsCSVInvalid(t *testing.T) {
+	input := `id,text,bound_low,bound_high,unit,category,explanation
+q1,How many keys does a piano have?,87,89,Keys,Culture,
+q2,How long is a marathon?,42300,42100,Meters,Sports,
+`
+	_, err := readQuestionsCSV(strings.NewReader(input))
+	if err == nil {
+		t.Fatal("Expected an error for inverted bounds.")
+	}
+	if !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("Expected the line number in the error, got: %s", err)
+	}
+}
+
+func TestReadQuestionsCSVKind(t *testing.T) {
+	input := `text,bound_low,bound_high,unit,kind
+How many keys does a piano have?,88,88,Keys,point
+How long is a marathon?,42100,42300,Meters,
+In which year did the Berlin Wall fall?,1988,1990,Year,point
+`
+	_, err := readQuestionsCSV(strings.NewReader(input))
+	if err == nil || !strings.Contains(err.Error(), "line 4") {
+		t.Errorf("Expected an error for the point question with a range in line 4, got: %v", err)
+	}
+
+	questions, err := readQuestionsCSV(strings.NewReader(strings.Join(strings.SplitAfter(input, "\n")[:3], "")))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !questions[0].IsPoint() || questions[1].IsPoint() || questions[1].Kind != "" {
+		t.Errorf("Unexpected kinds %q and %q", questions[0].Kind, questions[1].Kind)
+	}
+}
+
+func TestReadQuestionsCSVTrueValue(t *testing.T) {
+	input := `text,bound_low,bound_high,unit,true_value
+How many people live in the USA?,300000000,340000000,People,331000000
+How long is a marathon?,42100,42300,Meters,
+What is the net charge of a neutron?,-1,1,Elementary charges,0
+`
+	questions, err := readQuestionsCSV(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if v, ok := questions[0].Value(); !ok || v != 331000000 {
+		t.Errorf("Expected true value 331000000, got %v (%v)", v, ok)
+	}
+	if _, ok := questions[1].Value(); ok {
+		t.Error("Expected no true value for the range question.")
+	}
+	if v, ok := questions[2].Value(); !ok || v != 0 {
+		t.Errorf("Expected true value 0, got %v (%v)", v, ok)
+	}
+}
+
+func TestQuestionFile(t *testing.T) {
+	questions, err := readQuestionFile(DefaultQuestionFile)
+	if err != nil {
+		t.Fatalf("Can not read question file: %s", err)
+	}
+	if len(questions) == 0 {
+		t.Error("Question file is empty.")
+	}
+}
+
+func TestJSONLinesQuestionDatabase(t *testing.T) {
+	input := `{"id": "q1", "text": "Wie hoch ist das Matterhorn?", "boundLow": 4470, "boundHigh": 4480, "unit": "Meter"}
+{"id": "q2", "text": "broken",
+
+{"id": "q3", "text": "", "boundLow": 1, "boundHigh": 2}
+{"id": "q4", "text": "How many keys does a piano have?", "boundLow": 87, "boundHigh": 89, "unit": "Keys"}
+{"id": "q5", "text": "Inverted", "boundLow": 2, "boundHigh": 1}
+`
+	db, err := JSONLinesQuestionDatabase(strings.NewReader(input))
+	if err == nil {
+		t.Fatal("Expected an error for the invalid lines.")
+	}
+	for _, line := range []string{"line 2", "line 4", "line 6"} {
+		if !strings.Contains(err.Error(), line) {
+			t.Errorf("Expected error to mention %q, got: %s", line, err)
+		}
+	}
+
+	for _, id := range []string{"q1", "q4"} {
+		if _, err := db.GetByID(id); err != nil {
+			t.Errorf("Valid question %s was not imported: %s", id, err)
+		}
+	}
+	if selected := db.SelectRandom(NumQuestions); len(selected) != 2 {
+		t.Errorf("Expected 2 questions, got %d", len(selected))
+	}
+}
+
+func TestReadQuestionsCSVEmptyTag(t *testing.T) {
+	input := `text,bound_low,bound_high,unit,tags
+How many keys does a piano have?,87,89,Keys,"music,,instruments"
+`
+	if _, err := readQuestionsCSV(strings.NewReader(input)); err == nil {
+		t.Error("Expected an error for an empty tag.")
+	}
+}
+
+func TestReadQuestionsCSVTranslations(t *testing.T) {
+	input := `text,text_de,bound_low,bound_high,unit
+How many keys does a piano have?,Wie viele Tasten hat ein Klavier?,87,89,Keys
+How long is a marathon?,,42100,42300,Meters
+`
+	questions, err := readQuestionsCSV(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if text := questions[0].TextIn("de"); text != "Wie viele Tasten hat ein Klavier?" {
+		t.Errorf("Expected the German text, got %q", text)
+	}
+	if questions[1].Translations != nil {
+		t.Errorf("Expected no translations for empty fields, got %v", questions[1].Translations)
+	}
+}
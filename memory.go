@@ -0,0 +1,308 @@
+package predictiongame
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+type memoryGameDatabase struct {
+	mu    sync.RWMutex
+	games map[string]GameEntity
+	// now returns the time the games are started, saved and abandoned at.
+	now func() time.Time
+}
+
+// NewMemoryGameDatabase creates a GameDatabase which keeps the games in memory.
+// It is meant for tests and small deployments and can be used concurrently.
+func NewMemoryGameDatabase() GameDatabase {
+	return &memoryGameDatabase{
+		games: make(map[string]GameEntity),
+		now:   time.Now,
+	}
+}
+
+// copyAnswers makes sure callers can not modify the answers stored in the database.
+func copyAnswers(answers []Answer) []Answer {
+	if answers == nil {
+		return nil
+	}
+
+	return append([]Answer(nil), answers...)
+}
+
+// update lets fn change a copy of the game with the ID, or a new pending game if it does
+// not exist, and returns it. The caller has to hold the lock and store the game.
+func (db *memoryGameDatabase) update(id string, fn func(e *GameEntity) error) (GameEntity, error) {
+	e, ok := db.games[id]
+	if !ok {
+		e = newGame(id)
+	}
+
+	if err := fn(&e); err != nil {
+		return GameEntity{}, err
+	}
+
+	e.QuestionIDs = append([]string(nil), e.QuestionIDs...)
+	e.Answers = copyAnswers(e.Answers)
+	return e, nil
+}
+
+func (db *memoryGameDatabase) Start(r *http.Request, id string, numQuestions int) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	e, err := db.update(id, func(e *GameEntity) error {
+		return e.start(numQuestions, db.now())
+	})
+	if err != nil {
+		return err
+	}
+
+	db.games[id] = e
+	return nil
+}
+
+func (db *memoryGameDatabase) Save(r *http.Request, game GameEntity) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	e, err := db.update(game.ID, func(e *GameEntity) error {
+		return e.complete(game, db.now())
+	})
+	if err != nil {
+		return err
+	}
+
+	db.games[game.ID] = e
+	return nil
+}
+
+func (db *memoryGameDatabase) SaveBatch(r *http.Request, games []GameEntity) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	// The games are only stored if all of them can be completed.
+	now := db.now()
+	completed := make([]GameEntity, 0, len(games))
+	for _, g := range games {
+		e, err := db.update(g.ID, func(e *GameEntity) error {
+			return e.complete(g, now)
+		})
+		if err != nil {
+			return err
+		}
+		completed = append(completed, e)
+	}
+
+	for _, e := range completed {
+		db.games[e.ID] = e
+	}
+	return nil
+}
+
+func (db *memoryGameDatabase) SetScore(r *http.Request, id string, score GameScore) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	e, ok := db.games[id]
+	if !ok {
+		return ErrGameNotFound
+	}
+
+	e.Score = score
+	db.games[id] = e
+	return nil
+}
+
+func (db *memoryGameDatabase) SaveProgress(r *http.Request, id, uid string, answers []Answer) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	e, err := db.update(id, func(e *GameEntity) error {
+		return e.saveProgress(uid, answers, db.now())
+	})
+	if err != nil {
+		return err
+	}
+
+	db.games[id] = e
+	return nil
+}
+
+func (db *memoryGameDatabase) SaveQuestions(r *http.Request, id string, questionIDs []string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	e, err := db.update(id, func(e *GameEntity) error {
+		return e.serve(questionIDs, db.now())
+	})
+	if err != nil {
+		return err
+	}
+
+	db.games[id] = e
+	return nil
+}
+
+func (db *memoryGameDatabase) Abandon(r *http.Request, id string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	e, ok := db.games[id]
+	if !ok {
+		return ErrGameNotFound
+	}
+
+	if err := e.abandon(db.now()); err != nil {
+		return err
+	}
+
+	db.games[id] = e
+	return nil
+}
+
+func (db *memoryGameDatabase) Get(r *http.Request, id string) (GameEntity, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	e, ok := db.games[id]
+	if !ok {
+		return GameEntity{}, ErrGameNotFound
+	}
+
+	e.Answers = copyAnswers(e.Answers)
+	return e, nil
+}
+
+func (db *memoryGameDatabase) List(r *http.Request, uid string) ([]GameEntity, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var result []GameEntity
+	for _, e := range db.games {
+		if e.UserID != uid || !e.Completed() {
+			continue
+		}
+
+		e.Answers = copyAnswers(e.Answers)
+		result = append(result, e)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Time.After(result[j].Time)
+	})
+	return result, nil
+}
+
+func (db *memoryGameDatabase) ListPage(r *http.Request, uid string, offset, limit int) ([]GameEntity, int, error) {
+	games, err := db.List(r, uid)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	start, end := pageBounds(len(games), offset, limit)
+	return games[start:end], len(games), nil
+}
+
+func (db *memoryGameDatabase) Last(r *http.Request, uid string) (*GameEntity, error) {
+	games, err := db.List(r, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(games) == 0 {
+		return nil, ErrGameNotFound
+	}
+
+	return &games[0], nil
+}
+
+func (db *memoryGameDatabase) Leaderboard(r *http.Request, offset, limit int, by LeaderboardSort, cfg ScoreConfig) ([]LeaderboardEntry, int, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	games := make([]GameEntity, 0, len(db.games))
+	for _, e := range db.games {
+		games = append(games, e)
+	}
+
+	return newLeaderboard(games, by, offset, limit, cfg)
+}
+
+func (db *memoryGameDatabase) ListAll(r *http.Request) ([]GameEntity, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var result []GameEntity
+	for _, e := range db.games {
+		if e.Completed() {
+			e.Answers = copyAnswers(e.Answers)
+			result = append(result, e)
+		}
+	}
+	return result, nil
+}
+
+func (db *memoryGameDatabase) Iterate(r *http.Request, since time.Time, fn func(GameEntity) error) error {
+	// The games are copied, so fn can use the database.
+	db.mu.RLock()
+	games := make([]GameEntity, 0, len(db.games))
+	for _, e := range db.games {
+		if !e.Time.Before(since) {
+			e.Answers = copyAnswers(e.Answers)
+			games = append(games, e)
+		}
+	}
+	db.mu.RUnlock()
+
+	sort.Slice(games, func(i, j int) bool {
+		return games[i].Time.Before(games[j].Time)
+	})
+	for _, e := range games {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *memoryGameDatabase) ListRecent(r *http.Request, limit int) ([]GameEntity, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	games := make([]GameEntity, 0, len(db.games))
+	for _, e := range db.games {
+		games = append(games, e)
+	}
+
+	return recentGames(games, limit), nil
+}
+
+func (db *memoryGameDatabase) GetAnswerStats(ctx context.Context, questionID string, cfg ScoreConfig) (QuestionStats, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var games []GameEntity
+	for _, e := range db.games {
+		if e.answered(questionID) {
+			games = append(games, e)
+		}
+	}
+
+	return answerStats(newQuestionStats(games, cfg), questionID), nil
+}
+
+func (db *memoryGameDatabase) QuestionStats(r *http.Request, cfg ScoreConfig) (map[string]QuestionStats, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	games := make([]GameEntity, 0, len(db.games))
+	for _, e := range db.games {
+		games = append(games, e)
+	}
+
+	return newQuestionStats(games, cfg), nil
+}
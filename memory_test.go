@@ -0,0 +1,81 @@
+package predictiongame
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestMemoryGameDatabase(t *testing.T) {
+	db := NewMemoryGameDatabase()
+
+	answers := []Answer{{Question: demoQuestionList()[0], LowerBound: 8000, UpperBound: 9000}}
+	for _, id := range []string{"first", "second"} {
+		if err := db.Save(nil, GameEntity{ID: id, UserID: "user", Answers: answers}); err != nil {
+			t.Fatalf("Can not save game %s: %s", id, err)
+		}
+	}
+
+	game, err := db.Get(nil, "first")
+	if err != nil || game.UserID != "user" || len(game.Answers) != 1 {
+		t.Errorf("Unexpected game: %+v (%v)", game, err)
+	}
+
+	if _, err := db.Get(nil, "missing"); err != ErrGameNotFound {
+		t.Errorf("Expected ErrGameNotFound, got %v", err)
+	}
+
+	list, err := db.List(nil, "user")
+	if err != nil || len(list) != 2 || list[0].ID != "second" {
+		t.Errorf("Unexpected games: %+v (%v)", list, err)
+	}
+
+	if last, err := db.Last(nil, "user"); err != nil || last == nil || last.ID != "second" {
+		t.Errorf("Unexpected last game %+v (%v)", last, err)
+	}
+
+	if err := db.SaveProgress(nil, "first", "", answers); err != ErrGameCompleted {
+		t.Errorf("Expected ErrGameCompleted, got %v", err)
+	}
+
+	page, total, err := db.ListPage(nil, "user", 1, 5)
+	if err != nil || total != 2 || len(page) != 1 || page[0].ID != "first" {
+		t.Errorf("Unexpected page %+v of %d games (%v)", page, total, err)
+	}
+
+	if err := db.SaveProgress(nil, "third", "user", answers); err != nil {
+		t.Fatalf("Can not save progress: %s", err)
+	}
+	if stats, err := db.GetAnswerStats(context.Background(), answers[0].Question.ID, ScoreConfig{}); err != nil || stats.Answers != 2 {
+		t.Errorf("Expected the answers of the completed games, got %+v (%v)", stats, err)
+	}
+	if stats, err := db.GetAnswerStats(context.Background(), "unanswered", ScoreConfig{}); err != nil || stats.QuestionID != "unanswered" || stats.Answers != 0 {
+		t.Errorf("Expected empty stats, got %+v (%v)", stats, err)
+	}
+}
+
+func TestMemoryGameDatabaseConcurrent(t *testing.T) {
+	db := NewMemoryGameDatabase()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			id := fmt.Sprintf("game-%d", i)
+			for j := 0; j < 50; j++ {
+				db.SaveProgress(nil, id, "", nil)
+				db.Get(nil, id)
+				db.List(nil, "user")
+			}
+			db.Save(nil, GameEntity{ID: id, UserID: "user"})
+		}(i)
+	}
+	wg.Wait()
+
+	if list, _ := db.List(nil, "user"); len(list) != 10 {
+		t.Errorf("Expected 10 games, got %d", len(list))
+	}
+}
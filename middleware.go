@@ -0,0 +1,267 @@
+package predictiongame
+
+import (
+	"compress/gzip"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var gzipWriterPool = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(nil)
+	},
+}
+
+// incompressibleTypes contains prefixes of content types which are already compressed.
+var incompressibleTypes = []string{
+	"image/png",
+	"image/jpeg",
+	"image/gif",
+	"image/webp",
+	"image/x-icon",
+	"video/",
+	"audio/",
+	"font/woff",
+	"application/font-woff",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/vnd.ms-fontobject",
+	// Event streams are flushed after every event, so compressing them gains little.
+	"text/event-stream",
+}
+
+func compressible(contentType string) bool {
+	if contentType == "" {
+		return false
+	}
+
+	for _, prefix := range incompressibleTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		if strings.EqualFold(fields[0], "gzip") {
+			return len(fields) == 1 || strings.TrimSpace(fields[1]) != "q=0"
+		}
+	}
+
+	return false
+}
+
+// GzipMiddleware compresses the responses of next using gzip if the client supports it.
+// Responses which are already compressed, like images, and responses smaller than minSize
+// bytes are passed through unchanged.
+func GzipMiddleware(next http.Handler, minSize int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		if !acceptsGzip(r) || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipResponseWriter{ResponseWriter: w, minSize: minSize}
+		defer gw.close()
+
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// gzipResponseWriter buffers the beginning of the response until it knows whether the
+// response is large enough to be compressed.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	minSize int
+	status  int
+	buf     []byte
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (g *gzipResponseWriter) WriteHeader(status int) {
+	if g.status != 0 {
+		return
+	}
+	g.status = status
+
+	h := g.Header()
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified ||
+		h.Get("Content-Encoding") != "" || !compressible(h.Get("Content-Type")) {
+		g.decide(false)
+		return
+	}
+
+	if n, err := strconv.Atoi(h.Get("Content-Length")); err == nil {
+		g.decide(n >= g.minSize)
+	}
+}
+
+// decide writes the header, compressing the rest of the response if compress is true.
+func (g *gzipResponseWriter) decide(compress bool) {
+	g.decided = true
+
+	if compress {
+		h := g.Header()
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+
+		g.gz = gzipWriterPool.Get().(*gzip.Writer)
+		g.gz.Reset(g.ResponseWriter)
+	}
+
+	g.ResponseWriter.WriteHeader(g.status)
+}
+
+func (g *gzipResponseWriter) Write(b []byte) (int, error) {
+	if g.status == 0 {
+		if g.Header().Get("Content-Type") == "" {
+			g.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		g.WriteHeader(http.StatusOK)
+	}
+
+	if !g.decided {
+		g.buf = append(g.buf, b...)
+		if len(g.buf) < g.minSize {
+			return len(b), nil
+		}
+
+		g.decide(true)
+		if err := g.writeBuffer(); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+
+	if g.gz != nil {
+		return g.gz.Write(b)
+	}
+
+	return g.ResponseWriter.Write(b)
+}
+
+// writeBuffer writes the buffered beginning of the response.
+func (g *gzipResponseWriter) writeBuffer() error {
+	buf := g.buf
+	g.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+
+	var err error
+	if g.gz != nil {
+		_, err = g.gz.Write(buf)
+	} else {
+		_, err = g.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// Flush flushes the compressed data written so far to the client. A response which
+// is flushed before it reaches the minimum size is compressed anyway.
+func (g *gzipResponseWriter) Flush() {
+	if g.status != 0 && !g.decided {
+		g.decide(true)
+		g.writeBuffer()
+	}
+
+	if g.gz != nil {
+		g.gz.Flush()
+	}
+
+	if f, ok := g.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Push passes server push requests to the underlying ResponseWriter.
+func (g *gzipResponseWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := g.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+
+	return http.ErrNotSupported
+}
+
+func (g *gzipResponseWriter) close() {
+	if g.status != 0 && !g.decided {
+		g.decide(false)
+		g.writeBuffer()
+	}
+
+	if g.gz == nil {
+		return
+	}
+
+	g.gz.Close()
+	g.gz.Reset(nil)
+	gzipWriterPool.Put(g.gz)
+	g.gz = nil
+}
+
+// contentSecurityPolicy maps the directives of a Content-Security-Policy to their sources.
+type contentSecurityPolicy map[string][]string
+
+// defaultContentSecurityPolicy allows resources from the site itself and the external
+// scripts and Firebase endpoints used by the pages. The pages contain inline styles,
+// so these are allowed as well, but inline scripts are not.
+func defaultContentSecurityPolicy() contentSecurityPolicy {
+	return contentSecurityPolicy{
+		"default-src":     {"'self'"},
+		"script-src":      {"'self'", "https://ajax.googleapis.com", "https://oss.maxcdn.com", "https://www.gstatic.com"},
+		"style-src":       {"'self'", "'unsafe-inline'"},
+		"img-src":         {"'self'", "data:"},
+		"connect-src":     {"'self'", "https://*.googleapis.com", "https://*.firebaseio.com", "wss://*.firebaseio.com"},
+		"frame-src":       {"https://*.firebaseapp.com", "https://*.firebaseio.com"},
+		"frame-ancestors": {"'self'"},
+		"base-uri":        {"'self'"},
+		"form-action":     {"'self'"},
+	}
+}
+
+// String returns the policy in the format of the Content-Security-Policy header with the
+// directives sorted by name.
+func (p contentSecurityPolicy) String() string {
+	directives := make([]string, 0, len(p))
+	for d := range p {
+		directives = append(directives, d)
+	}
+	sort.Strings(directives)
+
+	parts := make([]string, 0, len(directives))
+	for _, d := range directives {
+		parts = append(parts, strings.Join(append([]string{d}, p[d]...), " "))
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+// SecurityHeadersMiddleware sets the given Content-Security-Policy and headers which
+// keep browsers from sniffing the content type, framing the page on other sites and
+// sending the full URL as referrer to other sites.
+func SecurityHeadersMiddleware(csp string) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			if csp != "" {
+				h.Set("Content-Security-Policy", csp)
+			}
+			h.Set("X-Content-Type-Options", "nosniff")
+			h.Set("X-Frame-Options", "SAMEORIGIN")
+			h.Set("Referrer-Policy", "strict-origin-when-cross-origin")
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
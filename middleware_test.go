@@ -0,0 +1,155 @@
+package predictiongame
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestGzipMiddleware(t *testing.T) {
+	body := strings.Repeat(`{"text": "How many questions are there?"}`, 100)
+	handler := GzipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.URL.Query().Get("type"))
+		io.WriteString(w, body)
+	}), 1024)
+
+	for _, tc := range []struct {
+		accept      string
+		contentType string
+		compressed  bool
+	}{
+		{"gzip, deflate", "application/json", true},
+		{"", "application/json", false},
+		{"deflate", "text/html; charset=utf-8", false},
+		{"gzip;q=0", "text/html; charset=utf-8", false},
+		{"gzip", "image/png", false},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/?type="+url.QueryEscape(tc.contentType), nil)
+		r.Header.Set("Accept-Encoding", tc.accept)
+
+		handler.ServeHTTP(w, r)
+
+		compressed := w.Header().Get("Content-Encoding") == "gzip"
+		if compressed != tc.compressed {
+			t.Errorf("%q %s: expected compressed=%v", tc.accept, tc.contentType, tc.compressed)
+			continue
+		}
+
+		var reader io.Reader = w.Body
+		if compressed {
+			gz, err := gzip.NewReader(w.Body)
+			if err != nil {
+				t.Fatalf("Can not read compressed body: %s", err)
+			}
+			reader = gz
+		}
+
+		data, err := io.ReadAll(reader)
+		if err != nil || string(data) != body {
+			t.Errorf("%q %s: unexpected body (%v)", tc.accept, tc.contentType, err)
+		}
+	}
+}
+
+func TestGzipMiddlewareMinSize(t *testing.T) {
+	chunk := strings.Repeat("x", 100)
+
+	for _, tc := range []struct {
+		chunks        int
+		contentLength bool
+		compressed    bool
+	}{
+		{1, false, false},
+		{9, false, false},
+		{11, false, true},
+		{1, true, false},
+		{20, true, true},
+	} {
+		handler := GzipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			if tc.contentLength {
+				w.Header().Set("Content-Length", strconv.Itoa(tc.chunks*len(chunk)))
+			}
+			for i := 0; i < tc.chunks; i++ {
+				io.WriteString(w, chunk)
+			}
+		}), 1000)
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		handler.ServeHTTP(w, r)
+
+		if compressed := w.Header().Get("Content-Encoding") == "gzip"; compressed != tc.compressed {
+			t.Errorf("%d bytes (Content-Length %v): expected compressed=%v", tc.chunks*len(chunk), tc.contentLength, tc.compressed)
+		}
+		if !tc.compressed && w.Body.Len() != tc.chunks*len(chunk) {
+			t.Errorf("%d bytes: got %d bytes", tc.chunks*len(chunk), w.Body.Len())
+		}
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	templ, err := loadTemplates()
+	if err != nil {
+		t.Fatalf("Can not load templates: %s", err)
+	}
+
+	handler := NewHandler(templ, SeedDemoQuestions(), NewMockGameDatabase(), WithCSPSources("script-src", "https://cdn.example.com"))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/about", nil))
+
+	csp := w.Header().Get("Content-Security-Policy")
+	if !strings.Contains(csp, "default-src 'self'") || !strings.Contains(csp, "https://cdn.example.com") {
+		t.Errorf("unexpected Content-Security-Policy %q", csp)
+	}
+	for name, value := range map[string]string{
+		"X-Content-Type-Options": "nosniff",
+		"X-Frame-Options":        "SAMEORIGIN",
+		"Referrer-Policy":        "strict-origin-when-cross-origin",
+	} {
+		if got := w.Header().Get(name); got != value {
+			t.Errorf("expected %s %q, got %q", name, value, got)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/questions/count", nil))
+	if csp := w.Header().Get("Content-Security-Policy"); csp != "" {
+		t.Errorf("expected no Content-Security-Policy on the API, got %q", csp)
+	}
+}
+
+func TestPagesWithoutInlineScripts(t *testing.T) {
+	handler := NewHandler(nil, SeedDemoQuestions(), NewMemoryGameDatabase())
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/play", nil))
+	play := w.Header().Get("Location")
+
+	inline := regexp.MustCompile(`<script(\s[^>]*)?>\s*[^<\s]`)
+	for _, target := range []string{"/", "/?lang=de", "/about", "/help/overview", "/help/elements", play} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status %d, got %d", target, http.StatusOK, w.Code)
+		}
+
+		for _, directive := range strings.Split(w.Header().Get("Content-Security-Policy"), "; ") {
+			if strings.HasPrefix(directive, "script-src ") && strings.Contains(directive, "'unsafe-inline'") {
+				t.Errorf("%s: expected no inline scripts to be allowed, got %q", target, directive)
+			}
+		}
+		if script := inline.FindString(w.Body.String()); script != "" {
+			t.Errorf("%s: expected no inline scripts, got %q", target, script)
+		}
+	}
+}
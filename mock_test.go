@@ -0,0 +1,210 @@
+package predictiongame
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// MockCall is a call of a method of MockGameDatabase.
+type MockCall struct {
+	Method string
+	Args   []interface{}
+}
+
+// MockGameDatabase is a GameDatabase for tests. It records all calls and
+// returns the values configured in its fields.
+type MockGameDatabase struct {
+	StartErr            error
+	SaveErr             error
+	SaveProgressErr     error
+	SaveQuestionsErr    error
+	AbandonErr          error
+	SetScoreErr         error
+	SaveBatchErr        error
+	GetGame             GameEntity
+	GetErr              error
+	ListGames           []GameEntity
+	ListErr             error
+	LastGame            *GameEntity
+	LastErr             error
+	LeaderboardRows     []LeaderboardEntry
+	LeaderboardErr      error
+	QuestionStatsResult map[string]QuestionStats
+	QuestionStatsErr    error
+
+	mu    sync.Mutex
+	calls []MockCall
+}
+
+// mockOption configures the return values of a MockGameDatabase.
+type mockOption func(*MockGameDatabase)
+
+// WithGetReturns configures the result of Get.
+func WithGetReturns(game GameEntity, err error) mockOption {
+	return func(db *MockGameDatabase) {
+		db.GetGame = game
+		db.GetErr = err
+	}
+}
+
+// WithListReturns configures the result of List.
+func WithListReturns(games []GameEntity, err error) mockOption {
+	return func(db *MockGameDatabase) {
+		db.ListGames = games
+		db.ListErr = err
+	}
+}
+
+// WithLastReturns configures the result of Last.
+func WithLastReturns(game *GameEntity, err error) mockOption {
+	return func(db *MockGameDatabase) {
+		db.LastGame = game
+		db.LastErr = err
+	}
+}
+
+// WithQuestionStatsReturns configures the result of QuestionStats.
+func WithQuestionStatsReturns(stats map[string]QuestionStats, err error) mockOption {
+	return func(db *MockGameDatabase) {
+		db.QuestionStatsResult = stats
+		db.QuestionStatsErr = err
+	}
+}
+
+// WithSaveReturns configures the result of Save.
+func WithSaveReturns(err error) mockOption {
+	return func(db *MockGameDatabase) {
+		db.SaveErr = err
+	}
+}
+
+// NewMockGameDatabase creates a MockGameDatabase with the given options.
+func NewMockGameDatabase(opts ...mockOption) *MockGameDatabase {
+	// Like the real databases, Last does not find games of users without any.
+	db := &MockGameDatabase{LastErr: ErrGameNotFound}
+	for _, opt := range opts {
+		opt(db)
+	}
+	return db
+}
+
+func (db *MockGameDatabase) record(method string, args ...interface{}) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.calls = append(db.calls, MockCall{Method: method, Args: args})
+}
+
+// Calls returns the calls of the method, or all calls if method is empty.
+func (db *MockGameDatabase) Calls(method string) []MockCall {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var result []MockCall
+	for _, c := range db.calls {
+		if method == "" || c.Method == method {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+func (db *MockGameDatabase) Start(r *http.Request, id string, numQuestions int) error {
+	db.record("Start", id, numQuestions)
+	return db.StartErr
+}
+
+func (db *MockGameDatabase) Save(r *http.Request, game GameEntity) error {
+	db.record("Save", game)
+	return db.SaveErr
+}
+
+func (db *MockGameDatabase) SaveProgress(r *http.Request, id, uid string, answers []Answer) error {
+	db.record("SaveProgress", id, uid, answers)
+	return db.SaveProgressErr
+}
+
+func (db *MockGameDatabase) SaveQuestions(r *http.Request, id string, questionIDs []string) error {
+	db.record("SaveQuestions", id, questionIDs)
+	return db.SaveQuestionsErr
+}
+
+func (db *MockGameDatabase) Abandon(r *http.Request, id string) error {
+	db.record("Abandon", id)
+	return db.AbandonErr
+}
+
+func (db *MockGameDatabase) Get(r *http.Request, id string) (GameEntity, error) {
+	db.record("Get", id)
+	return db.GetGame, db.GetErr
+}
+
+func (db *MockGameDatabase) List(r *http.Request, uid string) ([]GameEntity, error) {
+	db.record("List", uid)
+	return db.ListGames, db.ListErr
+}
+
+func (db *MockGameDatabase) ListPage(r *http.Request, uid string, offset, limit int) ([]GameEntity, int, error) {
+	db.record("ListPage", uid, offset, limit)
+	start, end := pageBounds(len(db.ListGames), offset, limit)
+	return db.ListGames[start:end], len(db.ListGames), db.ListErr
+}
+
+func (db *MockGameDatabase) ListAll(r *http.Request) ([]GameEntity, error) {
+	db.record("ListAll")
+	return db.ListGames, db.ListErr
+}
+
+func (db *MockGameDatabase) Iterate(r *http.Request, since time.Time, fn func(GameEntity) error) error {
+	db.record("Iterate", since)
+	if db.ListErr != nil {
+		return db.ListErr
+	}
+
+	for _, e := range db.ListGames {
+		if e.Time.Before(since) {
+			continue
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *MockGameDatabase) ListRecent(r *http.Request, limit int) ([]GameEntity, error) {
+	db.record("ListRecent", limit)
+	return recentGames(db.ListGames, limit), db.ListErr
+}
+
+func (db *MockGameDatabase) SaveBatch(r *http.Request, games []GameEntity) error {
+	db.record("SaveBatch", games)
+	return db.SaveBatchErr
+}
+
+func (db *MockGameDatabase) SetScore(r *http.Request, id string, score GameScore) error {
+	db.record("SetScore", id, score)
+	return db.SetScoreErr
+}
+
+func (db *MockGameDatabase) Last(r *http.Request, uid string) (*GameEntity, error) {
+	db.record("Last", uid)
+	return db.LastGame, db.LastErr
+}
+
+func (db *MockGameDatabase) Leaderboard(r *http.Request, offset, limit int, by LeaderboardSort, cfg ScoreConfig) ([]LeaderboardEntry, int, error) {
+	db.record("Leaderboard", offset, limit, by, cfg)
+	return db.LeaderboardRows, len(db.LeaderboardRows), db.LeaderboardErr
+}
+
+func (db *MockGameDatabase) GetAnswerStats(ctx context.Context, questionID string, cfg ScoreConfig) (QuestionStats, error) {
+	db.record("GetAnswerStats", questionID, cfg)
+	return answerStats(db.QuestionStatsResult, questionID), db.QuestionStatsErr
+}
+
+func (db *MockGameDatabase) QuestionStats(r *http.Request, cfg ScoreConfig) (map[string]QuestionStats, error) {
+	db.record("QuestionStats", cfg)
+	return db.QuestionStatsResult, db.QuestionStatsErr
+}
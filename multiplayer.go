@@ -0,0 +1,127 @@
+package predictiongame
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// subscriberBuffer is the number of score updates which are queued for a subscriber.
+// Updates for subscribers which fall further behind are dropped.
+const subscriberBuffer = 16
+
+// sseKeepAlive is the interval of the comments which keep idle event streams open
+// behind proxies.
+const sseKeepAlive = 30 * time.Second
+
+// ScoreUpdate is the current score of a player in a multiplayer game.
+type ScoreUpdate struct {
+	// DisplayName or AnonymousID identifies the player, see LeaderboardEntry.
+	DisplayName string  `json:"displayName,omitempty"`
+	AnonymousID string  `json:"anonymousId,omitempty"`
+	GameID      string  `json:"gameId"`
+	Score       float64 `json:"score"`
+	Correct     int     `json:"correct"`
+}
+
+// MultiplayerHub broadcasts the score updates of multiplayer games, like tournaments,
+// to their subscribers. It can be used concurrently.
+type MultiplayerHub struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan ScoreUpdate]bool
+}
+
+// NewMultiplayerHub returns a hub without subscribers.
+func NewMultiplayerHub() *MultiplayerHub {
+	return &MultiplayerHub{subscribers: make(map[string]map[chan ScoreUpdate]bool)}
+}
+
+// Subscribe returns a channel receiving the score updates of a game and a function
+// which ends the subscription and closes the channel.
+func (h *MultiplayerHub) Subscribe(gameID string) (<-chan ScoreUpdate, func()) {
+	ch := make(chan ScoreUpdate, subscriberBuffer)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.subscribers[gameID] == nil {
+		h.subscribers[gameID] = make(map[chan ScoreUpdate]bool)
+	}
+	h.subscribers[gameID][ch] = true
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+
+			delete(h.subscribers[gameID], ch)
+			if len(h.subscribers[gameID]) == 0 {
+				delete(h.subscribers, gameID)
+			}
+			close(ch)
+		})
+	}
+}
+
+// Publish sends an update to all subscribers of a game. It does not block; updates
+// for subscribers whose queue is full are dropped.
+func (h *MultiplayerHub) Publish(gameID string, update ScoreUpdate) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers[gameID] {
+		select {
+		case ch <- update:
+		default:
+		}
+	}
+}
+
+// SSEHandler streams the score updates of a game as server-sent events until the
+// client disconnects. Every update is sent as a "score" event with a ScoreUpdate as
+// JSON data.
+func SSEHandler(hub *MultiplayerHub, gameID string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+
+		updates, unsubscribe := hub.Subscribe(gameID)
+		defer unsubscribe()
+
+		h := w.Header()
+		h.Set("Content-Type", "text/event-stream")
+		h.Set("Cache-Control", "no-cache")
+		h.Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		keepAlive := time.NewTicker(sseKeepAlive)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-keepAlive.C:
+				if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+					return
+				}
+			case update := <-updates:
+				data, err := json.Marshal(update)
+				if err != nil {
+					return
+				}
+				if _, err := fmt.Fprintf(w, "event: score\ndata: %s\n\n", data); err != nil {
+					return
+				}
+			}
+			flusher.Flush()
+		}
+	})
+}
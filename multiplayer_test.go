@@ -0,0 +1,96 @@
+package predictiongame
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSSEHandler(t *testing.T) {
+	hub := NewMultiplayerHub()
+	server := httptest.NewServer(SSEHandler(hub, "game"))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatalf("Can not create request: %s", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Can not connect: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Unexpected Content-Type %q", ct)
+	}
+
+	// The handler has subscribed before sending the headers.
+	hub.Publish("other", ScoreUpdate{DisplayName: "ignored"})
+	hub.Publish("game", ScoreUpdate{DisplayName: "Alice", GameID: "g1", Score: 0.75, Correct: 6})
+
+	scanner := bufio.NewScanner(resp.Body)
+	var event, data string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+
+	var update ScoreUpdate
+	if err := json.Unmarshal([]byte(data), &update); err != nil {
+		t.Fatalf("Can not decode event %q: %s", data, err)
+	}
+	if event != "score" || update.DisplayName != "Alice" || update.Score != 0.75 {
+		t.Errorf("Unexpected event %q %+v", event, update)
+	}
+
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for {
+		hub.mu.Lock()
+		remaining := len(hub.subscribers)
+		hub.mu.Unlock()
+		if remaining == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Subscription was not removed after the client disconnected.")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMultiplayerHubDropsSlowSubscribers(t *testing.T) {
+	hub := NewMultiplayerHub()
+	updates, unsubscribe := hub.Subscribe("game")
+
+	for i := 0; i < subscriberBuffer+5; i++ {
+		hub.Publish("game", ScoreUpdate{Correct: i})
+	}
+	unsubscribe()
+	unsubscribe()
+
+	received := 0
+	for range updates {
+		received++
+	}
+	if received != subscriberBuffer {
+		t.Errorf("Expected %d queued updates, got %d", subscriberBuffer, received)
+	}
+}
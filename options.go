@@ -0,0 +1,461 @@
+package predictiongame
+
+import (
+	"context"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// MiddlewareFunc wraps a handler, for example to log or authenticate requests.
+type MiddlewareFunc func(http.Handler) http.Handler
+
+// handlerOptions contains the settings of the handlers.
+type handlerOptions struct {
+	// baseURL is the public URL of the site used in the sitemap, for example
+	// https://example.com. The host of the request is used if it is empty.
+	baseURL string
+	// basePath is the path prefix the handler is mounted under, for example
+	// /games/predict. It is empty if the handler serves the root.
+	basePath string
+	// adminToken is the bearer token needed for the admin endpoints. The admin endpoints
+	// are disabled if it is empty.
+	adminToken string
+	// serverPush enables HTTP/2 server push of the static assets on the play page.
+	serverPush bool
+	// numQuestions is the number of questions of a game unless it is chosen when
+	// starting the game.
+	numQuestions int
+	// maxQuestions is the maximum number of questions which can be chosen for a game.
+	maxQuestions int
+	// questionExclusionWindow is the number of recent games of a user whose questions
+	// are not repeated.
+	questionExclusionWindow int
+	// historyLimit is the maximum number of previous games shown on the game page.
+	historyLimit int
+	// passThreshold is the CalibratedScore a game needs to be passed.
+	passThreshold float64
+	// gzip enables compressing the responses for clients which support it.
+	gzip bool
+	// gzipMinSize is the minimum size in bytes of a response to be compressed.
+	gzipMinSize int
+	// maxBodyBytes is the maximum size of a submitted game in bytes.
+	maxBodyBytes int64
+	// exposeBounds sends the correct answers of the questions to the play page.
+	exposeBounds bool
+	// postOnlyPlayStart only starts games with a POST to /play, which shows a page with a
+	// start button to the other requests.
+	postOnlyPlayStart bool
+	// scoring decides when an answer counts as correct and which ratio of correct
+	// answers is expected.
+	scoring ScoreConfig
+	// csp is the Content-Security-Policy of the HTML pages.
+	csp contentSecurityPolicy
+	// templateFS contains the templates which are used if NewHandler is not given any.
+	// If it is nil, the templates directory or the embedded templates are used.
+	templateFS fs.FS
+	// templateFuncs are added to the functions of the templates parsed by NewHandler.
+	templateFuncs template.FuncMap
+	// embeddedAssets serves the static files and the templates from the binary
+	// instead of the directories on disk.
+	embeddedAssets bool
+	// middleware wraps the handler, the first one being the outermost.
+	middleware []MiddlewareFunc
+	// logger receives the errors which can not be reported to the client.
+	logger *slog.Logger
+	// users contains the profiles of the users.
+	users UserDatabase
+	// flags contains the reports of wrong or outdated questions.
+	flags FlagDatabase
+	// corrections contains the bounds of questions suggested by the players.
+	corrections CorrectionDatabase
+	// tournaments contains the tournaments and their results.
+	tournaments TournamentDatabase
+	// sessionSecret signs the identity cookies.
+	sessionSecret []byte
+	// tokenVerifier verifies the ID tokens of the users. Only the identity cookies are
+	// used if it is nil.
+	tokenVerifier TokenVerifier
+	// questionFile is the path of the CSV file the app reads the questions from when it
+	// starts, see CSVQuestionDatabase.
+	questionFile string
+}
+
+// Option changes the settings of the handler returned by NewHandler.
+type Option func(*handlerOptions)
+
+// defaultHandlerOptions returns the settings which are used when no options are given.
+func defaultHandlerOptions() handlerOptions {
+	return handlerOptions{
+		serverPush:              true,
+		numQuestions:            NumQuestions,
+		maxQuestions:            50,
+		passThreshold:           DefaultPassThreshold,
+		questionExclusionWindow: DefaultQuestionExclusionWindow,
+		historyLimit:            DefaultHistoryLimit,
+		gzip:                    true,
+		gzipMinSize:             1024,
+		maxBodyBytes:            64 << 10,
+		csp:                     defaultContentSecurityPolicy(),
+		logger:                  slog.Default(),
+		users:                   NewUserDatabase(),
+		flags:                   NewFlagDatabase(),
+		corrections:             NewCorrectionDatabase(),
+		tournaments:             NewTournamentDatabase(),
+		sessionSecret:           newSessionSecret(),
+		questionFile:            DefaultQuestionFile,
+	}
+}
+
+// newHandlerOptions applies opts to the default settings.
+func newHandlerOptions(opts ...Option) handlerOptions {
+	o := defaultHandlerOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithNumQuestions sets the number of questions of a game unless the player chooses
+// another number. It also raises the maximum number of questions if necessary.
+func WithNumQuestions(n int) Option {
+	return func(o *handlerOptions) {
+		if n < 1 {
+			return
+		}
+		o.numQuestions = n
+		if o.maxQuestions < n {
+			o.maxQuestions = n
+		}
+	}
+}
+
+// WithMaxQuestions sets the maximum number of questions a player can choose for a game.
+func WithMaxQuestions(n int) Option {
+	return func(o *handlerOptions) {
+		if n > 0 {
+			o.maxQuestions = n
+		}
+	}
+}
+
+// WithQuestionExclusionWindow sets the number of recent games of a user whose questions
+// are not repeated in the next game. Zero disables the exclusion.
+func WithQuestionExclusionWindow(k int) Option {
+	return func(o *handlerOptions) {
+		if k >= 0 {
+			o.questionExclusionWindow = k
+		}
+	}
+}
+
+// DefaultHistoryLimit is the number of previous games shown on the game page unless it is
+// changed with WithHistoryLimit.
+const DefaultHistoryLimit = 10
+
+// WithHistoryLimit sets the maximum number of previous games shown on the game page. The
+// page links to the list of all games of the user if there are more.
+func WithHistoryLimit(n int) Option {
+	return func(o *handlerOptions) {
+		if n > 0 {
+			o.historyLimit = n
+		}
+	}
+}
+
+// WithPassThreshold sets the CalibratedScore a game needs for the results page to
+// congratulate the player. Values outside of [0, 1] are ignored.
+func WithPassThreshold(f float64) Option {
+	return func(o *handlerOptions) {
+		if f >= 0 && f <= 1 {
+			o.passThreshold = f
+		}
+	}
+}
+
+// WithExpectedConfidence sets the ratio of correct answers the results of a game are
+// compared to. Values outside of (0, 1) are ignored.
+func WithExpectedConfidence(f float64) Option {
+	return func(o *handlerOptions) {
+		if f > 0 && f < 1 {
+			o.scoring.ExpectedConfidence = f
+		}
+	}
+}
+
+// WithTemplateFS sets the file system containing the templates, for example an embedded
+// file system with custom templates. The templates are the files in its root and are
+// named like them. They are only used if NewHandler is not given parsed templates; by
+// default they are read from the templates directory, see WithEmbeddedAssets.
+func WithTemplateFS(fsys fs.FS) Option {
+	return func(o *handlerOptions) {
+		if fsys != nil {
+			o.templateFS = fsys
+		}
+	}
+}
+
+// WithTemplateFuncs adds functions to the templates parsed by NewHandler, for example
+// to format numbers in custom templates set by WithTemplateFS. Functions with the names
+// of built-in ones replace them. They are not added to a template passed to NewHandler,
+// which has to be parsed with them already.
+func WithTemplateFuncs(funcs template.FuncMap) Option {
+	return func(o *handlerOptions) {
+		if o.templateFuncs == nil {
+			o.templateFuncs = make(template.FuncMap, len(funcs))
+		}
+		for name, fn := range funcs {
+			o.templateFuncs[name] = fn
+		}
+	}
+}
+
+// WithEmbeddedAssets serves the static files and the default templates from the copies
+// embedded in the binary instead of the static and templates directories.
+func WithEmbeddedAssets(enabled bool) Option {
+	return func(o *handlerOptions) {
+		o.embeddedAssets = enabled
+	}
+}
+
+// templates returns the file system containing the templates.
+func (o handlerOptions) templates() fs.FS {
+	if o.templateFS != nil {
+		return o.templateFS
+	}
+
+	return assetFS("templates", o.embeddedAssets)
+}
+
+// WithMiddleware wraps the handler with mw. The first middleware is the outermost
+// one; all of them run before the responses are compressed.
+func WithMiddleware(mw ...MiddlewareFunc) Option {
+	return func(o *handlerOptions) {
+		o.middleware = append(o.middleware, mw...)
+	}
+}
+
+// WithLogger sets the logger for errors which can not be reported to the client.
+// slog.Default is used otherwise.
+func WithLogger(l *slog.Logger) Option {
+	return func(o *handlerOptions) {
+		if l != nil {
+			o.logger = l
+		}
+	}
+}
+
+// loggerKey is the key of the logger in the context of a request.
+type loggerKey struct{}
+
+// loggerMiddleware adds the logger to the context of the requests, so the errors of
+// the helpers writing the responses are logged with it, see requestLogger.
+func loggerMiddleware(logger *slog.Logger) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), loggerKey{}, logger)))
+		})
+	}
+}
+
+// requestLogger returns the logger set by WithLogger for the request, or slog.Default
+// if the request has not been passed through NewHandler.
+func requestLogger(r *http.Request) *slog.Logger {
+	if l, ok := r.Context().Value(loggerKey{}).(*slog.Logger); ok {
+		return l
+	}
+
+	return slog.Default()
+}
+
+// WithUserDatabase sets the database containing the profiles of the users, which
+// are kept in memory otherwise.
+func WithUserDatabase(db UserDatabase) Option {
+	return func(o *handlerOptions) {
+		if db != nil {
+			o.users = db
+		}
+	}
+}
+
+// WithFlagDatabase sets the database containing the flags of the questions, which are
+// kept in memory otherwise.
+func WithFlagDatabase(db FlagDatabase) Option {
+	return func(o *handlerOptions) {
+		if db != nil {
+			o.flags = db
+		}
+	}
+}
+
+// WithCorrectionDatabase sets the database containing the corrections of the bounds
+// of the questions, which are kept in memory otherwise.
+func WithCorrectionDatabase(db CorrectionDatabase) Option {
+	return func(o *handlerOptions) {
+		if db != nil {
+			o.corrections = db
+		}
+	}
+}
+
+// WithTournamentDatabase sets the database containing the tournaments and their
+// results, which are kept in memory otherwise.
+func WithTournamentDatabase(db TournamentDatabase) Option {
+	return func(o *handlerOptions) {
+		if db != nil {
+			o.tournaments = db
+		}
+	}
+}
+
+// WithSessionSecret sets the secret signing the identity cookies. Without it a random
+// secret is used, so the users lose their identity when the process restarts and the
+// cookies are only valid for the process which set them. Empty secrets are ignored.
+func WithSessionSecret(secret []byte) Option {
+	return func(o *handlerOptions) {
+		if len(secret) > 0 {
+			o.sessionSecret = secret
+		}
+	}
+}
+
+// WithTokenVerifier identifies the users by the ID tokens they send as bearer tokens,
+// for example with a FirebaseTokenVerifier. Requests without a valid token are
+// identified by their identity cookie.
+func WithTokenVerifier(v TokenVerifier) Option {
+	return func(o *handlerOptions) {
+		if v != nil {
+			o.tokenVerifier = v
+		}
+	}
+}
+
+// WithBaseURL sets the public URL of the site used in the sitemap, for example
+// https://example.com.
+func WithBaseURL(url string) Option {
+	return func(o *handlerOptions) {
+		o.baseURL = url
+	}
+}
+
+// WithBasePath mounts the handler under the path prefix p, for example /games/predict,
+// so it can be served behind a reverse proxy without rewriting the URLs. The prefix is
+// added to the routes, the redirects and the links on the pages. The base URL of the
+// sitemap has to include it as well.
+func WithBasePath(p string) Option {
+	return func(o *handlerOptions) {
+		p = strings.TrimRight(p, "/")
+		if p != "" && !strings.HasPrefix(p, "/") {
+			p = "/" + p
+		}
+		o.basePath = p
+	}
+}
+
+// WithAdminToken enables the admin endpoints for requests with the given bearer token.
+func WithAdminToken(token string) Option {
+	return func(o *handlerOptions) {
+		o.adminToken = token
+	}
+}
+
+// WithServerPush enables or disables HTTP/2 server push of the static assets.
+func WithServerPush(enabled bool) Option {
+	return func(o *handlerOptions) {
+		o.serverPush = enabled
+	}
+}
+
+// WithGzip enables or disables compressing the responses.
+func WithGzip(enabled bool) Option {
+	return func(o *handlerOptions) {
+		o.gzip = enabled
+	}
+}
+
+// WithGzipMinSize sets the minimum size in bytes of a response to be compressed.
+func WithGzipMinSize(n int) Option {
+	return func(o *handlerOptions) {
+		o.gzipMinSize = n
+	}
+}
+
+// WithMaxBodyBytes sets the maximum size of a submitted game in bytes.
+func WithMaxBodyBytes(n int64) Option {
+	return func(o *handlerOptions) {
+		if n > 0 {
+			o.maxBodyBytes = n
+		}
+	}
+}
+
+// WithExposedBounds sends the correct answers of the questions to the play page, where
+// players can look them up, and scores the questions submitted by the client. This is
+// only meant for trusted players or practice. By default the play page only gets the
+// questions without their answers, which the server adds when the game is submitted.
+func WithExposedBounds(enabled bool) Option {
+	return func(o *handlerOptions) {
+		o.exposeBounds = enabled
+	}
+}
+
+// WithPostOnlyPlayStart only starts a new game when /play is requested with POST. A GET
+// shows a page with a button to start the game instead, so crawlers and prefetching
+// browsers following the links to /play do not start games. Other methods are rejected.
+func WithPostOnlyPlayStart(enabled bool) Option {
+	return func(o *handlerOptions) {
+		o.postOnlyPlayStart = enabled
+	}
+}
+
+// WithCSPSources adds sources to a directive of the Content-Security-Policy of the HTML
+// pages, for example WithCSPSources("script-src", "https://cdn.example.com") to load
+// scripts from a CDN.
+func WithCSPSources(directive string, sources ...string) Option {
+	return func(o *handlerOptions) {
+		o.csp[directive] = append(o.csp[directive], sources...)
+	}
+}
+
+// WithScoringMode sets the rule deciding when an answer counts as correct.
+func WithScoringMode(mode ScoringMode) Option {
+	return func(o *handlerOptions) {
+		o.scoring.Mode = mode
+	}
+}
+
+// WithMinOverlapFraction sets the fraction of the width of the correct range an answer
+// has to overlap to count as correct with ScoringOverlap, see ScoreConfig. Values
+// outside of [0, 1] are ignored.
+func WithMinOverlapFraction(f float64) Option {
+	return func(o *handlerOptions) {
+		if f >= 0 && f <= 1 {
+			o.scoring.MinOverlapFraction = f
+		}
+	}
+}
+
+// WithDifficultyWeighting scores correct answers by the difficulty of their questions
+// instead of counting them all the same, see ScoreConfig.WeightByDifficulty.
+func WithDifficultyWeighting(enabled bool) Option {
+	return func(o *handlerOptions) {
+		o.scoring.WeightByDifficulty = enabled
+	}
+}
+
+// DefaultQuestionFile is the path of the CSV file containing the questions unless it is
+// changed with WithQuestionFile.
+const DefaultQuestionFile = "Questions.csv"
+
+// WithQuestionFile sets the path of the CSV file the app reads the questions from when it
+// starts. NewHandler uses the QuestionDatabase it is given instead. An empty path is
+// ignored.
+func WithQuestionFile(path string) Option {
+	return func(o *handlerOptions) {
+		if path != "" {
+			o.questionFile = path
+		}
+	}
+}
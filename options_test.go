@@ -0,0 +1,194 @@
+package predictiongame
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestHandlerOptions(t *testing.T) {
+	o := newHandlerOptions(WithNumQuestions(80), WithExpectedConfidence(0.9), WithExpectedConfidence(1.5))
+
+	if o.numQuestions != 80 || o.maxQuestions != 80 {
+		t.Errorf("expected 80 questions, got %d (max %d)", o.numQuestions, o.maxQuestions)
+	}
+	if o.scoring.expected() != 0.9 {
+		t.Errorf("expected confidence 0.9, got %f", o.scoring.expected())
+	}
+	if o.logger == nil {
+		t.Errorf("expected default logger")
+	}
+}
+
+func TestWithMiddleware(t *testing.T) {
+	templ, err := loadTemplates()
+	if err != nil {
+		t.Fatalf("Can not load templates: %s", err)
+	}
+
+	var order []string
+	mw := func(name string) MiddlewareFunc {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	handler := NewHandler(templ, SeedDemoQuestions(), NewMockGameDatabase(), WithMiddleware(mw("first"), mw("second")), WithMiddleware(mw("third")))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/robots.txt", nil))
+
+	if expected := []string{"first", "second", "third"}; !reflect.DeepEqual(order, expected) {
+		t.Errorf("expected middleware order %v, got %v", expected, order)
+	}
+}
+
+func TestWithBasePath(t *testing.T) {
+	templ, err := loadTemplates()
+	if err != nil {
+		t.Fatalf("Can not load templates: %s", err)
+	}
+
+	handler := NewHandler(templ, SeedDemoQuestions(), NewMockGameDatabase(), WithBasePath("games/predict/"))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/games/predict/about", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if body := w.Body.String(); !strings.Contains(body, `href="/games/predict/static/css/app.css"`) {
+		t.Errorf("Expected links with the base path, got %s", body)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/about", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d outside of the base path, got %d", http.StatusNotFound, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/games/predict/play", nil))
+	if location := w.Header().Get("Location"); w.Code != http.StatusFound || !strings.HasPrefix(location, "/games/predict/play/") {
+		t.Errorf("Expected redirect into the base path, got %d %q", w.Code, location)
+	}
+
+	// Templates loaded once can be used by several handlers with different base paths.
+	w = httptest.NewRecorder()
+	NewHandler(templ, SeedDemoQuestions(), NewMockGameDatabase()).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/about", nil))
+	if body := w.Body.String(); !strings.Contains(body, `href="/static/css/app.css"`) {
+		t.Errorf("Expected links without the base path, got %s", body)
+	}
+}
+
+func TestWithTemplateFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html": {Data: []byte(`Custom {{ .Locale }} {{ basePath }}`)},
+	}
+
+	handler := NewHandler(nil, SeedDemoQuestions(), NewMockGameDatabase(), WithTemplateFS(fsys), WithBasePath("/custom"))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/custom/", nil))
+	if body := w.Body.String(); body != "Custom en /custom" {
+		t.Errorf("Expected the custom template, got %q", body)
+	}
+
+	// Without an option the templates are read from the templates directory.
+	w = httptest.NewRecorder()
+	NewHandler(nil, SeedDemoQuestions(), NewMockGameDatabase()).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/about", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "GetRational") {
+		t.Errorf("Expected the default templates, got %d", w.Code)
+	}
+}
+
+func TestWithTemplateFuncs(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html": {Data: []byte(`{{ withUnit 42 "m" }} {{ percent 0.5 }}`)},
+	}
+
+	handler := NewHandler(nil, SeedDemoQuestions(), NewMockGameDatabase(), WithTemplateFS(fsys), WithTemplateFuncs(template.FuncMap{
+		"withUnit": func(value float64, unit string) string { return fmt.Sprintf("%g %s", value, unit) },
+	}), WithTemplateFuncs(template.FuncMap{
+		"percent": func(ratio float64) string { return fmt.Sprintf("%.1f percent", ratio*100) },
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if body := w.Body.String(); body != "42 m 50.0 percent" {
+		t.Errorf("Expected the custom functions, got %q", body)
+	}
+}
+
+func TestWithEmbeddedAssets(t *testing.T) {
+	onDisk, err := os.ReadFile("static/css/app.css")
+	if err != nil {
+		t.Fatalf("Can not read stylesheet: %s", err)
+	}
+
+	for _, embedded := range []bool{false, true} {
+		handler := NewHandler(nil, SeedDemoQuestions(), NewMockGameDatabase(), WithEmbeddedAssets(embedded), WithGzip(false))
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/static/css/app.css", nil))
+		if w.Code != http.StatusOK || w.Body.String() != string(onDisk) {
+			t.Errorf("embedded=%v: unexpected stylesheet, status %d", embedded, w.Code)
+		}
+
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/about", nil))
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "GetRational") {
+			t.Errorf("embedded=%v: unexpected page, status %d", embedded, w.Code)
+		}
+	}
+}
+
+func TestWithMinOverlapFraction(t *testing.T) {
+	for _, tc := range []struct {
+		fraction, expected float64
+	}{
+		{0.25, 0.25},
+		{1, 1},
+		{-0.5, 0},
+		{1.5, 0},
+	} {
+		o := newHandlerOptions(WithScoringMode(ScoringOverlap), WithMinOverlapFraction(tc.fraction))
+		if o.scoring.MinOverlapFraction != tc.expected {
+			t.Errorf("WithMinOverlapFraction(%v): expected %v, got %v", tc.fraction, tc.expected, o.scoring.MinOverlapFraction)
+		}
+	}
+}
+
+func TestWithQuestionFile(t *testing.T) {
+	if o := newHandlerOptions(); o.questionFile != DefaultQuestionFile {
+		t.Errorf("Expected the default question file, got %q", o.questionFile)
+	}
+	if o := newHandlerOptions(WithQuestionFile("questions/de.csv")); o.questionFile != "questions/de.csv" {
+		t.Errorf("Expected the configured question file, got %q", o.questionFile)
+	}
+	if o := newHandlerOptions(WithQuestionFile("")); o.questionFile != DefaultQuestionFile {
+		t.Errorf("Expected an empty path to be ignored, got %q", o.questionFile)
+	}
+}
+
+func TestWithLogger(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html": {Data: []byte(`{{ json .Invalid }}`)},
+	}
+	var logs bytes.Buffer
+	handler := NewHandler(nil, SeedDemoQuestions(), NewMockGameDatabase(), WithTemplateFS(fsys), WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+
+	// The page context has no field Invalid, so rendering the template fails.
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if !strings.Contains(logs.String(), "Error rendering template") {
+		t.Errorf("Expected the error to be logged with the logger, got %q", logs.String())
+	}
+}
@@ -0,0 +1,401 @@
+package predictiongame
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// postgresSchema creates the tables used by the PostgreSQL game database.
+const postgresSchema = `
+CREATE TABLE IF NOT EXISTS games (
+	id      TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL DEFAULT '',
+	time    TIMESTAMPTZ NOT NULL,
+	status  TEXT NOT NULL,
+	answers JSONB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS games_user_time ON games (user_id, time DESC);
+CREATE INDEX IF NOT EXISTS games_answers ON games USING GIN (answers jsonb_path_ops);
+ALTER TABLE games ADD COLUMN IF NOT EXISTS question_ids JSONB;
+ALTER TABLE games ADD COLUMN IF NOT EXISTS question_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE games ADD COLUMN IF NOT EXISTS score JSONB;
+ALTER TABLE games ADD COLUMN IF NOT EXISTS idempotency_key TEXT;
+`
+
+// Migrate creates the tables needed by PostgresGameDatabase if they do not exist yet.
+func Migrate(db *sql.DB) error {
+	_, err := db.Exec(postgresSchema)
+	return err
+}
+
+type postgresGameDatabase struct {
+	db *sql.DB
+}
+
+// PostgresGameDatabase returns a GameDatabase which stores the games in PostgreSQL.
+// The tables have to be created using Migrate first.
+func PostgresGameDatabase(db *sql.DB) GameDatabase {
+	return &postgresGameDatabase{db: db}
+}
+
+// requestContext returns the context of the request or a background context if there is no request.
+func requestContext(r *http.Request) context.Context {
+	if r == nil {
+		return context.Background()
+	}
+
+	return r.Context()
+}
+
+// update loads the game with the ID in a transaction, locking its row, or a new pending
+// game if it does not exist, lets fn change it and stores it.
+func (db *postgresGameDatabase) update(r *http.Request, id string, fn func(e *GameEntity) error) error {
+	ctx := requestContext(r)
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := updatePostgresGame(ctx, tx, id, fn); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// updatePostgresGame is update within the transaction tx.
+func updatePostgresGame(ctx context.Context, tx *sql.Tx, id string, fn func(e *GameEntity) error) error {
+	row := tx.QueryRowContext(ctx, `
+		SELECT id, user_id, time, status, question_count, question_ids, answers, score, idempotency_key FROM games
+		WHERE id = $1 FOR UPDATE`, id)
+
+	e, err := scanGame(row)
+	if err == sql.ErrNoRows {
+		e = newGame(id)
+	} else if err != nil {
+		return err
+	}
+
+	if err := fn(&e); err != nil {
+		return err
+	}
+
+	answers, err := json.Marshal(e.Answers)
+	if err != nil {
+		return err
+	}
+
+	order, err := json.Marshal(e.QuestionIDs)
+	if err != nil {
+		return err
+	}
+
+	score, err := json.Marshal(e.Score)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO games (id, user_id, time, status, question_count, question_ids, answers, score, idempotency_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''))
+		ON CONFLICT (id) DO UPDATE SET user_id = $2, time = $3, status = $4, question_count = $5,
+			question_ids = $6, answers = $7, score = $8, idempotency_key = NULLIF($9, '')`,
+		e.ID, e.UserID, e.Time, e.Status, e.QuestionCount, order, answers, score, e.IdempotencyKey)
+	return err
+}
+
+func (db *postgresGameDatabase) Start(r *http.Request, id string, numQuestions int) error {
+	return db.update(r, id, func(e *GameEntity) error {
+		return e.start(numQuestions, time.Now())
+	})
+}
+
+func (db *postgresGameDatabase) Save(r *http.Request, game GameEntity) error {
+	return db.update(r, game.ID, func(e *GameEntity) error {
+		return e.complete(game, time.Now())
+	})
+}
+
+func (db *postgresGameDatabase) SaveBatch(r *http.Request, games []GameEntity) error {
+	ctx := requestContext(r)
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	for _, g := range games {
+		err := updatePostgresGame(ctx, tx, g.ID, func(e *GameEntity) error {
+			return e.complete(g, now)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (db *postgresGameDatabase) SetScore(r *http.Request, id string, score GameScore) error {
+	data, err := json.Marshal(score)
+	if err != nil {
+		return err
+	}
+
+	res, err := db.db.ExecContext(requestContext(r), `UPDATE games SET score = $2 WHERE id = $1`, id, data)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrGameNotFound
+	}
+
+	return nil
+}
+
+func (db *postgresGameDatabase) SaveProgress(r *http.Request, id, uid string, answers []Answer) error {
+	return db.update(r, id, func(e *GameEntity) error {
+		return e.saveProgress(uid, answers, time.Now())
+	})
+}
+
+func (db *postgresGameDatabase) SaveQuestions(r *http.Request, id string, questionIDs []string) error {
+	return db.update(r, id, func(e *GameEntity) error {
+		return e.serve(questionIDs, time.Now())
+	})
+}
+
+func (db *postgresGameDatabase) Abandon(r *http.Request, id string) error {
+	// Games are never deleted, so a game which exists is still found by update.
+	if _, err := db.Get(r, id); err != nil {
+		return err
+	}
+
+	return db.update(r, id, func(e *GameEntity) error {
+		return e.abandon(time.Now())
+	})
+}
+
+// scanGame reads a game from a row containing the columns id, user_id, time, status,
+// question_count, question_ids, answers, score and idempotency_key.
+func scanGame(row interface{ Scan(...interface{}) error }) (GameEntity, error) {
+	var e GameEntity
+	var order, answers, score []byte
+	var key sql.NullString
+	if err := row.Scan(&e.ID, &e.UserID, &e.Time, &e.Status, &e.QuestionCount, &order, &answers, &score, &key); err != nil {
+		return GameEntity{}, err
+	}
+	e.IdempotencyKey = key.String
+
+	// Games saved before the scores were stored have no score.
+	if score != nil {
+		if err := json.Unmarshal(score, &e.Score); err != nil {
+			return GameEntity{}, err
+		}
+	}
+
+	// Games saved before the question order was stored have no question_ids.
+	if order != nil {
+		if err := json.Unmarshal(order, &e.QuestionIDs); err != nil {
+			return GameEntity{}, err
+		}
+	}
+
+	if err := json.Unmarshal(answers, &e.Answers); err != nil {
+		return GameEntity{}, err
+	}
+
+	return e, nil
+}
+
+func (db *postgresGameDatabase) Get(r *http.Request, id string) (GameEntity, error) {
+	row := db.db.QueryRowContext(requestContext(r), `
+		SELECT id, user_id, time, status, question_count, question_ids, answers, score, idempotency_key FROM games WHERE id = $1`, id)
+
+	e, err := scanGame(row)
+	if err == sql.ErrNoRows {
+		return GameEntity{}, ErrGameNotFound
+	}
+	if err != nil {
+		return GameEntity{}, err
+	}
+
+	return e, nil
+}
+
+func (db *postgresGameDatabase) List(r *http.Request, uid string) ([]GameEntity, error) {
+	rows, err := db.db.QueryContext(requestContext(r), `
+		SELECT id, user_id, time, status, question_count, question_ids, answers, score, idempotency_key FROM games
+		WHERE user_id = $1 AND status = $2 ORDER BY time DESC`, uid, GameCompleted)
+	if err != nil {
+		return []GameEntity{}, err
+	}
+	defer rows.Close()
+
+	var result []GameEntity
+	for rows.Next() {
+		e, err := scanGame(rows)
+		if err != nil {
+			return []GameEntity{}, err
+		}
+
+		result = append(result, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return []GameEntity{}, err
+	}
+
+	return result, nil
+}
+
+func (db *postgresGameDatabase) ListPage(r *http.Request, uid string, offset, limit int) ([]GameEntity, int, error) {
+	var total int
+	err := db.db.QueryRowContext(requestContext(r), `
+		SELECT COUNT(*) FROM games WHERE user_id = $1 AND status = $2`, uid, GameCompleted).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	games, err := db.query(r, `
+		SELECT id, user_id, time, status, question_count, question_ids, answers, score, idempotency_key FROM games
+		WHERE user_id = $1 AND status = $2 ORDER BY time DESC LIMIT $3 OFFSET $4`, uid, GameCompleted, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	if games == nil {
+		games = []GameEntity{}
+	}
+
+	return games, total, nil
+}
+
+func (db *postgresGameDatabase) Last(r *http.Request, uid string) (*GameEntity, error) {
+	row := db.db.QueryRowContext(requestContext(r), `
+		SELECT id, user_id, time, status, question_count, question_ids, answers, score, idempotency_key FROM games
+		WHERE user_id = $1 AND status = $2 ORDER BY time DESC LIMIT 1`, uid, GameCompleted)
+
+	e, err := scanGame(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrGameNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+func (db *postgresGameDatabase) Leaderboard(r *http.Request, offset, limit int, by LeaderboardSort, cfg ScoreConfig) ([]LeaderboardEntry, int, error) {
+	games, err := db.query(r, `
+		SELECT id, user_id, time, status, question_count, question_ids, answers, score, idempotency_key FROM games
+		WHERE user_id <> '' AND status = $1`, GameCompleted)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return newLeaderboard(games, by, offset, limit, cfg)
+}
+
+func (db *postgresGameDatabase) ListAll(r *http.Request) ([]GameEntity, error) {
+	return db.query(r, `
+		SELECT id, user_id, time, status, question_count, question_ids, answers, score, idempotency_key FROM games
+		WHERE status = $1`, GameCompleted)
+}
+
+func (db *postgresGameDatabase) Iterate(r *http.Request, since time.Time, fn func(GameEntity) error) error {
+	rows, err := db.db.QueryContext(requestContext(r), `
+		SELECT id, user_id, time, status, question_count, question_ids, answers, score, idempotency_key FROM games
+		WHERE time >= $1 ORDER BY time`, since)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e, err := scanGame(rows)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (db *postgresGameDatabase) ListRecent(r *http.Request, limit int) ([]GameEntity, error) {
+	games, err := db.query(r, `
+		SELECT id, user_id, time, status, question_count, question_ids, answers, score, idempotency_key FROM games
+		WHERE status = $1 ORDER BY time DESC LIMIT $2`, GameCompleted, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return recentGames(games, limit), nil
+}
+
+// GetAnswerStats selects the games whose answers contain the question, which the
+// games_answers index supports.
+func (db *postgresGameDatabase) GetAnswerStats(ctx context.Context, questionID string, cfg ScoreConfig) (QuestionStats, error) {
+	games, err := db.queryContext(ctx, `
+		SELECT id, user_id, time, status, question_count, question_ids, answers, score, idempotency_key FROM games
+		WHERE status = $1 AND answers @> jsonb_build_array(jsonb_build_object('question', jsonb_build_object('id', $2::text)))`,
+		GameCompleted, questionID)
+	if err != nil {
+		return QuestionStats{}, err
+	}
+
+	return answerStats(newQuestionStats(games, cfg), questionID), nil
+}
+
+func (db *postgresGameDatabase) QuestionStats(r *http.Request, cfg ScoreConfig) (map[string]QuestionStats, error) {
+	games, err := db.query(r, `
+		SELECT id, user_id, time, status, question_count, question_ids, answers, score, idempotency_key FROM games
+		WHERE status = $1`, GameCompleted)
+	if err != nil {
+		return nil, err
+	}
+
+	return newQuestionStats(games, cfg), nil
+}
+
+// query returns the games selected by the query, which has to select the columns
+// scanGame expects.
+func (db *postgresGameDatabase) query(r *http.Request, query string, args ...interface{}) ([]GameEntity, error) {
+	return db.queryContext(requestContext(r), query, args...)
+}
+
+// queryContext is query using ctx.
+func (db *postgresGameDatabase) queryContext(ctx context.Context, query string, args ...interface{}) ([]GameEntity, error) {
+	rows, err := db.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var games []GameEntity
+	for rows.Next() {
+		e, err := scanGame(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		games = append(games, e)
+	}
+
+	return games, rows.Err()
+}
@@ -0,0 +1,88 @@
+//go:build integration
+
+package predictiongame
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	_ "github.com/lib/pq"
+)
+
+// The PostgreSQL tests need a database which can be used for testing, for example:
+//
+//	PREDICTIONGAME_POSTGRES_URL="postgres://localhost/predictiongame_test?sslmode=disable" go test -tags integration
+func TestPostgresGameDatabase(t *testing.T) {
+	dsn := os.Getenv("PREDICTIONGAME_POSTGRES_URL")
+	if dsn == "" {
+		t.Skip("PREDICTIONGAME_POSTGRES_URL is not set.")
+	}
+
+	raw, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("Can not open database: %s", err)
+	}
+	defer raw.Close()
+
+	if err := Migrate(raw); err != nil {
+		t.Fatalf("Can not migrate database: %s", err)
+	}
+	if _, err := raw.Exec("TRUNCATE games"); err != nil {
+		t.Fatalf("Can not clear games: %s", err)
+	}
+
+	db := PostgresGameDatabase(raw)
+
+	answers := []Answer{{Question: demoQuestionList()[0], LowerBound: 8000, UpperBound: 9000}}
+	for _, id := range []string{"first", "second"} {
+		if err := db.Save(nil, GameEntity{ID: id, UserID: "user", Answers: answers}); err != nil {
+			t.Fatalf("Can not save game %s: %s", id, err)
+		}
+	}
+
+	game, err := db.Get(nil, "first")
+	if err != nil {
+		t.Fatalf("Can not get game: %s", err)
+	}
+	if game.UserID != "user" || len(game.Answers) != 1 || game.Answers[0].Question.ID != answers[0].Question.ID {
+		t.Errorf("Unexpected game: %+v", game)
+	}
+
+	if _, err := db.Get(nil, "missing"); err != ErrGameNotFound {
+		t.Errorf("Expected ErrGameNotFound, got %v", err)
+	}
+
+	list, err := db.List(nil, "user")
+	if err != nil {
+		t.Fatalf("Can not list games: %s", err)
+	}
+	if len(list) != 2 || list[0].ID != "second" || list[1].ID != "first" {
+		t.Errorf("Unexpected games: %+v", list)
+	}
+
+	if last, err := db.Last(nil, "user"); err != nil || last == nil || last.ID != "second" {
+		t.Errorf("Unexpected last game %+v (%v)", last, err)
+	}
+	if last, err := db.Last(nil, "nobody"); err != ErrGameNotFound || last != nil {
+		t.Errorf("Expected ErrGameNotFound, got %+v (%v)", last, err)
+	}
+
+	if err := db.SaveProgress(nil, "third", "", answers); err != nil {
+		t.Fatalf("Can not save progress: %s", err)
+	}
+	if err := db.SaveProgress(nil, "third", "", answers); err != nil {
+		t.Fatalf("Can not update progress: %s", err)
+	}
+	if err := db.SaveProgress(nil, "first", "", answers); err != ErrGameCompleted {
+		t.Errorf("Expected ErrGameCompleted, got %v", err)
+	}
+
+	if stats, err := db.GetAnswerStats(context.Background(), answers[0].Question.ID, ScoreConfig{}); err != nil || stats.Answers != 2 {
+		t.Errorf("Expected the answers of the completed games, got %+v (%v)", stats, err)
+	}
+	if stats, err := db.GetAnswerStats(context.Background(), "unanswered", ScoreConfig{}); err != nil || stats.Answers != 0 {
+		t.Errorf("Expected empty stats, got %+v (%v)", stats, err)
+	}
+}
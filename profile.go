@@ -0,0 +1,312 @@
+package predictiongame
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"sync"
+	"time"
+
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/datastore"
+)
+
+// UserProfile contains the data of a user which is kept across games.
+type UserProfile struct {
+	ID          string            `json:"id"`
+	DisplayName string            `json:"displayName,omitempty"`
+	Email       string            `json:"email,omitempty"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	Preferences map[string]string `json:"preferences,omitempty"`
+}
+
+// ErrUserNotFound is returned when a user has no profile.
+var ErrUserNotFound = errors.New("user not found")
+
+// UserDatabase is the interface for the database containing the profiles of the users.
+type UserDatabase interface {
+	// Get returns the profile of a user or ErrUserNotFound.
+	Get(r *http.Request, uid string) (UserProfile, error)
+	// Save creates or replaces the profile with the ID of p.
+	Save(r *http.Request, p UserProfile) error
+	// Delete deletes the profile of a user. It does nothing if there is none.
+	Delete(r *http.Request, uid string) error
+}
+
+type memoryUserDatabase struct {
+	mu       sync.RWMutex
+	profiles map[string]UserProfile
+}
+
+// NewUserDatabase returns an in-memory UserDatabase which can be used concurrently.
+func NewUserDatabase() UserDatabase {
+	return &memoryUserDatabase{profiles: make(map[string]UserProfile)}
+}
+
+// copyPreferences makes sure callers can not modify the preferences stored in the database.
+func copyPreferences(prefs map[string]string) map[string]string {
+	if prefs == nil {
+		return nil
+	}
+
+	result := make(map[string]string, len(prefs))
+	for k, v := range prefs {
+		result[k] = v
+	}
+	return result
+}
+
+func (db *memoryUserDatabase) Get(r *http.Request, uid string) (UserProfile, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	p, ok := db.profiles[uid]
+	if !ok {
+		return UserProfile{}, ErrUserNotFound
+	}
+
+	p.Preferences = copyPreferences(p.Preferences)
+	return p, nil
+}
+
+func (db *memoryUserDatabase) Save(r *http.Request, p UserProfile) error {
+	if p.ID == "" {
+		return errors.New("user ID is empty")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	p.Preferences = copyPreferences(p.Preferences)
+	db.profiles[p.ID] = p
+	return nil
+}
+
+func (db *memoryUserDatabase) Delete(r *http.Request, uid string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	delete(db.profiles, uid)
+	return nil
+}
+
+// userEntity is a UserProfile as it is stored in the datastore, which can not store maps,
+// so the preferences are stored as JSON.
+type userEntity struct {
+	DisplayName string
+	Email       string `datastore:",noindex"`
+	CreatedAt   time.Time
+	Preferences string `datastore:",noindex"`
+}
+
+// userDatabase is the UserDatabase storing the profiles in the datastore of App Engine.
+type userDatabase struct{}
+
+func (db *userDatabase) Get(r *http.Request, uid string) (UserProfile, error) {
+	ctx := appengine.NewContext(r)
+
+	var e userEntity
+	err := datastore.Get(ctx, datastore.NewKey(ctx, "User", uid, 0, nil), &e)
+	if err == datastore.ErrNoSuchEntity {
+		return UserProfile{}, ErrUserNotFound
+	}
+	if err != nil {
+		return UserProfile{}, err
+	}
+
+	p := UserProfile{ID: uid, DisplayName: e.DisplayName, Email: e.Email, CreatedAt: e.CreatedAt}
+	if e.Preferences != "" {
+		if err := json.Unmarshal([]byte(e.Preferences), &p.Preferences); err != nil {
+			return UserProfile{}, fmt.Errorf("invalid preferences: %s", err)
+		}
+	}
+	return p, nil
+}
+
+func (db *userDatabase) Save(r *http.Request, p UserProfile) error {
+	if p.ID == "" {
+		return errors.New("user ID is empty")
+	}
+
+	e := userEntity{DisplayName: p.DisplayName, Email: p.Email, CreatedAt: p.CreatedAt}
+	if len(p.Preferences) > 0 {
+		prefs, err := json.Marshal(p.Preferences)
+		if err != nil {
+			return err
+		}
+		e.Preferences = string(prefs)
+	}
+
+	ctx := appengine.NewContext(r)
+	_, err := datastore.Put(ctx, datastore.NewKey(ctx, "User", p.ID, 0, nil), &e)
+	return err
+}
+
+func (db *userDatabase) Delete(r *http.Request, uid string) error {
+	ctx := appengine.NewContext(r)
+
+	err := datastore.Delete(ctx, datastore.NewKey(ctx, "User", uid, 0, nil))
+	if err == datastore.ErrNoSuchEntity {
+		return nil
+	}
+	return err
+}
+
+// ensureProfile creates an empty profile for the user if there is none yet. It is
+// called when the user saves a game.
+func ensureProfile(r *http.Request, users UserDatabase, uid string) error {
+	_, err := users.Get(r, uid)
+	if !errors.Is(err, ErrUserNotFound) {
+		return err
+	}
+
+	return users.Save(r, UserProfile{ID: uid, CreatedAt: time.Now()})
+}
+
+// profileDisplayNames is a DisplayNameDatabase storing the names in the profiles of
+// the users.
+type profileDisplayNames struct {
+	users UserDatabase
+}
+
+func (n profileDisplayNames) Set(r *http.Request, uid, name string) error {
+	p, err := n.users.Get(r, uid)
+	if errors.Is(err, ErrUserNotFound) {
+		p = UserProfile{ID: uid, CreatedAt: time.Now()}
+	} else if err != nil {
+		return err
+	}
+
+	p.DisplayName = name
+	return n.users.Save(r, p)
+}
+
+func (n profileDisplayNames) Get(r *http.Request, uid string) (string, bool) {
+	p, err := n.users.Get(r, uid)
+	if err != nil || p.DisplayName == "" {
+		return "", false
+	}
+
+	return p.DisplayName, true
+}
+
+// The limits of the preferences of a profile.
+const (
+	maxPreferences           = 20
+	maxPreferenceKeyLength   = 64
+	maxPreferenceValueLength = 256
+)
+
+// profileUpdate is the body of PUT /api/users/{uid}/profile. It replaces the fields of
+// the profile which can be changed by the user.
+type profileUpdate struct {
+	DisplayName string            `json:"displayName"`
+	Email       string            `json:"email"`
+	Preferences map[string]string `json:"preferences"`
+}
+
+// validate returns the update with a normalized display name or an error if one of the
+// fields is invalid. The display name and the email address may be empty.
+func (u profileUpdate) validate() (profileUpdate, error) {
+	if u.DisplayName != "" {
+		name, err := validateDisplayName(u.DisplayName)
+		if err != nil {
+			return u, fmt.Errorf("invalid name: %s", err)
+		}
+		u.DisplayName = name
+	}
+
+	if u.Email != "" {
+		addr, err := mail.ParseAddress(u.Email)
+		if err != nil || addr.Name != "" {
+			return u, fmt.Errorf("invalid email address %q", u.Email)
+		}
+	}
+
+	if len(u.Preferences) > maxPreferences {
+		return u, fmt.Errorf("%d preferences, at most %d are allowed", len(u.Preferences), maxPreferences)
+	}
+	for k, v := range u.Preferences {
+		if k == "" || len(k) > maxPreferenceKeyLength || len(v) > maxPreferenceValueLength {
+			return u, fmt.Errorf("invalid preference %q", k)
+		}
+	}
+
+	return u, nil
+}
+
+// profileHandler serves GET and PUT /api/users/{uid}/profile. Only the user can read
+// or change their profile.
+func profileHandler(users UserDatabase, opts handlerOptions) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := splitPath(r.URL.Path, "/api/users/")
+		if len(parts) != 2 || parts[1] != "profile" {
+			http.NotFound(w, r)
+			return
+		}
+
+		uid := parts[0]
+		if !validID(uid) {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		if !opts.hasIdentity(r, uid) {
+			http.Error(w, "Profiles of other users can not be accessed", http.StatusForbidden)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			p, err := users.Get(r, uid)
+			if errors.Is(err, ErrUserNotFound) {
+				http.Error(w, fmt.Sprintf("Profile can not be loaded: %s", err), http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Profile can not be loaded: %s", err), http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Cache-Control", "private, no-cache")
+			writeJSON(w, r, p)
+		case http.MethodPut:
+			defer r.Body.Close()
+
+			var update profileUpdate
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, opts.maxBodyBytes)).Decode(&update); err != nil {
+				http.Error(w, fmt.Sprintf("Error parsing profile: %s", err), http.StatusBadRequest)
+				return
+			}
+
+			update, err := update.validate()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			p, err := users.Get(r, uid)
+			if errors.Is(err, ErrUserNotFound) {
+				p = UserProfile{ID: uid, CreatedAt: time.Now()}
+			} else if err != nil {
+				http.Error(w, fmt.Sprintf("Profile can not be loaded: %s", err), http.StatusInternalServerError)
+				return
+			}
+
+			p.DisplayName = update.DisplayName
+			p.Email = update.Email
+			p.Preferences = update.Preferences
+			if err := users.Save(r, p); err != nil {
+				http.Error(w, fmt.Sprintf("Error saving profile: %s", err), http.StatusInternalServerError)
+				return
+			}
+
+			writeJSON(w, r, p)
+		default:
+			w.Header().Set("Allow", "GET, HEAD, PUT")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
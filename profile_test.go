@@ -0,0 +1,131 @@
+package predictiongame
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestUserDatabase(t *testing.T) {
+	users := NewUserDatabase()
+	if _, err := users.Get(nil, "user"); err != ErrUserNotFound {
+		t.Fatalf("Expected ErrUserNotFound, got %v", err)
+	}
+
+	prefs := map[string]string{"theme": "dark"}
+	if err := users.Save(nil, UserProfile{ID: "user", DisplayName: "Ada", Preferences: prefs}); err != nil {
+		t.Fatal(err)
+	}
+	prefs["theme"] = "light"
+
+	p, err := users.Get(nil, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.DisplayName != "Ada" || p.Preferences["theme"] != "dark" {
+		t.Errorf("Unexpected profile %+v", p)
+	}
+
+	if err := users.Delete(nil, "user"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := users.Get(nil, "user"); err != ErrUserNotFound {
+		t.Errorf("Expected ErrUserNotFound after deleting, got %v", err)
+	}
+}
+
+func TestProfileHandler(t *testing.T) {
+	users := NewUserDatabase()
+	handler := profileHandler(users, newHandlerOptions(WithSessionSecret(testSessionSecret)))
+
+	request := func(method, uid, cookie, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/api/users/"+uid+"/profile", strings.NewReader(body))
+		if cookie != "" {
+			addIdentity(r, cookie)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := request(http.MethodGet, "user", "user", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 without a profile, got %d", w.Code)
+	}
+
+	for _, tc := range []struct {
+		method, cookie, body string
+		status               int
+	}{
+		{http.MethodPut, "other", `{"displayName": "Ada"}`, http.StatusForbidden},
+		{http.MethodPut, "", `{"displayName": "Ada"}`, http.StatusForbidden},
+		{http.MethodPut, "user", `{"displayName": "<b>Ada</b>"}`, http.StatusBadRequest},
+		{http.MethodPut, "user", `{"email": "not an address"}`, http.StatusBadRequest},
+		{http.MethodPut, "user", `{"preferences": {"": "x"}}`, http.StatusBadRequest},
+		{http.MethodPut, "user", `not json`, http.StatusBadRequest},
+		{http.MethodDelete, "user", ``, http.StatusMethodNotAllowed},
+		{http.MethodPut, "user", `{"displayName": " Ada ", "email": "ada@example.com", "preferences": {"theme": "dark"}}`, http.StatusOK},
+	} {
+		if w := request(tc.method, "user", tc.cookie, tc.body); w.Code != tc.status {
+			t.Errorf("%s %q %s: expected status %d, got %d", tc.method, tc.cookie, tc.body, tc.status, w.Code)
+		}
+	}
+
+	if w := request(http.MethodGet, "user", "other", ""); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for the profile of another user, got %d", w.Code)
+	}
+
+	w := request(http.MethodGet, "user", "user", "")
+	var p UserProfile
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.ID != "user" || p.DisplayName != "Ada" || p.Email != "ada@example.com" || p.Preferences["theme"] != "dark" || p.CreatedAt.IsZero() {
+		t.Errorf("Unexpected profile %+v", p)
+	}
+}
+
+func TestSubmitHandlerCreatesProfile(t *testing.T) {
+	opts := defaultHandlerOptions()
+	handler := submitHandler(SeedDemoQuestions(), NewMockGameDatabase(), NewTournamentDatabase(), NewMultiplayerHub(), opts)
+
+	body := `{"id": "game", "uid": "user", "answers": []}`
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/game", strings.NewReader("data="+url.QueryEscape(body))))
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusFound, w.Code, w.Body)
+	}
+
+	p, err := opts.users.Get(nil, "user")
+	if err != nil {
+		t.Fatalf("Expected a profile after the first game, got %v", err)
+	}
+
+	// Saving another game keeps the profile.
+	p.DisplayName = "Ada"
+	if err := opts.users.Save(nil, p); err != nil {
+		t.Fatal(err)
+	}
+	body = `{"id": "game2", "uid": "user", "answers": []}`
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/game", strings.NewReader("data="+url.QueryEscape(body))))
+	if p, _ := opts.users.Get(nil, "user"); p.DisplayName != "Ada" {
+		t.Errorf("Expected the profile to be kept, got %+v", p)
+	}
+}
+
+func TestProfileDisplayNames(t *testing.T) {
+	users := NewUserDatabase()
+	names := profileDisplayNames{users: users}
+	if err := names.Set(nil, "user", "Ada"); err != nil {
+		t.Fatal(err)
+	}
+
+	if p, err := users.Get(nil, "user"); err != nil || p.DisplayName != "Ada" {
+		t.Errorf("Expected the name in the profile, got %+v (%v)", p, err)
+	}
+	if _, ok := names.Get(nil, "other"); ok {
+		t.Error("Expected no name for a user without a profile")
+	}
+}
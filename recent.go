@@ -0,0 +1,113 @@
+package predictiongame
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// The number of games returned by /api/games/recent by default and at most.
+const (
+	DefaultRecentGames = 20
+	maxRecentGames     = 100
+)
+
+// PublicGameSummary is a completed game as it is shown in the public feed. It does
+// not contain the answers, and the user is only identified by AnonymousID.
+type PublicGameSummary struct {
+	// AnonymousID is derived from the ID of the user, so the games of a user can be
+	// recognized in the feed without revealing who played them.
+	AnonymousID string `json:"anonymousId"`
+	// Score is the calibrated score of the game with the configured scoring rules, see
+	// GameScore.Calibration.
+	Score        float64   `json:"score"`
+	PlayedAt     time.Time `json:"playedAt"`
+	NumCorrect   int       `json:"numCorrect"`
+	NumQuestions int       `json:"numQuestions"`
+}
+
+// anonymousID returns an ID of the user which can be shown publicly. It is an HMAC of
+// the user ID with the session secret, so it can not be traced back to the user by
+// hashing known user IDs. The user ID is prefixed, so the ID differs from the signature
+// of the identity cookie.
+func (o handlerOptions) anonymousID(uid string) string {
+	mac := hmac.New(sha256.New, o.sessionSecret)
+	mac.Write([]byte("anonymous:" + uid))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// playerName returns the display name of the user, which is shown to the other players,
+// or the anonymous ID of the user if the user has no display name.
+func (o handlerOptions) playerName(r *http.Request, uid string) (displayName, anonymousID string) {
+	if name, ok := (profileDisplayNames{users: o.users}).Get(r, uid); ok {
+		return name, ""
+	}
+
+	return "", o.anonymousID(uid)
+}
+
+// newPublicGameSummary returns the summary of a completed game.
+func (o handlerOptions) newPublicGameSummary(g GameEntity) PublicGameSummary {
+	score := RescoreGame(g, o.scoring)
+	return PublicGameSummary{
+		AnonymousID:  o.anonymousID(g.UserID),
+		Score:        score.Calibration,
+		PlayedAt:     g.Time,
+		NumCorrect:   score.Correct,
+		NumQuestions: len(g.Answers),
+	}
+}
+
+// recentGames returns the limit newest completed games, newest first.
+func recentGames(games []GameEntity, limit int) []GameEntity {
+	completed := make([]GameEntity, 0, len(games))
+	for _, g := range games {
+		if g.Completed() {
+			completed = append(completed, g)
+		}
+	}
+
+	sort.Slice(completed, func(i, j int) bool {
+		return completed[i].Time.After(completed[j].Time)
+	})
+	if len(completed) > limit {
+		completed = completed[:limit]
+	}
+	return completed
+}
+
+// recentGamesHandler serves the public feed of the newest completed games of all users.
+// The limit query parameter sets the number of games.
+func recentGamesHandler(db GameDatabase, opts handlerOptions) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		_, limit, err := pageParams(r, DefaultRecentGames, maxRecentGames)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		games, err := db.ListRecent(r, limit)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Recent games can not be loaded: %s", err), gameErrorStatus(err))
+			return
+		}
+
+		summaries := make([]PublicGameSummary, len(games))
+		for i, g := range games {
+			summaries[i] = opts.newPublicGameSummary(g)
+		}
+
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		writeJSON(w, r, summaries)
+	})
+}
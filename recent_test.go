@@ -0,0 +1,90 @@
+package predictiongame
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecentGames(t *testing.T) {
+	now := time.Now()
+	q := demoQuestionList()[0]
+	answers := []Answer{
+		{Question: q, LowerBound: q.BoundLow, UpperBound: q.BoundHigh},
+		{Question: q, LowerBound: q.BoundHigh + 1, UpperBound: q.BoundHigh + 2},
+	}
+	games := []GameEntity{
+		{ID: "old", UserID: "alice", Time: now.Add(-time.Hour), Status: GameCompleted, Answers: answers},
+		{ID: "new", UserID: "bob", Time: now, Status: GameCompleted, Answers: append(answers, Answer{Question: q, LowerBound: q.BoundHigh, UpperBound: q.BoundHigh + 1})},
+		{ID: "progress", UserID: "alice", Time: now.Add(time.Hour), Status: GameInProgress, Answers: answers},
+	}
+
+	recent := recentGames(games, 1)
+	if len(recent) != 1 || recent[0].ID != "new" {
+		t.Fatalf("Expected the newest completed game, got %+v", recent)
+	}
+	if len(recentGames(games, 10)) != 2 {
+		t.Errorf("Expected only the completed games, got %+v", recentGames(games, 10))
+	}
+
+	// The third answer only touches the correct range, which does not count with the options.
+	opts := newHandlerOptions(WithSessionSecret(testSessionSecret), WithMinOverlapFraction(0.5))
+	summary := opts.newPublicGameSummary(recent[0])
+	if summary.AnonymousID != opts.anonymousID("bob") || !summary.PlayedAt.Equal(now) {
+		t.Errorf("Unexpected summary %+v", summary)
+	}
+	if summary.NumCorrect != 1 || summary.NumQuestions != 3 || summary.Score != calibratedScore(1, 3, ExpectedConfidence) {
+		t.Errorf("Expected the answers to be scored with the options, got %+v", summary)
+	}
+
+	if opts.anonymousID("alice") == opts.anonymousID("bob") || strings.Contains(opts.anonymousID("alice"), "alice") {
+		t.Errorf("Expected distinct anonymous IDs, got %q", opts.anonymousID("alice"))
+	}
+	other := newHandlerOptions(WithSessionSecret([]byte("other secret")))
+	if other.anonymousID("bob") == opts.anonymousID("bob") {
+		t.Errorf("Expected the anonymous IDs to depend on the secret")
+	}
+	if strings.Contains(signIdentity(testSessionSecret, "bob"), opts.anonymousID("bob")) {
+		t.Errorf("Expected the anonymous ID to differ from the signature of the identity cookie")
+	}
+}
+
+func TestRecentGamesHandler(t *testing.T) {
+	db := NewMockGameDatabase()
+	db.ListGames = []GameEntity{{ID: "game", UserID: "user", Time: time.Now(), Status: GameCompleted}}
+	handler := recentGamesHandler(db, defaultHandlerOptions())
+
+	for _, tc := range []struct {
+		method, query string
+		status        int
+	}{
+		{http.MethodGet, "", http.StatusOK},
+		{http.MethodGet, "?limit=5", http.StatusOK},
+		{http.MethodGet, "?limit=0", http.StatusBadRequest},
+		{http.MethodGet, "?limit=1000", http.StatusBadRequest},
+		{http.MethodPost, "", http.StatusMethodNotAllowed},
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(tc.method, "/api/games/recent"+tc.query, nil))
+		if w.Code != tc.status {
+			t.Errorf("%s %q: expected status %d, got %d", tc.method, tc.query, tc.status, w.Code)
+		}
+	}
+
+	if calls := db.Calls("ListRecent"); len(calls) != 2 || calls[0].Args[0] != DefaultRecentGames || calls[1].Args[0] != 5 {
+		t.Errorf("Unexpected calls %v", calls)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/games/recent", nil))
+	if body := w.Body.String(); strings.Contains(body, `"user"`) || strings.Contains(body, "answers") {
+		t.Errorf("Expected no user ID or answers in the feed, got %s", body)
+	}
+	var games []PublicGameSummary
+	if err := json.Unmarshal(w.Body.Bytes(), &games); err != nil || len(games) != 1 {
+		t.Errorf("Unexpected feed %s (%v)", w.Body, err)
+	}
+}
@@ -0,0 +1,90 @@
+package predictiongame
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"google.golang.org/appengine/datastore"
+)
+
+// ErrTransient marks an error of a GameDatabase as temporary, so the call may succeed
+// when it is repeated. Implementations wrap it, for example with
+// fmt.Errorf("%w: %w", ErrTransient, err); the datastore does so in datastoreError.
+var ErrTransient = errors.New("transient database error")
+
+// isRetryable returns true if err is a temporary failure of the database. Errors like
+// ErrGameNotFound, which are answers of a working database, are never retried.
+func isRetryable(err error) bool {
+	if errors.Is(err, ErrTransient) || errors.Is(err, datastore.ErrConcurrentTransaction) {
+		return true
+	}
+
+	var temporary interface{ Temporary() bool }
+	return errors.As(err, &temporary) && temporary.Temporary()
+}
+
+// RetryGameDatabase wraps a GameDatabase and repeats Save and Get when they fail with a
+// retryable error, so a short hiccup of the database does not lose a round. It waits
+// baseDelay before the second attempt and doubles the delay for every further one. It
+// stops waiting when the request is canceled.
+type RetryGameDatabase struct {
+	GameDatabase
+
+	attempts  int
+	baseDelay time.Duration
+	// after is time.After, which is replaced in the tests.
+	after func(time.Duration) <-chan time.Time
+}
+
+// NewRetryGameDatabase wraps db, trying Save and Get at most attempts times with a delay
+// starting at baseDelay between them.
+func NewRetryGameDatabase(db GameDatabase, attempts int, baseDelay time.Duration) *RetryGameDatabase {
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	return &RetryGameDatabase{
+		GameDatabase: db,
+		attempts:     attempts,
+		baseDelay:    baseDelay,
+		after:        time.After,
+	}
+}
+
+// retry calls fn until it succeeds, fails with an error which is not retryable, the
+// attempts are used up or the request is canceled.
+func (db *RetryGameDatabase) retry(r *http.Request, fn func() error) error {
+	delay := db.baseDelay
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= db.attempts || !isRetryable(err) {
+			return err
+		}
+
+		var done <-chan struct{}
+		if r != nil {
+			done = r.Context().Done()
+		}
+		select {
+		case <-db.after(delay):
+		case <-done:
+			return err
+		}
+		delay *= 2
+	}
+}
+
+func (db *RetryGameDatabase) Save(r *http.Request, game GameEntity) error {
+	return db.retry(r, func() error {
+		return db.GameDatabase.Save(r, game)
+	})
+}
+
+func (db *RetryGameDatabase) Get(r *http.Request, id string) (game GameEntity, err error) {
+	err = db.retry(r, func() error {
+		game, err = db.GameDatabase.Get(r, id)
+		return err
+	})
+	return game, err
+}
@@ -0,0 +1,110 @@
+package predictiongame
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRetryGameDatabase(t *testing.T) {
+	transient := fmt.Errorf("%w: deadline exceeded", ErrTransient)
+	for _, tc := range []struct {
+		err   error
+		calls int
+	}{
+		{nil, 1},
+		{transient, 3},
+		{ErrGameNotFound, 1},
+		{errors.New("invalid entity"), 1},
+	} {
+		mock := NewMockGameDatabase(WithGetReturns(GameEntity{}, tc.err), WithSaveReturns(tc.err))
+		db := NewRetryGameDatabase(mock, 3, time.Millisecond)
+
+		var delays []time.Duration
+		db.after = func(d time.Duration) <-chan time.Time {
+			delays = append(delays, d)
+			c := make(chan time.Time, 1)
+			c <- time.Time{}
+			return c
+		}
+
+		if _, err := db.Get(nil, "game"); err != tc.err {
+			t.Errorf("%v: expected the error of the database from Get, got %v", tc.err, err)
+		}
+		if err := db.Save(nil, GameEntity{ID: "game", UserID: "user"}); err != tc.err {
+			t.Errorf("%v: expected the error of the database from Save, got %v", tc.err, err)
+		}
+
+		if n := len(mock.Calls("Get")); n != tc.calls {
+			t.Errorf("%v: expected %d calls of Get, got %d", tc.err, tc.calls, n)
+		}
+		if n := len(mock.Calls("Save")); n != tc.calls {
+			t.Errorf("%v: expected %d calls of Save, got %d", tc.err, tc.calls, n)
+		}
+		if tc.calls == 3 && (len(delays) != 4 || delays[0] != time.Millisecond || delays[1] != 2*time.Millisecond) {
+			t.Errorf("Expected doubling delays, got %v", delays)
+		}
+	}
+}
+
+// apiError mirrors the error of the App Engine APIs, which is internal to the appengine package.
+type apiError struct {
+	code   int32
+	detail string
+}
+
+func (e apiError) Error() string {
+	return fmt.Sprintf("API error %d (datastore_v3: %s)", e.code, e.detail)
+}
+
+// callError mirrors the error of a failed call to the App Engine APIs.
+type callError struct {
+	timeout bool
+}
+
+func (e callError) Error() string   { return "call error" }
+func (e callError) IsTimeout() bool { return e.timeout }
+
+func TestDatastoreError(t *testing.T) {
+	for _, tc := range []struct {
+		err       error
+		retryable bool
+	}{
+		{apiError{5, "TIMEOUT"}, true},
+		{apiError{6, "INTERNAL_ERROR"}, true},
+		{apiError{11, "UNAVAILABLE"}, true},
+		{apiError{1, "BAD_REQUEST"}, false},
+		{callError{timeout: true}, true},
+		{callError{timeout: false}, false},
+		{ErrGameNotFound, false},
+	} {
+		err := datastoreError(tc.err)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%v: expected the original error to be wrapped, got %v", tc.err, err)
+		}
+		if isRetryable(err) != tc.retryable {
+			t.Errorf("%v: expected retryable %v", tc.err, tc.retryable)
+		}
+	}
+
+	if datastoreError(nil) != nil {
+		t.Errorf("Expected no error for nil")
+	}
+
+	// A timeout of the datastore is repeated by RetryGameDatabase.
+	timeout := datastoreError(apiError{5, "TIMEOUT"})
+	mock := NewMockGameDatabase(WithSaveReturns(timeout))
+	db := NewRetryGameDatabase(mock, 3, time.Millisecond)
+	db.after = func(time.Duration) <-chan time.Time {
+		c := make(chan time.Time, 1)
+		c <- time.Time{}
+		return c
+	}
+	if err := db.Save(nil, GameEntity{ID: "game", UserID: "user"}); err != timeout {
+		t.Errorf("Expected the timeout from Save, got %v", err)
+	}
+	if n := len(mock.Calls("Save")); n != 3 {
+		t.Errorf("Expected 3 calls of Save, got %d", n)
+	}
+}
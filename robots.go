@@ -0,0 +1,103 @@
+package predictiongame
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// routeMux is a ServeMux which records how crawlers should treat its routes, so that
+// robots.txt and the sitemap are built from the routes of the handler. Routes added
+// with Handle, like the static files, are left to the crawlers.
+type routeMux struct {
+	*http.ServeMux
+	// pages are the public pages, which crawlers may index and which are listed in
+	// the sitemap.
+	pages []string
+	// private are the routes crawlers are kept out of.
+	private []string
+	// public are the paths below private routes which crawlers may index anyway.
+	public []string
+}
+
+func newRouteMux() *routeMux {
+	return &routeMux{ServeMux: http.NewServeMux()}
+}
+
+// page registers a public page.
+func (m *routeMux) page(pattern string, handler http.Handler) {
+	m.Handle(pattern, handler)
+	m.pages = append(m.pages, pattern)
+}
+
+// hide registers a route which is not meant for crawlers, like the API or the pages of
+// individual games. The paths in public are below the route, but may be indexed, like
+// the share pages of the games which social media sites fetch for the link previews.
+// They may contain the wildcard *.
+func (m *routeMux) hide(pattern string, handler http.Handler, public ...string) {
+	m.Handle(pattern, handler)
+	m.private = append(m.private, pattern)
+	m.public = append(m.public, public...)
+}
+
+// robotsRules returns the paths crawlers may index and those they are kept out of,
+// prefixed with basePath. The private routes are shortened to their first segment,
+// so the API is disallowed as a whole instead of by endpoint.
+func (m *routeMux) robotsRules(basePath string) (allow, disallow []string) {
+	for _, p := range append(append([]string{}, m.pages...), m.public...) {
+		allow = append(allow, basePath+p)
+	}
+
+	var prefixes []string
+	seen := make(map[string]bool)
+	for _, p := range m.private {
+		if i := strings.Index(p[1:], "/"); i >= 0 {
+			p = p[:i+2]
+		}
+		if !seen[p] {
+			seen[p] = true
+			prefixes = append(prefixes, p)
+		}
+	}
+	for _, p := range prefixes {
+		covered := false
+		for _, other := range prefixes {
+			if other != p && strings.HasPrefix(p, other) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			disallow = append(disallow, basePath+p)
+		}
+	}
+
+	return allow, disallow
+}
+
+// sitemapPages returns the public pages listed in the sitemap, prefixed with basePath.
+func (m *routeMux) sitemapPages(basePath string) []string {
+	pages := make([]string, 0, len(m.pages))
+	for _, p := range m.pages {
+		pages = append(pages, basePath+p)
+	}
+	return pages
+}
+
+// RobotsHandler serves a robots.txt which keeps crawlers out of the paths in disallow,
+// except for those in allow.
+func RobotsHandler(allow, disallow []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var b strings.Builder
+		b.WriteString("User-agent: *\n")
+		for _, p := range disallow {
+			fmt.Fprintf(&b, "Disallow: %s\n", p)
+		}
+		for _, p := range allow {
+			fmt.Fprintf(&b, "Allow: %s\n", p)
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprint(w, b.String())
+	})
+}
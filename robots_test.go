@@ -0,0 +1,59 @@
+package predictiongame
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRobotsHandler(t *testing.T) {
+	for basePath, target := range map[string]string{"": "/robots.txt", "/predict": "/predict/robots.txt"} {
+		w := httptest.NewRecorder()
+		NewHandler(nil, SeedDemoQuestions(), NewMockGameDatabase(), WithBasePath(basePath)).ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+
+		body := w.Body.String()
+		for _, expected := range []string{
+			"User-agent: *",
+			"Disallow: " + basePath + "/api/",
+			"Disallow: " + basePath + "/admin/",
+			"Disallow: " + basePath + "/lastGame/",
+			"Allow: " + basePath + "/help/overview",
+			"Allow: " + basePath + "/game/*/share",
+		} {
+			if !strings.Contains(body, expected+"\n") {
+				t.Errorf("Base path %q: expected robots.txt to contain %q:\n%s", basePath, expected, body)
+			}
+		}
+		if strings.Contains(body, "/api/questions/") {
+			t.Errorf("Base path %q: expected the API to be disallowed as a whole:\n%s", basePath, body)
+		}
+
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+			t.Errorf("Expected text/plain, got %q", ct)
+		}
+	}
+}
+
+func TestRouteMuxRobotsRules(t *testing.T) {
+	m := newRouteMux()
+	m.page("/", http.NotFoundHandler())
+	m.page("/about", http.NotFoundHandler())
+	m.hide("/api/questions/", http.NotFoundHandler())
+	m.hide("/api/answer", http.NotFoundHandler())
+	m.hide("/play/", http.NotFoundHandler())
+	m.hide("/play", http.NotFoundHandler())
+	m.hide("/game/", http.NotFoundHandler(), "/game/*/share")
+
+	allow, disallow := m.robotsRules("/base")
+	if expected := []string{"/base/", "/base/about", "/base/game/*/share"}; !reflect.DeepEqual(allow, expected) {
+		t.Errorf("Expected allow %v, got %v", expected, allow)
+	}
+	if expected := []string{"/base/api/", "/base/play", "/base/game/"}; !reflect.DeepEqual(disallow, expected) {
+		t.Errorf("Expected disallow %v, got %v", expected, disallow)
+	}
+	if pages := m.sitemapPages("/base"); !reflect.DeepEqual(pages, []string{"/base/", "/base/about"}) {
+		t.Errorf("Unexpected sitemap pages %v", pages)
+	}
+}
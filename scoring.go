@@ -0,0 +1,309 @@
+package predictiongame
+
+import (
+	"fmt"
+	"math"
+)
+
+// ScoringMode decides when an answer counts as correct.
+type ScoringMode int
+
+const (
+	// ScoringOverlap counts an answer as correct if its range overlaps the correct range.
+	ScoringOverlap ScoringMode = iota
+	// ScoringContain counts an answer as correct if its range contains the whole correct range.
+	ScoringContain
+	// ScoringMidpoint counts an answer as correct if the midpoint of its range lies
+	// within the correct range.
+	ScoringMidpoint
+)
+
+var scoringModeNames = map[ScoringMode]string{
+	ScoringOverlap:  "overlap",
+	ScoringContain:  "contain",
+	ScoringMidpoint: "midpoint",
+}
+
+func (m ScoringMode) String() string {
+	if name, ok := scoringModeNames[m]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("ScoringMode(%d)", int(m))
+}
+
+// MarshalText encodes the mode as its name.
+func (m ScoringMode) MarshalText() ([]byte, error) {
+	if _, ok := scoringModeNames[m]; !ok {
+		return nil, fmt.Errorf("unknown scoring mode %d", int(m))
+	}
+
+	return []byte(m.String()), nil
+}
+
+// UnmarshalText decodes a mode from its name, see ParseScoringMode.
+func (m *ScoringMode) UnmarshalText(text []byte) error {
+	mode, err := ParseScoringMode(string(text))
+	if err != nil {
+		return err
+	}
+
+	*m = mode
+	return nil
+}
+
+// ParseScoringMode returns the ScoringMode with the given name. An empty name
+// selects the default ScoringOverlap.
+func ParseScoringMode(name string) (ScoringMode, error) {
+	if name == "" {
+		return ScoringOverlap, nil
+	}
+
+	for mode, n := range scoringModeNames {
+		if n == name {
+			return mode, nil
+		}
+	}
+
+	return ScoringOverlap, fmt.Errorf("unknown scoring mode %q", name)
+}
+
+// ScoreConfig contains the rules deciding when an answer counts as correct.
+type ScoreConfig struct {
+	Mode ScoringMode `json:"mode"`
+	// MinOverlapFraction is the fraction of the width of the correct range an answer has
+	// to overlap with ScoringOverlap, so a sliver of overlap does not count. Answers
+	// within the correct range are correct regardless. The default 0 counts answers
+	// which just touch the correct range as correct.
+	MinOverlapFraction float64 `json:"minOverlapFraction,omitempty"`
+	// WeightByDifficulty awards Question.Weight points for a correct answer instead of
+	// one, so harder questions are worth more. The default weighs all questions the same.
+	WeightByDifficulty bool `json:"weightByDifficulty,omitempty"`
+	// ExpectedConfidence is the ratio of correct answers the calibrated scores compare
+	// the hit rate to. Zero means the default ExpectedConfidence.
+	ExpectedConfidence float64 `json:"expectedConfidence,omitempty"`
+}
+
+// expected returns the ratio of correct answers which is expected from the players.
+func (cfg ScoreConfig) expected() float64 {
+	if cfg.ExpectedConfidence == 0 {
+		return ExpectedConfidence
+	}
+
+	return cfg.ExpectedConfidence
+}
+
+// Weight returns the points a correct answer to the question is worth when weighting
+// by difficulty. It is the difficulty of the question, or 1 if it has none.
+func (q Question) Weight() float64 {
+	if q.Difficulty <= 0 {
+		return 1
+	}
+
+	return q.Difficulty
+}
+
+// CorrectIn returns true if the range given in the answer is correct using the scoring mode.
+func (a Answer) CorrectIn(mode ScoringMode) bool {
+	return a.CorrectWith(ScoreConfig{Mode: mode})
+}
+
+// CorrectWith returns true if the range given in the answer is correct using the rules of cfg.
+// If the question has an exact answer (see Question.Value), the answer is correct if it
+// contains the value, regardless of the mode. For point questions this means that the
+// value lies within the tolerance of the estimate.
+func (a Answer) CorrectWith(cfg ScoreConfig) bool {
+	q := a.Question
+	qLow := q.BoundLow
+	qHigh := q.BoundHigh
+	aLow := a.LowerBound
+	aHigh := a.UpperBound
+
+	if v, ok := q.Value(); ok {
+		return aLow <= v && aHigh >= v
+	}
+
+	switch cfg.Mode {
+	case ScoringContain:
+		return aLow <= qLow && aHigh >= qHigh
+	case ScoringMidpoint:
+		mid := (aLow + aHigh) / 2
+		return mid >= qLow && mid <= qHigh
+	default:
+		if aLow >= qLow && aHigh <= qHigh {
+			return true
+		}
+		if aHigh < qLow || aLow > qHigh {
+			return false
+		}
+
+		// The overlap is measured on the scale of the question, like the widths.
+		overlap := q.scaled(math.Min(aHigh, qHigh)) - q.scaled(math.Max(aLow, qLow))
+		return overlap >= cfg.MinOverlapFraction*(q.scaled(qHigh)-q.scaled(qLow))
+	}
+}
+
+// ScoreIn returns the points awarded for the answer using the scoring mode.
+func (a Answer) ScoreIn(mode ScoringMode) float64 {
+	return a.ScoreWith(ScoreConfig{Mode: mode})
+}
+
+// ScoreWith returns the points awarded for the answer using the rules of cfg.
+func (a Answer) ScoreWith(cfg ScoreConfig) float64 {
+	if !a.CorrectWith(cfg) {
+		return 0
+	}
+	if cfg.WeightByDifficulty {
+		return a.Question.Weight()
+	}
+
+	return 1
+}
+
+// GameScore is the summary of the score of a game which is stored with it.
+type GameScore struct {
+	// Config contains the rules the game was scored with.
+	Config  ScoreConfig `json:"config"`
+	Correct int         `json:"correct"`
+	// Points is the sum of the points awarded for the answers.
+	Points float64 `json:"points"`
+	// HitRate is the ratio of correct answers.
+	HitRate float64 `json:"hitRate"`
+	// HitRatePercent is HitRate in percent, rounded to an integer, for display.
+	HitRatePercent int `json:"hitRatePercent"`
+	// Weighted is Points relative to the points of a game with only correct answers.
+	// It equals HitRate unless the game was scored with WeightByDifficulty.
+	Weighted float64 `json:"weighted"`
+	// Calibration rates how well the hit rate matches the expected confidence of the
+	// config, see GameEntity.CalibratedScore.
+	Calibration float64 `json:"calibration"`
+}
+
+// RescoreGame computes the score of the game using the rules of cfg. It only depends
+// on the answers, so scoring a game again with the same rules gives the same score.
+func RescoreGame(g GameEntity, cfg ScoreConfig) GameScore {
+	score := GameScore{Config: cfg}
+	maxPoints := 0.0
+	for _, a := range g.Answers {
+		if a.CorrectWith(cfg) {
+			score.Correct++
+		}
+		score.Points += a.ScoreWith(cfg)
+		if cfg.WeightByDifficulty {
+			maxPoints += a.Question.Weight()
+		} else {
+			maxPoints++
+		}
+	}
+	if len(g.Answers) > 0 {
+		score.HitRate = float64(score.Correct) / float64(len(g.Answers))
+		score.HitRatePercent = int(math.Round(score.HitRate * 100))
+		score.Weighted = score.Points / maxPoints
+	}
+	score.Calibration = calibratedScore(score.Correct, len(g.Answers), cfg.expected())
+
+	return score
+}
+
+// ScoringRule decides how a game is scored as a whole.
+type ScoringRule int
+
+const (
+	// HitRateRule rates how well the hit rate of a game matches ExpectedConfidence.
+	// It is the default.
+	HitRateRule ScoringRule = iota
+	// LogRule averages the Answer.LogScore of the answers, which also rewards narrow
+	// ranges close to the true values.
+	LogRule
+)
+
+var scoringRuleNames = map[ScoringRule]string{
+	HitRateRule: "hitrate",
+	LogRule:     "log",
+}
+
+func (r ScoringRule) String() string {
+	if name, ok := scoringRuleNames[r]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("ScoringRule(%d)", int(r))
+}
+
+// logScoreMinSigma is the smallest standard deviation LogScore assumes, relative to
+// the true value, so answers without any tolerance do not score infinitely.
+const logScoreMinSigma = 1e-3
+
+// LogScore returns the logarithmic score of the answer. Its range is read as the central
+// interval with the probability ExpectedConfidence of a normal distribution on the scale
+// of the question, and the score is the log density of that distribution at the true value
+// or the midpoint of the correct range. For linear questions the density is measured
+// relative to the true value, so the scores of questions with different units can be
+// compared. Higher scores are better: the score grows with narrower ranges around the
+// true value and falls with the square of the distance of a miss.
+func (a Answer) LogScore() float64 {
+	return a.logScore(ExpectedConfidence)
+}
+
+// logScore is LogScore reading the range of the answer as the central interval with
+// the probability expected.
+func (a Answer) logScore(expected float64) float64 {
+	q := a.Question
+	qLow, qHigh := q.correctRange()
+	x := (q.scaled(qLow) + q.scaled(qHigh)) / 2
+	lower, upper := q.scaled(a.LowerBound), q.scaled(a.UpperBound)
+
+	unit := 1.0
+	if !q.IsLog() && x != 0 {
+		unit = math.Abs(x)
+	}
+
+	z := math.Sqrt2 * math.Erfinv(expected)
+	sigma := math.Max((upper-lower)/(2*z), logScoreMinSigma*unit)
+	d := (x - (lower+upper)/2) / sigma
+
+	return -d*d/2 - math.Log(math.Sqrt(2*math.Pi)*sigma/unit)
+}
+
+// CalibratedScore rates how well the hit rate of the game matches ExpectedConfidence
+// using the default rules. It is 1 for a perfectly calibrated game and 0 if all or no
+// answers are correct.
+func (g GameEntity) CalibratedScore() float64 {
+	return g.CalibratedScoreWith(ScoreConfig{})
+}
+
+// CalibratedScoreWith is like CalibratedScore, but uses the rules and the expected
+// confidence of cfg.
+func (g GameEntity) CalibratedScoreWith(cfg ScoreConfig) float64 {
+	return g.CalibratedScoreBy(cfg, HitRateRule)
+}
+
+// CalibratedScoreBy scores the game using the rule and the expected confidence of cfg.
+// With HitRateRule the answers are checked using the rules of cfg. With LogRule it is
+// the mean LogScore of the answers, or zero if there are none.
+func (g GameEntity) CalibratedScoreBy(cfg ScoreConfig, rule ScoringRule) float64 {
+	if rule != LogRule {
+		return calibratedScore(int(correctAnswers(cfg, g.Answers)), len(g.Answers), cfg.expected())
+	}
+
+	if len(g.Answers) == 0 {
+		return 0
+	}
+
+	sum := 0.0
+	for _, a := range g.Answers {
+		sum += a.logScore(cfg.expected())
+	}
+	return sum / float64(len(g.Answers))
+}
+
+// calibratedScore rates how well the ratio of correct answers matches expected.
+func calibratedScore(correct, answers int, expected float64) float64 {
+	if answers == 0 {
+		return 0
+	}
+
+	hitRate := float64(correct) / float64(answers)
+	worst := math.Max(expected, 1-expected)
+	return 1 - math.Abs(hitRate-expected)/worst
+}
@@ -0,0 +1,322 @@
+package predictiongame
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCorrectIn(t *testing.T) {
+	question := Question{BoundLow: 10, BoundHigh: 20}
+
+	for _, tc := range []struct {
+		lower, upper               float64
+		overlap, contain, midpoint bool
+	}{
+		{12, 18, true, false, true},
+		{5, 25, true, true, true},
+		{15, 100, true, false, false},
+		{0, 12, true, false, false},
+		{21, 30, false, false, false},
+		{10, 20, true, true, true},
+	} {
+		a := Answer{Question: question, LowerBound: tc.lower, UpperBound: tc.upper}
+		for mode, expected := range map[ScoringMode]bool{
+			ScoringOverlap:  tc.overlap,
+			ScoringContain:  tc.contain,
+			ScoringMidpoint: tc.midpoint,
+		} {
+			if got := a.CorrectIn(mode); got != expected {
+				t.Errorf("[%v, %v] in mode %s: expected %v, got %v", tc.lower, tc.upper, mode, expected, got)
+			}
+		}
+
+		if a.Correct() != tc.overlap {
+			t.Errorf("[%v, %v]: Correct should default to overlap", tc.lower, tc.upper)
+		}
+	}
+}
+
+func TestParseScoringMode(t *testing.T) {
+	for name, expected := range map[string]ScoringMode{
+		"":         ScoringOverlap,
+		"overlap":  ScoringOverlap,
+		"contain":  ScoringContain,
+		"midpoint": ScoringMidpoint,
+	} {
+		if mode, err := ParseScoringMode(name); err != nil || mode != expected {
+			t.Errorf("%q: expected %s, got %s (%v)", name, expected, mode, err)
+		}
+	}
+
+	if _, err := ParseScoringMode("strict"); err == nil {
+		t.Error("Expected an error for an unknown scoring mode.")
+	}
+}
+
+func TestCorrectInPointQuestion(t *testing.T) {
+	question := Question{Kind: PointQuestion, BoundLow: 100, BoundHigh: 100}
+
+	for _, tc := range []struct {
+		estimate, tolerance float64
+		correct             bool
+	}{
+		{100, 0, true},
+		{90, 10, true},
+		{120, 10, false},
+	} {
+		a := Answer{Question: question, LowerBound: tc.estimate - tc.tolerance, UpperBound: tc.estimate + tc.tolerance}
+		for _, mode := range []ScoringMode{ScoringOverlap, ScoringContain, ScoringMidpoint} {
+			if got := a.CorrectIn(mode); got != tc.correct {
+				t.Errorf("%v±%v in mode %s: expected %v, got %v", tc.estimate, tc.tolerance, mode, tc.correct, got)
+			}
+		}
+
+		if estimate, tolerance := a.Estimate(); estimate != tc.estimate || tolerance != tc.tolerance {
+			t.Errorf("Expected estimate %v±%v, got %v±%v", tc.estimate, tc.tolerance, estimate, tolerance)
+		}
+	}
+}
+
+func TestCalibratedScore(t *testing.T) {
+	question := Question{BoundLow: 10, BoundHigh: 20}
+	correct := Answer{Question: question, LowerBound: 10, UpperBound: 20}
+	wrong := Answer{Question: question, LowerBound: 30, UpperBound: 40}
+
+	for _, tc := range []struct {
+		answers  []Answer
+		expected float64
+	}{
+		{nil, 0},
+		{[]Answer{correct, wrong}, 1},
+		{[]Answer{correct, correct}, 0},
+		{[]Answer{wrong, wrong}, 0},
+		{[]Answer{correct, correct, correct, wrong}, 0.5},
+	} {
+		if got := (GameEntity{Answers: tc.answers}).CalibratedScore(); got != tc.expected {
+			t.Errorf("%d answers: expected %v, got %v", len(tc.answers), tc.expected, got)
+		}
+	}
+}
+
+func TestCalibratedScoreExpectedConfidence(t *testing.T) {
+	question := Question{BoundLow: 10, BoundHigh: 20}
+	correct := Answer{Question: question, LowerBound: 10, UpperBound: 20}
+	wrong := Answer{Question: question, LowerBound: 30, UpperBound: 40}
+	game := GameEntity{Status: GameCompleted, Answers: []Answer{correct, correct, correct, wrong}}
+	cfg := ScoreConfig{ExpectedConfidence: 0.75}
+
+	if got := game.CalibratedScoreWith(cfg); got != 1 {
+		t.Errorf("Expected a calibrated game, got %v", got)
+	}
+	if got := RescoreGame(game, cfg).Calibration; got != 1 {
+		t.Errorf("Expected the score to use the expected confidence, got %v", got)
+	}
+	if got := newUserStats("user", []GameEntity{game}, cfg).CalibratedScore(); got != 1 {
+		t.Errorf("Expected the stats to use the expected confidence, got %v", got)
+	}
+	if got := (Tournament{Results: map[string]GameEntity{"user": game}}).Standings(cfg); got[0].Score != 1 {
+		t.Errorf("Expected the standings to use the expected confidence, got %+v", got)
+	}
+	if game.CalibratedScoreBy(cfg, LogRule) == game.CalibratedScoreBy(ScoreConfig{}, LogRule) {
+		t.Errorf("Expected the log score to use the expected confidence")
+	}
+}
+
+func TestCorrectInTrueValue(t *testing.T) {
+	question := Question{BoundLow: 300e6, BoundHigh: 340e6, TrueValue: 331e6, HasTrueValue: true}
+
+	for _, tc := range []struct {
+		lower, upper float64
+		correct      bool
+		miss         float64
+	}{
+		{320e6, 335e6, true, 0},
+		{300e6, 320e6, false, 11e6},
+		{335e6, 400e6, false, 4e6},
+	} {
+		a := Answer{Question: question, LowerBound: tc.lower, UpperBound: tc.upper}
+		for _, mode := range []ScoringMode{ScoringOverlap, ScoringContain, ScoringMidpoint} {
+			if got := a.CorrectIn(mode); got != tc.correct {
+				t.Errorf("[%v, %v] in mode %s: expected %v, got %v", tc.lower, tc.upper, mode, tc.correct, got)
+			}
+		}
+		if miss := a.MissDistance(); miss != tc.miss {
+			t.Errorf("[%v, %v]: expected miss distance %v, got %v", tc.lower, tc.upper, tc.miss, miss)
+		}
+	}
+
+	question.TrueValue = 350e6
+	if err := question.Validate(); err == nil {
+		t.Error("Expected an error for a true value outside of the bounds.")
+	}
+}
+
+func TestCorrectInTrueValueZero(t *testing.T) {
+	question := Question{Text: "What is the net charge of a neutron?", BoundLow: -1, BoundHigh: 1, HasTrueValue: true}
+	if err := question.Validate(); err != nil {
+		t.Fatalf("Expected a true value of zero to be valid, got %s", err)
+	}
+
+	if a := (Answer{Question: question, LowerBound: 0.5, UpperBound: 1}); a.CorrectIn(ScoringOverlap) {
+		t.Error("Expected an answer not containing zero to be wrong.")
+	}
+	if a := (Answer{Question: question, LowerBound: -0.5, UpperBound: 0.5}); !a.CorrectIn(ScoringOverlap) {
+		t.Error("Expected an answer containing zero to be correct.")
+	}
+
+	question.HasTrueValue, question.TrueValue = false, 0.5
+	if err := question.Validate(); err == nil {
+		t.Error("Expected an error for a true value without HasTrueValue.")
+	}
+}
+
+func TestCorrectWithMinOverlapFraction(t *testing.T) {
+	question := Question{BoundLow: 100, BoundHigh: 200}
+	cfg := ScoreConfig{Mode: ScoringOverlap, MinOverlapFraction: 0.1}
+
+	for _, tc := range []struct {
+		lower, upper float64
+		correct      bool
+	}{
+		{0, 100, false},
+		{0, 105, false},
+		{0, 110, true},
+		{195, 300, false},
+		{190, 300, true},
+		{150, 151, true},
+		{0, 300, true},
+		{210, 300, false},
+	} {
+		a := Answer{Question: question, LowerBound: tc.lower, UpperBound: tc.upper}
+		if got := a.CorrectWith(cfg); got != tc.correct {
+			t.Errorf("[%v, %v]: expected %v, got %v", tc.lower, tc.upper, tc.correct, got)
+		}
+		if a.CorrectWith(ScoreConfig{}) != a.CorrectIn(ScoringOverlap) {
+			t.Errorf("[%v, %v]: the default config differs from ScoringOverlap", tc.lower, tc.upper)
+		}
+	}
+
+	if !(Answer{Question: question, LowerBound: 0, UpperBound: 100}).Correct() {
+		t.Errorf("Expected an answer touching the correct range to be correct by default")
+	}
+}
+
+func TestMissDistanceWith(t *testing.T) {
+	question := Question{BoundLow: 100, BoundHigh: 200}
+
+	for _, tc := range []struct {
+		cfg          ScoreConfig
+		lower, upper float64
+		miss         float64
+	}{
+		{ScoreConfig{}, 0, 50, 50},
+		{ScoreConfig{}, 0, 100, 0},
+		{ScoreConfig{MinOverlapFraction: 0.1}, 0, 100, 10},
+		{ScoreConfig{MinOverlapFraction: 0.1}, 0, 105, 5},
+		{ScoreConfig{MinOverlapFraction: 0.1}, 0, 110, 0},
+		{ScoreConfig{MinOverlapFraction: 0.1}, 250, 300, 50},
+		{ScoreConfig{Mode: ScoringContain}, 120, 210, 20},
+		{ScoreConfig{Mode: ScoringContain}, 90, 210, 0},
+		{ScoreConfig{Mode: ScoringMidpoint}, 0, 100, 50},
+		{ScoreConfig{Mode: ScoringMidpoint}, 200, 300, 50},
+		{ScoreConfig{Mode: ScoringMidpoint}, 100, 200, 0},
+	} {
+		a := Answer{Question: question, LowerBound: tc.lower, UpperBound: tc.upper}
+		if miss := a.MissDistanceWith(tc.cfg); miss != tc.miss {
+			t.Errorf("[%v, %v] with %+v: expected miss distance %v, got %v", tc.lower, tc.upper, tc.cfg, tc.miss, miss)
+		}
+		if (a.MissDistanceWith(tc.cfg) == 0) != a.CorrectWith(tc.cfg) {
+			t.Errorf("[%v, %v] with %+v: expected the miss distance to agree with CorrectWith", tc.lower, tc.upper, tc.cfg)
+		}
+	}
+}
+
+func TestLogScore(t *testing.T) {
+	question := Question{BoundLow: 100, BoundHigh: 100}
+	answer := func(lower, upper float64) Answer {
+		return Answer{Question: question, LowerBound: lower, UpperBound: upper}
+	}
+
+	narrow, wide := answer(90, 110).LogScore(), answer(50, 150).LogScore()
+	if narrow <= wide {
+		t.Errorf("Expected a narrow range around the true value to score higher: %v <= %v", narrow, wide)
+	}
+
+	near, far := answer(110, 130).LogScore(), answer(200, 220).LogScore()
+	if near <= far {
+		t.Errorf("Expected a near miss to score higher than a far miss: %v <= %v", near, far)
+	}
+
+	if exact := answer(100, 100).LogScore(); math.IsInf(exact, 0) || exact <= narrow {
+		t.Errorf("Expected a finite maximum score for an exact answer, got %v", exact)
+	}
+
+	// The scores do not depend on the unit of the question.
+	scaled := Answer{Question: Question{BoundLow: 1e5, BoundHigh: 1e5}, LowerBound: 9e4, UpperBound: 1.1e5}
+	if got := scaled.LogScore(); math.Abs(got-narrow) > 1e-9 {
+		t.Errorf("Expected the score %v of the scaled answer, got %v", narrow, got)
+	}
+
+	game := GameEntity{Answers: []Answer{answer(90, 110), answer(50, 150)}}
+	if got := game.CalibratedScoreBy(ScoreConfig{}, LogRule); math.Abs(got-(narrow+wide)/2) > 1e-9 {
+		t.Errorf("Expected the mean log score %v, got %v", (narrow+wide)/2, got)
+	}
+	if game.CalibratedScoreBy(ScoreConfig{}, HitRateRule) != game.CalibratedScore() {
+		t.Errorf("Expected the hit rate rule to be the default")
+	}
+	if got := (GameEntity{}).CalibratedScoreBy(ScoreConfig{}, LogRule); got != 0 {
+		t.Errorf("Expected zero without answers, got %v", got)
+	}
+}
+
+func TestRescoreGameWeightByDifficulty(t *testing.T) {
+	easy := Question{BoundLow: 10, BoundHigh: 20}
+	hard := Question{BoundLow: 10, BoundHigh: 20, Difficulty: 3}
+	g := GameEntity{Answers: []Answer{
+		{Question: easy, LowerBound: 12, UpperBound: 15},
+		{Question: hard, LowerBound: 12, UpperBound: 15},
+		{Question: easy, LowerBound: 30, UpperBound: 40},
+	}}
+
+	for _, tc := range []struct {
+		weighted         bool
+		points, expected float64
+	}{
+		{false, 2, 2.0 / 3},
+		{true, 4, 4.0 / 5},
+	} {
+		score := RescoreGame(g, ScoreConfig{WeightByDifficulty: tc.weighted})
+		if score.Correct != 2 || math.Abs(score.HitRate-2.0/3) > 1e-9 {
+			t.Errorf("weighted=%v: expected 2 correct answers and a hit rate of 2/3, got %+v", tc.weighted, score)
+		}
+		if score.Points != tc.points || math.Abs(score.Weighted-tc.expected) > 1e-9 {
+			t.Errorf("weighted=%v: expected %g points and a weighted score of %g, got %+v", tc.weighted, tc.points, tc.expected, score)
+		}
+	}
+
+	if score := RescoreGame(GameEntity{}, ScoreConfig{WeightByDifficulty: true}); score.Weighted != 0 || score.HitRate != 0 {
+		t.Errorf("Expected a zero score without answers, got %+v", score)
+	}
+}
+
+func TestRescoreGameHitRatePercent(t *testing.T) {
+	q := Question{BoundLow: 10, BoundHigh: 20}
+	hit := Answer{Question: q, LowerBound: 12, UpperBound: 15}
+	miss := Answer{Question: q, LowerBound: 30, UpperBound: 40}
+
+	for _, tc := range []struct {
+		answers  []Answer
+		expected int
+	}{
+		{nil, 0},
+		{[]Answer{miss}, 0},
+		{[]Answer{hit, miss}, 50},
+		{[]Answer{hit, hit, miss}, 67},
+		{[]Answer{hit, miss, miss}, 33},
+		{[]Answer{hit, hit}, 100},
+	} {
+		if percent := RescoreGame(GameEntity{Answers: tc.answers}, ScoreConfig{}).HitRatePercent; percent != tc.expected {
+			t.Errorf("%d answers: expected %d%%, got %d%%", len(tc.answers), tc.expected, percent)
+		}
+	}
+}
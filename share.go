@@ -0,0 +1,176 @@
+package predictiongame
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"net/http"
+)
+
+// The score card has the size recommended for OpenGraph images.
+const (
+	cardWidth  = 1200
+	cardHeight = 630
+	cardMargin = 80
+)
+
+// cardMaxAge is how long the score card of a completed game may be cached, in seconds.
+const cardMaxAge = 24 * 60 * 60
+
+var (
+	cardBackground     = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	cardBrand          = color.RGBA{0x33, 0x7a, 0xb7, 0xff}
+	cardTrack          = color.RGBA{0xe5, 0xe5, 0xe5, 0xff}
+	cardMarker         = color.RGBA{0x33, 0x33, 0x33, 0xff}
+	cardCorrect        = color.RGBA{0x5c, 0xb8, 0x5c, 0xff}
+	cardMissed         = color.RGBA{0xd9, 0x53, 0x4f, 0xff}
+	cardUnderconfident = color.RGBA{0xf0, 0xad, 0x4e, 0xff}
+)
+
+// scoreSummary describes the result of a game in one line, for example "7 of 10 correct (70%)".
+func scoreSummary(cfg ScoreConfig, answers []Answer) string {
+	if len(answers) == 0 {
+		return "No questions answered"
+	}
+
+	return fmt.Sprintf("%.0f of %d correct (%s)", correctAnswers(cfg, answers), len(answers), correctAnswersPercent(cfg, answers))
+}
+
+// loadSharedGame loads the game which is shared. Only completed games can be shared,
+// because the score of the others is not final yet.
+func loadSharedGame(w http.ResponseWriter, r *http.Request, db GameDatabase, id string) (GameEntity, bool) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return GameEntity{}, false
+	}
+
+	if !validID(id) {
+		http.Error(w, "Invalid game ID", http.StatusBadRequest)
+		return GameEntity{}, false
+	}
+
+	game, err := db.Get(r, id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Game can not be loaded: %s", err), gameErrorStatus(err))
+		return GameEntity{}, false
+	}
+
+	if !game.Completed() {
+		http.Error(w, "Game is not completed yet", http.StatusConflict)
+		return GameEntity{}, false
+	}
+
+	return game, true
+}
+
+// serveShare renders a page for sharing the score of a game on social media. Its
+// OpenGraph tags contain the score and link to the score card.
+func serveShare(w http.ResponseWriter, r *http.Request, templ *template.Template, db GameDatabase, id string, opts handlerOptions) {
+	game, ok := loadSharedGame(w, r, db, id)
+	if !ok {
+		return
+	}
+
+	base := requestBaseURL(r, opts.baseURL)
+	if opts.baseURL == "" {
+		base += opts.basePath
+	}
+
+	description := "Test how well calibrated your confidence is."
+	if n := len(game.Answers); n > 0 {
+		description = evaluateConfidence(int(correctAnswers(opts.scoring, game.Answers)), n, opts.scoring.expected())
+	}
+
+	page, locale := localizedTemplate(templ, r, "share.html")
+	render(templ, w, r, page, struct {
+		pageContext
+		ID          string
+		Title       string
+		Description string
+		URL         string
+		ImageURL    string
+	}{
+		pageContext: newPageContext(r, locale),
+		ID:          id,
+		Title:       scoreSummary(opts.scoring, game.Answers),
+		Description: description,
+		URL:         base + "/game/" + id + "/share",
+		ImageURL:    base + "/game/" + id + "/card.png",
+	})
+}
+
+// serveCard generates the score card image of a game.
+func serveCard(w http.ResponseWriter, r *http.Request, db GameDatabase, id string, opts handlerOptions) {
+	game, ok := loadSharedGame(w, r, db, id)
+	if !ok {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, scoreCard(game.Answers, opts.scoring, opts.scoring.expected())); err != nil {
+		http.Error(w, fmt.Sprintf("Error rendering score card: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", cardMaxAge))
+	w.Write(buf.Bytes())
+}
+
+// scoreCard draws the answers of a game as a row of green and red squares above a bar
+// showing the hit rate. A marker on the bar shows the expected hit rate, and the
+// color of the bar whether the player was well calibrated, overconfident or
+// underconfident.
+func scoreCard(answers []Answer, cfg ScoreConfig, expected float64) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, cardWidth, cardHeight))
+	fillRect(img, img.Bounds(), cardBackground)
+	fillRect(img, image.Rect(0, 0, cardWidth, 40), cardBrand)
+
+	inner := cardWidth - 2*cardMargin
+	if n := len(answers); n > 0 {
+		size := inner / n
+		if size > 80 {
+			size = 80
+		}
+		gap := size / 5
+		for i, a := range answers {
+			c := cardMissed
+			if a.CorrectWith(cfg) {
+				c = cardCorrect
+			}
+			x := cardMargin + i*size
+			fillRect(img, image.Rect(x, 160, x+size-gap, 160+size-gap), c)
+		}
+	}
+
+	barTop, barBottom := 380, 460
+	fillRect(img, image.Rect(cardMargin, barTop, cardMargin+inner, barBottom), cardTrack)
+
+	if n := len(answers); n > 0 {
+		correct := int(correctAnswers(cfg, answers))
+		pLeft, pRight := binomialTest(correct, n, expected)
+
+		c := cardCorrect
+		if pLeft <= significanceLevel {
+			c = cardMissed
+		} else if pRight <= significanceLevel {
+			c = cardUnderconfident
+		}
+		width := inner * correct / n
+		fillRect(img, image.Rect(cardMargin, barTop, cardMargin+width, barBottom), c)
+	}
+
+	x := cardMargin + int(float64(inner)*expected)
+	fillRect(img, image.Rect(x-3, barTop-30, x+3, barBottom+30), cardMarker)
+
+	return img
+}
+
+func fillRect(img draw.Image, r image.Rectangle, c color.Color) {
+	draw.Draw(img, r, &image.Uniform{C: c}, image.Point{}, draw.Src)
+}
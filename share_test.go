@@ -0,0 +1,72 @@
+package predictiongame
+
+import (
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGameShare(t *testing.T) {
+	games := NewMemoryGameDatabase()
+	list := demoQuestionList()
+	answers := []Answer{
+		{Question: list[0], LowerBound: list[0].BoundLow, UpperBound: list[0].BoundHigh},
+		{Question: list[1], LowerBound: list[1].BoundHigh + 1, UpperBound: list[1].BoundHigh + 2},
+	}
+	if err := games.Save(nil, GameEntity{ID: "game", UserID: "user", Answers: answers}); err != nil {
+		t.Fatalf("Can not save game: %s", err)
+	}
+	if err := games.Start(nil, "started", 10); err != nil {
+		t.Fatalf("Can not start game: %s", err)
+	}
+
+	handler := NewHandler(nil, SeedDemoQuestions(), games, WithBaseURL("https://example.com/predict"), WithBasePath("/predict"))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/predict/game/game/share", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	body := w.Body.String()
+	for _, expected := range []string{
+		`<meta property="og:title" content="1 of 2 correct (50%)">`,
+		`<meta property="og:image" content="https://example.com/predict/game/game/card.png">`,
+		`<meta property="og:url" content="https://example.com/predict/game/game/share">`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected share page to contain %s:\n%s", expected, body)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/predict/game/game/card.png", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "image/png" {
+		t.Errorf("Expected content type image/png, got %q", ct)
+	}
+	img, err := png.Decode(w.Body)
+	if err != nil {
+		t.Fatalf("Can not decode score card: %s", err)
+	}
+	if b := img.Bounds(); b.Dx() != cardWidth || b.Dy() != cardHeight {
+		t.Errorf("Expected a %dx%d score card, got %v", cardWidth, cardHeight, b)
+	}
+
+	for _, tc := range []struct {
+		path   string
+		status int
+	}{
+		{"/predict/game/started/share", http.StatusConflict},
+		{"/predict/game/missing/card.png", http.StatusNotFound},
+	} {
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if w.Code != tc.status {
+			t.Errorf("%s: expected status %d, got %d", tc.path, tc.status, w.Code)
+		}
+	}
+}
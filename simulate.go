@@ -0,0 +1,111 @@
+package predictiongame
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/pborman/uuid"
+)
+
+// The strategies with which /api/game/simulate answers the questions.
+const (
+	// RandomStrategy answers with random ranges around the bounds of the questions.
+	RandomStrategy = "random"
+	// AlwaysCorrectStrategy answers with the correct ranges.
+	AlwaysCorrectStrategy = "always-correct"
+	// AlwaysWrongStrategy answers with ranges above the correct ranges.
+	AlwaysWrongStrategy = "always-wrong"
+)
+
+// SimulateRequest is the body of POST /api/game/simulate.
+type SimulateRequest struct {
+	UserID string `json:"uid"`
+	// Strategy is RandomStrategy, AlwaysCorrectStrategy or AlwaysWrongStrategy. It
+	// defaults to RandomStrategy.
+	Strategy string `json:"strategy"`
+}
+
+// simulationStrategies contains the known strategies.
+var simulationStrategies = map[string]bool{
+	RandomStrategy:        true,
+	AlwaysCorrectStrategy: true,
+	AlwaysWrongStrategy:   true,
+}
+
+// simulatedAnswer answers q with the strategy, which must be one of simulationStrategies.
+func simulatedAnswer(q Question, strategy string, rnd *rand.Rand) Answer {
+	low, high := q.correctRange()
+	width := math.Max(high-low, 1)
+
+	a := Answer{Question: q}
+	switch strategy {
+	case AlwaysCorrectStrategy:
+		a.LowerBound, a.UpperBound = low, high
+	case AlwaysWrongStrategy:
+		a.LowerBound, a.UpperBound = high+width, high+2*width
+	default:
+		// Both bounds lie within twice the width of the correct range around it.
+		x := low - 2*width + rnd.Float64()*5*width
+		y := low - 2*width + rnd.Float64()*5*width
+		a.LowerBound, a.UpperBound = math.Min(x, y), math.Max(x, y)
+	}
+
+	return a
+}
+
+// simulateHandler plays a game with one of the strategies and returns it with its
+// score, for testing clients and bots. Nothing is stored. The questions of the answers
+// are sent without their correct answers, but the answers themselves may reveal them,
+// so the handler is only served to admins.
+func simulateHandler(questions QuestionDatabase, opts handlerOptions) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		defer r.Body.Close()
+
+		var req SimulateRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, opts.maxBodyBytes)).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Error parsing request: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		if req.UserID != "" && !validID(req.UserID) {
+			http.Error(w, fmt.Sprintf("Invalid user ID %q", req.UserID), http.StatusBadRequest)
+			return
+		}
+		if req.Strategy == "" {
+			req.Strategy = RandomStrategy
+		}
+		if !simulationStrategies[req.Strategy] {
+			http.Error(w, fmt.Sprintf("Unknown strategy %q", req.Strategy), http.StatusBadRequest)
+			return
+		}
+
+		rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+		selected := questions.SelectRandom(opts.numQuestions)
+
+		played := GameEntity{UserID: req.UserID, Answers: make([]Answer, 0, len(selected))}
+		for _, q := range selected {
+			played.Answers = append(played.Answers, simulatedAnswer(q, req.Strategy, rnd))
+		}
+		played.Score = RescoreGame(played, opts.scoring)
+
+		game := newGame(uuid.NewRandom().String())
+		if err := game.complete(played, time.Now()); err != nil {
+			http.Error(w, fmt.Sprintf("Game can not be completed: %s", err), gameErrorStatus(err))
+			return
+		}
+		for i, q := range publicQuestions(selected) {
+			game.Answers[i].Question = q
+		}
+
+		writeJSON(w, r, game)
+	})
+}
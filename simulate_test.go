@@ -0,0 +1,87 @@
+package predictiongame
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSimulateHandler(t *testing.T) {
+	handler := simulateHandler(SeedDemoQuestions(), defaultHandlerOptions())
+
+	for _, tc := range []struct {
+		strategy string
+		correct  func(int) bool
+	}{
+		{AlwaysCorrectStrategy, func(n int) bool { return n == NumQuestions }},
+		{AlwaysWrongStrategy, func(n int) bool { return n == 0 }},
+		{RandomStrategy, func(n int) bool { return n >= 0 && n <= NumQuestions }},
+		{"", func(n int) bool { return n >= 0 && n <= NumQuestions }},
+	} {
+		w := httptest.NewRecorder()
+		body := `{"uid": "bot", "strategy": "` + tc.strategy + `"}`
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/game/simulate", strings.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%q: expected status 200, got %d: %s", tc.strategy, w.Code, w.Body)
+		}
+
+		var game GameEntity
+		if err := json.NewDecoder(w.Body).Decode(&game); err != nil {
+			t.Fatalf("%q: can not decode game: %s", tc.strategy, err)
+		}
+		if game.UserID != "bot" || !game.Completed() || len(game.Answers) != NumQuestions {
+			t.Errorf("%q: unexpected game %+v", tc.strategy, game)
+		}
+		if !tc.correct(game.Score.Correct) {
+			t.Errorf("%q: unexpected number of correct answers %d", tc.strategy, game.Score.Correct)
+		}
+		for _, a := range game.Answers {
+			if a.LowerBound > a.UpperBound {
+				t.Errorf("%q: inverted answer %+v", tc.strategy, a)
+			}
+			if a.Question.BoundLow != 0 || a.Question.BoundHigh != 0 || a.Question.Explanation != "" {
+				t.Errorf("%q: expected the question without its answer, got %+v", tc.strategy, a.Question)
+			}
+		}
+	}
+
+	for _, tc := range []struct {
+		method, body string
+		status       int
+	}{
+		{http.MethodGet, "", http.StatusMethodNotAllowed},
+		{http.MethodPost, `{"strategy": "cheat"}`, http.StatusBadRequest},
+		{http.MethodPost, `{"uid": "../admin"}`, http.StatusBadRequest},
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(tc.method, "/api/game/simulate", strings.NewReader(tc.body)))
+		if w.Code != tc.status {
+			t.Errorf("%s %s: expected status %d, got %d", tc.method, tc.body, tc.status, w.Code)
+		}
+	}
+}
+
+func TestSimulateHandlerAdminOnly(t *testing.T) {
+	body := `{"strategy": "always-correct"}`
+
+	w := httptest.NewRecorder()
+	NewHandler(nil, SeedDemoQuestions(), NewMockGameDatabase()).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/game/simulate", strings.NewReader(body)))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d without an admin token, got %d", http.StatusNotFound, w.Code)
+	}
+
+	handler := NewHandler(nil, SeedDemoQuestions(), NewMockGameDatabase(), WithAdminToken(testAdminToken))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/game/simulate", strings.NewReader(body)))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a player, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, adminRequest(http.MethodPost, "/api/game/simulate", body))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d for an admin, got %d", http.StatusOK, w.Code)
+	}
+}
@@ -0,0 +1,91 @@
+package predictiongame
+
+import (
+	"encoding/xml"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// buildTime is the time the binary was built. It is used as the modification time
+// of the pages in the sitemap.
+var buildTime = readBuildTime()
+
+// readBuildTime returns the commit time recorded by the Go toolchain, or the
+// modification time of the executable if it is not available.
+func readBuildTime() time.Time {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key != "vcs.time" {
+				continue
+			}
+
+			if t, err := time.Parse(time.RFC3339, s.Value); err == nil {
+				return t
+			}
+		}
+	}
+
+	if path, err := os.Executable(); err == nil {
+		if fi, err := os.Stat(path); err == nil {
+			return fi.ModTime()
+		}
+	}
+
+	return time.Now()
+}
+
+type sitemapURL struct {
+	Loc        string `xml:"loc"`
+	LastMod    string `xml:"lastmod"`
+	ChangeFreq string `xml:"changefreq"`
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+// requestBaseURL returns baseURL without a trailing slash, or the scheme and host of the
+// request if it is empty.
+func requestBaseURL(r *http.Request, baseURL string) string {
+	if base := strings.TrimSuffix(baseURL, "/"); base != "" {
+		return base
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// SitemapHandler serves a sitemap.xml listing the pages, which are paths below baseURL.
+// If baseURL is empty, the scheme and host of the request are used.
+func SitemapHandler(baseURL string, pages []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		base := requestBaseURL(r, baseURL)
+
+		set := sitemapURLSet{}
+		for _, p := range pages {
+			set.URLs = append(set.URLs, sitemapURL{
+				Loc:        base + p,
+				LastMod:    buildTime.UTC().Format("2006-01-02"),
+				ChangeFreq: "monthly",
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		if _, err := w.Write([]byte(xml.Header)); err != nil {
+			return
+		}
+
+		enc := xml.NewEncoder(w)
+		enc.Indent("", "  ")
+		if err := enc.Encode(set); err != nil {
+			requestLogger(r).Error("Error writing sitemap", "error", err)
+		}
+	})
+}
@@ -0,0 +1,56 @@
+package predictiongame
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSitemapHandler(t *testing.T) {
+	pages := []string{"/", "/about"}
+	for base, expected := range map[string]string{
+		"https://getrational.example/": "https://getrational.example/about",
+		"":                             "http://example.com/about",
+	} {
+		w := httptest.NewRecorder()
+		SitemapHandler(base, pages).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/sitemap.xml", nil))
+
+		var set sitemapURLSet
+		if err := xml.Unmarshal(w.Body.Bytes(), &set); err != nil {
+			t.Fatalf("Invalid sitemap: %s", err)
+		}
+
+		if len(set.URLs) != len(pages) {
+			t.Fatalf("Expected %d URLs, got %d", len(pages), len(set.URLs))
+		}
+		if u := set.URLs[1]; u.Loc != expected || u.ChangeFreq != "monthly" || u.LastMod != buildTime.UTC().Format("2006-01-02") {
+			t.Errorf("Unexpected URL %+v", u)
+		}
+	}
+}
+
+func TestSitemapBasePath(t *testing.T) {
+	handler := NewHandler(nil, SeedDemoQuestions(), NewMockGameDatabase(), WithBaseURL("https://getrational.example"), WithBasePath("/predict"))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/predict/sitemap.xml", nil))
+
+	var set sitemapURLSet
+	if err := xml.Unmarshal(w.Body.Bytes(), &set); err != nil {
+		t.Fatalf("Invalid sitemap: %s", err)
+	}
+
+	locs := make(map[string]bool)
+	for _, u := range set.URLs {
+		locs[u.Loc] = true
+	}
+	for _, expected := range []string{"https://getrational.example/predict/", "https://getrational.example/predict/about", "https://getrational.example/predict/help/overview"} {
+		if !locs[expected] {
+			t.Errorf("Expected %s in the sitemap, got %+v", expected, set.URLs)
+		}
+	}
+	if len(set.URLs) != 4 {
+		t.Errorf("Expected the 4 public pages, got %+v", set.URLs)
+	}
+}
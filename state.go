@@ -0,0 +1,171 @@
+package predictiongame
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidTransition is returned when a game can not change from its status to another.
+var ErrInvalidTransition = errors.New("invalid game status transition")
+
+// StateMachine defines the transitions allowed between the statuses of a game.
+type StateMachine struct {
+	// transitions contains the statuses a game may change to by its current status.
+	transitions map[GameStatus][]GameStatus
+	// always contains the statuses a game may change to from any status.
+	always []GameStatus
+}
+
+// gameStateMachine is the StateMachine of the games: a pending game is started, a
+// started game is saved again or completed, and any game may be abandoned.
+var gameStateMachine = StateMachine{
+	transitions: map[GameStatus][]GameStatus{
+		GamePending:    {GameInProgress},
+		GameInProgress: {GameInProgress, GameCompleted},
+	},
+	always: []GameStatus{GameAbandoned},
+}
+
+// Allowed returns true if a game may change from the status from to the status to.
+func (m StateMachine) Allowed(from, to GameStatus) bool {
+	for _, s := range m.always {
+		if s == to {
+			return true
+		}
+	}
+	for _, s := range m.transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition returns an error wrapping ErrInvalidTransition if a game may not change
+// from the status from to the status to.
+func (m StateMachine) Transition(from, to GameStatus) error {
+	if !m.Allowed(from, to) {
+		return fmt.Errorf("%w from %q to %q", ErrInvalidTransition, from, to)
+	}
+	return nil
+}
+
+// Transition changes the status of the game to the status to if gameStateMachine allows
+// it. Games without a status, which were saved before the status was introduced, are
+// completed.
+func (g *GameEntity) Transition(to GameStatus) error {
+	from := g.Status
+	if from == "" {
+		from = GameCompleted
+	}
+
+	if err := gameStateMachine.Transition(from, to); err != nil {
+		return err
+	}
+	g.Status = to
+	return nil
+}
+
+// newGame returns a game with the ID which has not been started yet. The databases store
+// it when a game is saved which does not exist.
+func newGame(id string) GameEntity {
+	return GameEntity{ID: id, Status: GamePending}
+}
+
+// Playable returns true if the game has not been completed or abandoned yet.
+func (g GameEntity) Playable() bool {
+	return g.Status == GamePending || g.Status == GameInProgress
+}
+
+// start prepares the stored game for being played with numQuestions questions at now.
+// The status is not changed, so a game which is played already can be loaded again.
+func (g *GameEntity) start(numQuestions int, now time.Time) error {
+	if g.Completed() {
+		return ErrGameCompleted
+	}
+	if !g.Playable() {
+		return fmt.Errorf("%w: game is %s", ErrInvalidTransition, g.Status)
+	}
+
+	g.Time = now
+	g.QuestionCount = numQuestions
+	return nil
+}
+
+// saveProgress stores the answers given so far by the user uid in the stored game at now.
+// The first known user is kept.
+func (g *GameEntity) saveProgress(uid string, answers []Answer, now time.Time) error {
+	if g.Completed() {
+		return ErrGameCompleted
+	}
+	if err := g.Transition(GameInProgress); err != nil {
+		return err
+	}
+
+	if g.UserID == "" {
+		g.UserID = uid
+	}
+	g.Time = now
+	g.Answers = answers
+	return nil
+}
+
+// serve stores the IDs of the questions served for the game at now, in the order they
+// are presented.
+func (g *GameEntity) serve(questionIDs []string, now time.Time) error {
+	if g.Completed() {
+		return ErrGameCompleted
+	}
+	if !g.Playable() {
+		return fmt.Errorf("%w: game is %s", ErrInvalidTransition, g.Status)
+	}
+
+	g.Time = now
+	g.QuestionIDs = questionIDs
+	return nil
+}
+
+// complete stores the submitted game done in the stored game at now. A pending game has
+// been played by the client without saving its progress, so it is started first. The
+// questions served for the game are kept; only games which have not been served, like
+// simulated ones, take the question IDs of done. It returns ErrDuplicateSubmit if done
+// repeats the submit which completed the game.
+func (g *GameEntity) complete(done GameEntity, now time.Time) error {
+	if g.Completed() && done.IdempotencyKey != "" && g.IdempotencyKey == done.IdempotencyKey && g.UserID == done.UserID {
+		return ErrDuplicateSubmit
+	}
+	if g.Status == GamePending {
+		if err := g.Transition(GameInProgress); err != nil {
+			return err
+		}
+	}
+	if err := g.Transition(GameCompleted); err != nil {
+		return err
+	}
+
+	g.UserID = done.UserID
+	g.Time = now
+	g.QuestionCount = len(done.Answers)
+	if len(g.QuestionIDs) == 0 {
+		g.QuestionIDs = done.QuestionIDs
+	}
+	g.Answers = done.Answers
+	g.Score = done.Score
+	g.IdempotencyKey = done.IdempotencyKey
+	return nil
+}
+
+// abandon marks the stored game as abandoned at now. Completed games are kept, so their
+// results can not be hidden by abandoning them.
+func (g *GameEntity) abandon(now time.Time) error {
+	if g.Completed() {
+		return ErrGameCompleted
+	}
+	if err := g.Transition(GameAbandoned); err != nil {
+		return err
+	}
+
+	g.Time = now
+	return nil
+}
@@ -0,0 +1,140 @@
+package predictiongame
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestGameTransition(t *testing.T) {
+	for _, tc := range []struct {
+		from, to GameStatus
+		allowed  bool
+	}{
+		{GamePending, GameInProgress, true},
+		{GameInProgress, GameCompleted, true},
+		{GameInProgress, GameInProgress, true},
+		{GamePending, GameAbandoned, true},
+		{GameInProgress, GameAbandoned, true},
+		{GameCompleted, GameAbandoned, true},
+		{GamePending, GameCompleted, false},
+		{GameCompleted, GameInProgress, false},
+		{GameCompleted, GameCompleted, false},
+		{GameAbandoned, GameInProgress, false},
+		{"", GameCompleted, false},
+	} {
+		g := GameEntity{Status: tc.from}
+		err := g.Transition(tc.to)
+		if tc.allowed {
+			if err != nil || g.Status != tc.to {
+				t.Errorf("%q to %q: expected the status %q, got %q (%v)", tc.from, tc.to, tc.to, g.Status, err)
+			}
+			continue
+		}
+
+		if !errors.Is(err, ErrInvalidTransition) || g.Status != tc.from {
+			t.Errorf("%q to %q: expected ErrInvalidTransition and an unchanged status, got %q (%v)", tc.from, tc.to, g.Status, err)
+		}
+	}
+}
+
+func TestGameLifecycle(t *testing.T) {
+	db := NewMemoryGameDatabase()
+	answers := []Answer{{Question: demoQuestionList()[0], LowerBound: 8000, UpperBound: 9000}}
+
+	status := func(id string) GameStatus {
+		game, err := db.Get(nil, id)
+		if err != nil {
+			t.Fatalf("Can not load game %s: %s", id, err)
+		}
+		return game.Status
+	}
+
+	if err := db.Start(nil, "played", 10); err != nil || status("played") != GamePending {
+		t.Errorf("Expected a pending game, got %q (%v)", status("played"), err)
+	}
+	if err := db.SaveProgress(nil, "played", "", answers); err != nil || status("played") != GameInProgress {
+		t.Errorf("Expected a game in progress, got %q (%v)", status("played"), err)
+	}
+	if err := db.Save(nil, GameEntity{ID: "played", UserID: "user", Answers: answers}); err != nil || status("played") != GameCompleted {
+		t.Errorf("Expected a completed game, got %q (%v)", status("played"), err)
+	}
+	if err := db.Save(nil, GameEntity{ID: "played", UserID: "user", Answers: answers}); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Expected ErrInvalidTransition completing a game again, got %v", err)
+	}
+	if err := db.Abandon(nil, "played"); err != ErrGameCompleted || status("played") != GameCompleted {
+		t.Errorf("Expected ErrGameCompleted abandoning a completed game, got %v", err)
+	}
+
+	// Games the client played without saving progress are started when they are completed.
+	if err := db.Start(nil, "unsaved", 10); err != nil {
+		t.Fatalf("Can not start game: %s", err)
+	}
+	if err := db.Save(nil, GameEntity{ID: "unsaved", UserID: "user", Answers: answers}); err != nil || status("unsaved") != GameCompleted {
+		t.Errorf("Expected a completed game, got %q (%v)", status("unsaved"), err)
+	}
+
+	if err := db.SaveProgress(nil, "abandoned", "", answers); err != nil {
+		t.Fatalf("Can not save progress: %s", err)
+	}
+	if err := db.Abandon(nil, "abandoned"); err != nil || status("abandoned") != GameAbandoned {
+		t.Errorf("Expected an abandoned game, got %q (%v)", status("abandoned"), err)
+	}
+	for name, err := range map[string]error{
+		"Start":        db.Start(nil, "abandoned", 10),
+		"SaveProgress": db.SaveProgress(nil, "abandoned", "", answers),
+		"Save":         db.Save(nil, GameEntity{ID: "abandoned", UserID: "user", Answers: answers}),
+	} {
+		if !errors.Is(err, ErrInvalidTransition) {
+			t.Errorf("%s: expected ErrInvalidTransition for an abandoned game, got %v", name, err)
+		}
+	}
+	if games, err := db.List(nil, "user"); err != nil || len(games) != 2 {
+		t.Errorf("Expected only the completed games, got %+v (%v)", games, err)
+	}
+
+	if err := db.Abandon(nil, "missing"); err != ErrGameNotFound {
+		t.Errorf("Expected ErrGameNotFound, got %v", err)
+	}
+}
+
+func TestCompletedLegacyGame(t *testing.T) {
+	for status, completed := range map[GameStatus]bool{
+		"":             true,
+		GameCompleted:  true,
+		GamePending:    false,
+		GameInProgress: false,
+		GameAbandoned:  false,
+	} {
+		if got := (GameEntity{Status: status}).Completed(); got != completed {
+			t.Errorf("%q: expected completed %v, got %v", status, completed, got)
+		}
+	}
+}
+
+func TestSubmitHandlerRejectsInvalidTransition(t *testing.T) {
+	db := NewMemoryGameDatabase()
+	if err := db.Save(nil, GameEntity{ID: "game", UserID: "user", Answers: []Answer{}}); err != nil {
+		t.Fatalf("Can not save game: %s", err)
+	}
+	handler := submitHandler(SeedDemoQuestions(), db, NewTournamentDatabase(), NewMultiplayerHub(), newHandlerOptions(WithSessionSecret(testSessionSecret)))
+
+	// The status sent by the client is ignored, the one of the stored game decides.
+	body := `{"id": "game", "uid": "user", "status": "pending", "answers": []}`
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/game", strings.NewReader("data="+url.QueryEscape(body)))
+	addIdentity(r, "user")
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status %d submitting a completed game again, got %d", http.StatusConflict, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	apiGameHandler(SeedDemoQuestions(), db, defaultHandlerOptions()).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/game/game/abandon", nil))
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status %d abandoning a completed game, got %d", http.StatusConflict, w.Code)
+	}
+}
@@ -1,6 +1,37 @@
 "use strict";
 
-function initGame(gameID, questions) {
+// basePath is the path prefix the pages are served under, which header.html sets in a
+// meta element.
+var basePath = $('meta[name="base-path"]').attr("content") || "";
+
+// The pages contain no inline scripts, which the Content-Security-Policy forbids.
+// Instead they set data attributes on their elements, which are read here.
+$(document).ready(function() {
+    var game = $("#game[data-game-id]");
+    if (game.length) {
+        initGame(game.attr("data-game-id"), JSON.parse(game.attr("data-questions")),
+            JSON.parse(game.attr("data-progress")), game.attr("data-tournament"));
+    }
+
+    var tour = $("[data-tour-exit]");
+    if (tour.length) {
+        startTour(tour);
+    }
+
+    $("#lastGame").click(function() {
+        var user = firebase.auth().currentUser;
+
+        if (user) {
+            window.location.href = basePath + "/lastGame/" + user.uid;
+        }
+    });
+
+    $('[data-toggle="popover"]').popover({
+        placement: "top"
+    });
+});
+
+function initGame(gameID, questions, progress, tournament) {
     var questionField = $("#question"),
         gameProgress = $("#gameProgress"),
         unitField = $("#unit"),
@@ -8,14 +39,24 @@ function initGame(gameID, questions) {
         fieldGroup = $("#boundGroup"),
         minField = $("#lowerBound"),
         maxField = $("#upperBound"),
-        idx = 0,
-        answers = [];
+        separator = $("#boundSeparator"),
+        answers = progress || [],
+        idx = Math.min(answers.length, questions.length - 1);
 
     function updateView(idx) {
         questionField.html(questions[idx].text);
         gameProgress.html(idx + " / " + questions.length);
         gameProgress.css("width", (idx / questions.length * 100) + "%" );
         unitField.html(questions[idx].unit);
+        if (isPoint(questions[idx])) {
+            minField.attr("placeholder", "estimate");
+            separator.html("±");
+            maxField.attr("placeholder", "tolerance");
+        } else {
+            minField.attr("placeholder", "min");
+            separator.html("–");
+            maxField.attr("placeholder", "max");
+        }
         minField.val("");
         maxField.val("");
         minField.focus();
@@ -30,7 +71,8 @@ function initGame(gameID, questions) {
     }
 
     function nextButtonClick() {
-        var valid = checkInput(minField, maxField);
+        var point = isPoint(questions[idx]),
+            valid = point ? checkEstimate(minField, maxField) : checkInput(minField, maxField);
 
         if (!valid) {
             fieldGroup.addClass("has-error");
@@ -39,13 +81,23 @@ function initGame(gameID, questions) {
 
         fieldGroup.removeClass("has-error");
 
+        var lower = parseFloat(minField.val()),
+            upper = parseFloat(maxField.val());
+        if (point) {
+            // Point questions are answered as estimate ± tolerance.
+            var estimate = lower, tolerance = upper;
+            lower = estimate - tolerance;
+            upper = estimate + tolerance;
+        }
+
         answers[idx] = {
             "question": questions[idx],
-            "lower": parseFloat(minField.val()),
-            "upper": parseFloat(maxField.val()),
+            "lower": lower,
+            "upper": upper,
         }
 
         if (idx < questions.length - 1) {
+            autosave(gameID, answers);
             idx++;
 
             updateView(idx);
@@ -59,12 +111,32 @@ function initGame(gameID, questions) {
 
             var user = firebase.auth().currentUser;
 
-            $("#formData").val(JSON.stringify({
-                "id": gameID,
-                "answers": answers,
-                "uid": user.uid
-            }));
-            $("#gameForm").submit();
+            // The ID token proves to the server that the game is submitted by the user.
+            user.getToken().then(function(token) {
+                return $.ajax({
+                    type: "POST",
+                    url: basePath + "/game",
+                    contentType: "application/json",
+                    dataType: "json",
+                    // A game is only submitted once, so its ID marks the repeated
+                    // submits after a lost response as the same one.
+                    headers: {
+                        "Authorization": "Bearer " + token,
+                        "Idempotency-Key": gameID
+                    },
+                    data: JSON.stringify({
+                        "id": gameID,
+                        "answers": answers,
+                        "uid": user.uid,
+                        "tournament": tournament
+                    })
+                });
+            }).then(function(result) {
+                window.location.href = result.url;
+            }, function(xhr) {
+                console.error("saving the game failed: " + (xhr.status || xhr));
+                nextButton.removeAttr("disabled");
+            });
         }
     }
 
@@ -73,6 +145,41 @@ function initGame(gameID, questions) {
     nextButton.click(nextButtonClick);
 }
 
+// startTour starts the intro.js tour of a help page. The tour element names the pages
+// to go to when the tour is completed or left in data-tour-complete and data-tour-exit.
+// Its hidden elements with the class tour-step are steps which are not attached to an
+// element of the page.
+function startTour(tour) {
+    var options = {skipLabel: "Exit"},
+        steps = tour.find(".tour-step").map(function() {
+            return {intro: $(this).html()};
+        }).get();
+    if (steps.length) {
+        options.steps = steps;
+    }
+
+    introJs().oncomplete(function() {
+        window.location.replace(tour.attr("data-tour-complete"));
+    }).onexit(function() {
+        window.location.replace(tour.attr("data-tour-exit"));
+    }).setOptions(options).start();
+}
+
+function autosave(gameID, answers) {
+    $.ajax({
+        type: "POST",
+        url: basePath + "/game/" + encodeURIComponent(gameID) + "/autosave",
+        contentType: "application/json",
+        data: JSON.stringify(answers)
+    }).fail(function(xhr) {
+        console.error("autosave failed: " + xhr.status);
+    });
+}
+
+function isPoint(question) {
+    return question.kind === "point";
+}
+
 function isNumber(n) {
   return !isNaN(n) && isFinite(n);
 }
@@ -143,3 +250,10 @@ $.getScript( "https://www.gstatic.com/firebasejs/3.4.0/firebase.js", function()
         }
     });
 });
+
+function checkEstimate(estimateField, toleranceField) {
+    var estimate = parseFloat(estimateField.val()),
+        tolerance = parseFloat(toleranceField.val());
+
+    return isNumber(estimate) && isNumber(tolerance) && tolerance >= 0;
+}
@@ -0,0 +1,240 @@
+package predictiongame
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// UserStats summarizes the completed games of a user.
+type UserStats struct {
+	UserID     string    `json:"uid,omitempty"`
+	Games      int       `json:"games"`
+	Answers    int       `json:"answers"`
+	Correct    int       `json:"correct"`
+	LastPlayed time.Time `json:"lastPlayed"`
+	// AverageBias is the mean RelativeError of the answers. It is positive if the
+	// user tends to overestimate.
+	AverageBias float64 `json:"averageBias"`
+	// AverageWidth and MedianWidth describe the widths of the answered intervals, see
+	// Answer.Width. Together with the hit rate they show whether a user is
+	// calibrated or just gives very wide intervals.
+	AverageWidth float64 `json:"averageWidth"`
+	MedianWidth  float64 `json:"medianWidth"`
+	// ExpectedConfidence is the ratio of correct answers CalibratedScore and Evaluation
+	// compare the hit rate to. Zero means the default ExpectedConfidence.
+	ExpectedConfidence float64 `json:"expectedConfidence,omitempty"`
+}
+
+// HitRate returns the ratio of correct answers to all answers.
+func (s UserStats) HitRate() float64 {
+	if s.Answers == 0 {
+		return 0
+	}
+
+	return float64(s.Correct) / float64(s.Answers)
+}
+
+// CalibratedScore rates how well the hit rate matches the expected confidence, see
+// GameEntity.CalibratedScore.
+func (s UserStats) CalibratedScore() float64 {
+	return calibratedScore(s.Correct, s.Answers, s.expected())
+}
+
+// expected returns the ratio of correct answers which is expected from the user.
+func (s UserStats) expected() float64 {
+	return ScoreConfig{ExpectedConfidence: s.ExpectedConfidence}.expected()
+}
+
+// Evaluation describes how well calibrated the user is.
+func (s UserStats) Evaluation() string {
+	if s.Answers == 0 {
+		return ""
+	}
+
+	return evaluateConfidence(s.Correct, s.Answers, s.expected())
+}
+
+// newUserStats aggregates the completed games of a user, checking the answers using the
+// rules of cfg.
+func newUserStats(uid string, games []GameEntity, cfg ScoreConfig) UserStats {
+	stats := UserStats{UserID: uid, ExpectedConfidence: cfg.ExpectedConfidence}
+	bias := 0.0
+	var widths []float64
+	for _, g := range games {
+		if !g.Completed() {
+			continue
+		}
+
+		stats.Games++
+		stats.Answers += len(g.Answers)
+		stats.Correct += int(correctAnswers(cfg, g.Answers))
+		for _, a := range g.Answers {
+			bias += a.RelativeError()
+			widths = append(widths, a.Width())
+		}
+		if g.Time.After(stats.LastPlayed) {
+			stats.LastPlayed = g.Time
+		}
+	}
+
+	if stats.Answers > 0 {
+		stats.AverageBias = bias / float64(stats.Answers)
+	}
+	stats.AverageWidth, stats.MedianWidth = meanAndMedian(widths)
+
+	return stats
+}
+
+// loadUserStats loads the games of a user and summarizes those saved at or after since,
+// checking the answers using the rules of cfg. A zero since summarizes all games.
+func loadUserStats(r *http.Request, db GameDatabase, uid string, since time.Time, cfg ScoreConfig) (UserStats, error) {
+	games, err := db.List(r, uid)
+	if err != nil {
+		return UserStats{}, err
+	}
+
+	var recent []GameEntity
+	for _, g := range games {
+		if !g.Time.Before(since) {
+			recent = append(recent, g)
+		}
+	}
+
+	return newUserStats(uid, recent, cfg), nil
+}
+
+// QuestionStats summarizes the answers to a question in the completed games.
+type QuestionStats struct {
+	QuestionID string `json:"questionId"`
+	Answers    int    `json:"answers"`
+	Correct    int    `json:"correct"`
+	// AverageLowerBound and AverageUpperBound are the means of the bounds of the answers.
+	AverageLowerBound float64 `json:"averageLowerBound"`
+	AverageUpperBound float64 `json:"averageUpperBound"`
+	// Widths are the widths of the answers, see Answer.Width.
+	Widths []float64 `json:"-"`
+}
+
+// HitRate returns the ratio of correct answers to all answers.
+func (s QuestionStats) HitRate() float64 {
+	if s.Answers == 0 {
+		return 0
+	}
+
+	return float64(s.Correct) / float64(s.Answers)
+}
+
+// newQuestionStats aggregates the answers of the completed games by question, checking
+// them using the rules of cfg.
+func newQuestionStats(games []GameEntity, cfg ScoreConfig) map[string]QuestionStats {
+	stats := make(map[string]QuestionStats)
+	for _, g := range games {
+		if !g.Completed() {
+			continue
+		}
+
+		for _, a := range g.Answers {
+			id := a.Question.ID
+			if id == "" {
+				continue
+			}
+
+			s := stats[id]
+			s.QuestionID = id
+			s.Answers++
+			if a.CorrectWith(cfg) {
+				s.Correct++
+			}
+			s.AverageLowerBound += a.LowerBound
+			s.AverageUpperBound += a.UpperBound
+			s.Widths = append(s.Widths, a.Width())
+			stats[id] = s
+		}
+	}
+
+	for id, s := range stats {
+		s.AverageLowerBound /= float64(s.Answers)
+		s.AverageUpperBound /= float64(s.Answers)
+		stats[id] = s
+	}
+
+	return stats
+}
+
+// answerStats returns the stats of a question, which are empty if it has not been answered.
+func answerStats(stats map[string]QuestionStats, questionID string) QuestionStats {
+	s, ok := stats[questionID]
+	if !ok {
+		s.QuestionID = questionID
+	}
+	return s
+}
+
+// histogramBucket counts the values from Lower to Upper. Upper is only included in the
+// last bucket of a histogram.
+type histogramBucket struct {
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
+	Count int     `json:"count"`
+}
+
+// histogram divides the range of the values into n buckets of equal width and counts
+// the values in them. It returns a single bucket if all values are equal and none if
+// there are no values.
+func histogram(values []float64, n int) []histogramBucket {
+	if len(values) == 0 || n < 1 {
+		return []histogramBucket{}
+	}
+
+	low, high := values[0], values[0]
+	for _, v := range values {
+		low = math.Min(low, v)
+		high = math.Max(high, v)
+	}
+	if low == high {
+		return []histogramBucket{{Lower: low, Upper: high, Count: len(values)}}
+	}
+
+	step := (high - low) / float64(n)
+	buckets := make([]histogramBucket, n)
+	for i := range buckets {
+		buckets[i].Lower = low + float64(i)*step
+		buckets[i].Upper = low + float64(i+1)*step
+	}
+	buckets[n-1].Upper = high
+
+	for _, v := range values {
+		i := int((v - low) / step)
+		if i >= n {
+			i = n - 1
+		}
+		buckets[i].Count++
+	}
+
+	return buckets
+}
+
+// meanAndMedian returns the mean and the median of the values, or zero if there are none.
+func meanAndMedian(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	sum := 0.0
+	for _, v := range sorted {
+		sum += v
+	}
+
+	mid := len(sorted) / 2
+	median := sorted[mid]
+	if len(sorted)%2 == 0 {
+		median = (sorted[mid-1] + sorted[mid]) / 2
+	}
+
+	return sum / float64(len(sorted)), median
+}
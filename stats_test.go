@@ -0,0 +1,193 @@
+package predictiongame
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewUserStats(t *testing.T) {
+	question := Question{BoundLow: 10, BoundHigh: 20}
+	correct := Answer{Question: question, LowerBound: 5, UpperBound: 15}
+	wrong := Answer{Question: question, LowerBound: 30, UpperBound: 40}
+	last := time.Date(2016, time.September, 18, 0, 0, 0, 0, time.UTC)
+
+	stats := newUserStats("user", []GameEntity{
+		{Time: last, Status: GameCompleted, Answers: []Answer{correct, wrong}},
+		{Time: last.Add(-time.Hour), Answers: []Answer{correct}},
+		{Time: last.Add(time.Hour), Status: GameInProgress, Answers: []Answer{wrong}},
+	}, ScoreConfig{})
+
+	if stats.Games != 2 || stats.Answers != 3 || stats.Correct != 2 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	if !stats.LastPlayed.Equal(last) {
+		t.Errorf("Expected last played %s, got %s", last, stats.LastPlayed)
+	}
+	if rate := stats.HitRate(); rate < 0.66 || rate > 0.67 {
+		t.Errorf("Expected hit rate 2/3, got %v", rate)
+	}
+}
+
+func TestRelativeError(t *testing.T) {
+	for _, tc := range []struct {
+		low, high, lower, upper float64
+		expected                float64
+	}{
+		{100, 100, 150, 250, 1},
+		{90, 110, 40, 60, -0.5},
+		{-20, 0, -5, -5, 0.5},
+		{-10, 10, 50, 100, 0},
+	} {
+		a := Answer{Question: Question{BoundLow: tc.low, BoundHigh: tc.high}, LowerBound: tc.lower, UpperBound: tc.upper}
+		if got := a.RelativeError(); math.Abs(got-tc.expected) > 1e-9 {
+			t.Errorf("[%v, %v] for [%v, %v]: expected %v, got %v", tc.lower, tc.upper, tc.low, tc.high, tc.expected, got)
+		}
+	}
+}
+
+func TestUserStatsAverageBias(t *testing.T) {
+	question := Question{BoundLow: 100, BoundHigh: 100}
+	stats := newUserStats("user", []GameEntity{{
+		Status: GameCompleted,
+		Answers: []Answer{
+			{Question: question, LowerBound: 200, UpperBound: 200},
+			{Question: question, LowerBound: 50, UpperBound: 50},
+		},
+	}}, ScoreConfig{})
+
+	if math.Abs(stats.AverageBias-0.25) > 1e-9 {
+		t.Errorf("Expected average bias 0.25, got %v", stats.AverageBias)
+	}
+}
+
+func TestUserStatsWidth(t *testing.T) {
+	question := Question{BoundLow: 100, BoundHigh: 100}
+	answer := func(lower, upper float64) Answer {
+		return Answer{Question: question, LowerBound: lower, UpperBound: upper}
+	}
+
+	stats := newUserStats("user", []GameEntity{
+		{Status: GameCompleted, Answers: []Answer{answer(90, 110), answer(0, 1000)}},
+		{Status: GameCompleted, Answers: []Answer{answer(100, 100), answer(50, 110)}},
+		{Status: GameInProgress, Answers: []Answer{answer(0, 1e6)}},
+	}, ScoreConfig{})
+
+	if stats.AverageWidth != 270 || stats.MedianWidth != 40 {
+		t.Errorf("Expected average width 270 and median 40, got %v and %v", stats.AverageWidth, stats.MedianWidth)
+	}
+
+	if empty := newUserStats("user", nil, ScoreConfig{}); empty.AverageWidth != 0 || empty.MedianWidth != 0 {
+		t.Errorf("Expected zero widths without answers, got %+v", empty)
+	}
+}
+
+func TestUserStatsScoreConfig(t *testing.T) {
+	question := Question{BoundLow: 100, BoundHigh: 200}
+	games := []GameEntity{{Status: GameCompleted, Answers: []Answer{
+		{Question: question, LowerBound: 150, UpperBound: 160},
+		{Question: question, LowerBound: 0, UpperBound: 105},
+	}}}
+
+	if stats := newUserStats("user", games, ScoreConfig{}); stats.Correct != 2 {
+		t.Errorf("Expected 2 correct answers by default, got %d", stats.Correct)
+	}
+	if stats := newUserStats("user", games, ScoreConfig{MinOverlapFraction: 0.1}); stats.Correct != 1 {
+		t.Errorf("Expected 1 correct answer with a minimum overlap, got %d", stats.Correct)
+	}
+}
+
+func TestLogScaleQuestion(t *testing.T) {
+	question := Question{BoundLow: 1000, BoundHigh: 1000, Scale: LogScale}
+	answer := func(lower, upper float64) Answer {
+		return Answer{Question: question, LowerBound: lower, UpperBound: upper}
+	}
+
+	tests := []struct {
+		answer      Answer
+		width, miss float64
+		correct     bool
+	}{
+		{answer(100, 10000), 2, 0, true},
+		{answer(1, 10), 1, 2, false},
+		{answer(1e5, 1e6), 1, 2, false},
+		{answer(-5, 10), 1, 2, false},
+	}
+	for _, tt := range tests {
+		a := tt.answer
+		if width := a.Width(); math.Abs(width-tt.width) > 1e-9 {
+			t.Errorf("Expected width %v for %v-%v, got %v", tt.width, a.LowerBound, a.UpperBound, width)
+		}
+		if miss := a.MissDistance(); math.Abs(miss-tt.miss) > 1e-9 {
+			t.Errorf("Expected miss distance %v for %v-%v, got %v", tt.miss, a.LowerBound, a.UpperBound, miss)
+		}
+		if a.Correct() != tt.correct {
+			t.Errorf("Expected correct %v for %v-%v", tt.correct, a.LowerBound, a.UpperBound)
+		}
+	}
+
+	if rel := answer(100, 100000).RelativeError(); math.Abs(rel-math.Sqrt(10)+1) > 1e-9 {
+		t.Errorf("Expected relative error of the geometric midpoint, got %v", rel)
+	}
+
+	valid := Question{Text: "How many?", BoundLow: 1, BoundHigh: 10, Scale: LogScale}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Unexpected error for a valid log-scale question: %s", err)
+	}
+
+	invalid := Question{Text: "How many?", BoundLow: 0, BoundHigh: 10, Scale: LogScale}
+	if err := invalid.Validate(); err == nil {
+		t.Errorf("Expected an error for a log-scale question with a lower bound of zero")
+	}
+	invalid.Scale = "exponential"
+	if err := invalid.Validate(); err == nil {
+		t.Errorf("Expected an error for an unknown scale")
+	}
+}
+
+func TestNewQuestionStats(t *testing.T) {
+	q1 := Question{ID: "q1", BoundLow: 10, BoundHigh: 20}
+	q2 := Question{ID: "q2", BoundLow: 10, BoundHigh: 20}
+	hit := func(q Question) Answer { return Answer{Question: q, LowerBound: 5, UpperBound: 15} }
+	miss := func(q Question) Answer { return Answer{Question: q, LowerBound: 30, UpperBound: 40} }
+
+	games := []GameEntity{
+		{Status: GameCompleted, Answers: []Answer{hit(q1), miss(q2)}},
+		{Answers: []Answer{miss(q1), miss(q2)}},
+		{Status: GameInProgress, Answers: []Answer{hit(q2)}},
+	}
+	stats := newQuestionStats(games, ScoreConfig{})
+
+	expected := map[string]QuestionStats{
+		"q1": {QuestionID: "q1", Answers: 2, Correct: 1, AverageLowerBound: 17.5, AverageUpperBound: 27.5, Widths: []float64{10, 10}},
+		"q2": {QuestionID: "q2", Answers: 2, Correct: 0, AverageLowerBound: 30, AverageUpperBound: 40, Widths: []float64{10, 10}},
+	}
+	if !reflect.DeepEqual(stats, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, stats)
+	}
+	if rate := stats["q1"].HitRate(); rate != 0.5 {
+		t.Errorf("Expected hit rate 0.5, got %v", rate)
+	}
+
+	if strict := newQuestionStats(games, ScoreConfig{Mode: ScoringContain}); strict["q1"].Correct != 0 {
+		t.Errorf("Expected no correct answers with ScoringContain, got %+v", strict["q1"])
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	for _, tc := range []struct {
+		values   []float64
+		n        int
+		expected []histogramBucket
+	}{
+		{nil, 3, []histogramBucket{}},
+		{[]float64{5, 5}, 3, []histogramBucket{{5, 5, 2}}},
+		{[]float64{0, 1, 2, 3, 9, 10}, 2, []histogramBucket{{0, 5, 4}, {5, 10, 2}}},
+		{[]float64{0, 10, 20, 30}, 3, []histogramBucket{{0, 10, 1}, {10, 20, 1}, {20, 30, 2}}},
+	} {
+		if got := histogram(tc.values, tc.n); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("histogram(%v, %d): expected %v, got %v", tc.values, tc.n, tc.expected, got)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package predictiongame
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// weeklySummarySubject is the subject of the weekly summary emails.
+const weeklySummarySubject = "Your weekly GetRational summary"
+
+// weeklySummaryPeriod is the period of the games summarized in the weekly summary.
+const weeklySummaryPeriod = 7 * 24 * time.Hour
+
+// Mailer sends HTML emails.
+type Mailer interface {
+	Send(to, subject, htmlBody string) error
+}
+
+// SMTPMailer is a Mailer which sends the emails using an SMTP server.
+type SMTPMailer struct {
+	// Addr is the address of the SMTP server in the form host:port.
+	Addr string
+	// Username and Password are used for PLAIN authentication if Username is set.
+	Username string
+	Password string
+	// From is the sender address.
+	From string
+}
+
+// Send sends an HTML email to the given address.
+func (m SMTPMailer) Send(to, subject, htmlBody string) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, err := net.SplitHostPort(m.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", m.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/html; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(htmlBody)
+
+	return smtp.SendMail(m.Addr, auth, m.From, []string{to}, msg.Bytes())
+}
+
+// AddressBook maps user IDs to the email addresses the weekly summary is sent to.
+type AddressBook map[string]string
+
+// readAddressFile reads an AddressBook from a CSV file with the columns uid and email.
+func readAddressFile(path string) (AddressBook, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return readAddresses(f)
+}
+
+func readAddresses(r io.Reader) (AddressBook, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+
+	addresses := AddressBook{}
+	for line := 1; ; line++ {
+		rec, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if line == 1 && rec[0] == "uid" {
+			continue
+		}
+
+		if !strings.Contains(rec[1], "@") {
+			return nil, fmt.Errorf("line %d: invalid email address %q", line, rec[1])
+		}
+		addresses[rec[0]] = rec[1]
+	}
+
+	return addresses, nil
+}
+
+// renderWeeklySummary renders the weekly summary email for the stats of a user.
+func renderWeeklySummary(templ *template.Template, stats UserStats) (string, error) {
+	var body bytes.Buffer
+	if err := templ.ExecuteTemplate(&body, "weekly-summary.html", stats); err != nil {
+		return "", err
+	}
+
+	return body.String(), nil
+}
+
+// summaryResult is the response of the weekly summary task.
+type summaryResult struct {
+	Sent   int `json:"sent"`
+	Failed int `json:"failed"`
+}
+
+// weeklySummaryHandler sends the weekly summary to every user in the address book who
+// has completed a game in the last weeklySummaryPeriod, summarizing only those games. It
+// is triggered by the App Engine cron service (see cron.yaml).
+func weeklySummaryHandler(templ *template.Template, db GameDatabase, mailer Mailer, addresses AddressBook, opts handlerOptions) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// App Engine removes this header from external requests.
+		if r.Header.Get("X-Appengine-Cron") != "true" {
+			http.Error(w, "Only available to cron jobs", http.StatusForbidden)
+			return
+		}
+
+		uids := make([]string, 0, len(addresses))
+		for uid := range addresses {
+			uids = append(uids, uid)
+		}
+		sort.Strings(uids)
+
+		since := time.Now().Add(-weeklySummaryPeriod)
+		var result summaryResult
+		for _, uid := range uids {
+			stats, err := loadUserStats(r, db, uid, since, opts.scoring)
+			if err != nil {
+				opts.logger.Error("Error loading stats", "user", uid, "error", err)
+				result.Failed++
+				continue
+			}
+
+			if stats.Games == 0 {
+				continue
+			}
+
+			body, err := renderWeeklySummary(templ, stats)
+			if err != nil {
+				opts.logger.Error("Error rendering weekly summary", "user", uid, "error", err)
+				result.Failed++
+				continue
+			}
+
+			if err := mailer.Send(addresses[uid], weeklySummarySubject, body); err != nil {
+				opts.logger.Error("Error sending weekly summary", "user", uid, "error", err)
+				result.Failed++
+				continue
+			}
+
+			result.Sent++
+		}
+
+		writeJSON(w, r, result)
+	})
+}
@@ -0,0 +1,108 @@
+package predictiongame
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type recordingMailer struct {
+	sent map[string]string
+}
+
+func (m *recordingMailer) Send(to, subject, htmlBody string) error {
+	if m.sent == nil {
+		m.sent = make(map[string]string)
+	}
+	m.sent[to] = htmlBody
+	return nil
+}
+
+func TestRenderWeeklySummary(t *testing.T) {
+	templ, err := loadTemplates()
+	if err != nil {
+		t.Fatalf("Can not load templates: %s", err)
+	}
+
+	stats := UserStats{
+		UserID:     "user",
+		Games:      3,
+		Answers:    36,
+		Correct:    18,
+		LastPlayed: time.Date(2016, time.September, 18, 12, 0, 0, 0, time.UTC),
+	}
+
+	body, err := renderWeeklySummary(templ, stats)
+	if err != nil {
+		t.Fatalf("Can not render summary: %s", err)
+	}
+
+	for _, expected := range []string{"<strong>3</strong>", "18 / 36", "(50%)", "September 18, 2016", "well calibrated"} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected summary to contain %q:\n%s", expected, body)
+		}
+	}
+}
+
+func TestWeeklySummaryHandler(t *testing.T) {
+	templ, err := loadTemplates()
+	if err != nil {
+		t.Fatalf("Can not load templates: %s", err)
+	}
+
+	question := Question{BoundLow: 10, BoundHigh: 20}
+	db := NewMockGameDatabase(WithListReturns([]GameEntity{
+		{Time: time.Now().Add(-time.Hour), Status: GameCompleted, Answers: []Answer{{Question: question, LowerBound: 5, UpperBound: 15}}},
+		{Time: time.Now().Add(-2 * weeklySummaryPeriod), Status: GameCompleted, Answers: []Answer{{Question: question, LowerBound: 30, UpperBound: 40}}},
+	}, nil))
+	mailer := &recordingMailer{}
+	addresses := AddressBook{"a": "a@example.com", "b": "b@example.com"}
+	handler := weeklySummaryHandler(templ, db, mailer, addresses, defaultHandlerOptions())
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/tasks/weekly-summary", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d without cron header, got %d", http.StatusForbidden, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/tasks/weekly-summary", nil)
+	r.Header.Set("X-Appengine-Cron", "true")
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if len(mailer.sent) != 2 || mailer.sent["a@example.com"] == "" {
+		t.Errorf("Expected summaries for both users, got %v", mailer.sent)
+	}
+	// Only the game of the last week is summarized.
+	if body := mailer.sent["a@example.com"]; !strings.Contains(body, "1 / 1") {
+		t.Errorf("Expected a summary of the last week, got %s", body)
+	}
+
+	mailer = &recordingMailer{}
+	db = NewMockGameDatabase(WithListReturns([]GameEntity{
+		{Time: time.Now().Add(-2 * weeklySummaryPeriod), Status: GameCompleted, Answers: []Answer{{Question: question, LowerBound: 5, UpperBound: 15}}},
+	}, nil))
+	w = httptest.NewRecorder()
+	weeklySummaryHandler(templ, db, mailer, addresses, defaultHandlerOptions()).ServeHTTP(w, r)
+	if len(mailer.sent) != 0 {
+		t.Errorf("Expected no summaries without games in the last week, got %v", mailer.sent)
+	}
+}
+
+func TestReadAddresses(t *testing.T) {
+	addresses, err := readAddresses(strings.NewReader("uid,email\nuser, user@example.com\n"))
+	if err != nil {
+		t.Fatalf("Can not read addresses: %s", err)
+	}
+	if len(addresses) != 1 || addresses["user"] != "user@example.com" {
+		t.Errorf("Unexpected addresses %v", addresses)
+	}
+
+	if _, err := readAddresses(strings.NewReader("user,nobody\n")); err == nil {
+		t.Error("Expected an error for an invalid address.")
+	}
+}
@@ -4,95 +4,137 @@ import (
 	"encoding/json"
 	"fmt"
 	"html/template"
-	"log"
+	"io/fs"
+	"os"
+	"strconv"
 )
 
 func safeHTML(text string) template.HTML {
 	return template.HTML(text)
 }
 
-func rangeStr(lower, upper float64) string {
+// FormatBound formats a bound or an answer with precision decimal places.
+func FormatBound(value float64, precision int) string {
+	return strconv.FormatFloat(value, 'f', precision, 64)
+}
+
+func rangeStr(lower, upper float64, precision int) string {
 	if lower == upper {
-		return fmt.Sprintf("%.0f", lower)
+		return FormatBound(lower, precision)
 	}
 
-	return fmt.Sprintf("%.0f-%.0f", lower, upper)
+	return FormatBound(lower, precision) + "-" + FormatBound(upper, precision)
 }
 
-func formatJSON(data interface{}) template.JS {
+// answerStr formats the answer as a range or, for point questions, as estimate±tolerance,
+// with the precision of the question.
+func answerStr(a Answer) string {
+	precision := a.Question.Precision
+	if a.Question.IsPoint() {
+		estimate, tolerance := a.Estimate()
+		return FormatBound(estimate, precision) + "±" + FormatBound(tolerance, precision)
+	}
+
+	return rangeStr(a.LowerBound, a.UpperBound, precision)
+}
+
+// formatJSON encodes data for a script. An error stops the execution of the template,
+// which is logged by render.
+func formatJSON(data interface{}) (template.JS, error) {
 	bytes, err := json.Marshal(data)
 	if err != nil {
-		log.Printf("Error marshaling JSON: %s", err)
+		return "", err
 	}
 
-	return template.JS(bytes)
+	return template.JS(bytes), nil
 }
 
-func tableClass(a Answer) string {
-	if a.Correct() {
+func tableClass(cfg ScoreConfig, a Answer) string {
+	if a.CorrectWith(cfg) {
 		return "success"
 	}
 
 	return "danger"
 }
 
-func answerEvaluation(answers []Answer) string {
-	correct := correctAnswers(answers)
-	return evaluateConfidence(int(correct), len(answers), ExpectedConfidence)
+func answerEvaluation(cfg ScoreConfig, expected float64, answers []Answer) string {
+	correct := correctAnswers(cfg, answers)
+	return evaluateConfidence(int(correct), len(answers), expected)
 }
 
-func correctAnswers(answers []Answer) float64 {
+func correctAnswers(cfg ScoreConfig, answers []Answer) float64 {
 	correct := 0
 	for _, a := range answers {
-		if a.Correct() {
+		if a.CorrectWith(cfg) {
 			correct++
 		}
 	}
 	return float64(correct)
 }
 
-func correctAnswersPercent(answers []Answer) string {
-	correct := correctAnswers(answers)
+func correctAnswersPercent(cfg ScoreConfig, answers []Answer) string {
+	if len(answers) == 0 {
+		return "0%"
+	}
+
+	correct := correctAnswers(cfg, answers)
 	return fmt.Sprintf("%.0f%%", correct/float64(len(answers))*100)
 }
 
-func targetScore(answers []Answer) float64 {
-	return float64(len(answers)) * ExpectedConfidence
+func targetScore(expected float64, answers []Answer) float64 {
+	return float64(len(answers)) * expected
 }
 
-func countHistory(games []GameEntity) (float64, int) {
+func countHistory(cfg ScoreConfig, games []GameEntity) (float64, int) {
 	correct := 0.0
 	count := 0
 	for _, g := range games {
-		correct += correctAnswers(g.Answers)
+		correct += correctAnswers(cfg, g.Answers)
 		count += len(g.Answers)
 	}
 	return float64(correct), count
 }
 
-func correctAnswersHistory(games []GameEntity) float64 {
-	correct, _ := countHistory(games)
+func correctAnswersHistory(cfg ScoreConfig, games []GameEntity) float64 {
+	correct, _ := countHistory(cfg, games)
 	return correct
 }
 
-func correctAnswersHistoryPercent(games []GameEntity) string {
-	correct, count := countHistory(games)
+func correctAnswersHistoryPercent(cfg ScoreConfig, games []GameEntity) string {
+	correct, count := countHistory(cfg, games)
 	return fmt.Sprintf("%.0f%%", correct/float64(count)*100)
 }
 
-func targetScoreHistory(games []GameEntity) float64 {
-	_, count := countHistory(games)
-	return float64(count) * ExpectedConfidence
+func targetScoreHistory(expected float64, games []GameEntity) float64 {
+	count := 0
+	for _, g := range games {
+		count += len(g.Answers)
+	}
+	return float64(count) * expected
+}
+
+func percent(ratio float64) string {
+	return fmt.Sprintf("%.0f%%", ratio*100)
 }
 
 func offset(value, offset int) int {
 	return value + offset
 }
 
+// loadTemplates parses the templates in the templates directory.
 func loadTemplates() (*template.Template, error) {
+	return parseTemplates(os.DirFS("templates"), nil)
+}
+
+// parseTemplates parses all files in the root of fsys as templates, which are named like
+// the files. The functions in funcs are added to the built-in ones, replacing those
+// with the same names.
+func parseTemplates(fsys fs.FS, funcs template.FuncMap) (*template.Template, error) {
 	templ := template.New("root").Funcs(template.FuncMap{
 		"safeHTML":              safeHTML,
 		"rangeStr":              rangeStr,
+		"answerStr":             answerStr,
+		"formatBound":           FormatBound,
 		"json":                  formatJSON,
 		"tableClass":            tableClass,
 		"evaluation":            answerEvaluation,
@@ -103,9 +145,12 @@ func loadTemplates() (*template.Template, error) {
 		"correctHistoryPercent": correctAnswersHistoryPercent,
 		"targetHistory":         targetScoreHistory,
 		"offset":                offset,
-	})
+		"percent":               percent,
+		"localize":              localize,
+		"basePath":              func() string { return "" },
+	}).Funcs(funcs)
 
-	templ, err := templ.ParseGlob("templates/*")
+	templ, err := templ.ParseFS(fsys, "*")
 	if err != nil {
 		return nil, err
 	}
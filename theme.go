@@ -0,0 +1,99 @@
+package predictiongame
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// The themes of the pages.
+const (
+	LightTheme = "light"
+	DarkTheme  = "dark"
+)
+
+// DefaultTheme is the theme of the pages unless the user chose another one.
+const DefaultTheme = LightTheme
+
+// themeCookie is the name of the cookie containing the theme chosen by the user.
+const themeCookie = "theme"
+
+// themeCookieMaxAge is how long the theme cookie is kept, in seconds.
+const themeCookieMaxAge = 365 * 24 * 60 * 60
+
+// themeKey is the context key of the theme of a request.
+type themeKey struct{}
+
+// validTheme returns true if the pages can be rendered with theme.
+func validTheme(theme string) bool {
+	return theme == LightTheme || theme == DarkTheme
+}
+
+// ThemeMiddleware reads the theme chosen by the user from the theme cookie and stores
+// it in the context of the request, where the handlers find it with requestTheme.
+func ThemeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		theme := DefaultTheme
+		if c, err := r.Cookie(themeCookie); err == nil && validTheme(c.Value) {
+			theme = c.Value
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), themeKey{}, theme)))
+	})
+}
+
+// requestTheme returns the theme of the request, or DefaultTheme if it did not pass
+// ThemeMiddleware.
+func requestTheme(r *http.Request) string {
+	if theme, ok := r.Context().Value(themeKey{}).(string); ok {
+		return theme
+	}
+
+	return DefaultTheme
+}
+
+// themePreference is the request and response of POST /api/preferences/theme.
+type themePreference struct {
+	Theme string `json:"theme"`
+}
+
+// themePreferenceHandler sets the theme cookie to the theme in the request. An empty
+// theme clears the cookie, so the default theme is used again.
+func themePreferenceHandler(basePath string, maxBodyBytes int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		defer r.Body.Close()
+
+		var req themePreference
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Error parsing theme: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		cookie := &http.Cookie{
+			Name:     themeCookie,
+			Value:    req.Theme,
+			Path:     basePath + "/",
+			MaxAge:   themeCookieMaxAge,
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		}
+		switch {
+		case req.Theme == "":
+			cookie.MaxAge = -1
+			req.Theme = DefaultTheme
+		case !validTheme(req.Theme):
+			http.Error(w, fmt.Sprintf("Unknown theme %q", req.Theme), http.StatusBadRequest)
+			return
+		}
+
+		http.SetCookie(w, cookie)
+		writeJSON(w, r, req)
+	})
+}
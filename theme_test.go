@@ -0,0 +1,72 @@
+package predictiongame
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestThemeMiddleware(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html": {Data: []byte(`{{ .Theme }}`)},
+	}
+	handler := NewHandler(nil, SeedDemoQuestions(), NewMockGameDatabase(), WithTemplateFS(fsys), WithBasePath("/predict"))
+
+	for cookie, expected := range map[string]string{
+		"":        LightTheme,
+		"dark":    DarkTheme,
+		"light":   LightTheme,
+		"unknown": LightTheme,
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/predict/", nil)
+		if cookie != "" {
+			r.AddCookie(&http.Cookie{Name: themeCookie, Value: cookie})
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if body := w.Body.String(); body != expected {
+			t.Errorf("Expected theme %q for cookie %q, got %q", expected, cookie, body)
+		}
+	}
+}
+
+func TestThemePreferenceHandler(t *testing.T) {
+	handler := themePreferenceHandler("/predict", 1024)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/preferences/theme", strings.NewReader(`{"theme": "dark"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value != DarkTheme || cookies[0].Path != "/predict/" {
+		t.Errorf("Expected a dark theme cookie for /predict/, got %v", cookies)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/preferences/theme", strings.NewReader(`{"theme": ""}`)))
+	if cookies := w.Result().Cookies(); len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+		t.Errorf("Expected the theme cookie to be cleared, got %v", cookies)
+	}
+	if body := w.Body.String(); !strings.Contains(body, `"theme":"light"`) {
+		t.Errorf("Expected the default theme in the response, got %s", body)
+	}
+
+	for _, tc := range []struct {
+		method, body string
+		status       int
+	}{
+		{http.MethodGet, "", http.StatusMethodNotAllowed},
+		{http.MethodPost, `{"theme": "blue"}`, http.StatusBadRequest},
+		{http.MethodPost, `not json`, http.StatusBadRequest},
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(tc.method, "/api/preferences/theme", strings.NewReader(tc.body)))
+		if w.Code != tc.status {
+			t.Errorf("%s %q: expected status %d, got %d", tc.method, tc.body, tc.status, w.Code)
+		}
+	}
+}
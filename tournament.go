@@ -0,0 +1,453 @@
+package predictiongame
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pborman/uuid"
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/datastore"
+)
+
+// ErrTournamentNotFound is returned when a tournament does not exist.
+var ErrTournamentNotFound = errors.New("tournament not found")
+
+// ErrTournamentClosed is returned when adding a result outside of the time of a tournament.
+var ErrTournamentClosed = errors.New("tournament is not open")
+
+// ErrTournamentPlayed is returned when a player submits a second result for a tournament.
+var ErrTournamentPlayed = errors.New("player has already played the tournament")
+
+// defaultTournamentDuration is the duration of a tournament if no end is given.
+const defaultTournamentDuration = 7 * 24 * time.Hour
+
+// Tournament lets a group of players answer the same questions and compare their scores.
+type Tournament struct {
+	ID        string     `json:"id" datastore:"-"`
+	Name      string     `json:"name,omitempty"`
+	Questions []Question `json:"questions"`
+	Start     time.Time  `json:"start"`
+	End       time.Time  `json:"end"`
+	// Results maps the player IDs to their games.
+	Results map[string]GameEntity `json:"-" datastore:"-"`
+}
+
+// Open returns true if results can be added to the tournament at the time t.
+func (t Tournament) Open(now time.Time) bool {
+	return !now.Before(t.Start) && now.Before(t.End)
+}
+
+// Standing is the result of a player in a tournament.
+type Standing struct {
+	Rank int `json:"rank"`
+	// Player is the ID of the user. It is not sent to the clients, which get the
+	// DisplayName or AnonymousID of the player instead, see LeaderboardEntry.
+	Player      string  `json:"-"`
+	DisplayName string  `json:"displayName,omitempty"`
+	AnonymousID string  `json:"anonymousId,omitempty"`
+	GameID      string  `json:"gameId"`
+	Score       float64 `json:"score"`
+	Correct     int     `json:"correct"`
+}
+
+// Standings returns the results ordered by their calibrated score using the rules of
+// cfg. Players with the same score share a rank; the earlier submission is listed first.
+func (t Tournament) Standings(cfg ScoreConfig) []Standing {
+	games := make([]GameEntity, 0, len(t.Results))
+	for _, g := range t.Results {
+		games = append(games, g)
+	}
+	sort.Slice(games, func(i, j int) bool {
+		si, sj := games[i].CalibratedScoreWith(cfg), games[j].CalibratedScoreWith(cfg)
+		if si != sj {
+			return si > sj
+		}
+		return games[i].Time.Before(games[j].Time)
+	})
+
+	result := make([]Standing, 0, len(games))
+	for i, g := range games {
+		s := Standing{
+			Rank:    i + 1,
+			Player:  g.UserID,
+			GameID:  g.ID,
+			Score:   g.CalibratedScoreWith(cfg),
+			Correct: int(correctAnswers(cfg, g.Answers)),
+		}
+		if i > 0 && result[i-1].Score == s.Score {
+			s.Rank = result[i-1].Rank
+		}
+		result = append(result, s)
+	}
+
+	return result
+}
+
+// validate returns an error if the tournament can not be created.
+func (t Tournament) validate() error {
+	if len(t.Questions) == 0 {
+		return errors.New("tournament has no questions")
+	}
+	if !t.End.After(t.Start) {
+		return fmt.Errorf("end %s is not after start %s", t.End, t.Start)
+	}
+
+	return nil
+}
+
+// checkResult returns an error if the game of a player who has not played the
+// tournament yet can not be added to its results.
+func (t Tournament) checkResult(game GameEntity) error {
+	if !t.Open(game.Time) {
+		return ErrTournamentClosed
+	}
+
+	return t.checkAnswers(game.Answers)
+}
+
+// checkAnswers returns an error if the answers are not for the questions of the tournament.
+func (t Tournament) checkAnswers(answers []Answer) error {
+	if len(answers) != len(t.Questions) {
+		return fmt.Errorf("expected %d answers, got %d", len(t.Questions), len(answers))
+	}
+
+	for i, a := range answers {
+		if a.Question.ID != t.Questions[i].ID {
+			return fmt.Errorf("answer %d is not for question %s", i+1, t.Questions[i].ID)
+		}
+	}
+
+	return nil
+}
+
+// TournamentDatabase is the interface for the database containing the tournaments.
+type TournamentDatabase interface {
+	// Create stores a new tournament and returns its ID.
+	Create(r *http.Request, t Tournament) (string, error)
+	// Get returns the tournament with its results or ErrTournamentNotFound.
+	Get(r *http.Request, id string) (Tournament, error)
+	// AddResult records the game of a player. Only the first game of every player counts.
+	AddResult(r *http.Request, id string, game GameEntity) error
+}
+
+type memoryTournamentDatabase struct {
+	mu          sync.RWMutex
+	tournaments map[string]Tournament
+}
+
+// NewTournamentDatabase returns an in-memory TournamentDatabase which can be used concurrently.
+func NewTournamentDatabase() TournamentDatabase {
+	return &memoryTournamentDatabase{tournaments: make(map[string]Tournament)}
+}
+
+func (db *memoryTournamentDatabase) Create(r *http.Request, t Tournament) (string, error) {
+	if err := t.validate(); err != nil {
+		return "", err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t.ID = uuid.NewRandom().String()
+	t.Questions = append([]Question(nil), t.Questions...)
+	t.Results = make(map[string]GameEntity)
+	db.tournaments[t.ID] = t
+	return t.ID, nil
+}
+
+func (db *memoryTournamentDatabase) Get(r *http.Request, id string) (Tournament, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	t, ok := db.tournaments[id]
+	if !ok {
+		return Tournament{}, ErrTournamentNotFound
+	}
+
+	results := make(map[string]GameEntity, len(t.Results))
+	for player, g := range t.Results {
+		g.Answers = copyAnswers(g.Answers)
+		results[player] = g
+	}
+	t.Results = results
+	return t, nil
+}
+
+func (db *memoryTournamentDatabase) AddResult(r *http.Request, id string, game GameEntity) error {
+	if game.UserID == "" {
+		return errors.New("game has no player")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t, ok := db.tournaments[id]
+	if !ok {
+		return ErrTournamentNotFound
+	}
+
+	if _, ok := t.Results[game.UserID]; ok {
+		return ErrTournamentPlayed
+	}
+
+	if err := t.checkResult(game); err != nil {
+		return err
+	}
+
+	game.Answers = copyAnswers(game.Answers)
+	t.Results[game.UserID] = game
+	return nil
+}
+
+// tournamentDatabase is the TournamentDatabase storing the tournaments in the datastore
+// of App Engine. The results are children of the key of their tournament named by their
+// player, so every player has a single result.
+type tournamentDatabase struct{}
+
+func (db *tournamentDatabase) Create(r *http.Request, t Tournament) (string, error) {
+	if err := t.validate(); err != nil {
+		return "", err
+	}
+
+	ctx := appengine.NewContext(r)
+
+	t.ID = uuid.NewRandom().String()
+	if _, err := datastore.Put(ctx, datastore.NewKey(ctx, "Tournament", t.ID, 0, nil), &t); err != nil {
+		return "", err
+	}
+	return t.ID, nil
+}
+
+func (db *tournamentDatabase) Get(r *http.Request, id string) (Tournament, error) {
+	ctx := appengine.NewContext(r)
+
+	k := datastore.NewKey(ctx, "Tournament", id, 0, nil)
+	var t Tournament
+	err := datastore.Get(ctx, k, &t)
+	if err == datastore.ErrNoSuchEntity {
+		return Tournament{}, ErrTournamentNotFound
+	}
+	if err != nil {
+		return Tournament{}, err
+	}
+
+	var results []GameEntity
+	keys, err := datastore.NewQuery("TournamentResult").Ancestor(k).GetAll(ctx, &results)
+	if err != nil {
+		return Tournament{}, err
+	}
+
+	t.ID = id
+	t.Results = make(map[string]GameEntity, len(results))
+	for i, rk := range keys {
+		t.Results[rk.StringID()] = results[i]
+	}
+	return t, nil
+}
+
+func (db *tournamentDatabase) AddResult(r *http.Request, id string, game GameEntity) error {
+	if game.UserID == "" {
+		return errors.New("game has no player")
+	}
+
+	ctx := appengine.NewContext(r)
+
+	k := datastore.NewKey(ctx, "Tournament", id, 0, nil)
+	return datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		var t Tournament
+		err := datastore.Get(ctx, k, &t)
+		if err == datastore.ErrNoSuchEntity {
+			return ErrTournamentNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		rk := datastore.NewKey(ctx, "TournamentResult", game.UserID, 0, k)
+		var existing GameEntity
+		err = datastore.Get(ctx, rk, &existing)
+		if err == nil {
+			return ErrTournamentPlayed
+		}
+		if err != datastore.ErrNoSuchEntity {
+			return err
+		}
+
+		if err := t.checkResult(game); err != nil {
+			return err
+		}
+
+		_, err = datastore.Put(ctx, rk, &game)
+		return err
+	}, nil)
+}
+
+// tournamentErrorStatus returns the HTTP status for an error returned by a TournamentDatabase.
+func tournamentErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrTournamentNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrTournamentClosed), errors.Is(err, ErrTournamentPlayed):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// checkTournamentResult returns an error if the tournament with the ID would not accept
+// the game as the result of its player. The game which already is the result of its
+// player is accepted, so its submit can be repeated with its idempotency key.
+func checkTournamentResult(r *http.Request, tournaments TournamentDatabase, id string, game GameEntity) error {
+	t, err := tournaments.Get(r, id)
+	if err != nil {
+		return err
+	}
+
+	if existing, ok := t.Results[game.UserID]; ok {
+		if existing.ID == game.ID {
+			return nil
+		}
+		return ErrTournamentPlayed
+	}
+
+	return t.checkResult(game)
+}
+
+// newTournamentRequest is the body of a POST to /api/tournaments. If no questions are
+// given, the default number of random questions are used. The tournament starts now and lasts
+// a week unless specified otherwise.
+type newTournamentRequest struct {
+	Name        string    `json:"name"`
+	QuestionIDs []string  `json:"questionIds"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+}
+
+func tournamentsHandler(questions QuestionDatabase, tournaments TournamentDatabase, opts handlerOptions) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		defer r.Body.Close()
+
+		var req newTournamentRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, opts.maxBodyBytes)).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Error parsing tournament: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		t := Tournament{Name: req.Name, Start: req.Start, End: req.End}
+		if t.Start.IsZero() {
+			t.Start = time.Now()
+		}
+		if t.End.IsZero() {
+			t.End = t.Start.Add(defaultTournamentDuration)
+		}
+
+		if len(req.QuestionIDs) == 0 {
+			t.Questions = questions.SelectRandom(opts.numQuestions)
+		}
+		for _, id := range req.QuestionIDs {
+			q, err := questions.GetByID(id)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Question %q can not be loaded: %s", id, err), http.StatusBadRequest)
+				return
+			}
+			if !q.Enabled {
+				http.Error(w, fmt.Sprintf("Question %q is disabled", id), http.StatusBadRequest)
+				return
+			}
+			t.Questions = append(t.Questions, q)
+		}
+
+		id, err := tournaments.Create(r, t)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid tournament: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		writeJSONStatus(w, r, http.StatusCreated, struct {
+			ID string `json:"id"`
+		}{
+			ID: id,
+		})
+	})
+}
+
+// tournamentStandings is the response of GET /api/tournaments/:id. The score updates of
+// the players are streamed as server-sent events by GET /api/tournaments/:id/events.
+type tournamentStandings struct {
+	Tournament
+	Standings []Standing `json:"standings"`
+}
+
+func tournamentHandler(tournaments TournamentDatabase, hub *MultiplayerHub, opts handlerOptions) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := splitPath(r.URL.Path, "/api/tournaments/")
+		if len(parts) == 0 || len(parts) > 2 || (len(parts) == 2 && parts[1] != "events") {
+			http.NotFound(w, r)
+			return
+		}
+		id := parts[0]
+
+		t, err := tournaments.Get(r, id)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Tournament can not be loaded: %s", err), tournamentErrorStatus(err))
+			return
+		}
+
+		if len(parts) == 2 {
+			SSEHandler(hub, id).ServeHTTP(w, r)
+			return
+		}
+
+		// Until the tournament ends it may still be played, so the answers are not sent.
+		if time.Now().Before(t.End) {
+			t.Questions = publicQuestions(t.Questions)
+		}
+
+		standings := t.Standings(opts.scoring)
+		for i, s := range standings {
+			standings[i].DisplayName, standings[i].AnonymousID = opts.playerName(r, s.Player)
+		}
+		writeJSON(w, r, tournamentStandings{
+			Tournament: t,
+			Standings:  standings,
+		})
+	})
+}
+
+func playTournamentHandler(templ *template.Template, tournaments TournamentDatabase, opts handlerOptions) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := path.Base(r.URL.Path)
+
+		t, err := tournaments.Get(r, id)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Tournament can not be loaded: %s", err), tournamentErrorStatus(err))
+			return
+		}
+
+		if !t.Open(time.Now()) {
+			http.Error(w, fmt.Sprintf("Tournament %s is not open", id), http.StatusConflict)
+			return
+		}
+
+		page, locale := localizedTemplate(templ, r, "play.html")
+		render(templ, w, r, page, playContext{
+			pageContext: newPageContext(r, locale),
+			ID:          uuid.NewRandom().String(),
+			Questions:   opts.playQuestions(t.Questions),
+			Tournament:  t.ID,
+		})
+	})
+}
@@ -0,0 +1,259 @@
+package predictiongame
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func tournamentAnswers(questions []Question, correct int) []Answer {
+	answers := make([]Answer, 0, len(questions))
+	for i, q := range questions {
+		a := Answer{Question: q, LowerBound: q.BoundHigh + 1, UpperBound: q.BoundHigh + 2}
+		if i < correct {
+			a.LowerBound, a.UpperBound = q.BoundLow, q.BoundHigh
+		}
+		answers = append(answers, a)
+	}
+	return answers
+}
+
+func TestTournamentAddResult(t *testing.T) {
+	db := NewTournamentDatabase()
+	questions := demoQuestionList()[:4]
+	now := time.Now()
+
+	id, err := db.Create(nil, Tournament{Questions: questions, Start: now.Add(-time.Hour), End: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("Can not create tournament: %s", err)
+	}
+
+	for _, tc := range []struct {
+		game     GameEntity
+		expected error
+	}{
+		{GameEntity{UserID: "a", Time: now, Answers: tournamentAnswers(questions, 2)}, nil},
+		{GameEntity{UserID: "a", Time: now, Answers: tournamentAnswers(questions, 4)}, ErrTournamentPlayed},
+		{GameEntity{UserID: "b", Time: now.Add(2 * time.Hour), Answers: tournamentAnswers(questions, 2)}, ErrTournamentClosed},
+	} {
+		if err := db.AddResult(nil, id, tc.game); err != tc.expected {
+			t.Errorf("Player %s: expected %v, got %v", tc.game.UserID, tc.expected, err)
+		}
+	}
+
+	if err := db.AddResult(nil, id, GameEntity{UserID: "c", Time: now, Answers: tournamentAnswers(questions[:3], 2)}); err == nil {
+		t.Error("Expected an error for answers to other questions.")
+	}
+	if err := db.AddResult(nil, "missing", GameEntity{UserID: "a", Time: now}); err != ErrTournamentNotFound {
+		t.Errorf("Expected ErrTournamentNotFound, got %v", err)
+	}
+}
+
+func TestTournamentStandings(t *testing.T) {
+	questions := demoQuestionList()[:4]
+	now := time.Now()
+	tournament := Tournament{Results: map[string]GameEntity{
+		"over":  {ID: "1", UserID: "over", Time: now, Answers: tournamentAnswers(questions, 0)},
+		"late":  {ID: "2", UserID: "late", Time: now.Add(time.Minute), Answers: tournamentAnswers(questions, 2)},
+		"early": {ID: "3", UserID: "early", Time: now, Answers: tournamentAnswers(questions, 2)},
+		"under": {ID: "4", UserID: "under", Time: now, Answers: tournamentAnswers(questions, 3)},
+	}}
+
+	var players []string
+	var ranks []int
+	for _, s := range tournament.Standings(ScoreConfig{}) {
+		players = append(players, s.Player)
+		ranks = append(ranks, s.Rank)
+	}
+
+	if strings.Join(players, ",") != "early,late,under,over" {
+		t.Errorf("Unexpected order %v", players)
+	}
+	if ranks[0] != 1 || ranks[1] != 1 || ranks[2] != 3 || ranks[3] != 4 {
+		t.Errorf("Unexpected ranks %v", ranks)
+	}
+}
+
+func TestTournamentHandlers(t *testing.T) {
+	questions := SeedDemoQuestions()
+	tournaments := NewTournamentDatabase()
+	games := NewMemoryGameDatabase()
+	opts := defaultHandlerOptions()
+
+	w := httptest.NewRecorder()
+	body := `{"name": "Office", "questionIds": ["` + demoQuestionList()[0].ID + `", "` + demoQuestionList()[1].ID + `"]}`
+	tournamentsHandler(questions, tournaments, opts).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/tournaments", strings.NewReader(body)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body)
+	}
+
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatalf("Can not decode response: %s", err)
+	}
+
+	tournament, err := tournaments.Get(nil, created.ID)
+	if err != nil {
+		t.Fatalf("Can not load tournament: %s", err)
+	}
+
+	game, err := json.Marshal(map[string]interface{}{
+		"id":         "game",
+		"uid":        "player",
+		"answers":    tournamentAnswers(tournament.Questions, 1),
+		"tournament": created.ID,
+	})
+	if err != nil {
+		t.Fatalf("Can not encode game: %s", err)
+	}
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/game", strings.NewReader("data="+url.QueryEscape(string(game))))
+	submitHandler(questions, games, tournaments, NewMultiplayerHub(), opts).ServeHTTP(w, r)
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusFound, w.Code, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	tournamentHandler(tournaments, NewMultiplayerHub(), opts).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/tournaments/"+created.ID, nil))
+
+	// While the tournament is open neither the answers nor the IDs of the players are sent.
+	if strings.Contains(w.Body.String(), `"player"`) || strings.Contains(w.Body.String(), "trueValue") {
+		t.Errorf("Unexpected private data in %s", w.Body)
+	}
+
+	var standings tournamentStandings
+	if err := json.NewDecoder(w.Body).Decode(&standings); err != nil {
+		t.Fatalf("Can not decode standings: %s", err)
+	}
+	if standings.Name != "Office" || len(standings.Standings) != 1 || standings.Standings[0].Score != 1 {
+		t.Errorf("Unexpected standings %+v", standings)
+	}
+	if s := standings.Standings[0]; s.AnonymousID != opts.anonymousID("player") || s.DisplayName != "" {
+		t.Errorf("Expected the anonymous ID of the player, got %+v", s)
+	}
+	if q := standings.Questions[0]; q.BoundLow != 0 || q.BoundHigh != 0 {
+		t.Errorf("Expected the question without its answer, got %+v", q)
+	}
+
+	w = httptest.NewRecorder()
+	tournamentHandler(tournaments, NewMultiplayerHub(), opts).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/tournaments/missing", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestWithTournamentDatabase(t *testing.T) {
+	tournaments := NewTournamentDatabase()
+	now := time.Now()
+	id, err := tournaments.Create(nil, Tournament{Name: "Office", Questions: demoQuestionList()[:2], Start: now.Add(-time.Hour), End: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("Can not create tournament: %s", err)
+	}
+
+	// Handlers using the same database, like the instances of the app, share the tournaments.
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		NewHandler(nil, SeedDemoQuestions(), NewMockGameDatabase(), WithTournamentDatabase(tournaments)).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/tournaments/"+id, nil))
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Office") {
+			t.Errorf("Handler %d: expected the tournament, got %d", i, w.Code)
+		}
+	}
+}
+
+func TestSubmitHandlerTournamentAfterSave(t *testing.T) {
+	tournaments := NewTournamentDatabase()
+	now := time.Now()
+	questions := demoQuestionList()[:2]
+	id, err := tournaments.Create(nil, Tournament{Questions: questions, Start: now.Add(-time.Hour), End: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("Can not create tournament: %s", err)
+	}
+
+	game, _ := json.Marshal(map[string]interface{}{
+		"id":         "game",
+		"uid":        "player",
+		"answers":    tournamentAnswers(questions, 1),
+		"tournament": id,
+	})
+	games := NewMockGameDatabase(WithSaveReturns(errors.New("connection lost")))
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/game", strings.NewReader(string(game)))
+	r.Header.Set("Content-Type", "application/json")
+	submitHandler(SeedDemoQuestions(), games, tournaments, NewMultiplayerHub(), defaultHandlerOptions()).ServeHTTP(w, r)
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusInternalServerError, w.Code, w.Body)
+	}
+
+	if tournament, err := tournaments.Get(nil, id); err != nil || len(tournament.Results) != 0 {
+		t.Errorf("Expected no result for a game which was not saved, got %+v (%v)", tournament.Results, err)
+	}
+}
+
+func TestSubmitHandlerTournamentBeforeSave(t *testing.T) {
+	tournaments := NewTournamentDatabase()
+	now := time.Now()
+	questions := demoQuestionList()[:2]
+	id, err := tournaments.Create(nil, Tournament{Questions: questions, Start: now.Add(-2 * time.Hour), End: now.Add(-time.Hour)})
+	if err != nil {
+		t.Fatalf("Can not create tournament: %s", err)
+	}
+
+	game, _ := json.Marshal(map[string]interface{}{
+		"id":         "game",
+		"uid":        "player",
+		"answers":    tournamentAnswers(questions, 1),
+		"tournament": id,
+	})
+	games := NewMemoryGameDatabase()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/game", strings.NewReader(string(game)))
+	r.Header.Set("Content-Type", "application/json")
+	submitHandler(SeedDemoQuestions(), games, tournaments, NewMultiplayerHub(), defaultHandlerOptions()).ServeHTTP(w, r)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusConflict, w.Code, w.Body)
+	}
+
+	if _, err := games.Get(nil, "game"); err == nil {
+		t.Errorf("Expected the game of a closed tournament not to be saved")
+	}
+}
+
+func TestTournamentsHandlerDisabledQuestion(t *testing.T) {
+	list := demoQuestionList()[:2]
+	list[1].Enabled = false
+	questions := NewQuestionDatabase(list, nil)
+
+	w := httptest.NewRecorder()
+	body := `{"name": "Office", "questionIds": ["` + list[0].ID + `", "` + list[1].ID + `"]}`
+	tournamentsHandler(questions, NewTournamentDatabase(), defaultHandlerOptions()).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/tournaments", strings.NewReader(body)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body)
+	}
+}
+
+func TestTournamentsHandlerAdminOnly(t *testing.T) {
+	body := `{"name": "Office", "questionIds": ["` + demoQuestionList()[0].ID + `"]}`
+	handler := NewHandler(nil, SeedDemoQuestions(), NewMockGameDatabase(), WithAdminToken(testAdminToken))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/tournaments", strings.NewReader(body)))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/api/tournaments", strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+testAdminToken)
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body)
+	}
+}
@@ -0,0 +1,257 @@
+package predictiongame
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxDisplayNameLength is the maximum number of characters of a display name.
+const maxDisplayNameLength = 32
+
+// displayNamePunctuation are the characters besides letters, digits and spaces which
+// can be used in a display name.
+const displayNamePunctuation = "-_.'"
+
+// validateDisplayName returns the name without surrounding spaces or an error if it is
+// empty, too long or contains characters other than letters, digits, single spaces
+// and displayNamePunctuation.
+func validateDisplayName(name string) (string, error) {
+	if !utf8.ValidString(name) {
+		return "", errors.New("name is not valid UTF-8")
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errors.New("name is empty")
+	}
+	if n := utf8.RuneCountInString(name); n > maxDisplayNameLength {
+		return "", fmt.Errorf("name has %d characters, at most %d are allowed", n, maxDisplayNameLength)
+	}
+
+	for _, r := range name {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r), r == ' ', strings.ContainsRune(displayNamePunctuation, r):
+		default:
+			return "", fmt.Errorf("name contains invalid character %q", r)
+		}
+	}
+	if strings.Contains(name, "  ") {
+		return "", errors.New("name contains consecutive spaces")
+	}
+
+	return name, nil
+}
+
+// DisplayNameDatabase is the interface for the database containing the names the
+// users are shown with, for example on the leaderboard.
+type DisplayNameDatabase interface {
+	// Set sets the display name of a user. The name has to be validated before.
+	Set(r *http.Request, uid, name string) error
+	// Get returns the display name of a user or false if the user has none.
+	Get(r *http.Request, uid string) (string, bool)
+}
+
+// displayName is the body of a POST to /api/user/name and its response. The name is
+// returned unchanged apart from surrounding spaces; writeJSON escapes the HTML
+// characters, so it can be embedded in pages safely.
+type displayName struct {
+	UserID string `json:"uid"`
+	Name   string `json:"name"`
+}
+
+// userGame is a game in the response of GET /api/user/{uid}/games.
+type userGame struct {
+	ID        string    `json:"id"`
+	Time      time.Time `json:"time"`
+	Questions int       `json:"questions"`
+	Correct   int       `json:"correct"`
+	// Score is the CalibratedScore of the game.
+	Score float64 `json:"score"`
+}
+
+// userGamesPage is the response of GET /api/user/{uid}/games.
+type userGamesPage struct {
+	Games  []userGame `json:"games"`
+	Offset int        `json:"offset"`
+	Limit  int        `json:"limit"`
+	Total  int        `json:"total"`
+}
+
+// serveUserGames lists the completed games of a user, newest first. Only the user
+// can list their games.
+func serveUserGames(w http.ResponseWriter, r *http.Request, db GameDatabase, uid string, opts handlerOptions) {
+	if !validID(uid) {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if !opts.hasIdentity(r, uid) {
+		http.Error(w, "Games of other users can not be listed", http.StatusForbidden)
+		return
+	}
+
+	offset, limit, err := pageParams(r, 20, 100)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	games, total, err := db.ListPage(r, uid, offset, limit)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Game list can not be loaded: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "private, no-cache")
+	writeJSON(w, r, userGamesPage{
+		Games:  newUserGames(games, opts.scoring),
+		Offset: offset,
+		Limit:  limit,
+		Total:  total,
+	})
+}
+
+// newUserGames summarizes the games for a list of the games of a user, checking the
+// answers using the rules of cfg.
+func newUserGames(games []GameEntity, cfg ScoreConfig) []userGame {
+	list := make([]userGame, 0, len(games))
+	for _, g := range games {
+		list = append(list, userGame{
+			ID:        g.ID,
+			Time:      g.Time,
+			Questions: len(g.Answers),
+			Correct:   int(correctAnswers(cfg, g.Answers)),
+			Score:     g.CalibratedScoreWith(cfg),
+		})
+	}
+	return list
+}
+
+// historyContext is the context of the page listing the games of the user.
+type historyContext struct {
+	pageContext
+	Games []userGame
+	Total int
+	// NewerURL and OlderURL link to the neighbouring pages, if there are any.
+	NewerURL string
+	OlderURL string
+}
+
+// historyHandler shows the completed games of the signed in user, newest first. It is
+// the page version of GET /api/user/{uid}/games and takes the same offset and limit.
+func historyHandler(templ *template.Template, db GameDatabase, opts handlerOptions) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uid, ok := opts.userID(r)
+		if !ok {
+			http.Error(w, "Only signed in users can list their games", http.StatusForbidden)
+			return
+		}
+
+		offset, limit, err := pageParams(r, 20, 100)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		games, total, err := db.ListPage(r, uid, offset, limit)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Game list can not be loaded: %s", err), http.StatusInternalServerError)
+			return
+		}
+
+		pageURL := func(offset int) string {
+			return fmt.Sprintf("%s/history?offset=%d&limit=%d", opts.basePath, offset, limit)
+		}
+
+		page, locale := localizedTemplate(templ, r, "history.html")
+		ctx := historyContext{
+			pageContext: newPageContext(r, locale),
+			Games:       newUserGames(games, opts.scoring),
+			Total:       total,
+		}
+		if offset > 0 {
+			newer := offset - limit
+			if newer < 0 {
+				newer = 0
+			}
+			ctx.NewerURL = pageURL(newer)
+		}
+		if offset+len(games) < total {
+			ctx.OlderURL = pageURL(offset + len(games))
+		}
+
+		w.Header().Set("Cache-Control", "private, no-cache")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		render(templ, w, r, page, ctx)
+	})
+}
+
+// userAPIHandler serves the endpoints below /api/user/{uid}/.
+func userAPIHandler(db GameDatabase, opts handlerOptions) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := splitPath(r.URL.Path, "/api/user/")
+		if len(parts) != 2 {
+			http.NotFound(w, r)
+			return
+		}
+
+		uid, action := parts[0], parts[1]
+		switch action {
+		case "export.json":
+			serveUserExport(w, r, db, uid, opts)
+		case "games":
+			serveUserGames(w, r, db, uid, opts)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// displayNameHandler sets the display name of the user of the request. The user ID of
+// the body may be omitted, but it has to be the verified user if it is given.
+func displayNameHandler(names DisplayNameDatabase, opts handlerOptions) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		defer r.Body.Close()
+
+		var req displayName
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, opts.maxBodyBytes)).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Error parsing name: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		uid, ok := opts.userID(r)
+		if !ok {
+			http.Error(w, "Only signed in users can choose a name", http.StatusForbidden)
+			return
+		}
+		if req.UserID != "" && req.UserID != uid {
+			http.Error(w, "Names of other users can not be changed", http.StatusForbidden)
+			return
+		}
+
+		name, err := validateDisplayName(req.Name)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid name: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		if err := names.Set(r, uid, name); err != nil {
+			http.Error(w, fmt.Sprintf("Error saving name: %s", err), http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, r, displayName{UserID: uid, Name: name})
+	})
+}
@@ -0,0 +1,185 @@
+package predictiongame
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestValidateDisplayName(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		expected string
+		valid    bool
+	}{
+		{"Ada Lovelace", "Ada Lovelace", true},
+		{"  Zoë_O'Neil-2.0 ", "Zoë_O'Neil-2.0", true},
+		{"李小龍", "李小龍", true},
+		{"", "", false},
+		{"   ", "", false},
+		{strings.Repeat("a", maxDisplayNameLength+1), "", false},
+		{"<script>alert(1)</script>", "", false},
+		{"Bobby\x00Tables", "", false},
+		{"line\nbreak", "", false},
+		{"right\u202eleft", "", false},
+		{"two  spaces", "", false},
+		{"\xff", "", false},
+	} {
+		name, err := validateDisplayName(tc.name)
+		if (err == nil) != tc.valid || name != tc.expected {
+			t.Errorf("%q: expected %q valid=%v, got %q (%v)", tc.name, tc.expected, tc.valid, name, err)
+		}
+	}
+}
+
+func TestDisplayNameHandler(t *testing.T) {
+	names := profileDisplayNames{users: NewUserDatabase()}
+	handler := displayNameHandler(names, newHandlerOptions(WithSessionSecret(testSessionSecret)))
+
+	for _, tc := range []struct {
+		cookie, body string
+		status       int
+	}{
+		{"user", `{"uid": "user", "name": " Ada "}`, http.StatusOK},
+		{"user", `{"uid": "user", "name": "<img src=x onerror=alert(1)>"}`, http.StatusBadRequest},
+		{"user", `{"uid": "user", "name": "tab\tname"}`, http.StatusBadRequest},
+		{"user", `{"uid": "user", "name": "` + strings.Repeat("x", 2048) + `"}`, http.StatusBadRequest},
+		{"user", `not json`, http.StatusBadRequest},
+		{"", `{"uid": "user", "name": "Eve"}`, http.StatusForbidden},
+		{"other", `{"uid": "user", "name": "Eve"}`, http.StatusForbidden},
+		{"other", `{"name": "Eve"}`, http.StatusOK},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/api/user/name", strings.NewReader(tc.body))
+		if tc.cookie != "" {
+			addIdentity(r, tc.cookie)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != tc.status {
+			t.Errorf("%q %.40s: expected status %d, got %d", tc.cookie, tc.body, tc.status, w.Code)
+		}
+	}
+
+	if name, ok := names.Get(nil, "user"); !ok || name != "Ada" {
+		t.Errorf("Expected name %q, got %q", "Ada", name)
+	}
+	if name, ok := names.Get(nil, "other"); !ok || name != "Eve" {
+		t.Errorf("Expected name %q for the user of the cookie, got %q", "Eve", name)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/user/name", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
+
+func TestUserGamesHandler(t *testing.T) {
+	games := NewMemoryGameDatabase()
+	q := Question{ID: "q", Text: "How many?", BoundLow: 10, BoundHigh: 20}
+	for _, id := range []string{"first", "second", "third"} {
+		if err := games.Save(nil, GameEntity{ID: id, UserID: "user", Answers: []Answer{{Question: q, LowerBound: 15, UpperBound: 30}}}); err != nil {
+			t.Fatalf("Can not save game: %s", err)
+		}
+	}
+	handler := userAPIHandler(games, newHandlerOptions(WithSessionSecret(testSessionSecret)))
+
+	request := func(cookie string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/user/user/games?offset=1&limit=1", nil)
+		if cookie != "" {
+			addIdentity(r, cookie)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	for _, cookie := range []string{"", "other"} {
+		if w := request(cookie); w.Code != http.StatusForbidden {
+			t.Errorf("Cookie %q: expected status %d, got %d", cookie, http.StatusForbidden, w.Code)
+		}
+	}
+
+	w := request("user")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var page userGamesPage
+	if err := json.NewDecoder(w.Body).Decode(&page); err != nil {
+		t.Fatalf("Can not decode games: %s", err)
+	}
+	if page.Total != 3 || page.Offset != 1 || page.Limit != 1 || len(page.Games) != 1 {
+		t.Fatalf("Unexpected page %+v", page)
+	}
+	if g := page.Games[0]; g.ID != "second" || g.Questions != 1 || g.Correct != 1 || g.Time.IsZero() {
+		t.Errorf("Unexpected game %+v", g)
+	}
+}
+
+func TestHistoryHandler(t *testing.T) {
+	templ, err := loadTemplates()
+	if err != nil {
+		t.Fatalf("Can not load templates: %s", err)
+	}
+
+	games := NewMemoryGameDatabase()
+	q := Question{ID: "q", Text: "How many?", BoundLow: 10, BoundHigh: 20}
+	for _, id := range []string{"first", "second", "third"} {
+		if err := games.Save(nil, GameEntity{ID: id, UserID: "user", Answers: []Answer{{Question: q, LowerBound: 15, UpperBound: 30}}}); err != nil {
+			t.Fatalf("Can not save game: %s", err)
+		}
+	}
+	handler := historyHandler(templ, games, newHandlerOptions(WithSessionSecret(testSessionSecret)))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/history", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d without an identity, got %d", http.StatusForbidden, w.Code)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/history?offset=1&limit=1", nil)
+	addIdentity(r, "user")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Expected an HTML page, got %q", ct)
+	}
+
+	body := w.Body.String()
+	for _, expected := range []string{
+		`href="/game/second"`,
+		`href="/history?offset=0&amp;limit=1"`,
+		`href="/history?offset=2&amp;limit=1"`,
+		"1 / 1",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected %q in the page, got %s", expected, body)
+		}
+	}
+	if strings.Contains(body, "/game/first") || strings.Contains(body, "/game/third") {
+		t.Errorf("Expected only the second game, got %s", body)
+	}
+}
+
+func TestSubmitHandlerSetsIdentityCookie(t *testing.T) {
+	handler := NewHandler(nil, SeedDemoQuestions(), NewMemoryGameDatabase(), WithBasePath("/predict"), WithSessionSecret(testSessionSecret))
+
+	body := url.Values{"data": {`{"id": "game", "uid": "user", "answers": []}`}}.Encode()
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/predict/game", strings.NewReader(body)))
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expected status %d, got %d", http.StatusFound, w.Code)
+	}
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != identityCookie || cookies[0].Value != signIdentity(testSessionSecret, "user") || cookies[0].Path != "/predict/" || !cookies[0].HttpOnly {
+		t.Errorf("Unexpected cookies %+v", cookies)
+	}
+}